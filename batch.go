@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"slices"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -670,7 +671,7 @@ func (b *Batch) Get(key []byte) ([]byte, io.Closer, error) {
 	if b.index == nil {
 		return nil, nil, ErrNotIndexed
 	}
-	return b.db.getInternal(key, b, nil /* snapshot */)
+	return b.db.getInternal(key, b, nil /* snapshot */, 0 /* maxMergeOperands */)
 }
 
 func (b *Batch) prepareDeferredKeyValueRecord(keyLen, valueLen int, kind InternalKeyKind) {
@@ -986,6 +987,9 @@ func (b *Batch) SingleDeleteDeferred(keyLen int) *DeferredBatchOp {
 // It is safe to modify the contents of the arguments after DeleteRange
 // returns.
 func (b *Batch) DeleteRange(start, end []byte, _ *WriteOptions) error {
+	if err := b.checkRangeBounds(InternalKeyKindRangeDelete, start, end); err != nil {
+		return err
+	}
 	deferredOp := b.DeleteRangeDeferred(len(start), len(end))
 	copy(deferredOp.Key, start)
 	copy(deferredOp.Value, end)
@@ -1020,6 +1024,54 @@ func (b *Batch) DeleteRangeDeferred(startLen, endLen int) *DeferredBatchOp {
 	return &b.deferredOp
 }
 
+// DeleteRanges deletes all of the point keys (and values) in each of the given
+// ranges [Start,End). Unlike calling DeleteRange for each range, overlapping
+// and adjacent ranges are first coalesced, so the batch contains the minimal
+// number of range deletions covering the union of the ranges. The ranges may
+// be provided in any order. Empty ranges are ignored. Like DeleteRange,
+// DeleteRanges does NOT delete overlapping range keys.
+//
+// It is safe to modify the contents of the arguments after DeleteRanges
+// returns.
+func (b *Batch) DeleteRanges(ranges []KeyRange, o *WriteOptions) error {
+	cmp := base.DefaultComparer.Compare
+	if b.db != nil {
+		cmp = b.db.cmp
+	}
+	sorted := make([]KeyRange, 0, len(ranges))
+	for _, r := range ranges {
+		if cmp(r.Start, r.End) < 0 {
+			sorted = append(sorted, r)
+		}
+	}
+	slices.SortFunc(sorted, func(a, b KeyRange) int {
+		return cmp(a.Start, b.Start)
+	})
+	for i := 0; i < len(sorted); {
+		start, end := sorted[i].Start, sorted[i].End
+		for i++; i < len(sorted) && cmp(sorted[i].Start, end) <= 0; i++ {
+			if cmp(sorted[i].End, end) > 0 {
+				end = sorted[i].End
+			}
+		}
+		if err := b.DeleteRange(start, end, o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRangeBounds returns an error wrapping ErrInvalidBatch if
+// Options.ValidateRangeBounds is set and start isn't less than end.
+func (b *Batch) checkRangeBounds(kind InternalKeyKind, start, end []byte) error {
+	if b.db == nil || !b.db.opts.ValidateRangeBounds || b.db.cmp(start, end) < 0 {
+		return nil
+	}
+	formatKey := b.db.opts.Comparer.FormatKey
+	return errors.Wrapf(ErrInvalidBatch, "%s: start key %s is not less than end key %s",
+		kind, formatKey(start), formatKey(end))
+}
+
 // RangeKeySet sets a range key mapping the key range [start, end) at the MVCC
 // timestamp suffix to value. The suffix is optional. If any portion of the key
 // range [start, end) is already set by a range key with the same suffix value,
@@ -1036,6 +1088,9 @@ func (b *Batch) RangeKeySet(start, end, suffix, value []byte, _ *WriteOptions) e
 			panic("RangeKeySet called with suffixed end key")
 		}
 	}
+	if err := b.checkRangeBounds(InternalKeyKindRangeKeySet, start, end); err != nil {
+		return err
+	}
 	suffixValues := [1]rangekey.SuffixValue{{Suffix: suffix, Value: value}}
 	internalValueLen := rangekey.EncodedSetValueLen(end, suffixValues[:])
 
@@ -1092,6 +1147,9 @@ func (b *Batch) RangeKeyUnset(start, end, suffix []byte, _ *WriteOptions) error
 			panic("RangeKeyUnset called with suffixed end key")
 		}
 	}
+	if err := b.checkRangeBounds(InternalKeyKindRangeKeyUnset, start, end); err != nil {
+		return err
+	}
 	suffixes := [1][]byte{suffix}
 	internalValueLen := rangekey.EncodedUnsetValueLen(end, suffixes[:])
 
@@ -1134,6 +1192,9 @@ func (b *Batch) RangeKeyDelete(start, end []byte, _ *WriteOptions) error {
 			panic("RangeKeyDelete called with suffixed end key")
 		}
 	}
+	if err := b.checkRangeBounds(InternalKeyKindRangeKeyDelete, start, end); err != nil {
+		return err
+	}
 	deferredOp := b.RangeKeyDeleteDeferred(len(start), len(end))
 	copy(deferredOp.Key, start)
 	copy(deferredOp.Value, end)
@@ -1158,6 +1219,22 @@ func (b *Batch) RangeKeyDeleteDeferred(startLen, endLen int) *DeferredBatchOp {
 	return &b.deferredOp
 }
 
+// DeleteRangeAndRangeKeys deletes all of the point keys and all of the range
+// keys in the range [start,end) (inclusive on start, exclusive on end). It is
+// a convenience for wiping a span entirely, equivalent to calling both
+// DeleteRange and RangeKeyDelete: the batch contains a range deletion and a
+// range key deletion over the span, which are committed atomically with the
+// rest of the batch.
+//
+// It is safe to modify the contents of the arguments after
+// DeleteRangeAndRangeKeys returns.
+func (b *Batch) DeleteRangeAndRangeKeys(start, end []byte, o *WriteOptions) error {
+	if err := b.DeleteRange(start, end, o); err != nil {
+		return err
+	}
+	return b.RangeKeyDelete(start, end, o)
+}
+
 // LogData adds the specified to the batch. The data will be written to the
 // WAL, but not added to memtables or sstables. Log data is never indexed,
 // which makes it useful for testing WAL performance.
@@ -1634,6 +1711,87 @@ func (b *Batch) Reader() batchrepr.Reader {
 	return batchrepr.Read(b.data)
 }
 
+// writtenKeySizes returns the sizes of the key and value of a batch record, as
+// reported by Metrics.Keys.MaxKeySize and MaxValueSize. The key size is that of
+// the larger of the start and end keys of range deletions and range keys, and
+// only point keys with values have a value size.
+func writtenKeySizes(kind InternalKeyKind, ukey, value []byte) (keySize, valueSize uint64) {
+	keySize = uint64(len(ukey))
+	switch kind {
+	case InternalKeyKindSet, InternalKeyKindSetWithDelete, InternalKeyKindMerge:
+		valueSize = uint64(len(value))
+	case InternalKeyKindRangeDelete:
+		keySize = max(keySize, uint64(len(value)))
+	case InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete:
+		if end, _, err := rangekey.DecodeEndKey(kind, value); err == nil {
+			keySize = max(keySize, uint64(len(end)))
+		}
+	}
+	return keySize, valueSize
+}
+
+// Validate checks the invariants of the batch's records without applying
+// them, returning an error wrapping ErrInvalidBatch that identifies the index
+// and kind of the first offending record. It verifies that:
+//
+//   - every record decodes and is of a kind permitted in a batch;
+//   - no record's key or value exceeds the maximum batch size;
+//   - the start key of every range deletion and range key is less than its end
+//     key; and
+//   - the bounds of every range key are prefixes, i.e. have no suffix.
+//
+// Keys are compared using the Comparer of the DB that created the batch, or
+// DefaultComparer if the batch wasn't created by a DB. Validate is intended to
+// catch application bugs before a batch is committed; it's not called by
+// commit.
+func (b *Batch) Validate() error {
+	comparer := DefaultComparer
+	if b.db != nil {
+		comparer = b.db.opts.Comparer
+	}
+	cmp, split, formatKey := comparer.Compare, comparer.Split, comparer.FormatKey
+
+	for i, r := 0, batchrepr.Read(b.data); len(r) > 0; i++ {
+		kind, key, value, ok, err := r.Next()
+		if !ok {
+			if err != nil {
+				return errors.Wrapf(err, "record %d", i)
+			}
+			break
+		}
+		invalid := func(format string, args ...interface{}) error {
+			args = append([]interface{}{i, kind}, args...)
+			return errors.Wrapf(ErrInvalidBatch, "record %d (%s): "+format, args...)
+		}
+		if uint64(len(key)) >= maxBatchSize || uint64(len(value)) >= maxBatchSize {
+			return invalid("entry too large: key %d bytes, value %d bytes", len(key), len(value))
+		}
+		switch kind {
+		case InternalKeyKindSet, InternalKeyKindDelete, InternalKeyKindMerge,
+			InternalKeyKindSingleDelete, InternalKeyKindSetWithDelete, InternalKeyKindDeleteSized,
+			InternalKeyKindLogData, InternalKeyKindIngestSST:
+		case InternalKeyKindRangeDelete:
+			if cmp(key, value) >= 0 {
+				return invalid("start key %s is not less than end key %s", formatKey(key), formatKey(value))
+			}
+		case InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete:
+			end, _, err := rangekey.DecodeEndKey(kind, value)
+			if err != nil {
+				return invalid("%v", err)
+			}
+			if cmp(key, end) >= 0 {
+				return invalid("start key %s is not less than end key %s", formatKey(key), formatKey(end))
+			}
+			if split(key) != len(key) || split(end) != len(end) {
+				return invalid("bounds %s-%s are suffixed", formatKey(key), formatKey(end))
+			}
+		default:
+			return invalid("unrecognized kind")
+		}
+	}
+	return nil
+}
+
 // SyncWait is to be used in conjunction with DB.ApplyNoSyncWait.
 func (b *Batch) SyncWait() error {
 	now := time.Now()
@@ -1085,6 +1085,75 @@ func TestBatchRangeOps(t *testing.T) {
 	})
 }
 
+func TestBatchValidate(t *testing.T) {
+	var b Batch
+	require.NoError(t, b.Validate())
+	require.NoError(t, b.Set([]byte("b"), []byte("1"), nil))
+	require.NoError(t, b.Set([]byte("a"), []byte("2"), nil))
+	require.NoError(t, b.DeleteRange([]byte("a"), []byte("c"), nil))
+	require.NoError(t, b.RangeKeySet([]byte("a"), []byte("c"), nil, []byte("3"), nil))
+	require.NoError(t, b.LogData([]byte("data"), nil))
+	require.NoError(t, b.Validate())
+
+	validate := func(b *Batch) string {
+		err := b.Validate()
+		require.True(t, errors.Is(err, ErrInvalidBatch))
+		return err.Error()
+	}
+
+	var inverted Batch
+	require.NoError(t, inverted.SetRepr(append([]byte(nil), b.Repr()...)))
+	require.NoError(t, inverted.DeleteRange([]byte("c"), []byte("c"), nil))
+	require.Equal(t, "record 5 (RANGEDEL): start key c is not less than end key c: pebble: invalid batch",
+		validate(&inverted))
+
+	var rangeKeys Batch
+	require.NoError(t, rangeKeys.RangeKeyDelete([]byte("a"), []byte("b"), nil))
+	require.NoError(t, rangeKeys.RangeKeyUnset([]byte("d"), []byte("c"), nil, nil))
+	require.Equal(t, "record 1 (RANGEKEYUNSET): start key d is not less than end key c: pebble: invalid batch",
+		validate(&rangeKeys))
+
+	var truncated Batch
+	require.NoError(t, truncated.SetRepr(b.Repr()[:len(b.Repr())-1]))
+	require.Contains(t, validate(&truncated), "record 4")
+}
+
+func TestBatchValidateRangeBounds(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                  vfs.NewMem(),
+		Comparer:            testkeys.Comparer,
+		FormatMajorVersion:  FormatNewest,
+		ValidateRangeBounds: true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	b := d.NewBatch()
+	defer b.Close()
+	require.NoError(t, b.DeleteRange([]byte("a"), []byte("b"), nil))
+	require.NoError(t, b.RangeKeySet([]byte("a"), []byte("b"), nil, nil, nil))
+	for _, err := range []error{
+		b.DeleteRange([]byte("b"), []byte("b"), nil),
+		b.DeleteRange([]byte("c"), []byte("b"), nil),
+		b.RangeKeySet([]byte("c"), []byte("b"), nil, nil, nil),
+		b.RangeKeyUnset([]byte("c"), []byte("b"), nil, nil),
+		b.RangeKeyDelete([]byte("c"), []byte("b"), nil),
+		b.DeleteRangeAndRangeKeys([]byte("c"), []byte("b"), nil),
+		d.DeleteRange([]byte("c"), []byte("b"), nil),
+		d.RangeKeyDelete([]byte("c"), []byte("b"), nil),
+	} {
+		require.True(t, errors.Is(err, ErrInvalidBatch))
+	}
+	require.Equal(t, uint32(2), b.Count())
+	require.EqualError(t, b.RangeKeyUnset([]byte("c"), []byte("b"), nil, nil),
+		"RANGEKEYUNSET: start key c is not less than end key b: pebble: invalid batch")
+	require.NoError(t, b.Commit(nil))
+
+	// Batches not created by a DB aren't validated.
+	var unvalidated Batch
+	require.NoError(t, unvalidated.DeleteRange([]byte("b"), []byte("a"), nil))
+}
+
 func TestBatchTooLarge(t *testing.T) {
 	var b Batch
 	var result interface{}
@@ -1739,3 +1808,99 @@ func TestBatchOption(t *testing.T) {
 		require.Equal(t, tc.expected, b)
 	}
 }
+
+func TestBatchDeleteRangeAndRangeKeys(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                 vfs.NewMem(),
+		Comparer:           testkeys.Comparer,
+		FormatMajorVersion: FormatNewest,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	for _, k := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, d.Set([]byte(k), []byte(k), nil))
+	}
+	require.NoError(t, d.RangeKeySet([]byte("a"), []byte("e"), []byte("@5"), []byte("v"), nil))
+	require.NoError(t, d.Flush())
+
+	scan := func(r Reader) string {
+		iter, err := r.NewIter(&IterOptions{KeyTypes: IterKeyTypePointsAndRanges})
+		require.NoError(t, err)
+		defer func() { require.NoError(t, iter.Close()) }()
+		var buf strings.Builder
+		for valid := iter.First(); valid; valid = iter.Next() {
+			hasPoint, hasRange := iter.HasPointAndRange()
+			if hasPoint {
+				fmt.Fprintf(&buf, "%s ", iter.Key())
+			}
+			if hasRange && iter.RangeKeyChanged() {
+				start, end := iter.RangeBounds()
+				fmt.Fprintf(&buf, "[%s-%s) ", start, end)
+			}
+		}
+		return strings.TrimSpace(buf.String())
+	}
+	const expected = "a [a-b) d [d-e)"
+
+	b := d.NewIndexedBatch()
+	require.NoError(t, b.DeleteRangeAndRangeKeys([]byte("b"), []byte("d"), nil))
+	require.Equal(t, expected, scan(b))
+	require.NoError(t, b.Commit(nil))
+	require.Equal(t, expected, scan(d))
+
+	// The deletions continue to apply after flushing and compacting.
+	require.NoError(t, d.Flush())
+	require.Equal(t, expected, scan(d))
+	require.NoError(t, d.Compact([]byte("a"), []byte("e"), false /* parallelize */))
+	require.Equal(t, expected, scan(d))
+	require.NoError(t, d.CheckLevels(nil))
+
+	require.NoError(t, d.DeleteRangeAndRangeKeys([]byte("a"), []byte("z"), nil))
+	require.Equal(t, "", scan(d))
+}
+
+func TestBatchDeleteRanges(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	for _, k := range []string{"a", "c", "e", "g", "i", "k", "m"} {
+		require.NoError(t, d.Set([]byte(k), []byte(k), nil))
+	}
+
+	b := d.NewBatch()
+	require.NoError(t, b.DeleteRanges([]KeyRange{
+		{Start: []byte("j"), End: []byte("l")},
+		{Start: []byte("b"), End: []byte("d")},
+		{Start: []byte("f"), End: []byte("h")},
+		{Start: []byte("d"), End: []byte("e")},
+		{Start: []byte("c"), End: []byte("d")},
+		{Start: []byte("n"), End: []byte("n")},
+		{Start: []byte("g"), End: []byte("g2")},
+	}, nil))
+
+	// The overlapping and adjacent ranges are coalesced, and the empty range is
+	// dropped.
+	var tombstones []string
+	for r := b.Reader(); ; {
+		kind, start, end, ok, err := r.Next()
+		require.NoError(t, err)
+		if !ok {
+			break
+		}
+		require.Equal(t, InternalKeyKindRangeDelete, kind)
+		tombstones = append(tombstones, fmt.Sprintf("[%s-%s)", start, end))
+	}
+	require.Equal(t, []string{"[b-e)", "[f-h)", "[j-l)"}, tombstones)
+
+	require.NoError(t, b.Commit(nil))
+	iter, err := d.NewIter(nil)
+	require.NoError(t, err)
+	var keys []string
+	for valid := iter.First(); valid; valid = iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, []string{"a", "e", "i", "m"}, keys)
+}
@@ -21,3 +21,22 @@ type Cache = cache.Cache
 func NewCache(size int64) *cache.Cache {
 	return cache.New(size)
 }
+
+// CacheOptions holds the optional parameters for NewCacheWithOptions.
+type CacheOptions struct {
+	// Shards is the number of shards the cache is split into. Each shard has
+	// its own lock and is given an equal fraction of the cache's capacity.
+	// Increasing the number of shards reduces lock contention when the cache is
+	// accessed from many goroutines concurrently; decreasing it allows each
+	// shard to hold more of a frequently accessed sstable.
+	//
+	// The default value is 0, which selects 4 shards per GOMAXPROCS, or 4
+	// shards if that would produce shards smaller than 4 MiB.
+	Shards int
+}
+
+// NewCacheWithOptions creates a new cache of the specified size, like
+// NewCache, configured with the specified options.
+func NewCacheWithOptions(size int64, opts CacheOptions) *cache.Cache {
+	return cache.NewWithShards(size, opts.Shards)
+}
@@ -26,6 +26,9 @@ type checkpointOptions struct {
 
 	// If set, any SSTs that don't overlap with these spans are excluded from a checkpoint.
 	restrictToSpans []CheckpointSpan
+
+	// maxLevel is the deepest level whose SSTs are included in a checkpoint.
+	maxLevel int
 }
 
 // CheckpointOption set optional parameters used by `DB.Checkpoint`.
@@ -59,6 +62,21 @@ func WithRestrictToSpans(spans []CheckpointSpan) CheckpointOption {
 	}
 }
 
+// WithMaxLevel restricts the checkpoint to the SSTs in levels L0 through
+// maxLevel; any SSTs in deeper levels are excluded from the checkpoint, as if
+// they had been deleted. The WAL is included as usual.
+//
+// The resulting checkpoint opens as a consistent DB, but it only contains the
+// history recorded in the included levels. Keys whose most recent version is
+// in an excluded level are missing from the checkpoint, and deletions in the
+// included levels no longer shadow anything beneath them. This is useful for
+// cheaply backing up recent writes.
+func WithMaxLevel(maxLevel int) CheckpointOption {
+	return func(opt *checkpointOptions) {
+		opt.maxLevel = maxLevel
+	}
+}
+
 // CheckpointSpan is a key range [Start, End) (inclusive on Start, exclusive on
 // End) of interest for a checkpoint.
 type CheckpointSpan struct {
@@ -66,10 +84,13 @@ type CheckpointSpan struct {
 	End   []byte
 }
 
-// excludeFromCheckpoint returns true if an SST file should be excluded from the
-// checkpoint because it does not overlap with the spans of interest
-// (opt.restrictToSpans).
-func excludeFromCheckpoint(f *fileMetadata, opt *checkpointOptions, cmp Compare) bool {
+// excludeFromCheckpoint returns true if an SST file in the given level should
+// be excluded from the checkpoint because it is deeper than opt.maxLevel or
+// does not overlap with the spans of interest (opt.restrictToSpans).
+func excludeFromCheckpoint(f *fileMetadata, level int, opt *checkpointOptions, cmp Compare) bool {
+	if level > opt.maxLevel {
+		return true
+	}
 	if len(opt.restrictToSpans) == 0 {
 		// Option not set; don't exclude anything.
 		return false
@@ -148,10 +169,16 @@ func (d *DB) Checkpoint(
 ) (
 	ckErr error, /* used in deferred cleanup */
 ) {
-	opt := &checkpointOptions{}
+	if d.opts.ReadOnlyStore != nil {
+		return errors.New("pebble: checkpoints are not supported with a read-only store")
+	}
+	opt := &checkpointOptions{maxLevel: numLevels - 1}
 	for _, fn := range opts {
 		fn(opt)
 	}
+	if opt.maxLevel < 0 || opt.maxLevel >= numLevels {
+		return errors.Errorf("pebble: checkpoint max level %d is not within [0, %d]", opt.maxLevel, numLevels-1)
+	}
 
 	if _, err := d.opts.FS.Stat(destDir); !oserror.IsNotExist(err) {
 		if err == nil {
@@ -278,11 +305,20 @@ func (d *DB) Checkpoint(
 	// Set of FileBacking.DiskFileNum which will be required by virtual sstables
 	// in the checkpoint.
 	requiredVirtualBackingFiles := make(map[base.DiskFileNum]struct{})
+	// The subdirectories of the checkpoint that sstables are placed in by
+	// Options.SSTablePathFunc, which are synced along with the checkpoint
+	// directory.
+	subdirs := make(map[string]vfs.File)
+	defer func() {
+		for _, subdir := range subdirs {
+			_ = subdir.Close()
+		}
+	}()
 	// Link or copy the sstables.
 	for l := range current.Levels {
 		iter := current.Levels[l].Iter()
 		for f := iter.First(); f != nil; f = iter.Next() {
-			if excludeFromCheckpoint(f, opt, d.cmp) {
+			if excludeFromCheckpoint(f, l, opt, d.cmp) {
 				if excludedFiles == nil {
 					excludedFiles = make(map[deletedFileEntry]*fileMetadata)
 				}
@@ -316,8 +352,20 @@ func (d *DB) Checkpoint(
 				continue
 			}
 
-			srcPath := base.MakeFilepath(fs, d.dirname, fileTypeTable, fileBacking.DiskFileNum)
+			srcPath := d.objProvider.Path(meta)
 			destPath := fs.PathJoin(destDir, fs.PathBase(srcPath))
+			if f := d.opts.SSTablePathFunc; f != nil {
+				rel := f(base.FileNum(fileBacking.DiskFileNum))
+				destPath = fs.PathJoin(destDir, rel)
+				if subdir := fs.PathDir(destPath); fs.PathDir(rel) != "." && subdirs[subdir] == nil {
+					var subdirFile vfs.File
+					subdirFile, ckErr = mkdirAllAndSyncParents(fs, subdir)
+					if ckErr != nil {
+						return ckErr
+					}
+					subdirs[subdir] = subdirFile
+				}
+			}
 			ckErr = vfs.LinkOrCopy(fs, srcPath, destPath)
 			if ckErr != nil {
 				return ckErr
@@ -366,16 +414,57 @@ func (d *DB) Checkpoint(
 		}
 	}
 
-	// Sync and close the checkpoint directory.
+	// Sync the subdirectories and the checkpoint directory, and close the
+	// latter.
+	for _, subdir := range subdirs {
+		if ckErr = subdir.Sync(); ckErr != nil {
+			return ckErr
+		}
+	}
 	ckErr = dir.Sync()
 	if ckErr != nil {
 		return ckErr
 	}
 	ckErr = dir.Close()
 	dir = nil
+	if ckErr != nil {
+		return ckErr
+	}
+
+	if opt.maxLevel < numLevels-1 {
+		// The checkpoint's MANIFEST was edited to exclude the deeper levels, so
+		// check that it opens without dangling references, and that its LSM is
+		// consistent.
+		ckErr = checkCheckpoint(destDir, d.opts)
+	}
 	return ckErr
 }
 
+// openCheckpoint opens the checkpoint in dirname read-only, with the options
+// of the DB it was taken from.
+func openCheckpoint(dirname string, opts *Options) (*DB, error) {
+	o := opts.Clone()
+	o.ReadOnly = true
+	o.ErrorIfExists = false
+	o.ErrorIfNotPristine = false
+	// The checkpoint holds copies of the WALs of the DB.
+	o.WALDir = ""
+	o.WALFailover = nil
+	o.EventListener = nil
+	return Open(dirname, o)
+}
+
+// checkCheckpoint opens the checkpoint in dirname read-only and runs
+// CheckLevels on it.
+func checkCheckpoint(dirname string, opts *Options) error {
+	d, err := openCheckpoint(dirname, opts)
+	if err != nil {
+		return errors.Wrapf(err, "pebble: opening checkpoint %q", dirname)
+	}
+	err = d.CheckLevels(nil /* stats */)
+	return firstError(errors.Wrapf(err, "pebble: checking checkpoint %q", dirname), d.Close())
+}
+
 func (d *DB) writeCheckpointManifest(
 	fs vfs.FS,
 	formatVers FormatMajorVersion,
@@ -466,3 +555,62 @@ func (d *DB) writeCheckpointManifest(
 	}
 	return manifestMarker.Close()
 }
+
+// VerifyCheckpoint verifies that the checkpoint in checkpointDir, created by
+// DB.Checkpoint without any restrictions to spans or levels, is a faithful
+// copy of the DB in srcDir. It opens both read-only with the given options, so
+// neither may be open, and the source DB must not have flushed or compacted
+// since the checkpoint was taken.
+//
+// The checkpoint's version must reference the same sstables as the source's,
+// as determined by their VersionFingerprints, and each of its sstables must
+// have the size recorded in its manifest when the checkpoint was taken.
+// Finally, the checkpoint must pass CheckLevels, which reads all of its
+// sstables, verifying their checksums and the LSM's invariants. This detects
+// checkpoints whose sstables were corrupted or truncated after the checkpoint
+// was taken, including hard-linked sstables that were modified through the
+// source, which the source can't be compared against.
+func VerifyCheckpoint(srcDir, checkpointDir string, opts *Options) error {
+	o := opts.Clone()
+	o.ReadOnly = true
+	src, err := Open(srcDir, o)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	ckpt, err := openCheckpoint(checkpointDir, opts)
+	if err != nil {
+		return err
+	}
+	defer ckpt.Close()
+
+	if src.VersionFingerprint() != ckpt.VersionFingerprint() {
+		return errors.Errorf("pebble: checkpoint %q does not contain the sstables of %q", checkpointDir, srcDir)
+	}
+	readState := ckpt.loadReadState()
+	defer readState.unref()
+	checked := make(map[base.DiskFileNum]struct{})
+	for _, level := range readState.current.Levels {
+		iter := level.Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			backing := f.FileBacking
+			if _, ok := checked[backing.DiskFileNum]; ok {
+				continue
+			}
+			checked[backing.DiskFileNum] = struct{}{}
+			meta, err := ckpt.objProvider.Lookup(fileTypeTable, backing.DiskFileNum)
+			if err != nil {
+				return err
+			}
+			size, err := ckpt.objProvider.Size(meta)
+			if err != nil {
+				return err
+			}
+			if uint64(size) != backing.Size {
+				return errors.Errorf("pebble: checkpoint sstable %s has size %d, expected %d",
+					backing.DiskFileNum, size, backing.Size)
+			}
+		}
+	}
+	return ckpt.CheckLevels(nil)
+}
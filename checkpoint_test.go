@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"math/rand"
 	"runtime"
 	"sort"
@@ -16,9 +17,11 @@ import (
 	"testing"
 
 	"github.com/cockroachdb/datadriven"
+	"github.com/cockroachdb/errors/oserror"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/objstorage/remote"
 	"github.com/cockroachdb/pebble/vfs"
+	"github.com/cockroachdb/pebble/vfs/errorfs"
 	"github.com/stretchr/testify/require"
 )
 
@@ -437,3 +440,161 @@ func TestCheckpointManyFiles(t *testing.T) {
 		require.Equal(t, 10, n)
 	}
 }
+
+func TestCheckpointMaxLevel(t *testing.T) {
+	fs := vfs.NewMem()
+	opts := &Options{
+		FS:                          fs,
+		FormatMajorVersion:          internalFormatNewest,
+		DisableAutomaticCompactions: true,
+		Logger:                      testLogger{t},
+	}
+	d, err := Open("db", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Write old history to L6, and recent writes to L0 and the WAL.
+	require.NoError(t, d.Set([]byte("a"), []byte("old"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("old"), nil))
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+	require.NoError(t, d.Set([]byte("b"), []byte("new"), nil))
+	require.NoError(t, d.Set([]byte("c"), []byte("new"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("d"), []byte("unflushed"), nil))
+
+	require.Error(t, d.Checkpoint("checkpoint-invalid", WithMaxLevel(numLevels)))
+	require.NoError(t, d.Checkpoint("checkpoint", WithMaxLevel(2)))
+
+	// The checkpoint opens without any references to the excluded sstables,
+	// and contains only the recent writes.
+	c, err := Open("checkpoint", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, c.Close()) }()
+	tables, err := c.SSTables()
+	require.NoError(t, err)
+	for level := 3; level < numLevels; level++ {
+		require.Empty(t, tables[level])
+	}
+	var stats CheckLevelsStats
+	require.NoError(t, c.CheckLevels(&stats))
+
+	iter, err := c.NewIter(nil)
+	require.NoError(t, err)
+	var kvs []string
+	for valid := iter.First(); valid; valid = iter.Next() {
+		kvs = append(kvs, fmt.Sprintf("%s:%s", iter.Key(), iter.Value()))
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, []string{"b:new", "c:new", "d:unflushed"}, kvs)
+}
+
+func TestCheckpointMaxLevelCheck(t *testing.T) {
+	// Reads of the checkpoint's sstables fail, as if they were corrupt.
+	fs := errorfs.Wrap(vfs.NewMem(), errorfs.InjectorFunc(func(op errorfs.Op) error {
+		if op.Kind == errorfs.OpFileReadAt && strings.HasPrefix(op.Path, "checkpoint/") &&
+			strings.HasSuffix(op.Path, ".sst") {
+			return errorfs.ErrInjected
+		}
+		return nil
+	}))
+	d, err := Open("db", &Options{FS: fs, Logger: testLogger{t}})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	require.NoError(t, d.Set([]byte("a"), []byte("v"), nil))
+	require.NoError(t, d.Flush())
+
+	// The checkpoint is checked before it's reported as complete, and removed
+	// when the check fails.
+	err = d.Checkpoint("checkpoint", WithMaxLevel(2))
+	require.ErrorIs(t, err, errorfs.ErrInjected)
+	_, err = fs.Stat("checkpoint")
+	require.True(t, oserror.IsNotExist(err))
+}
+
+func TestVerifyCheckpoint(t *testing.T) {
+	fs := vfs.NewMem()
+	opts := &Options{FS: fs, DisableAutomaticCompactions: true, Logger: testLogger{t}}
+	d, err := Open("db", opts)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprint(i)), nil))
+		if i%25 == 0 {
+			require.NoError(t, d.Flush())
+		}
+	}
+	require.NoError(t, d.Flush())
+	for _, dir := range []string{"faithful", "truncated", "corrupted", "corrupted-source"} {
+		require.NoError(t, d.Checkpoint(dir))
+	}
+	require.NoError(t, d.Close())
+
+	require.NoError(t, VerifyCheckpoint("db", "faithful", opts))
+
+	// firstTable returns the path of the first sstable in dir.
+	firstTable := func(dir string) string {
+		ls, err := fs.List(dir)
+		require.NoError(t, err)
+		sort.Strings(ls)
+		for _, name := range ls {
+			if strings.HasSuffix(name, ".sst") {
+				return fs.PathJoin(dir, name)
+			}
+		}
+		t.Fatalf("no sstables in %s", dir)
+		return ""
+	}
+	// rewriteTable replaces an sstable of the checkpoint with a modified copy,
+	// leaving the source's sstable intact.
+	rewriteTable := func(dir string, modify func([]byte) []byte) {
+		path := firstTable(dir)
+		f, err := fs.Open(path)
+		require.NoError(t, err)
+		data, err := io.ReadAll(f)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		require.NoError(t, fs.Remove(path))
+		f, err = fs.Create(path, vfs.WriteCategoryUnspecified)
+		require.NoError(t, err)
+		_, err = f.Write(modify(data))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+	rewriteTable("truncated", func(data []byte) []byte { return data[:len(data)/2] })
+	err = VerifyCheckpoint("db", "truncated", opts)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "size")
+	rewriteTable("corrupted", func(data []byte) []byte {
+		data[len(data)/2] ^= 0xff
+		return data
+	})
+	err = VerifyCheckpoint("db", "corrupted", opts)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "checksum mismatch")
+
+	// Corrupting a hard-linked sstable through the source corrupts the
+	// checkpoint's sstable too.
+	f, err := fs.OpenReadWrite(firstTable("corrupted-source"), vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	stat, err := f.Stat()
+	require.NoError(t, err)
+	b := make([]byte, 1)
+	_, err = f.ReadAt(b, stat.Size()/2)
+	require.NoError(t, err)
+	b[0] ^= 0xff
+	_, err = f.WriteAt(b, stat.Size()/2)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	err = VerifyCheckpoint("db", "corrupted-source", opts)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "checksum mismatch")
+
+	// A checkpoint no longer matches once the source's LSM changes.
+	d, err = Open("db", opts)
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("new"), nil, nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Close())
+	err = VerifyCheckpoint("db", "faithful", opts)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "does not contain the sstables")
+}
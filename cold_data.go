@@ -0,0 +1,123 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/cockroachdb/pebble/objstorage"
+)
+
+// coldDataEnv holds the state used to identify cold files and the files
+// already demoted to shared storage. See Options.ColdDataThreshold.
+type coldDataEnv struct {
+	now         time.Time
+	openedAt    time.Time
+	objProvider objstorage.Provider
+	// candidates are the cold files stored locally found by the last call to
+	// checkColdData, largest first.
+	candidates []coldDataCandidate
+}
+
+// coldDataCandidate is a cold file stored locally, which a cold data
+// compaction may demote to shared storage.
+type coldDataCandidate struct {
+	level int
+	file  *fileMetadata
+}
+
+// coldDataEnv returns the coldDataEnv for the current time. DB.mu must be
+// held.
+func (d *DB) coldDataEnv() coldDataEnv {
+	return coldDataEnv{
+		now:         d.timeNow(),
+		openedAt:    d.openedAt,
+		objProvider: d.objProvider,
+		candidates:  d.mu.coldData.candidates,
+	}
+}
+
+// isCold returns true if the file has been read fewer than
+// opts.ColdDataThreshold times per opts.ColdDataPeriod, on average, since it
+// was created or the DB was opened, and has existed for at least one period.
+func (e coldDataEnv) isCold(opts *Options, f *fileMetadata) bool {
+	since := time.Unix(f.CreationTime, 0)
+	if since.Before(e.openedAt) {
+		since = e.openedAt
+	}
+	age := e.now.Sub(since)
+	if age < opts.ColdDataPeriod {
+		return false
+	}
+	periods := float64(age) / float64(opts.ColdDataPeriod)
+	return float64(f.Reads.Load()) < opts.ColdDataThreshold*periods
+}
+
+// isRemote returns true if the file's backing object is stored remotely.
+func (e coldDataEnv) isRemote(f *fileMetadata) bool {
+	meta, err := e.objProvider.Lookup(fileTypeTable, f.FileBacking.DiskFileNum)
+	// Files whose objects can't be found aren't eligible for demotion.
+	return err != nil || meta.IsRemote()
+}
+
+// checkColdData scans the current version for cold files, caching the ones
+// stored locally as the candidates of cold data compactions and the total size
+// of all of them for Metrics.ColdDataBytes, and schedules a cold data
+// compaction. The scan, which looks up the backing object of every cold file,
+// runs without DB.mu held, and only once per Options.ColdDataPeriod rather
+// than whenever a compaction is picked.
+func (d *DB) checkColdData() {
+	rs := d.loadReadState()
+	defer rs.unref()
+	d.mu.Lock()
+	env := d.coldDataEnv()
+	d.mu.Unlock()
+
+	var candidates []coldDataCandidate
+	var size uint64
+	for l := 0; l < numLevels; l++ {
+		iter := rs.current.Levels[l].Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			if !env.isCold(d.opts, f) {
+				continue
+			}
+			size += f.Size
+			if !env.isRemote(f) {
+				candidates = append(candidates, coldDataCandidate{level: l, file: f})
+			}
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b coldDataCandidate) int {
+		return cmp.Compare(b.file.Size, a.file.Size)
+	})
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mu.coldData.candidates = candidates
+	d.mu.coldData.size = size
+	// NB: The check may run concurrently with a call to Close. If a Close call
+	// beat us to acquiring d.mu, maybeScheduleCompactionPicker observes
+	// d.closed and returns.
+	d.maybeScheduleCompactionPicker(pickColdData)
+}
+
+// checkColdDataPeriodically calls checkColdData once per
+// Options.ColdDataPeriod, since files become cold with the passage of time
+// rather than in response to an event that schedules compactions. It returns
+// when the DB is closed.
+func (d *DB) checkColdDataPeriodically() {
+	ticker := time.NewTicker(d.opts.ColdDataPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.closedCh:
+			return
+		case <-ticker.C:
+			d.checkColdData()
+		}
+	}
+}
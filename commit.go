@@ -10,7 +10,9 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/batchrepr"
+	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/record"
 )
 
@@ -130,6 +132,9 @@ type commitEnv struct {
 	// The visible sequence number at which reads should be performed. Ratcheted
 	// upwards atomically as batches are applied to the memtable.
 	visibleSeqNum *atomic.Uint64
+	// The allocator reserving the sequence numbers of batches, in place of
+	// logSeqNum, which is then advanced past each reservation. Optional.
+	seqNumAllocator SeqNumAllocator
 
 	// Apply the batch to the specified memtable. Called concurrently.
 	apply func(b *Batch, mem *memTable) error
@@ -139,6 +144,11 @@ type commitEnv struct {
 	// the memtable the batch should be applied to. Serial execution enforced by
 	// commitPipeline.mu.
 	write func(b *Batch, wg *sync.WaitGroup, err *error) (*memTable, error)
+	// Observe the batch after it has been assigned a sequence number and
+	// written to the WAL, but before it is applied or published. Optional.
+	// Serial execution in sequence number order is enforced by
+	// commitPipeline.mu.
+	observe func(b *Batch, firstSeqNum uint64)
 }
 
 // A commitPipeline manages the stages of committing a set of mutations
@@ -244,6 +254,12 @@ type commitPipeline struct {
 	commitQueueSem chan struct{}
 	logSyncQSem    chan struct{}
 	ingestSem      chan struct{}
+	// syncedSeqNum is one greater than the largest sequence number known to
+	// have been synced to the WAL. Batches are written to the WAL in sequence
+	// number order, so the completion of a synced batch implies that every
+	// batch with a smaller sequence number has been synced too, whether or not
+	// those batches requested a sync.
+	syncedSeqNum atomic.Uint64
 	// The mutex to use for synchronizing access to logSeqNum and serializing
 	// calls to commitEnv.write().
 	mu sync.Mutex
@@ -347,21 +363,43 @@ func (p *commitPipeline) Commit(b *Batch, syncWAL bool, noSyncWait bool) error {
 	// b.commitErr. We will read b.commitErr in Batch.SyncWait after the
 	// LogWriter is done writing.
 
+	if syncWAL && !noSyncWait && err == nil {
+		p.ratchetSyncedSeqNum(b.SeqNum() + uint64(b.Count()))
+	}
+
 	b.commitStats.TotalDuration = time.Since(commitStartTime)
 
 	return err
 }
 
+// ratchetSyncedSeqNum records that every batch with a sequence number less
+// than seqNum has been synced to the WAL.
+func (p *commitPipeline) ratchetSyncedSeqNum(seqNum uint64) {
+	for {
+		cur := p.syncedSeqNum.Load()
+		if seqNum <= cur || p.syncedSeqNum.CompareAndSwap(cur, seqNum) {
+			return
+		}
+	}
+}
+
+// synced returns true if the batch with the given sequence number and count
+// is known to have been synced to the WAL.
+func (p *commitPipeline) synced(seqNum uint64, count uint32) bool {
+	return seqNum+uint64(count) <= p.syncedSeqNum.Load()
+}
+
 // AllocateSeqNum allocates count sequence numbers, invokes the prepare
 // callback, then the apply callback, and then publishes the sequence
 // numbers. AllocateSeqNum does not write to the WAL or add entries to the
 // memtable. AllocateSeqNum can be used to sequence an operation such as
 // sstable ingestion within the commit pipeline. The prepare callback is
 // invoked with commitPipeline.mu held, but note that DB.mu is not held and
-// must be locked if necessary.
+// must be locked if necessary. If the sequence numbers can't be allocated,
+// neither callback is invoked and the error is returned.
 func (p *commitPipeline) AllocateSeqNum(
 	count int, prepare func(seqNum uint64), apply func(seqNum uint64),
-) {
+) error {
 	// This method is similar to Commit and prepare. Be careful about trying to
 	// share additional code with those methods because Commit and prepare are
 	// performance critical code paths.
@@ -379,16 +417,20 @@ func (p *commitPipeline) AllocateSeqNum(
 
 	p.mu.Lock()
 
+	// Assign the batch a sequence number.
+	logSeqNum := p.env.logSeqNum.Load()
+	seqNum, err := p.allocateSeqNum(uint64(count))
+	if err != nil {
+		p.mu.Unlock()
+		<-p.commitQueueSem
+		return err
+	}
+
 	// Enqueue the batch in the pending queue. Note that while the pending queue
 	// is lock-free, we want the order of batches to be the same as the sequence
 	// number order.
 	p.pending.enqueue(b)
 
-	// Assign the batch a sequence number. Note that we use atomic operations
-	// here to handle concurrent reads of logSeqNum. commitPipeline.mu provides
-	// mutual exclusion for other goroutines writing to logSeqNum.
-	logSeqNum := p.env.logSeqNum.Add(uint64(count)) - uint64(count)
-	seqNum := logSeqNum
 	if seqNum == 0 {
 		// We can't use the value 0 for the global seqnum during ingestion, because
 		// 0 indicates no global seqnum. So allocate one more seqnum.
@@ -397,10 +439,11 @@ func (p *commitPipeline) AllocateSeqNum(
 	}
 	b.setSeqNum(seqNum)
 
-	// Wait for any outstanding writes to the memtable to complete. This is
-	// necessary for ingestion so that the check for memtable overlap can see any
-	// writes that were sequenced before the ingestion. The spin loop is
-	// unfortunate, but obviates the need for additional synchronization.
+	// Wait for any outstanding writes to the memtable to complete, i.e. for the
+	// batches preceding this one to be published. This is necessary for
+	// ingestion so that the check for memtable overlap can see any writes that
+	// were sequenced before the ingestion. The spin loop is unfortunate, but
+	// obviates the need for additional synchronization.
 	for {
 		visibleSeqNum := p.env.visibleSeqNum.Load()
 		if visibleSeqNum == logSeqNum {
@@ -423,6 +466,7 @@ func (p *commitPipeline) AllocateSeqNum(
 	p.publish(b)
 
 	<-p.commitQueueSem
+	return nil
 }
 
 func (p *commitPipeline) prepare(b *Batch, syncWAL bool, noSyncWait bool) (*memTable, error) {
@@ -430,6 +474,22 @@ func (p *commitPipeline) prepare(b *Batch, syncWAL bool, noSyncWait bool) (*memT
 	if n == invalidBatchCount {
 		return nil, ErrInvalidBatch
 	}
+	p.mu.Lock()
+
+	// Assign the batch a sequence number.
+	seqNum, err := p.allocateSeqNum(n)
+	if err != nil {
+		p.mu.Unlock()
+		<-p.commitQueueSem
+		if syncWAL {
+			<-p.logSyncQSem
+		}
+		return nil, err
+	}
+	b.setSeqNum(seqNum)
+
+	// The batch's wait groups are only added to once it's been assigned a
+	// sequence number, so that a failed allocation leaves them untouched.
 	var syncWG *sync.WaitGroup
 	var syncErr *error
 	switch {
@@ -451,26 +511,48 @@ func (p *commitPipeline) prepare(b *Batch, syncWAL bool, noSyncWait bool) (*memT
 		b.commit.Add(2)
 	}
 
-	p.mu.Lock()
-
 	// Enqueue the batch in the pending queue. Note that while the pending queue
 	// is lock-free, we want the order of batches to be the same as the sequence
 	// number order.
 	p.pending.enqueue(b)
 
-	// Assign the batch a sequence number. Note that we use atomic operations
-	// here to handle concurrent reads of logSeqNum. commitPipeline.mu provides
-	// mutual exclusion for other goroutines writing to logSeqNum.
-	b.setSeqNum(p.env.logSeqNum.Add(n) - n)
-
 	// Write the data to the WAL.
 	mem, err := p.env.write(b, syncWG, syncErr)
+	if err == nil && p.env.observe != nil {
+		p.env.observe(b, b.SeqNum())
+	}
 
 	p.mu.Unlock()
 
 	return mem, err
 }
 
+// errInvalidSeqNumAllocation is returned when an Options.SeqNumAllocator
+// reserves sequence numbers that violate its requirements. The batch or
+// ingestion that requested them is rejected before entering the commit
+// pipeline, which remains usable.
+var errInvalidSeqNumAllocation = errors.New("pebble: SeqNumAllocator reserved invalid sequence numbers")
+
+// allocateSeqNum reserves count sequence numbers, returning the first of
+// them. commitPipeline.mu must be held.
+func (p *commitPipeline) allocateSeqNum(count uint64) (uint64, error) {
+	if p.env.seqNumAllocator == nil {
+		// Note that we use atomic operations here to handle concurrent reads of
+		// logSeqNum. commitPipeline.mu provides mutual exclusion for other
+		// goroutines writing to logSeqNum.
+		return p.env.logSeqNum.Add(count) - count, nil
+	}
+	next := p.env.logSeqNum.Load()
+	seqNum := p.env.seqNumAllocator.Next(count)
+	if seqNum < next || seqNum >= base.InternalKeySeqNumBatch ||
+		count > base.InternalKeySeqNumBatch-seqNum {
+		return 0, errors.Wrapf(errInvalidSeqNumAllocation, "[%d, %d), expected at least %d",
+			errors.Safe(seqNum), errors.Safe(seqNum+count), errors.Safe(next))
+	}
+	p.env.logSeqNum.Store(seqNum + count)
+	return seqNum, nil
+}
+
 func (p *commitPipeline) publish(b *Batch) {
 	// Mark the batch as applied.
 	b.applied.Store(true)
@@ -16,7 +16,9 @@ import (
 	"github.com/cockroachdb/pebble/internal/arenaskl"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/invariants"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
 	"github.com/cockroachdb/pebble/record"
+	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
@@ -423,3 +425,132 @@ func BenchmarkCommitPipeline(b *testing.B) {
 		}
 	}
 }
+
+func TestCommitObserver(t *testing.T) {
+	var d *DB
+	var observed []uint64
+	var nextSeqNum uint64
+	opts := &Options{
+		FS: vfs.NewMem(),
+		CommitObserver: func(b *Batch, firstSeqNum uint64) {
+			// Batches are observed in order, and before they become visible.
+			if nextSeqNum != 0 && firstSeqNum != nextSeqNum {
+				t.Errorf("observed seqnum %d, expected %d", firstSeqNum, nextSeqNum)
+			}
+			if v := d.mu.versions.visibleSeqNum.Load(); v > firstSeqNum {
+				t.Errorf("batch at seqnum %d observed after becoming visible (visible=%d)", firstSeqNum, v)
+			}
+			nextSeqNum = firstSeqNum + uint64(b.Count())
+			observed = append(observed, firstSeqNum)
+		},
+	}
+	var err error
+	d, err = Open("", opts)
+	require.NoError(t, err)
+
+	const n = 100
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			b := d.NewBatch()
+			require.NoError(t, b.Set([]byte(fmt.Sprint(i)), nil, nil))
+			if i%2 == 0 {
+				require.NoError(t, b.Delete([]byte(fmt.Sprint(i+1)), nil))
+			}
+			require.NoError(t, b.Commit(nil))
+		}(i)
+	}
+	wg.Wait()
+	require.NoError(t, d.Close())
+
+	require.Len(t, observed, n)
+	require.Equal(t, nextSeqNum, d.mu.versions.logSeqNum.Load())
+}
+
+// testSeqNumAllocator is a SeqNumAllocator that leaves a gap of 100 sequence
+// numbers before each reservation, as if other DBs shared it.
+type testSeqNumAllocator struct {
+	next uint64
+}
+
+func (a *testSeqNumAllocator) Next(count uint64) uint64 {
+	a.next += 100
+	seqNum := a.next
+	a.next += count
+	return seqNum
+}
+
+func TestSeqNumAllocator(t *testing.T) {
+	alloc := &testSeqNumAllocator{next: 1000}
+	fs := vfs.NewMem()
+	opts := &Options{FS: fs, SeqNumAllocator: alloc}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+
+	const n = 20
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			b := d.NewBatch()
+			require.NoError(t, b.Set([]byte(fmt.Sprint(i)), []byte("a"), nil))
+			require.NoError(t, b.Set([]byte(fmt.Sprint(i)), []byte("b"), nil))
+			require.NoError(t, b.Commit(nil))
+			require.Less(t, uint64(1000), b.SeqNum())
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, alloc.next, d.mu.versions.logSeqNum.Load())
+	require.Equal(t, alloc.next, d.mu.versions.visibleSeqNum.Load())
+
+	// Ingestions draw from the allocator too.
+	f, err := fs.Create("ext", vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	w := sstable.NewWriter(objstorageprovider.NewFileWritable(f), sstable.WriterOptions{})
+	require.NoError(t, w.Set([]byte("z"), []byte("ingested")))
+	require.NoError(t, w.Close())
+	require.NoError(t, d.Ingest([]string{"ext"}))
+	require.Equal(t, alloc.next, d.mu.versions.logSeqNum.Load())
+
+	// An allocator moving backwards fails the commit, without wedging the
+	// commit pipeline.
+	alloc.next -= 200
+	require.ErrorIs(t, d.Set([]byte("x"), nil, nil), errInvalidSeqNumAllocation)
+	// The failed commit leaves the batch's wait groups untouched, so waiting
+	// for its sync doesn't hang.
+	alloc.next -= 200
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("x"), nil, nil))
+	require.ErrorIs(t, d.ApplyNoSyncWait(b, Sync), errInvalidSeqNumAllocation)
+	waited := make(chan struct{})
+	go func() {
+		defer close(waited)
+		_ = b.SyncWait()
+	}()
+	select {
+	case <-waited:
+	case <-time.After(10 * time.Second):
+		t.Fatal("SyncWait hung after a failed commit")
+	}
+	alloc.next += 200
+	require.NoError(t, d.Set([]byte("0"), []byte("c"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Close())
+
+	// The allocator resumes from its counter when the DB is reopened.
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	require.NoError(t, d.Set([]byte("1"), []byte("c"), nil))
+	for k, want := range map[string]string{"0": "c", "1": "c", "2": "b", "z": "ingested"} {
+		v, closer, err := d.Get([]byte(k))
+		require.NoError(t, err)
+		require.Equal(t, want, string(v))
+		require.NoError(t, closer.Close())
+	}
+	_, _, err = d.Get([]byte("x"))
+	require.ErrorIs(t, err, ErrNotFound)
+}
@@ -35,6 +35,11 @@ var errEmptyTable = errors.New("pebble: empty table")
 // concurrent excise or ingest-split operation.
 var ErrCancelledCompaction = errors.New("pebble: compaction cancelled by a concurrent operation, will retry compaction")
 
+// ErrCompactionsPaused is returned by manual compactions requested while
+// compactions are paused by DB.PauseCompactions, unless
+// Options.QueueManualCompactionsWhilePaused is set.
+var ErrCompactionsPaused = errors.New("pebble: compactions are paused")
+
 var compactLabels = pprof.Labels("pebble", "compact")
 var flushLabels = pprof.Labels("pebble", "flush")
 var gcLabels = pprof.Labels("pebble", "gc")
@@ -108,7 +113,7 @@ type compactionWritable struct {
 	objstorage.Writable
 
 	versions *versionSet
-	written  *int64
+	written  *atomic.Int64
 }
 
 // Write is part of the objstorage.Writable interface.
@@ -117,7 +122,7 @@ func (c *compactionWritable) Write(p []byte) error {
 		return err
 	}
 
-	*c.written += int64(len(p))
+	c.written.Add(int64(len(p)))
 	c.versions.incrementCompactionBytes(int64(len(p)))
 	return nil
 }
@@ -140,6 +145,12 @@ const (
 	compactionKindRead
 	compactionKindRewrite
 	compactionKindIngestedFlushable
+	// compactionKindRebuildFilter denotes a compaction that rewrites a single
+	// file with a new filter, copying its data blocks unchanged.
+	compactionKindRebuildFilter
+	// compactionKindColdData denotes a compaction that rewrites a single cold
+	// file onto shared storage. See Options.ColdDataThreshold.
+	compactionKindColdData
 )
 
 func (k compactionKind) String() string {
@@ -162,6 +173,10 @@ func (k compactionKind) String() string {
 		return "ingested-flushable"
 	case compactionKindCopy:
 		return "copy"
+	case compactionKindRebuildFilter:
+		return "rebuild-filter"
+	case compactionKindColdData:
+		return "cold-data"
 	}
 	return "?"
 }
@@ -173,12 +188,20 @@ type compaction struct {
 	// to cancel, such as if a conflicting excise operation raced it to manifest
 	// application. Only holders of the manifest lock will write to this atomic.
 	cancel atomic.Bool
+	// id identifies the compaction to DB.InProgressCompactions and
+	// DB.CancelCompaction. It's assigned when the compaction is added to
+	// d.mu.compact.inProgress.
+	id CompactionID
 
 	kind compactionKind
 	// isDownload is true if this compaction was started as part of a Download
 	// operation. In this case kind is compactionKindCopy or
 	// compactionKindRewrite.
 	isDownload bool
+	// outputMetadata is the table metadata requested for the outputs of a
+	// manual compaction by CompactOptions.OutputMetadata. If nil, the metadata
+	// of the outputs is derived from the inputs.
+	outputMetadata map[string]string
 
 	cmp       Compare
 	equal     Equal
@@ -221,8 +244,10 @@ type compaction struct {
 
 	// flushing contains the flushables (aka memtables) that are being flushed.
 	flushing flushableList
-	// bytesWritten contains the number of bytes that have been written to outputs.
-	bytesWritten int64
+	// bytesWritten contains the number of bytes that have been written to
+	// outputs. It's written by the compaction goroutine and may be read
+	// concurrently by DB.InProgressCompactions.
+	bytesWritten atomic.Int64
 
 	// The boundaries of the input data.
 	smallest InternalKey
@@ -253,6 +278,10 @@ type compaction struct {
 
 	metrics map[int]*LevelMetrics
 
+	// compression, if not DefaultCompression, overrides the compression of the
+	// output level for the compaction's outputs. It's set by DB.RewriteLevel.
+	compression Compression
+
 	pickerMetrics compactionPickerMetrics
 }
 
@@ -518,7 +547,7 @@ func newFlush(
 		}
 	}
 
-	if cur.L0Sublevels != nil {
+	if cur.L0Sublevels != nil && !opts.DeterministicFlushOutput {
 		c.l0Limits = cur.L0Sublevels.FlushSplitKeys()
 	}
 
@@ -584,9 +613,11 @@ func newFlush(
 
 	if opts.FlushSplitBytes > 0 {
 		c.maxOutputFileSize = uint64(opts.Level(0).TargetFileSize)
-		c.maxOverlapBytes = maxGrandparentOverlapBytes(opts, 0)
-		c.grandparents = c.version.Overlaps(baseLevel, c.userKeyBounds())
-		adjustGrandparentOverlapBytesForFlush(c, flushingBytes)
+		if !opts.DeterministicFlushOutput {
+			c.maxOverlapBytes = maxGrandparentOverlapBytes(opts, 0)
+			c.grandparents = c.version.Overlaps(baseLevel, c.userKeyBounds())
+			adjustGrandparentOverlapBytesForFlush(c, flushingBytes)
+		}
 	}
 
 	// We don't elide tombstones for flushes.
@@ -950,6 +981,8 @@ type manualCompaction struct {
 	start       []byte
 	end         []byte
 	split       bool
+	// outputMetadata is CompactOptions.OutputMetadata.
+	outputMetadata map[string]string
 }
 
 type readCompaction struct {
@@ -965,6 +998,8 @@ type readCompaction struct {
 }
 
 func (d *DB) addInProgressCompaction(c *compaction) {
+	d.mu.compact.nextID++
+	c.id = d.mu.compact.nextID
 	d.mu.compact.inProgress[c] = struct{}{}
 	var isBase, isIntraL0 bool
 	for _, cl := range c.inputs {
@@ -1059,6 +1094,11 @@ func (d *DB) maybeScheduleFlush() {
 	if d.mu.compact.flushing || d.closed.Load() != nil || d.opts.ReadOnly {
 		return
 	}
+	// A quiesced DB doesn't flush, except for the flushes that ingestions in
+	// progress when it was quiesced may be waiting for. See DB.Quiesce.
+	if d.mu.compact.quiesced && d.mu.compact.ingestingCount == 0 {
+		return
+	}
 	if len(d.mu.mem.queue) <= 1 {
 		return
 	}
@@ -1379,6 +1419,13 @@ func (d *DB) flush1() (bytesFlushed uint64, err error) {
 		// None of the immutable memtables are ready for flushing.
 		return 0, nil
 	}
+	if !ingest && n > 1 && d.opts.FlushSelector != nil {
+		n = d.selectFlushLocked(n)
+		inputBytes = 0
+		for i := 0; i < n; i++ {
+			inputBytes += d.mu.mem.queue[i].inuseBytes()
+		}
+	}
 	if !ingest {
 		// Flushes of memtables add the prefix of n memtables from the flushable
 		// queue.
@@ -1658,6 +1705,14 @@ func pickElisionOnly(picker compactionPicker, env compactionEnv) *pickedCompacti
 	return picker.pickElisionOnlyCompaction(env)
 }
 
+func pickSnapshotStripe(picker compactionPicker, env compactionEnv) *pickedCompaction {
+	return picker.pickSnapshotStripeCompaction(env)
+}
+
+func pickColdData(picker compactionPicker, env compactionEnv) *pickedCompaction {
+	return picker.pickColdDataCompaction(env)
+}
+
 // tryScheduleDownloadCompaction tries to start a download compaction.
 //
 // Returns true if we started a download compaction (or completed it
@@ -1682,6 +1737,34 @@ func (d *DB) tryScheduleDownloadCompaction(env compactionEnv, maxConcurrentDownl
 	return false
 }
 
+// maxConcurrentCompactionsLocked returns the maximum number of concurrent
+// compactions, as determined by Options.CompactionConcurrencyPolicy if set, or
+// Options.MaxConcurrentCompactions otherwise. The choice is recorded in
+// d.mu.compact.concurrency.
+//
+// Requires d.mu to be held.
+func (d *DB) maxConcurrentCompactionsLocked() int {
+	var n int
+	if policy := d.opts.CompactionConcurrencyPolicy; policy != nil {
+		vers := d.mu.versions.currentVersion()
+		n = policy.MaxConcurrentCompactions(CompactionConcurrencyInputs{
+			L0Bytes:               vers.Levels[0].Size(),
+			L0Sublevels:           len(vers.L0SublevelFiles),
+			L0CompactionThreshold: d.opts.L0CompactionThreshold,
+			LBaseMaxBytes:         d.opts.LBaseMaxBytes,
+			Current:               d.mu.compact.concurrency,
+		})
+		n = max(n, 1)
+	} else {
+		n = d.opts.MaxConcurrentCompactions()
+	}
+	if d.opts.DeterministicCompaction {
+		n = 1
+	}
+	d.mu.compact.concurrency = n
+	return n
+}
+
 // maybeScheduleCompactionPicker schedules a compaction if necessary,
 // calling `pickFunc` to pick automatic compactions.
 //
@@ -1689,10 +1772,10 @@ func (d *DB) tryScheduleDownloadCompaction(env compactionEnv, maxConcurrentDownl
 func (d *DB) maybeScheduleCompactionPicker(
 	pickFunc func(compactionPicker, compactionEnv) *pickedCompaction,
 ) {
-	if d.closed.Load() != nil || d.opts.ReadOnly {
+	if d.closed.Load() != nil || d.opts.ReadOnly || d.mu.compact.paused || d.mu.compact.quiesced {
 		return
 	}
-	maxCompactions := d.opts.MaxConcurrentCompactions()
+	maxCompactions := d.maxConcurrentCompactionsLocked()
 	maxDownloads := d.opts.MaxConcurrentDownloads()
 
 	if d.mu.compact.compactingCount >= maxCompactions &&
@@ -1722,6 +1805,12 @@ func (d *DB) maybeScheduleCompactionPicker(
 		earliestSnapshotSeqNum:  d.mu.snapshots.earliest(),
 		earliestUnflushedSeqNum: d.getEarliestUnflushedSeqNumLocked(),
 	}
+	if d.opts.SnapshotStripeCompactionWeight > 0 {
+		env.snapshots = d.mu.snapshots.toSlice()
+	}
+	if d.opts.ColdDataThreshold > 0 {
+		env.coldData = d.coldDataEnv()
+	}
 
 	if d.mu.compact.compactingCount < maxCompactions {
 		// Check for delete-only compactions first, because they're expected to be
@@ -1789,6 +1878,13 @@ func (d *DB) tryScheduleManualCompaction(env compactionEnv, manual *manualCompac
 	}
 
 	c := newCompaction(pc, d.opts, d.timeNow(), d.ObjProvider())
+	if manual.outputMetadata != nil {
+		// The tables must be rewritten to change their metadata.
+		c.outputMetadata = manual.outputMetadata
+		if c.kind == compactionKindMove || c.kind == compactionKindCopy {
+			c.kind = compactionKindDefault
+		}
+	}
 	d.mu.compact.compactingCount++
 	d.addInProgressCompaction(c)
 	go d.compact(c, manual.done)
@@ -2024,7 +2120,7 @@ func checkDeleteCompactionHints(
 			overlaps := v.Overlaps(l, base.UserKeyBoundsEndExclusive(h.start, h.end))
 			iter := overlaps.Iter()
 			for m := iter.First(); m != nil; m = iter.Next() {
-				if m.IsCompacting() || !h.canDelete(cmp, m, snapshots) || files[m] {
+				if m.IsCompacting() || m.IsPinned() || !h.canDelete(cmp, m, snapshots) || files[m] {
 					continue
 				}
 				if files == nil {
@@ -2132,13 +2228,17 @@ func (d *DB) compact1(c *compaction, errChannel chan error) (err error) {
 		d.mu.snapshots.cumulativePinnedCount += stats.CumulativePinnedKeys
 		d.mu.snapshots.cumulativePinnedSize += stats.CumulativePinnedSize
 		d.mu.versions.metrics.Keys.MissizedTombstonesCount += stats.CountMissizedDels
+		info.InputKeyCount = stats.CountInputKeys
+		info.OutputKeyCount = stats.CountOutputKeys
+		info.DroppedKeyCount = stats.CountInputKeys - stats.CountOutputKeys - stats.CountMergedKeys
 	}
 
 	// NB: clearing compacting state must occur before updating the read state;
 	// L0Sublevels initialization depends on it.
 	d.clearCompactingState(c, err != nil)
 	d.mu.versions.incrementCompactions(c.kind, c.extraLevels, c.pickerMetrics)
-	d.mu.versions.incrementCompactionBytes(-c.bytesWritten)
+	d.mu.versions.incrementCompactionInputFiles(c.inputs)
+	d.mu.versions.incrementCompactionBytes(-c.bytesWritten.Load())
 
 	info.TotalDuration = d.timeNow().Sub(c.beganAt)
 	d.opts.EventListener.CompactionEnd(info)
@@ -2289,9 +2389,16 @@ func (d *DB) runCopyCompaction(
 			}
 		}
 
+		// CopySpan doesn't copy the user properties of the source table, so
+		// carry its table metadata over explicitly.
+		tableMetadata, err := d.compactionOutputMetadata(c)
+		if err != nil {
+			return nil, compact.Stats{}, err
+		}
+		writerOpts := d.opts.MakeWriterOptions(c.outputLevel.level, d.FormatMajorVersion().MaxTableFormat())
 		wrote, err := sstable.CopySpan(ctx,
 			src, d.opts.MakeReaderOptions(),
-			w, d.opts.MakeWriterOptions(c.outputLevel.level, d.FormatMajorVersion().MaxTableFormat()),
+			w, withTableMetadata(writerOpts, tableMetadata),
 			start, end,
 		)
 		src = nil // We passed src to CopySpan; it's responsible for closing it.
@@ -2341,6 +2448,116 @@ func (d *DB) runCopyCompaction(
 	return ve, compact.Stats{}, nil
 }
 
+// runRebuildFilterCompaction runs a compaction that rewrites a single sstable
+// with a filter built according to the filter policy of its level, copying its
+// data blocks unchanged (see sstable.RebuildFilter). The new sstable replaces
+// the input in the same level under a new FileNum.
+//
+// d.mu must be held when calling this method. The mutex will be released when
+// doing IO.
+func (d *DB) runRebuildFilterCompaction(
+	jobID JobID, c *compaction,
+) (ve *versionEdit, stats compact.Stats, _ error) {
+	iter := c.startLevel.files.Iter()
+	inputMeta := iter.First()
+	if iter.Next() != nil {
+		return nil, compact.Stats{}, base.AssertionFailedf("got more than one file for a rebuild-filter compaction")
+	}
+	if inputMeta.Virtual {
+		return nil, compact.Stats{}, base.AssertionFailedf("cannot rebuild the filter of virtual sstable %s", inputMeta.FileNum)
+	}
+	if c.cancel.Load() {
+		return nil, compact.Stats{}, ErrCancelledCompaction
+	}
+	ve = &versionEdit{
+		DeletedFiles: map[deletedFileEntry]*fileMetadata{
+			{Level: c.startLevel.level, FileNum: inputMeta.FileNum}: inputMeta,
+		},
+	}
+
+	newMeta := &fileMetadata{
+		Size:                  inputMeta.Size,
+		CreationTime:          inputMeta.CreationTime,
+		SmallestSeqNum:        inputMeta.SmallestSeqNum,
+		LargestSeqNum:         inputMeta.LargestSeqNum,
+		LargestSeqNumAbsolute: inputMeta.LargestSeqNumAbsolute,
+		Stats:                 inputMeta.Stats,
+		SyntheticPrefix:       inputMeta.SyntheticPrefix,
+		SyntheticSuffix:       inputMeta.SyntheticSuffix,
+	}
+	if inputMeta.HasPointKeys {
+		newMeta.ExtendPointKeyBounds(c.cmp, inputMeta.SmallestPointKey, inputMeta.LargestPointKey)
+	}
+	if inputMeta.HasRangeKeys {
+		newMeta.ExtendRangeKeyBounds(c.cmp, inputMeta.SmallestRangeKey, inputMeta.LargestRangeKey)
+	}
+	newMeta.FileNum = d.mu.versions.getNextFileNum()
+	newMeta.InitPhysicalBacking()
+
+	// Before dropping the db mutex, grab a ref to the current version. This
+	// prevents any concurrent excises from deleting files that this compaction
+	// needs to read/maintain a reference to.
+	vers := d.mu.versions.currentVersion()
+	vers.Ref()
+	defer vers.UnrefLocked()
+
+	// NB: The order here is reversed, lock after unlock. This is similar to
+	// runCompaction.
+	d.mu.Unlock()
+	defer d.mu.Lock()
+
+	deleteOnExit := false
+	defer func() {
+		if deleteOnExit {
+			_ = d.objProvider.Remove(fileTypeTable, newMeta.FileBacking.DiskFileNum)
+		}
+	}()
+
+	ctx := context.TODO()
+	src, err := d.objProvider.OpenForReading(
+		ctx, fileTypeTable, inputMeta.FileBacking.DiskFileNum, objstorage.OpenOptions{},
+	)
+	if err != nil {
+		return nil, compact.Stats{}, err
+	}
+	w, _, err := d.objProvider.Create(
+		ctx, fileTypeTable, newMeta.FileBacking.DiskFileNum,
+		objstorage.CreateOptions{
+			PreferSharedStorage: remote.ShouldCreateShared(d.opts.Experimental.CreateOnShared, c.outputLevel.level),
+		},
+	)
+	if err != nil {
+		src.Close()
+		return nil, compact.Stats{}, err
+	}
+	deleteOnExit = true
+
+	writerOpts := d.opts.MakeWriterOptions(c.outputLevel.level, d.FormatMajorVersion().MaxTableFormat())
+	wrote, err := sstable.RebuildFilter(ctx, src, d.opts.MakeReaderOptions(), w, writerOpts)
+	if err != nil {
+		return nil, compact.Stats{}, err
+	}
+	newMeta.FileBacking.Size = wrote
+	newMeta.Size = wrote
+	ve.NewFiles = []newFileEntry{{
+		Level: c.outputLevel.level,
+		Meta:  newMeta,
+	}}
+	c.metrics = map[int]*LevelMetrics{
+		c.outputLevel.level: {
+			BytesIn:         inputMeta.Size,
+			BytesCompacted:  newMeta.Size,
+			TablesCompacted: 1,
+		},
+	}
+
+	if err := d.objProvider.Sync(); err != nil {
+		return nil, compact.Stats{}, err
+	}
+	deleteOnExit = false
+	return ve, compact.Stats{}, nil
+}
+
 func (d *DB) runDeleteOnlyCompaction(
 	jobID JobID, c *compaction,
 ) (ve *versionEdit, stats compact.Stats, retErr error) {
@@ -2408,6 +2625,8 @@ func (d *DB) runCompaction(
 		return d.runMoveCompaction(jobID, c)
 	case compactionKindCopy:
 		return d.runCopyCompaction(jobID, c)
+	case compactionKindRebuildFilter:
+		return d.runRebuildFilterCompaction(jobID, c)
 	case compactionKindIngestedFlushable:
 		panic("pebble: runCompaction cannot handle compactionKindIngestedFlushable.")
 	}
@@ -2451,6 +2670,14 @@ func (d *DB) runCompaction(
 	if result.Err == nil {
 		ve, result.Err = c.makeVersionEdit(result)
 	}
+	if result.Err == nil {
+		for _, nf := range ve.NewFiles {
+			nf.Meta.SnapshotStripes = snapshotStripes(snapshots, nf.Meta)
+		}
+	}
+	if result.Err == nil && c.flushing == nil && d.opts.CompactionOutputValidator != nil {
+		result.Err = d.validateCompactionOutputs(ve)
+	}
 	if result.Err != nil {
 		// Delete any created tables.
 		for i := range result.Tables {
@@ -2463,6 +2690,35 @@ func (d *DB) runCompaction(
 	return ve, result.Stats, result.Err
 }
 
+// validateCompactionOutputs invokes Options.CompactionOutputValidator on each
+// of the output tables of a compaction. The tables have already been written
+// and synced, but not yet installed in the manifest.
+func (d *DB) validateCompactionOutputs(ve *versionEdit) error {
+	for _, nf := range ve.NewFiles {
+		if err := d.validateCompactionOutput(nf.Level, nf.Meta); err != nil {
+			return errors.Wrapf(err, "pebble: compaction output %s failed validation", nf.Meta.FileNum)
+		}
+	}
+	return nil
+}
+
+func (d *DB) validateCompactionOutput(level int, meta *fileMetadata) error {
+	// The table is not yet part of a version, so it cannot be opened through
+	// the table cache.
+	readable, err := d.objProvider.OpenForReading(
+		context.TODO(), fileTypeTable, meta.FileBacking.DiskFileNum, objstorage.OpenOptions{MustExist: true})
+	if err != nil {
+		return err
+	}
+	cacheOpts := private.SSTableCacheOpts(d.cacheID, meta.FileBacking.DiskFileNum).(sstable.ReaderOption)
+	r, err := sstable.NewReader(readable, d.opts.MakeReaderOptions(), cacheOpts)
+	if err != nil {
+		return err
+	}
+	err = d.opts.CompactionOutputValidator(level, meta.TableInfo(), r)
+	return firstError(err, r.Close())
+}
+
 // compactAndWrite runs the data part of a compaction, where we set up a
 // compaction iterator and use it to write output tables.
 func (d *DB) compactAndWrite(
@@ -2523,13 +2779,39 @@ func (d *DB) compactAndWrite(
 		MaxGrandparentOverlapBytes: c.maxOverlapBytes,
 		TargetOutputFileSize:       c.maxOutputFileSize,
 	}
+	if c.kind != compactionKindFlush {
+		breakpoint := d.opts.CompactionDebugBreakpoint
+		var progress *compactionProgressReporter
+		if d.opts.CompactionProgressFunc != nil {
+			progress = d.newCompactionProgressReporter(jobID, c, iter)
+		}
+		if breakpoint != nil || progress != nil {
+			runnerCfg.PointKeyWritten = func(key *base.InternalKey) {
+				if progress != nil {
+					progress.maybeReport(key.UserKey)
+				}
+				if breakpoint != nil && breakpoint(key.UserKey) {
+					d.pauseCompaction(jobID, key.UserKey)
+				}
+			}
+		}
+	}
+	var tableMetadata []byte
+	if c.kind != compactionKindFlush {
+		if tableMetadata, err = d.compactionOutputMetadata(c); err != nil {
+			return compact.Result{Err: err}
+		}
+	}
 	runner := compact.NewRunner(runnerCfg, iter)
 	for runner.MoreDataToWrite() {
 		if c.cancel.Load() {
 			return runner.Finish().WithError(ErrCancelledCompaction)
 		}
 		// Create a new table.
-		writerOpts := d.opts.MakeWriterOptions(c.outputLevel.level, tableFormat)
+		writerOpts := withTableMetadata(d.opts.MakeWriterOptions(c.outputLevel.level, tableFormat), tableMetadata)
+		if c.compression != DefaultCompression {
+			writerOpts.Compression = c.compression
+		}
 		objMeta, tw, cpuWorkHandle, err := d.newCompactionOutput(jobID, c, writerOpts)
 		if err != nil {
 			return runner.Finish().WithError(err)
@@ -2538,12 +2820,139 @@ func (d *DB) compactAndWrite(
 		d.opts.Experimental.CPUWorkPermissionGranter.CPUWorkDone(cpuWorkHandle)
 	}
 	result = runner.Finish()
+	if d.opts.DeterministicCompaction {
+		for i := range result.Tables {
+			result.Tables[i].CreationTime = time.Unix(0, 0)
+		}
+	}
 	if result.Err == nil {
 		result.Err = d.objProvider.Sync()
 	}
 	return result
 }
 
+// CompactionProgress describes the progress of a compaction so far, as
+// reported to Options.CompactionProgressFunc.
+type CompactionProgress struct {
+	// JobID is the job ID of the compaction, as reported to the EventListener.
+	JobID JobID
+	// Reason is the reason for the compaction, as reported in CompactionInfo.
+	Reason string
+	// OutputLevel is the level the compaction writes to.
+	OutputLevel int
+	// BytesRead is the total size of the keys and values read from the
+	// compaction's inputs, before compression.
+	BytesRead uint64
+	// BytesWritten is the number of bytes written to the compaction's output
+	// sstables, after compression.
+	BytesWritten uint64
+	// OutputKey is the user key of the last point key written by the
+	// compaction. It's only valid for the duration of the call.
+	OutputKey []byte
+	// Elapsed is the time since the compaction began.
+	Elapsed time.Duration
+}
+
+// compactionProgressCheckKeys is the number of output keys between checks of
+// whether a compaction's progress is due to be reported, which keeps calls to
+// time.Now off the path of most keys.
+const compactionProgressCheckKeys = 128
+
+// compactionProgressReporter throttles the calls to
+// Options.CompactionProgressFunc by a compaction.
+type compactionProgressReporter struct {
+	fn         func(CompactionProgress)
+	interval   time.Duration
+	jobID      JobID
+	c          *compaction
+	iter       *compact.Iter
+	keys       int
+	lastReport time.Time
+}
+
+func (d *DB) newCompactionProgressReporter(
+	jobID JobID, c *compaction, iter *compact.Iter,
+) *compactionProgressReporter {
+	interval := d.opts.private.compactionProgressInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+	return &compactionProgressReporter{
+		fn:         d.opts.CompactionProgressFunc,
+		interval:   interval,
+		jobID:      jobID,
+		c:          c,
+		iter:       iter,
+		lastReport: c.beganAt,
+	}
+}
+
+// maybeReport is called after each point key is written by the compaction,
+// and reports its progress if the interval since the last report has passed.
+func (r *compactionProgressReporter) maybeReport(outputKey []byte) {
+	r.keys++
+	if r.keys%compactionProgressCheckKeys != 0 {
+		return
+	}
+	now := time.Now()
+	if now.Sub(r.lastReport) < r.interval {
+		return
+	}
+	r.lastReport = now
+	r.fn(CompactionProgress{
+		JobID:        r.jobID,
+		Reason:       r.c.kind.String(),
+		OutputLevel:  r.c.outputLevel.level,
+		BytesRead:    r.iter.Stats().CountInputBytes,
+		BytesWritten: uint64(r.c.bytesWritten.Load()),
+		OutputKey:    outputKey,
+		Elapsed:      now.Sub(r.c.beganAt),
+	})
+}
+
+// CompactionBreakpoint describes a compaction paused by
+// Options.CompactionDebugBreakpoint.
+type CompactionBreakpoint struct {
+	// JobID is the job ID of the compaction, as reported to the EventListener.
+	JobID JobID
+	// OutputKey is the user key of the last point key written by the
+	// compaction, for which Options.CompactionDebugBreakpoint returned true.
+	OutputKey []byte
+
+	resume chan struct{}
+}
+
+// Resume resumes the paused compaction. It must be called exactly once.
+func (b *CompactionBreakpoint) Resume() {
+	close(b.resume)
+}
+
+// CompactionBreakpoints returns the channel on which compactions paused by
+// Options.CompactionDebugBreakpoint are sent. See
+// Options.CompactionDebugBreakpoint.
+func (d *DB) CompactionBreakpoints() <-chan *CompactionBreakpoint {
+	return d.compactionBreakpoints
+}
+
+// pauseCompaction sends a CompactionBreakpoint for the compaction with the
+// given job ID, and waits for it to be resumed or for the DB to be closed.
+func (d *DB) pauseCompaction(jobID JobID, outputKey []byte) {
+	b := &CompactionBreakpoint{
+		JobID:     jobID,
+		OutputKey: slices.Clone(outputKey),
+		resume:    make(chan struct{}),
+	}
+	select {
+	case d.compactionBreakpoints <- b:
+	case <-d.closedCh:
+		return
+	}
+	select {
+	case <-b.resume:
+	case <-d.closedCh:
+	}
+}
+
 // makeVersionEdit creates the version edit for a compaction, based on the
 // tables in compact.Result.
 func (c *compaction) makeVersionEdit(result compact.Result) (*versionEdit, error) {
@@ -2692,10 +3101,12 @@ func (d *DB) newCompactionOutput(
 		}
 	}
 
-	// Prefer shared storage if present.
+	// Prefer shared storage if present. Cold data compactions always demote
+	// their outputs to shared storage.
 	createOpts := objstorage.CreateOptions{
-		PreferSharedStorage: remote.ShouldCreateShared(d.opts.Experimental.CreateOnShared, c.outputLevel.level),
-		WriteCategory:       writeCategory,
+		PreferSharedStorage: c.kind == compactionKindColdData ||
+			remote.ShouldCreateShared(d.opts.Experimental.CreateOnShared, c.outputLevel.level),
+		WriteCategory: writeCategory,
 	}
 	writable, objMeta, err := d.objProvider.Create(ctx, fileTypeTable, diskFileNum, createOpts)
 	if err != nil {
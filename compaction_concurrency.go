@@ -0,0 +1,100 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+// CompactionConcurrencyInputs describes the state of the LSM consulted by a
+// CompactionConcurrencyPolicy.
+type CompactionConcurrencyInputs struct {
+	// L0Bytes is the total size of the files in L0.
+	L0Bytes uint64
+	// L0Sublevels is the number of L0 sublevels, i.e. L0's read amplification.
+	L0Sublevels int
+	// L0CompactionThreshold and LBaseMaxBytes are the corresponding Options.
+	L0CompactionThreshold int
+	LBaseMaxBytes         int64
+	// Current is the concurrency returned by the previous evaluation of the
+	// policy, or zero for the first evaluation.
+	Current int
+}
+
+// CompactionConcurrencyPolicy determines the maximum number of concurrent
+// compactions (not including download compactions) from the state of L0. It
+// is consulted, with DB.mu held, every time compactions are scheduled, and so
+// must be cheap. See Options.CompactionConcurrencyPolicy.
+type CompactionConcurrencyPolicy interface {
+	// MaxConcurrentCompactions returns the maximum number of concurrent
+	// compactions. Values less than 1 are treated as 1.
+	MaxConcurrentCompactions(in CompactionConcurrencyInputs) int
+}
+
+// AdaptiveCompactionConcurrency returns a CompactionConcurrencyPolicy that
+// scales the number of concurrent compactions between min and max with the
+// L0 debt: one additional compaction is permitted for every multiple of
+// L0CompactionThreshold sublevels or of LBaseMaxBytes bytes in L0 beyond the
+// first, whichever is larger.
+//
+// The policy forms a feedback loop: additional concurrency drains L0 faster,
+// which reduces the debt, which in turn reduces the concurrency. To avoid
+// oscillating around a multiple, the concurrency is raised as soon as the debt
+// calls for it, but only lowered once the debt has fallen 25% below the level
+// that justified the current concurrency.
+//
+// A min less than 1 is treated as 1, and a max less than min as min.
+func AdaptiveCompactionConcurrency(min, max int) CompactionConcurrencyPolicy {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	return adaptiveCompactionConcurrency{min: min, max: max}
+}
+
+type adaptiveCompactionConcurrency struct {
+	min, max int
+}
+
+// hysteresisFactor is the factor, in percent, by which the L0 debt is
+// inflated when deciding whether to lower the concurrency.
+const hysteresisFactor = 125
+
+func (a adaptiveCompactionConcurrency) MaxConcurrentCompactions(
+	in CompactionConcurrencyInputs,
+) int {
+	want := a.forDebt(in, 100)
+	if want >= in.Current {
+		return want
+	}
+	// Only lower the concurrency if doing so is still warranted after
+	// inflating the debt.
+	if lower := a.forDebt(in, hysteresisFactor); lower < in.Current {
+		return lower
+	}
+	return in.Current
+}
+
+// forDebt returns the concurrency warranted by the L0 debt described by in,
+// scaled by pct percent.
+func (a adaptiveCompactionConcurrency) forDebt(in CompactionConcurrencyInputs, pct int) int {
+	var n int
+	if in.L0CompactionThreshold > 0 {
+		n = in.L0Sublevels * pct / (100 * in.L0CompactionThreshold)
+	}
+	if in.LBaseMaxBytes > 0 {
+		if b := int(in.L0Bytes * uint64(pct) / (100 * uint64(in.LBaseMaxBytes))); b > n {
+			n = b
+		}
+	}
+	// The first multiple of the thresholds is served by the minimum
+	// concurrency.
+	c := a.min
+	if n > 1 {
+		c += n - 1
+	}
+	if c > a.max {
+		c = a.max
+	}
+	return c
+}
@@ -0,0 +1,70 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveCompactionConcurrency(t *testing.T) {
+	p := AdaptiveCompactionConcurrency(2, 5)
+	in := func(sublevels int, l0Bytes uint64, current int) CompactionConcurrencyInputs {
+		return CompactionConcurrencyInputs{
+			L0Bytes:               l0Bytes,
+			L0Sublevels:           sublevels,
+			L0CompactionThreshold: 4,
+			LBaseMaxBytes:         64 << 20,
+			Current:               current,
+		}
+	}
+	testCases := []struct {
+		sublevels int
+		l0Bytes   uint64
+		current   int
+		expected  int
+	}{
+		// No debt.
+		{0, 0, 0, 2},
+		{4, 64 << 20, 0, 2},
+		// Every additional multiple of either threshold adds a compaction.
+		{8, 0, 2, 3},
+		{12, 0, 2, 4},
+		{0, 192 << 20, 2, 4},
+		{8, 192 << 20, 2, 4},
+		// Capped at max.
+		{100, 0, 2, 5},
+		// Lowering requires the debt to fall 25% below the level warranting
+		// the current concurrency.
+		{11, 0, 4, 4},
+		{10, 0, 4, 4},
+		{9, 0, 4, 3},
+		{7, 0, 3, 3},
+		{6, 0, 3, 2},
+	}
+	for _, tc := range testCases {
+		require.Equal(t, tc.expected, p.MaxConcurrentCompactions(in(tc.sublevels, tc.l0Bytes, tc.current)),
+			"sublevels=%d l0Bytes=%d current=%d", tc.sublevels, tc.l0Bytes, tc.current)
+	}
+
+	// Invalid bounds are clamped.
+	require.Equal(t, 1, AdaptiveCompactionConcurrency(0, 0).MaxConcurrentCompactions(in(100, 0, 0)))
+}
+
+func TestCompactionConcurrencyPolicyMetrics(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		CompactionConcurrencyPolicy: AdaptiveCompactionConcurrency(3, 8),
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	require.Equal(t, 3, d.Metrics().Compact.Concurrency)
+	require.Equal(t, 3, d.MetricsSnapshot().CompactConcurrency)
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/manifest"
+)
+
+// CompactionEstimate is the estimated cost of a manual compaction, returned
+// by DB.EstimateCompaction.
+type CompactionEstimate struct {
+	// Compactions is the number of compactions the manual compaction would
+	// run, one for each level with sstables overlapping the range when not
+	// parallelized.
+	Compactions int
+	// InputBytes is the total size of the sstables the compactions would read,
+	// including the estimated size of the sstables written by earlier
+	// compactions of the manual compaction and read by later ones.
+	InputBytes uint64
+	// OutputBytes is the estimated total size of the sstables the compactions
+	// would write. It's the size of their inputs less the space that the
+	// deletions within them are estimated to reclaim, according to the table
+	// stats of the sstables.
+	OutputBytes uint64
+	// Duration is the estimated time the compactions would take, assuming they
+	// write at the average throughput of the compactions run since the DB was
+	// opened. It's zero if no compactions have run yet.
+	Duration time.Duration
+}
+
+// EstimateCompaction estimates the cost of compacting the range [start, end]
+// with DB.Compact, without running any compactions. It picks the compaction of
+// each level that Compact would, using the current version of the LSM, and
+// reads only the metadata of the sstables, never their contents. Since it
+// doesn't account for memtables, which Compact flushes first, or concurrent
+// compactions, which may change the LSM before Compact runs, the estimate is
+// only a rough guide.
+func (d *DB) EstimateCompaction(start, end []byte) (CompactionEstimate, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.cmp(start, end) >= 0 {
+		return CompactionEstimate{}, errors.Errorf("EstimateCompaction start %s is not less than end %s",
+			d.opts.Comparer.FormatKey(start), d.opts.Comparer.FormatKey(end))
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	vers := d.mu.versions.currentVersion()
+	bounds := base.UserKeyBoundsInclusive(start, end)
+	maxLevelWithFiles := 1
+	for level := 0; level < numLevels; level++ {
+		if overlaps := vers.Overlaps(level, bounds); !overlaps.Empty() {
+			maxLevelWithFiles = level + 1
+		}
+	}
+	// As in CompactWithOptions, the bottommost level is never compacted into
+	// itself.
+	maxLevelWithFiles = min(maxLevelWithFiles, numLevels-1)
+
+	// The inputs of each compaction are picked from the current version, while
+	// Compact would pick them after the preceding compactions ran. To model
+	// those, the output of each compaction is carried over to the next in place
+	// of the sstables of its output level, which are read only once.
+	var est CompactionEstimate
+	var carried uint64
+	read := make(map[base.FileNum]struct{})
+	env := compactionEnv{
+		diskAvailBytes:          d.diskAvailBytes.Load(),
+		earliestSnapshotSeqNum:  d.mu.snapshots.earliest(),
+		earliestUnflushedSeqNum: d.getEarliestUnflushedSeqNumLocked(),
+	}
+	for level := 0; level < maxLevelWithFiles; level++ {
+		files := vers.Overlaps(level, bounds)
+		if files.Empty() {
+			continue
+		}
+		levels := []manifest.LevelSlice{files}
+		// Conflicts with in-progress compactions prevent picking a compaction,
+		// in which case the overlapping sstables of the level alone are used.
+		pc, _ := pickManualCompaction(vers, d.opts, env, d.mu.versions.picker.getBaseLevel(), &manualCompaction{
+			level: level,
+			start: start,
+			end:   end,
+		})
+		if pc != nil {
+			levels = levels[:0]
+			for _, cl := range append([]*compactionLevel{pc.startLevel, pc.outputLevel}, pc.extraLevels...) {
+				levels = append(levels, cl.files)
+			}
+		}
+		inputBytes, reclaimedBytes := carried, uint64(0)
+		for _, slice := range levels {
+			iter := slice.Iter()
+			for f := iter.First(); f != nil; f = iter.Next() {
+				if _, ok := read[f.FileNum]; ok {
+					continue
+				}
+				read[f.FileNum] = struct{}{}
+				inputBytes += f.Size
+				if f.StatsValid() {
+					reclaimedBytes += f.Stats.PointDeletionsBytesEstimate + f.Stats.RangeDeletionsBytesEstimate
+				}
+			}
+		}
+		carried = inputBytes - min(reclaimedBytes, inputBytes)
+		est.Compactions++
+		est.InputBytes += inputBytes
+		est.OutputBytes += carried
+	}
+
+	var compactedBytes uint64
+	for i := range d.mu.versions.metrics.Levels {
+		compactedBytes += d.mu.versions.metrics.Levels[i].BytesCompacted
+	}
+	if compactedBytes > 0 && d.mu.compact.duration > 0 {
+		est.Duration = time.Duration(float64(est.OutputBytes) / float64(compactedBytes) * float64(d.mu.compact.duration))
+	}
+	return est, nil
+}
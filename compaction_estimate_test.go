@@ -0,0 +1,69 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateCompaction(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem(), DisableAutomaticCompactions: true})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	_, err = d.EstimateCompaction([]byte("b"), []byte("a"))
+	require.Error(t, err)
+	est, err := d.EstimateCompaction([]byte("a"), []byte("z"))
+	require.NoError(t, err)
+	require.Equal(t, CompactionEstimate{}, est)
+
+	// levelSizes returns the total size of the sstables in each level.
+	levelSizes := func() (sizes [numLevels]uint64) {
+		m := d.Metrics()
+		for i := range m.Levels {
+			sizes[i] = uint64(m.Levels[i].Size)
+		}
+		return sizes
+	}
+	write := func(value string) {
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 100; j++ {
+				require.NoError(t, d.Set([]byte(fmt.Sprintf("k%03d", j)), []byte(value), nil))
+			}
+			require.NoError(t, d.Flush())
+		}
+	}
+
+	write("old")
+	sizes := levelSizes()
+	est, err = d.EstimateCompaction([]byte("a"), []byte("z"))
+	require.NoError(t, err)
+	require.Equal(t, 1, est.Compactions)
+	require.Equal(t, sizes[0], est.InputBytes)
+	require.LessOrEqual(t, est.OutputBytes, est.InputBytes)
+	// No compactions have run yet to estimate the duration from.
+	require.Zero(t, est.Duration)
+	// The estimate doesn't change the LSM.
+	require.Equal(t, sizes, levelSizes())
+
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+	write("new")
+	sizes = levelSizes()
+	est, err = d.EstimateCompaction([]byte("a"), []byte("z"))
+	require.NoError(t, err)
+	require.Equal(t, 1, est.Compactions)
+	require.Equal(t, sizes[0]+sizes[numLevels-1], est.InputBytes)
+	require.Greater(t, est.Duration, time.Duration(0))
+
+	// A range that doesn't overlap any sstables is free.
+	est, err = d.EstimateCompaction([]byte("x"), []byte("z"))
+	require.NoError(t, err)
+	require.Equal(t, CompactionEstimate{}, est)
+}
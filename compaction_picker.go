@@ -13,6 +13,7 @@ import (
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/compact"
 	"github.com/cockroachdb/pebble/internal/humanize"
 	"github.com/cockroachdb/pebble/internal/manifest"
 )
@@ -37,15 +38,24 @@ type compactionEnv struct {
 	earliestSnapshotSeqNum  uint64
 	inProgressCompactions   []compactionInfo
 	readCompactionEnv       readCompactionEnv
+	// snapshots holds the sequence numbers of the open snapshots in increasing
+	// order. It's only populated if Options.SnapshotStripeCompactionWeight is
+	// set.
+	snapshots compact.Snapshots
+	// coldData holds the state used to identify cold files. It's only
+	// populated if Options.ColdDataThreshold is set.
+	coldData coldDataEnv
 }
 
 type compactionPicker interface {
-	getScores([]compactionInfo) [numLevels]float64
+	getScores([]compactionInfo) (scores [numLevels]float64, topLevel int)
 	getBaseLevel() int
 	estimatedCompactionDebt(l0ExtraSize uint64) uint64
 	pickAuto(env compactionEnv) (pc *pickedCompaction)
 	pickElisionOnlyCompaction(env compactionEnv) (pc *pickedCompaction)
 	pickRewriteCompaction(env compactionEnv) (pc *pickedCompaction)
+	pickSnapshotStripeCompaction(env compactionEnv) (pc *pickedCompaction)
+	pickColdDataCompaction(env compactionEnv) (pc *pickedCompaction)
 	pickReadTriggeredCompaction(env compactionEnv) (pc *pickedCompaction)
 	forceBaseLevel1()
 }
@@ -488,7 +498,8 @@ func (pc *pickedCompaction) setupInputs(
 					sizeSum += f.Size
 				}
 			}
-			if sizeSum+pc.outputLevel.files.SizeSum() < maxExpandedBytes {
+			if sizeSum+pc.outputLevel.files.SizeSum() < maxExpandedBytes &&
+				!exceedsMaxCompactionInputFiles(opts, len(newStartLevelFiles)+pc.outputLevel.files.Len()) {
 				startLevel.files = manifest.NewLevelSliceSeqSorted(newStartLevelFiles)
 				pc.smallest, pc.largest = manifest.KeyRange(pc.cmp,
 					startLevel.files.Iter(), pc.outputLevel.files.Iter())
@@ -496,7 +507,7 @@ func (pc *pickedCompaction) setupInputs(
 				*pc.lcf = *oldLcf
 			}
 		}
-	} else if pc.grow(pc.smallest, pc.largest, maxExpandedBytes, startLevel) {
+	} else if pc.grow(opts, pc.smallest, pc.largest, maxExpandedBytes, startLevel) {
 		pc.maybeExpandBounds(manifest.KeyRange(pc.cmp,
 			startLevel.files.Iter(), pc.outputLevel.files.Iter()))
 	}
@@ -513,7 +524,7 @@ func (pc *pickedCompaction) setupInputs(
 // c.level+1 files in the compaction, and returns whether the inputs grew. sm
 // and la are the smallest and largest InternalKeys in all of the inputs.
 func (pc *pickedCompaction) grow(
-	sm, la InternalKey, maxExpandedBytes uint64, startLevel *compactionLevel,
+	opts *Options, sm, la InternalKey, maxExpandedBytes uint64, startLevel *compactionLevel,
 ) bool {
 	if pc.outputLevel.files.Empty() {
 		return false
@@ -528,6 +539,9 @@ func (pc *pickedCompaction) grow(
 	if grow0.SizeSum()+pc.outputLevel.files.SizeSum() >= maxExpandedBytes {
 		return false
 	}
+	if exceedsMaxCompactionInputFiles(opts, pc.inputFileCount()-startLevel.files.Len()+grow0.Len()) {
+		return false
+	}
 	// We need to include the outputLevel iter because without it, in a multiLevel scenario,
 	// sm1 and la1 could shift the output level keyspace when pc.outputLevel.files is set to grow1.
 	sm1, la1 := manifest.KeyRange(pc.cmp, grow0.Iter(), pc.outputLevel.files.Iter())
@@ -543,6 +557,21 @@ func (pc *pickedCompaction) grow(
 	return true
 }
 
+// inputFileCount returns the number of input files of the compaction.
+func (pc *pickedCompaction) inputFileCount() int {
+	var n int
+	for i := range pc.inputs {
+		n += pc.inputs[i].files.Len()
+	}
+	return n
+}
+
+// exceedsMaxCompactionInputFiles returns whether a compaction of n files would
+// exceed Options.MaxCompactionInputFiles.
+func exceedsMaxCompactionInputFiles(opts *Options, n int) bool {
+	return opts.MaxCompactionInputFiles > 0 && n > opts.MaxCompactionInputFiles
+}
+
 func (pc *pickedCompaction) compactionSize() uint64 {
 	var bytesToCompact uint64
 	for i := range pc.inputs {
@@ -562,15 +591,16 @@ func (pc *pickedCompaction) setupMultiLevelCandidate(opts *Options, diskAvailByt
 	pc.startLevel = &pc.inputs[0]
 	pc.extraLevels = []*compactionLevel{&pc.inputs[1]}
 	pc.outputLevel = &pc.inputs[2]
-	return pc.setupInputs(opts, diskAvailBytes, pc.extraLevels[len(pc.extraLevels)-1])
+	return pc.setupInputs(opts, diskAvailBytes, pc.extraLevels[len(pc.extraLevels)-1]) &&
+		!exceedsMaxCompactionInputFiles(opts, pc.inputFileCount())
 }
 
 // anyTablesCompacting returns true if any tables in the level slice are
-// compacting.
+// compacting, or are pinned and so mustn't be compacted.
 func anyTablesCompacting(inputs manifest.LevelSlice) bool {
 	it := inputs.Iter()
 	for f := it.First(); f != nil; f = it.Next() {
-		if f.IsCompacting() {
+		if f.IsCompacting() || f.IsPinned() {
 			return true
 		}
 	}
@@ -702,12 +732,22 @@ type compactionPickerByScore struct {
 
 var _ compactionPicker = &compactionPickerByScore{}
 
-func (p *compactionPickerByScore) getScores(inProgress []compactionInfo) [numLevels]float64 {
-	var scores [numLevels]float64
+// getScores returns the compensated score ratio of each level, and the level
+// that pickAuto tries first to pick a score-based compaction from, or -1 if no
+// level should be compacted.
+func (p *compactionPickerByScore) getScores(
+	inProgress []compactionInfo,
+) (scores [numLevels]float64, topLevel int) {
+	topLevel = -1
 	for _, info := range p.calculateLevelScores(inProgress) {
 		scores[info.level] = info.compensatedScoreRatio
+		// The levels are sorted by priority. As in pickAuto, the last level is
+		// never the start level of a score-based compaction.
+		if topLevel == -1 && info.shouldCompact() && info.level != numLevels-1 {
+			topLevel = info.level
+		}
 	}
-	return scores
+	return scores, topLevel
 }
 
 func (p *compactionPickerByScore) getBaseLevel() int {
@@ -1076,11 +1116,12 @@ func pickCompactionSeedFile(
 
 	for f := startIter.First(); f != nil; f = startIter.Next() {
 		var overlappingBytes uint64
-		compacting := f.IsCompacting()
+		compacting := f.IsCompacting() || f.IsPinned()
 		if compacting {
-			// Move on if this file is already being compacted. We'll likely
-			// still need to move past the overlapping output files regardless,
-			// but in cases where all start-level files are compacting we won't.
+			// Move on if this file is already being compacted or is pinned.
+			// We'll likely still need to move past the overlapping output files
+			// regardless, but in cases where all start-level files are
+			// compacting we won't.
 			continue
 		}
 
@@ -1091,7 +1132,7 @@ func pickCompactionSeedFile(
 
 		for outputFile != nil && sstableKeyCompare(cmp, outputFile.Smallest, f.Largest) <= 0 && !compacting {
 			overlappingBytes += outputFile.Size
-			compacting = compacting || outputFile.IsCompacting()
+			compacting = compacting || outputFile.IsCompacting() || outputFile.IsPinned()
 
 			// For files in the bottommost level of the LSM, the
 			// Stats.RangeDeletionsBytesEstimate field is set to the estimate
@@ -1317,6 +1358,12 @@ func (p *compactionPickerByScore) pickAuto(env compactionEnv) (pc *pickedCompact
 		}
 	}
 
+	// Check for files that retain versions of keys for snapshots that have
+	// since been released.
+	if pc := p.pickSnapshotStripeCompaction(env); pc != nil {
+		return pc
+	}
+
 	// Check for L6 files with tombstones that may be elided. These files may
 	// exist if a snapshot prevented the elision of a tombstone or because of
 	// a move compaction. These are low-priority compactions because they
@@ -1329,6 +1376,11 @@ func (p *compactionPickerByScore) pickAuto(env compactionEnv) (pc *pickedCompact
 		return pc
 	}
 
+	// Check for cold files that may be demoted to shared storage.
+	if pc := p.pickColdDataCompaction(env); pc != nil {
+		return pc
+	}
+
 	// NB: This should only be run if a read compaction wasn't
 	// scheduled.
 	//
@@ -1412,6 +1464,11 @@ func (a elisionOnlyAnnotator) Accumulate(f *fileMetadata, dst interface{}) (inte
 	if f.IsCompacting() {
 		return dst, true
 	}
+	if f.IsPinned() {
+		// Files may be unpinned without a new version, so the annotation
+		// mustn't be cached.
+		return dst, false
+	}
 	if !f.StatsValid() {
 		return dst, false
 	}
@@ -1535,6 +1592,103 @@ func (p *compactionPickerByScore) pickElisionOnlyCompaction(
 	return nil
 }
 
+// pickSnapshotStripeCompaction attempts to construct a compaction that
+// rewrites the file with the highest snapshot stripe score, if any file's
+// score is at least 1. A file's score is the number of snapshots that split it
+// when it was written (FileMetadata.SnapshotStripes) which have since been
+// released, multiplied by Options.SnapshotStripeCompactionWeight. Like a
+// rewrite compaction, the compaction outputs files to the same level as the
+// input level.
+func (p *compactionPickerByScore) pickSnapshotStripeCompaction(
+	env compactionEnv,
+) (pc *pickedCompaction) {
+	weight := p.opts.SnapshotStripeCompactionWeight
+	if weight <= 0 {
+		return nil
+	}
+	var candidate *fileMetadata
+	var candidateLevel int
+	candidateScore := 1.0
+	for l := numLevels - 1; l >= 0; l-- {
+		iter := p.vers.Levels[l].Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			if f.SnapshotStripes == 0 || f.IsCompacting() || f.IsPinned() {
+				continue
+			}
+			released := f.SnapshotStripes - snapshotStripes(env.snapshots, f)
+			if score := weight * float64(released); score >= candidateScore {
+				candidate, candidateLevel, candidateScore = f, l, score
+			}
+		}
+	}
+	if candidate == nil {
+		return nil
+	}
+	lf := p.vers.Levels[candidateLevel].Find(p.opts.Comparer.Compare, candidate)
+	if lf.Empty() {
+		panic(fmt.Sprintf("file %s not found in level %d as expected", candidate.FileNum, candidateLevel))
+	}
+	if anyTablesCompacting(lf) {
+		return nil
+	}
+	pc = newPickedCompaction(p.opts, p.vers, candidateLevel, candidateLevel, p.baseLevel)
+	pc.kind = compactionKindRewrite
+	pc.startLevel.files = lf
+	pc.smallest, pc.largest = manifest.KeyRange(pc.cmp, pc.startLevel.files.Iter())
+	// Fail-safe to protect against compacting the same sstable concurrently.
+	if inputRangeAlreadyCompacting(env, pc) {
+		return nil
+	}
+	if pc.startLevel.level == 0 {
+		pc.startLevel.l0SublevelInfo = generateSublevelInfo(pc.cmp, pc.startLevel.files)
+	}
+	pc.score = candidateScore
+	return pc
+}
+
+// pickColdDataCompaction attempts to construct a compaction that rewrites the
+// largest cold file stored locally onto shared storage, if any. Like a rewrite
+// compaction, the compaction outputs files to the same level as the input
+// level. The candidates are those found by the last periodic scan (see
+// DB.checkColdData), skipping the ones no longer in the version.
+func (p *compactionPickerByScore) pickColdDataCompaction(
+	env compactionEnv,
+) (pc *pickedCompaction) {
+	if p.opts.ColdDataThreshold <= 0 {
+		return nil
+	}
+	for _, c := range env.coldData.candidates {
+		f := c.file
+		if f.IsCompacting() || f.IsPinned() || !env.coldData.isCold(p.opts, f) {
+			continue
+		}
+		lf := p.vers.Levels[c.level].Find(p.opts.Comparer.Compare, f)
+		if lf.Empty() || anyTablesCompacting(lf) {
+			continue
+		}
+		pc = newPickedCompaction(p.opts, p.vers, c.level, c.level, p.baseLevel)
+		pc.kind = compactionKindColdData
+		pc.startLevel.files = lf
+		pc.smallest, pc.largest = manifest.KeyRange(pc.cmp, pc.startLevel.files.Iter())
+		// Fail-safe to protect against compacting the same sstable concurrently.
+		if inputRangeAlreadyCompacting(env, pc) {
+			continue
+		}
+		if pc.startLevel.level == 0 {
+			pc.startLevel.l0SublevelInfo = generateSublevelInfo(pc.cmp, pc.startLevel.files)
+		}
+		return pc
+	}
+	return nil
+}
+
+// snapshotStripes returns the number of the snapshots whose sequence numbers
+// split the sequence number range of the file, i.e. that see some but not all
+// of its keys.
+func snapshotStripes(snapshots compact.Snapshots, f *fileMetadata) int {
+	return snapshots.Index(f.LargestSeqNum) - snapshots.Index(f.SmallestSeqNum)
+}
+
 // pickRewriteCompaction attempts to construct a compaction that
 // rewrites a file marked for compaction. pickRewriteCompaction will
 // pull in adjacent files in the file's atomic compaction unit if
@@ -1800,6 +1954,10 @@ func pickManualCompaction(
 		// ignore this manual compaction as there is nothing to do (manual.level
 		// points to an empty level).
 		return nil, false
+	} else if manual.level == numLevels-1 {
+		// A manual compaction of the bottommost level rewrites its tables in
+		// place.
+		outputLevel = manual.level
 	}
 	// This conflictsWithInProgress call is necessary for the manual compaction to
 	// be retried when it conflicts with an ongoing automatic compaction. Without
@@ -1854,7 +2012,7 @@ func pickDownloadCompaction(
 	if file.CompactionState == manifest.CompactionStateCompacting {
 		return nil
 	}
-	if kind != compactionKindCopy && kind != compactionKindRewrite {
+	if kind != compactionKindCopy && kind != compactionKindRewrite && kind != compactionKindRebuildFilter {
 		panic("invalid download/rewrite compaction kind")
 	}
 	pc = newPickedCompaction(opts, vers, level, level, baseLevel)
@@ -1951,7 +2109,9 @@ func inputRangeAlreadyCompacting(env compactionEnv, pc *pickedCompaction) bool {
 	for _, cl := range pc.inputs {
 		iter := cl.files.Iter()
 		for f := iter.First(); f != nil; f = iter.Next() {
-			if f.IsCompacting() {
+			// Pinned files are treated as compacting: they mustn't be compacted
+			// until they're unpinned. See DB.PinRange.
+			if f.IsCompacting() || f.IsPinned() {
 				return true
 			}
 		}
@@ -21,6 +21,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/humanize"
 	"github.com/cockroachdb/pebble/internal/manifest"
 	"github.com/cockroachdb/pebble/internal/testkeys"
+	"github.com/cockroachdb/pebble/objstorage/remote"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/stretchr/testify/require"
 )
@@ -1637,3 +1638,180 @@ func checkTableBoundary(a, b *fileMetadata, cmp base.Compare) (ok bool) {
 	c := cmp(a.LargestPointKey.UserKey, b.SmallestPointKey.UserKey)
 	return c < 0 || (c == 0 && a.LargestPointKey.IsExclusiveSentinel())
 }
+
+func TestCompactionPickerSnapshotStripes(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                             vfs.NewMem(),
+		SnapshotStripeCompactionWeight: 0.5,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Write four versions of a key, separated by three snapshots, and flush
+	// them to an sstable that preserves all of them.
+	var snaps []*Snapshot
+	for i := 1; i <= 4; i++ {
+		if i > 1 {
+			snaps = append(snaps, d.NewSnapshot())
+		}
+		require.NoError(t, d.Set([]byte("k"), []byte(fmt.Sprint(i)), nil))
+	}
+	require.NoError(t, d.Flush())
+
+	// entries waits for compactions to complete and returns the level and
+	// number of entries of each sstable.
+	entries := func() []string {
+		d.mu.Lock()
+		for d.mu.compact.compactingCount > 0 {
+			d.mu.compact.cond.Wait()
+		}
+		d.mu.Unlock()
+		tables, err := d.SSTables(WithProperties())
+		require.NoError(t, err)
+		var res []string
+		for level, infos := range tables {
+			for _, info := range infos {
+				res = append(res, fmt.Sprintf("L%d:%d", level, info.Properties.NumEntries))
+			}
+		}
+		return res
+	}
+	// stripes returns the number of snapshots that split the L0 sstable when
+	// it was written.
+	stripes := func() int {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		iter := d.mu.versions.currentVersion().Levels[0].Iter()
+		return iter.First().SnapshotStripes
+	}
+	require.Equal(t, []string{"L0:4"}, entries())
+	require.Equal(t, 3, stripes())
+
+	// With a weight of 0.5, the sstable is rewritten once two of its
+	// snapshots are released; only the versions visible to the remaining
+	// snapshot and the newest version are kept.
+	require.NoError(t, snaps[0].Close())
+	require.Equal(t, []string{"L0:4"}, entries())
+	require.NoError(t, snaps[2].Close())
+	require.Equal(t, []string{"L0:2"}, entries())
+	require.Equal(t, 1, stripes())
+	require.Equal(t, int64(1), d.Metrics().Compact.RewriteCount)
+
+	// Releasing the last snapshot isn't enough to rewrite the new sstable.
+	require.NoError(t, snaps[1].Close())
+	require.Equal(t, []string{"L0:2"}, entries())
+	require.Equal(t, int64(1), d.Metrics().Compact.RewriteCount)
+}
+
+func TestCompactionPickerColdData(t *testing.T) {
+	opts := &Options{
+		FS:                vfs.NewMem(),
+		ColdDataThreshold: 2,
+		ColdDataPeriod:    time.Hour,
+		Logger:            testLogger{t},
+	}
+	opts.Experimental.RemoteStorage = remote.MakeSimpleFactory(map[remote.Locator]remote.Storage{
+		"": remote.NewInMem(),
+	})
+	opts.Experimental.CreateOnShared = remote.CreateOnSharedLower
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	require.NoError(t, d.SetCreatorID(1))
+
+	now := time.Now()
+	d.mu.Lock()
+	d.timeNow = func() time.Time { return now }
+	d.mu.Unlock()
+
+	// Write two L0 sstables, which are stored locally, and read one of them.
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("b"), []byte("2"), nil))
+	require.NoError(t, d.Flush())
+	for i := 0; i < 5; i++ {
+		_, closer, err := d.Get([]byte("b"))
+		require.NoError(t, err)
+		require.NoError(t, closer.Close())
+	}
+
+	// tables waits for compactions to complete and returns the smallest key
+	// of each L0 sstable along with whether it's stored remotely.
+	tables := func() map[string]bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		for d.mu.compact.compactingCount > 0 {
+			d.mu.compact.cond.Wait()
+		}
+		res := make(map[string]bool)
+		iter := d.mu.versions.currentVersion().Levels[0].Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			meta, err := d.objProvider.Lookup(fileTypeTable, f.FileBacking.DiskFileNum)
+			require.NoError(t, err)
+			res[string(f.Smallest.UserKey)] = meta.IsRemote()
+		}
+		return res
+	}
+
+	// Neither sstable has existed for a full period yet.
+	d.checkColdData()
+	require.Equal(t, map[string]bool{"a": false, "b": false}, tables())
+	require.Zero(t, d.Metrics().ColdDataBytes)
+
+	// Two hours later, the sstable containing "a" has been read less than
+	// twice per hour, but isn't found until the next check.
+	now = now.Add(2 * time.Hour)
+	d.mu.Lock()
+	d.maybeScheduleCompactionPicker(pickColdData)
+	d.mu.Unlock()
+	require.Equal(t, map[string]bool{"a": false, "b": false}, tables())
+	require.Zero(t, d.Metrics().ColdDataBytes)
+
+	// The check demotes it to shared storage. The one containing "b" is still
+	// read often enough to remain local.
+	d.checkColdData()
+	require.Equal(t, map[string]bool{"a": true, "b": false}, tables())
+	require.Equal(t, int64(1), d.Metrics().Compact.RewriteCount)
+	m := d.Metrics()
+	require.NotZero(t, m.ColdDataBytes)
+	require.Less(t, m.ColdDataBytes, uint64(m.Levels[0].Size))
+
+	v, closer, err := d.Get([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, "1", string(v))
+	require.NoError(t, closer.Close())
+}
+
+func TestCompactionScores(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		L0CompactionThreshold:       2,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	scores, level := d.CompactionScores()
+	require.Equal(t, make([]float64, numLevels), scores)
+	require.Equal(t, -1, level)
+
+	// Overlapping flushes stack up L0 sublevels until L0 needs compacting.
+	for i := 0; i < 3; i++ {
+		require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+		require.NoError(t, d.Set([]byte("b"), []byte("1"), nil))
+		require.NoError(t, d.Flush())
+	}
+	scores, level = d.CompactionScores()
+	require.Len(t, scores, numLevels)
+	require.GreaterOrEqual(t, scores[0], 1.0)
+	require.Equal(t, 0, level)
+	m := d.Metrics()
+	for l := range scores {
+		require.Equal(t, m.Levels[l].Score, scores[l])
+	}
+
+	require.NoError(t, d.Compact([]byte("a"), []byte("c"), false /* parallelize */))
+	scores, level = d.CompactionScores()
+	require.Zero(t, scores[0])
+	require.Equal(t, -1, level)
+}
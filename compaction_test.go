@@ -13,6 +13,7 @@ import (
 	"math/rand"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -23,6 +24,7 @@ import (
 	"github.com/cockroachdb/datadriven"
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble/bloom"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/compact"
 	"github.com/cockroachdb/pebble/internal/manifest"
@@ -58,8 +60,8 @@ type compactionPickerForTesting struct {
 
 var _ compactionPicker = &compactionPickerForTesting{}
 
-func (p *compactionPickerForTesting) getScores([]compactionInfo) [numLevels]float64 {
-	return [numLevels]float64{}
+func (p *compactionPickerForTesting) getScores([]compactionInfo) ([numLevels]float64, int) {
+	return [numLevels]float64{}, -1
 }
 
 func (p *compactionPickerForTesting) getBaseLevel() int {
@@ -105,6 +107,18 @@ func (p *compactionPickerForTesting) pickRewriteCompaction(
 	return nil
 }
 
+func (p *compactionPickerForTesting) pickSnapshotStripeCompaction(
+	env compactionEnv,
+) (pc *pickedCompaction) {
+	return nil
+}
+
+func (p *compactionPickerForTesting) pickColdDataCompaction(
+	env compactionEnv,
+) (pc *pickedCompaction) {
+	return nil
+}
+
 func (p *compactionPickerForTesting) pickReadTriggeredCompaction(
 	env compactionEnv,
 ) (pc *pickedCompaction) {
@@ -2843,3 +2857,689 @@ func TestCompactionErrorStats(t *testing.T) {
 	d.mu.Unlock()
 	require.NoError(t, d.Close())
 }
+
+func TestCompactL0(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		L0CompactionThreshold:       2,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Each flush produces an sstable spanning [a,z] that overlaps all of the
+	// previous ones, adding an L0 sublevel.
+	for i := 0; i < 4; i++ {
+		require.NoError(t, d.Set([]byte("a"), []byte(fmt.Sprint(i)), nil))
+		require.NoError(t, d.Set([]byte("z"), []byte(fmt.Sprint(i)), nil))
+		require.NoError(t, d.Flush())
+	}
+
+	stats, err := d.CompactL0(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 4, stats.StartSublevels)
+	require.Less(t, stats.EndSublevels, 2)
+	require.Equal(t, 1, stats.Compactions)
+
+	// Nothing to do once L0 is below the target.
+	stats, err = d.CompactL0(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, stats.Compactions)
+
+	// A canceled context is reported.
+	for i := 0; i < 2; i++ {
+		require.NoError(t, d.Set([]byte("a"), []byte(fmt.Sprint(i)), nil))
+		require.NoError(t, d.Flush())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = d.CompactL0(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestCompactionOutputValidator(t *testing.T) {
+	var validated []string
+	fail := true
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{
+		FS:                          mem,
+		DisableAutomaticCompactions: true,
+		CompactionOutputValidator: func(level int, info TableInfo, r *sstable.Reader) error {
+			validated = append(validated, fmt.Sprintf("L%d:%s", level, info.FileNum))
+			// The reader is usable from within the validator.
+			iter, err := r.NewIter(sstable.NoTransforms, nil, nil)
+			if err != nil {
+				return err
+			}
+			n := 0
+			for kv := iter.First(); kv != nil; kv = iter.Next() {
+				n++
+			}
+			if err := iter.Close(); err != nil {
+				return err
+			}
+			if n != 2 {
+				return errors.Errorf("unexpected key count %d", n)
+			}
+			if fail {
+				return errors.New("injected validation failure")
+			}
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("a"), []byte("2"), nil))
+	require.NoError(t, d.Flush())
+	// Flushes are not validated.
+	require.Empty(t, validated)
+
+	lsmBefore := d.DebugString()
+	err = d.Compact([]byte("a"), []byte("c"), false /* parallelize */)
+	require.ErrorContains(t, err, "injected validation failure")
+	require.Len(t, validated, 1)
+	// The failed compaction's inputs remain in place.
+	require.Equal(t, lsmBefore, d.DebugString())
+
+	fail = false
+	require.NoError(t, d.Compact([]byte("a"), []byte("c"), false /* parallelize */))
+	require.Len(t, validated, 2)
+	require.NotEqual(t, lsmBefore, d.DebugString())
+
+	v, closer, err := d.Get([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, "2", string(v))
+	require.NoError(t, closer.Close())
+}
+
+func TestCompactionPerLevelFilterPolicy(t *testing.T) {
+	opts := &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		Levels:                      make([]LevelOptions, numLevels),
+	}
+	for i := range opts.Levels {
+		opts.Levels[i].FilterPolicy = bloom.FilterPolicy(10)
+	}
+	// Disable filters for the bottommost level.
+	opts.Levels[numLevels-1].FilterPolicy = nil
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	filterPolicies := func() map[int][]string {
+		tables, err := d.SSTables(WithProperties())
+		require.NoError(t, err)
+		m := make(map[int][]string)
+		for level := range tables {
+			for _, info := range tables[level] {
+				m[level] = append(m[level], info.Properties.FilterPolicyName)
+			}
+		}
+		return m
+	}
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("a"), []byte("2"), nil))
+	require.NoError(t, d.Flush())
+	bloomName := bloom.FilterPolicy(10).Name()
+	require.Equal(t, map[int][]string{0: {bloomName, bloomName}}, filterPolicies())
+
+	// Compacting into the bottommost level rewrites the tables without a
+	// filter.
+	require.NoError(t, d.Compact([]byte("a"), []byte("c"), false /* parallelize */))
+	require.Equal(t, map[int][]string{numLevels - 1: {""}}, filterPolicies())
+
+	// Tables with and without filters are readable side by side.
+	require.NoError(t, d.Set([]byte("c"), []byte("3"), nil))
+	require.NoError(t, d.Flush())
+	require.Equal(t, map[int][]string{0: {bloomName}, numLevels - 1: {""}}, filterPolicies())
+	for _, kv := range [][2]string{{"a", "2"}, {"b", "1"}, {"c", "3"}} {
+		v, closer, err := d.Get([]byte(kv[0]))
+		require.NoError(t, err)
+		require.Equal(t, kv[1], string(v))
+		require.NoError(t, closer.Close())
+	}
+	_, _, err = d.Get([]byte("d"))
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestPauseCompactions(t *testing.T) {
+	numL0Files := func(d *DB) int64 {
+		return d.Metrics().Levels[0].NumFiles
+	}
+	flushKeys := func(d *DB, n int) {
+		for i := 0; i < n; i++ {
+			require.NoError(t, d.Set([]byte("a"), []byte(strconv.Itoa(i)), nil))
+			require.NoError(t, d.Set([]byte("b"), []byte(strconv.Itoa(i)), nil))
+			require.NoError(t, d.Flush())
+		}
+	}
+
+	t.Run("automatic", func(t *testing.T) {
+		d, err := Open("", &Options{
+			FS:                    vfs.NewMem(),
+			L0CompactionThreshold: 1,
+		})
+		require.NoError(t, err)
+		defer func() { require.NoError(t, d.Close()) }()
+
+		d.PauseCompactions()
+		// Pausing twice is a no-op.
+		d.PauseCompactions()
+		require.True(t, d.Metrics().Compact.Paused)
+		require.True(t, d.MetricsSnapshot().CompactPaused)
+
+		// Flushes proceed, but nothing is compacted out of L0.
+		flushKeys(d, 3)
+		require.Equal(t, int64(3), numL0Files(d))
+		require.Equal(t, int64(0), d.Metrics().Compact.Count)
+		require.ErrorIs(t, d.Compact([]byte("a"), []byte("c"), false /* parallelize */), ErrCompactionsPaused)
+		_, err = d.CompactL0(context.Background())
+		require.ErrorIs(t, err, ErrCompactionsPaused)
+
+		d.ResumeCompactions()
+		require.False(t, d.Metrics().Compact.Paused)
+		require.Eventually(t, func() bool { return numL0Files(d) == 0 }, 10*time.Second, time.Millisecond)
+	})
+
+	t.Run("queue-manual", func(t *testing.T) {
+		d, err := Open("", &Options{
+			FS:                                vfs.NewMem(),
+			DisableAutomaticCompactions:       true,
+			QueueManualCompactionsWhilePaused: true,
+		})
+		require.NoError(t, err)
+		defer func() { require.NoError(t, d.Close()) }()
+
+		flushKeys(d, 2)
+		d.PauseCompactions()
+		errCh := make(chan error, 1)
+		go func() { errCh <- d.Compact([]byte("a"), []byte("c"), false /* parallelize */) }()
+
+		// The manual compaction is queued rather than run.
+		select {
+		case err := <-errCh:
+			t.Fatalf("manual compaction completed while paused: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		require.Equal(t, int64(2), numL0Files(d))
+
+		d.ResumeCompactions()
+		require.NoError(t, <-errCh)
+		require.Equal(t, int64(0), numL0Files(d))
+	})
+}
+
+func TestQuiesce(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{
+		FS:                    mem,
+		L0CompactionThreshold: 1,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	// listFiles lists the files in the DB directory, except for the WAL, which
+	// writes may continue to modify while the DB is quiesced.
+	listFiles := func() []string {
+		ls, err := mem.List("")
+		require.NoError(t, err)
+		var files []string
+		for _, f := range ls {
+			if !strings.HasSuffix(f, ".log") {
+				files = append(files, f)
+			}
+		}
+		sort.Strings(files)
+		return files
+	}
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	release, err := d.Quiesce()
+	require.NoError(t, err)
+	// The write was flushed.
+	require.Equal(t, int64(1), d.Metrics().Total().NumFiles)
+	files := listFiles()
+	_, err = d.Quiesce()
+	require.ErrorIs(t, err, ErrQuiesced)
+
+	// Writes are committed, but flushes wait for the DB to be released.
+	require.NoError(t, d.Set([]byte("b"), []byte("1"), nil))
+	errCh := make(chan error, 1)
+	go func() { errCh <- d.Flush() }()
+	select {
+	case err := <-errCh:
+		t.Fatalf("flush completed while quiesced: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.Equal(t, files, listFiles())
+
+	release()
+	require.NoError(t, <-errCh)
+	// Releasing twice is a no-op.
+	release()
+	require.NotEqual(t, files, listFiles())
+	v, closer, err := d.Get([]byte("b"))
+	require.NoError(t, err)
+	require.Equal(t, "1", string(v))
+	require.NoError(t, closer.Close())
+}
+
+func TestQuiesceRewrites(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		FormatMajorVersion:          FormatFlushableIngest,
+		DisableAutomaticCompactions: true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	for _, k := range []string{"a", "b"} {
+		require.NoError(t, d.Set([]byte(k), []byte("1"), nil))
+		require.NoError(t, d.Flush())
+	}
+	// Mark one of the sstables for compaction, which ratcheting to
+	// FormatPrePebblev1MarkedCompacted rewrites.
+	d.mu.Lock()
+	d.mu.versions.logLock()
+	vers := d.mu.versions.currentVersion()
+	iter := vers.Levels[0].Iter()
+	iter.First().MarkedForCompaction = true
+	vers.Stats.MarkedForCompaction++
+	vers.Levels[0].InvalidateAnnotation(markedForCompactionAnnotator{})
+	d.mu.versions.logUnlock()
+	d.mu.Unlock()
+
+	// Neither rewriting sstables nor the ratchet's rewrite compactions start
+	// while the DB is quiesced.
+	release, err := d.Quiesce()
+	require.NoError(t, err)
+	rewriteCh := make(chan error, 1)
+	go func() {
+		_, err := d.RewriteLevel(0, ZstdCompression)
+		rewriteCh <- err
+	}()
+	ratchetCh := make(chan error, 1)
+	go func() { ratchetCh <- d.RatchetFormatMajorVersion(FormatPrePebblev1MarkedCompacted) }()
+	select {
+	case err := <-rewriteCh:
+		t.Fatalf("rewrite completed while quiesced: %v", err)
+	case err := <-ratchetCh:
+		t.Fatalf("ratchet completed while quiesced: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.Equal(t, int64(0), d.Metrics().Compact.Count)
+
+	release()
+	require.NoError(t, <-rewriteCh)
+	require.NoError(t, <-ratchetCh)
+	require.Equal(t, FormatPrePebblev1MarkedCompacted, d.FormatMajorVersion())
+
+	// Rewrites fail while compactions are paused, as manual compactions do.
+	d.PauseCompactions()
+	_, err = d.RewriteLevel(0, SnappyCompression)
+	require.ErrorIs(t, err, ErrCompactionsPaused)
+	d.ResumeCompactions()
+}
+
+func TestPinRange(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                    vfs.NewMem(),
+		L0CompactionThreshold: 1,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	fileNums := func(level int) []FileNum {
+		tables, err := d.SSTables()
+		require.NoError(t, err)
+		var fileNums []FileNum
+		for _, info := range tables[level] {
+			fileNums = append(fileNums, info.FileNum)
+		}
+		return fileNums
+	}
+	flushKeys := func(keys ...string) {
+		for _, k := range keys {
+			require.NoError(t, d.Set([]byte(k), []byte(k), nil))
+		}
+		require.NoError(t, d.Flush())
+	}
+	flushKeys("a", "b")
+	require.NoError(t, d.Compact([]byte("a"), []byte("c"), false /* parallelize */))
+	flushKeys("y", "z")
+	require.NoError(t, d.Compact([]byte("y"), []byte("zz"), false /* parallelize */))
+	require.Empty(t, fileNums(0))
+	l6 := fileNums(6)
+	require.Len(t, l6, 2)
+
+	_, err = d.PinRange([]byte("c"), []byte("a"))
+	require.Error(t, err)
+	unpin, err := d.PinRange([]byte("a"), []byte("c"))
+	require.NoError(t, err)
+
+	// Sstables outside of the pinned range are compacted as usual.
+	flushKeys("y")
+	require.NoError(t, d.Compact([]byte("y"), []byte("zz"), false /* parallelize */))
+	require.Equal(t, l6[0], fileNums(6)[0])
+	require.NotEqual(t, l6[1], fileNums(6)[1])
+
+	// Flushes overlapping the pinned range proceed, but aren't compacted into
+	// the pinned sstable.
+	flushKeys("a")
+	errCh := make(chan error, 1)
+	go func() { errCh <- d.Compact([]byte("a"), []byte("c"), false /* parallelize */) }()
+	select {
+	case err := <-errCh:
+		t.Fatalf("manual compaction of a pinned range completed: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.Len(t, fileNums(0), 1)
+	require.Equal(t, l6[0], fileNums(6)[0])
+
+	unpin()
+	// Unpinning twice is a no-op.
+	unpin()
+	require.NoError(t, <-errCh)
+	require.Eventually(t, func() bool { return len(fileNums(0)) == 0 }, 10*time.Second, time.Millisecond)
+	require.NotEqual(t, l6[0], fileNums(6)[0])
+}
+
+func TestDeterministicCompaction(t *testing.T) {
+	// build writes and compacts the same keys in a new DB, returning the
+	// contents of its sstables by filename.
+	build := func() map[string][]byte {
+		fs := vfs.NewMem()
+		opts := &Options{
+			FS:                          fs,
+			DisableAutomaticCompactions: true,
+			DeterministicCompaction:     true,
+			MaxConcurrentCompactions:    func() int { return 4 },
+			FlushSplitBytes:             1 << 10,
+		}
+		opts.Levels = make([]LevelOptions, numLevels)
+		for i := range opts.Levels {
+			opts.Levels[i].TargetFileSize = 4 << 10
+		}
+		d, err := Open("", opts)
+		require.NoError(t, err)
+		for i := 0; i < 5; i++ {
+			for j := 0; j < 1000; j++ {
+				key := []byte(fmt.Sprintf("k%04d", (j*7+i)%1000))
+				require.NoError(t, d.Set(key, bytes.Repeat([]byte{byte(i)}, 100), nil))
+			}
+			require.NoError(t, d.DeleteRange([]byte(fmt.Sprintf("k%d", i)), []byte(fmt.Sprintf("k%d5", i)), nil))
+			require.NoError(t, d.Flush())
+		}
+		require.NoError(t, d.Compact([]byte("k"), []byte("l"), true /* parallelize */))
+
+		d.mu.Lock()
+		for _, level := range d.mu.versions.currentVersion().Levels {
+			iter := level.Iter()
+			for f := iter.First(); f != nil; f = iter.Next() {
+				require.Zero(t, f.CreationTime)
+			}
+		}
+		d.mu.Unlock()
+		require.NoError(t, d.Close())
+
+		files := make(map[string][]byte)
+		names, err := fs.List("")
+		require.NoError(t, err)
+		for _, name := range names {
+			if ft, _, ok := base.ParseFilename(fs, name); !ok || ft != base.FileTypeTable {
+				continue
+			}
+			f, err := fs.Open(name)
+			require.NoError(t, err)
+			var buf bytes.Buffer
+			_, err = buf.ReadFrom(f)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+			files[name] = buf.Bytes()
+		}
+		return files
+	}
+	files := build()
+	require.Greater(t, len(files), 1)
+	for i := 0; i < 3; i++ {
+		require.Equal(t, files, build())
+	}
+}
+
+func TestCompactionKeyCounts(t *testing.T) {
+	var infos []CompactionInfo
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		EventListener: &EventListener{
+			CompactionEnd: func(info CompactionInfo) { infos = append(infos, info) },
+		},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Write three versions of each of "a" and "b", the latter as MERGEs, and a
+	// SET and a DEL of "c", in separate sstables.
+	for i := 0; i < 3; i++ {
+		v := []byte(fmt.Sprint(i))
+		require.NoError(t, d.Set([]byte("a"), v, nil))
+		require.NoError(t, d.Merge([]byte("b"), v, nil))
+		if i == 0 {
+			require.NoError(t, d.Set([]byte("c"), v, nil))
+		} else if i == 1 {
+			require.NoError(t, d.Delete([]byte("c"), nil))
+		}
+		require.NoError(t, d.Flush())
+	}
+	require.NoError(t, d.Compact([]byte("a"), []byte("d"), false /* parallelize */))
+
+	// The two older versions of "a" and both keys of "c" are dropped, and the
+	// two older MERGEs of "b" are merged into the newest one.
+	require.Len(t, infos, 1)
+	require.Equal(t, uint64(8), infos[0].InputKeyCount)
+	require.Equal(t, uint64(2), infos[0].OutputKeyCount)
+	require.Equal(t, uint64(4), infos[0].DroppedKeyCount)
+}
+
+func TestCancelCompaction(t *testing.T) {
+	created := make(chan struct{})
+	release := make(chan struct{})
+	compactionErrs := make(chan error, 10)
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		EventListener: &EventListener{
+			TableCreated: func(info TableCreateInfo) {
+				if info.Reason == "compacting" {
+					created <- struct{}{}
+					<-release
+				}
+			},
+			CompactionEnd: func(info CompactionInfo) {
+				compactionErrs <- info.Err
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, d.Set([]byte("a"), []byte(strconv.Itoa(i)), nil))
+		require.NoError(t, d.Set([]byte("b"), []byte(strconv.Itoa(i)), nil))
+		require.NoError(t, d.Flush())
+	}
+	require.Empty(t, d.InProgressCompactions())
+	fingerprint := d.VersionFingerprint()
+
+	compactErr := make(chan error, 1)
+	go func() { compactErr <- d.Compact([]byte("a"), []byte("c"), false /* parallelize */) }()
+
+	// Wait for the compaction to begin writing its output.
+	<-created
+	descs := d.InProgressCompactions()
+	require.Len(t, descs, 1)
+	desc := descs[0]
+	require.Equal(t, "default", desc.Reason)
+	require.Equal(t, 6, desc.OutputLevel)
+	require.Equal(t, 0, desc.Input[0].Level)
+	require.Len(t, desc.Input[0].Tables, 2)
+	require.False(t, desc.StartTime.IsZero())
+
+	require.ErrorIs(t, d.CancelCompaction(desc.ID+1), ErrCompactionNotFound)
+	require.NoError(t, d.CancelCompaction(desc.ID))
+	release <- struct{}{}
+	require.ErrorIs(t, <-compactionErrs, ErrCancelledCompaction)
+
+	// DB.Compact retries the cancelled compaction, which is only possible if
+	// the inputs' compacting marks were released. The version is unchanged in
+	// the interim.
+	<-created
+	require.Equal(t, fingerprint, d.VersionFingerprint())
+	require.Equal(t, int64(2), d.Metrics().Levels[0].NumFiles)
+	descs = d.InProgressCompactions()
+	require.Len(t, descs, 1)
+	require.Greater(t, descs[0].ID, desc.ID)
+	require.Equal(t, desc.Input, descs[0].Input)
+	release <- struct{}{}
+	require.NoError(t, <-compactErr)
+	require.NoError(t, <-compactionErrs)
+	require.Equal(t, int64(0), d.Metrics().Levels[0].NumFiles)
+	require.Equal(t, int64(1), d.Metrics().Levels[6].NumFiles)
+
+	// The completed compaction can no longer be cancelled.
+	require.ErrorIs(t, d.CancelCompaction(descs[0].ID), ErrCompactionNotFound)
+	require.Empty(t, d.InProgressCompactions())
+}
+
+func TestCompactionDebugBreakpoint(t *testing.T) {
+	var jobIDs []JobID
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		CompactionDebugBreakpoint: func(outputKey []byte) bool {
+			return string(outputKey) == "c"
+		},
+		EventListener: &EventListener{
+			CompactionBegin: func(info CompactionInfo) {
+				jobIDs = append(jobIDs, JobID(info.JobID))
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Flushes don't pause.
+	for _, keys := range [][]string{{"a", "c"}, {"b", "c", "d"}} {
+		for _, k := range keys {
+			require.NoError(t, d.Set([]byte(k), nil, nil))
+		}
+		require.NoError(t, d.Flush())
+	}
+
+	compactErr := make(chan error, 1)
+	go func() { compactErr <- d.Compact([]byte("a"), []byte("f"), false /* parallelize */) }()
+	b := <-d.CompactionBreakpoints()
+	require.Equal(t, "c", string(b.OutputKey))
+	require.Equal(t, jobIDs, []JobID{b.JobID})
+	// The compaction is in progress, and its inputs are unchanged.
+	require.Len(t, d.InProgressCompactions(), 1)
+	require.Equal(t, int64(2), d.Metrics().Levels[0].NumFiles)
+	require.Equal(t, int64(0), d.Metrics().Levels[6].NumFiles)
+	b.Resume()
+	require.NoError(t, <-compactErr)
+	require.Equal(t, int64(0), d.Metrics().Levels[0].NumFiles)
+	require.Equal(t, int64(1), d.Metrics().Levels[6].NumFiles)
+
+	// Closing the DB resumes a paused compaction.
+	require.NoError(t, d.Set([]byte("c"), nil, nil))
+	require.NoError(t, d.Flush())
+	go func() { compactErr <- d.Compact([]byte("a"), []byte("f"), false /* parallelize */) }()
+	<-d.CompactionBreakpoints()
+}
+
+func TestCompactionProgressFunc(t *testing.T) {
+	var progress []CompactionProgress
+	var jobIDs []JobID
+	opts := &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		CompactionProgressFunc: func(p CompactionProgress) {
+			p.OutputKey = slices.Clone(p.OutputKey)
+			progress = append(progress, p)
+		},
+		EventListener: &EventListener{
+			CompactionBegin: func(info CompactionInfo) {
+				jobIDs = append(jobIDs, JobID(info.JobID))
+			},
+		},
+	}
+	opts.private.compactionProgressInterval = time.Nanosecond
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Flushes don't report progress.
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 1000; j++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("k%04d", j)), bytes.Repeat([]byte{'v'}, 100), nil))
+		}
+		require.NoError(t, d.Flush())
+	}
+	require.Empty(t, progress)
+
+	require.NoError(t, d.Compact([]byte("k"), []byte("l"), false /* parallelize */))
+	require.Len(t, jobIDs, 1)
+	// The output keys are reported every compactionProgressCheckKeys keys.
+	require.Len(t, progress, 1000/compactionProgressCheckKeys)
+	for i, p := range progress {
+		require.Equal(t, jobIDs[0], p.JobID)
+		require.Equal(t, 6, p.OutputLevel)
+		require.Equal(t, fmt.Sprintf("k%04d", (i+1)*compactionProgressCheckKeys-1), string(p.OutputKey))
+		require.Greater(t, p.BytesRead, uint64(0))
+		if i > 0 {
+			require.Greater(t, p.BytesRead, progress[i-1].BytesRead)
+			require.GreaterOrEqual(t, p.BytesWritten, progress[i-1].BytesWritten)
+			require.GreaterOrEqual(t, p.Elapsed, progress[i-1].Elapsed)
+		}
+	}
+}
+
+func TestMaxCompactionInputFiles(t *testing.T) {
+	// run compacts ten disjoint L0 files and returns the compaction metrics.
+	run := func(maxInputFiles int) (count int64, inputFiles uint64, maxFiles int) {
+		d, err := Open("", &Options{
+			FS:                          vfs.NewMem(),
+			DisableAutomaticCompactions: true,
+			MaxCompactionInputFiles:     maxInputFiles,
+		})
+		require.NoError(t, err)
+		defer func() { require.NoError(t, d.Close()) }()
+		for i := 0; i < 10; i++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("k%d", i)), nil, nil))
+			require.NoError(t, d.Flush())
+		}
+		require.NoError(t, d.Compact([]byte("k"), []byte("l"), false /* parallelize */))
+		m := d.Metrics()
+		require.Equal(t, int64(0), m.Levels[0].NumFiles)
+		snap := m.Snapshot()
+		require.Equal(t, m.Compact.InputFiles, snap.CompactInputFiles)
+		require.Equal(t, m.Compact.MaxInputFiles, snap.CompactMaxInputFiles)
+		return m.Compact.Count, m.Compact.InputFiles, m.Compact.MaxInputFiles
+	}
+
+	count, inputFiles, maxFiles := run(0)
+	require.Equal(t, int64(1), count)
+	require.Equal(t, uint64(10), inputFiles)
+	require.Equal(t, 10, maxFiles)
+
+	count, inputFiles, maxFiles = run(4)
+	require.Equal(t, int64(3), count)
+	require.Equal(t, uint64(10), inputFiles)
+	require.Equal(t, 4, maxFiles)
+}
@@ -24,6 +24,9 @@ type Successor = base.Successor
 // Split exports the base.Split type.
 type Split = base.Split
 
+// CompareRangeSuffixes exports the base.CompareRangeSuffixes type.
+type CompareRangeSuffixes = base.CompareRangeSuffixes
+
 // Comparer exports the base.Comparer type.
 type Comparer = base.Comparer
 
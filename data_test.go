@@ -719,7 +719,7 @@ func runCompactCmd(td *datadriven.TestData, d *DB) error {
 		if err != nil {
 			return err
 		}
-		return d.manualCompact(iStart.UserKey, iEnd.UserKey, level, parallelize)
+		return d.manualCompact(iStart.UserKey, iEnd.UserKey, level, CompactOptions{Parallelize: parallelize})
 	}
 	return d.Compact([]byte(parts[0]), []byte(parts[1]), parallelize)
 }
@@ -6,15 +6,20 @@
 package pebble // import "github.com/cockroachdb/pebble"
 
 import (
+	"cmp"
 	"context"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"slices"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/batchrepr"
 	"github.com/cockroachdb/pebble/internal/arenaskl"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/invalidating"
@@ -54,6 +59,12 @@ var (
 	// ErrReadOnly is returned when a write operation is performed on a read-only
 	// database.
 	ErrReadOnly = errors.New("pebble: read-only")
+	// ErrDiskFull is returned when a write operation is performed while the
+	// free space on the disk is below Options.MinFreeDiskBytes.
+	ErrDiskFull = errors.New("pebble: insufficient free disk space")
+	// ErrBatchExceedsMaxSize is returned when a batch larger than
+	// Options.MaxBatchSize is applied.
+	ErrBatchExceedsMaxSize = errors.New("pebble: batch exceeds Options.MaxBatchSize")
 	// errNoSplit indicates that the user is trying to perform a range key
 	// operation but the configured Comparer does not provide a Split
 	// implementation.
@@ -275,9 +286,25 @@ type DB struct {
 	// batches written to the WAL, without the overhead of the record
 	// envelopes.
 	logBytesIn atomic.Uint64
+	// The cumulative count of committed keys of each kind. See
+	// Metrics.Keys.WrittenKindsCount.
+	writtenKindsCount [InternalKeyKindMax + 1]atomic.Uint64
+
+	// The seek distances of closed iterators, reported by
+	// Metrics.SeekDistanceHistogram.
+	seekDistances seekDistanceCounts
+
+	// The number of retries of reads of remote objects, and the number of
+	// reads that failed with retryable errors regardless, reported by
+	// Metrics.ObjStore.
+	objStoreReadRetries atomic.Uint64
+	objStoreFailedReads atomic.Uint64
 
 	// The number of bytes available on disk.
 	diskAvailBytes atomic.Uint64
+	// The time (in nanoseconds since the epoch) at which the commit path last
+	// refreshed diskAvailBytes. Only used when Options.MinFreeDiskBytes is set.
+	diskAvailCheckedAt atomic.Int64
 
 	cacheID        uint64
 	dirname        string
@@ -290,6 +317,9 @@ type DB struct {
 	// The threshold for determining when a batch is "large" and will skip being
 	// inserted into a memtable.
 	largeBatchThreshold uint64
+	// rangeStats counts the reads and writes of the ranges defined by
+	// Options.RangeStatsBuckets, or is nil if there are none.
+	rangeStats *rangeStats
 	// The current OPTIONS file number.
 	optionsFileNum base.DiskFileNum
 	// The on-disk size of the current OPTIONS file.
@@ -300,6 +330,9 @@ type DB struct {
 
 	fileLock *Lock
 	dataDir  vfs.File
+	// openDirKey is the key of the DB's data directory in openDirs, which is
+	// removed by Close.
+	openDirKey string
 
 	tableCache           *tableCacheContainer
 	newIters             tableNewIters
@@ -317,6 +350,16 @@ type DB struct {
 	closed   *atomic.Value
 	closedCh chan struct{}
 
+	// l0WriteStalled is set while batch commits and ingestions are stalled by
+	// Options.L0ResumeWritesThreshold, so that waitForL0Headroom only acquires
+	// d.mu while they are. It's only modified with d.mu held, by
+	// updateL0WriteStallLocked.
+	l0WriteStalled atomic.Bool
+
+	// compactionBreakpoints receives the compactions paused by
+	// Options.CompactionDebugBreakpoint.
+	compactionBreakpoints chan *CompactionBreakpoint
+
 	cleanupManager *cleanupManager
 
 	// During an iterator close, we may asynchronously schedule read compactions.
@@ -420,6 +463,20 @@ type DB struct {
 			cond sync.Cond
 			// True when a flush is in progress.
 			flushing bool
+			// True when compactions are paused. See DB.PauseCompactions.
+			paused bool
+			// True when the DB is quiesced, pausing flushes, compactions and
+			// ingestions. See DB.Quiesce.
+			quiesced bool
+			// The number of in-progress ingestions, which DB.Quiesce waits for.
+			ingestingCount int
+			// The number of in-progress DB.DropKeysBelow calls, which
+			// DB.Quiesce waits for. Unlike ingestions, they don't wait for
+			// flushes once counted.
+			droppingKeysCount int
+			// The maximum number of concurrent compactions chosen the last time
+			// compactions were scheduled. See maxConcurrentCompactionsLocked.
+			concurrency int
 			// The number of ongoing non-download compactions.
 			compactingCount int
 			// The number of download compactions.
@@ -439,6 +496,9 @@ type DB struct {
 			// map may have already committed an edit to the version but are
 			// lingering performing cleanup, like deleting obsolete files.
 			inProgress map[*compaction]struct{}
+			// nextID is the CompactionID most recently assigned to an
+			// in-progress compaction.
+			nextID CompactionID
 
 			// rescheduleReadCompaction indicates to an iterator that a read compaction
 			// should be scheduled.
@@ -466,6 +526,9 @@ type DB struct {
 		snapshots struct {
 			// The list of active snapshots.
 			snapshotList
+			// The set of EventuallyFileOnlySnapshots that are file-only
+			// snapshots, each of which pins a version.
+			fileOnly map[*EventuallyFileOnlySnapshot]struct{}
 
 			// The cumulative count and size of snapshot-pinned keys written to
 			// sstables.
@@ -473,6 +536,16 @@ type DB struct {
 			cumulativePinnedSize  uint64
 		}
 
+		// coldData caches the result of the last scan for cold files. See
+		// checkColdData.
+		coldData struct {
+			// candidates are the cold files stored locally, largest first.
+			candidates []coldDataCandidate
+			// size is the total size of the cold files, whether or not they
+			// have been demoted to shared storage.
+			size uint64
+		}
+
 		tableStats struct {
 			// Condition variable used to signal the completion of a
 			// job to collect table stats.
@@ -491,6 +564,16 @@ type DB struct {
 			pending []manifest.NewFileEntry
 		}
 
+		// l0WriteStall holds the statistics of the stall of batch commits and
+		// ingestions imposed by Options.L0ResumeWritesThreshold. See
+		// waitForL0Headroom.
+		l0WriteStall struct {
+			// count and duration are the cumulative number of stalled commits
+			// and ingestions, and the time they spent stalled.
+			count    uint64
+			duration time.Duration
+		}
+
 		tableValidation struct {
 			// cond is a condition variable used to signal the completion of a
 			// job to validate one or more sstables.
@@ -527,7 +610,7 @@ func (d *DB) TestOnlyWaitForCleaning() {
 // slice will remain valid until the returned Closer is closed. On success, the
 // caller MUST call closer.Close() or a memory leak will occur.
 func (d *DB) Get(key []byte) ([]byte, io.Closer, error) {
-	return d.getInternal(key, nil /* batch */, nil /* snapshot */)
+	return d.getInternal(key, nil /* batch */, nil /* snapshot */, 0 /* maxMergeOperands */)
 }
 
 type getIterAlloc struct {
@@ -542,7 +625,9 @@ var getIterAllocPool = sync.Pool{
 	},
 }
 
-func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer, error) {
+func (d *DB) getInternal(
+	key []byte, b *Batch, s *Snapshot, maxMergeOperands int,
+) ([]byte, io.Closer, error) {
 	if err := d.closed.Load(); err != nil {
 		panic(err)
 	}
@@ -551,19 +636,63 @@ func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer,
 	// files in the associated version from being deleted if there is a current
 	// compaction. The readState is unref'd by Iterator.Close().
 	readState := d.loadReadState()
-
-	// Determine the seqnum to read at after grabbing the read state (current and
-	// memtables) above.
 	var seqNum uint64
 	if s != nil {
 		seqNum = s.seqNum
-	} else {
-		seqNum = d.mu.versions.visibleSeqNum.Load()
 	}
+	return d.getWithReadState(key, b, readState, false /* pinned */, seqNum, maxMergeOperands)
+}
 
-	buf := getIterAllocPool.Get().(*getIterAlloc)
+// getWithReadState is like getInternal, but reads the given readState as of
+// seqNum or, if seqNum is zero, the current visible seqnum. The returned
+// Closer unrefs the readState, unless it's pinned by a ReadSession.
+func (d *DB) getWithReadState(
+	key []byte, b *Batch, readState *readState, pinned bool, seqNum uint64, maxMergeOperands int,
+) ([]byte, io.Closer, error) {
+	d.rangeStats.recordRead(key)
 
+	buf := getIterAllocPool.Get().(*getIterAlloc)
 	get := &buf.get
+	d.initGetIter(get, key, b, seqNum, readState)
+
+	i := &buf.dbi
+	pointIter := get
+	*i = Iterator{
+		ctx:             context.Background(),
+		getIterAlloc:    buf,
+		iter:            pointIter,
+		pointIter:       pointIter,
+		merge:           d.merge,
+		comparer:        *d.opts.Comparer,
+		readState:       readState,
+		readStatePinned: pinned,
+		keyBuf:          buf.keyBuf,
+	}
+	i.opts.MaxMergeOperands = maxMergeOperands
+
+	if !i.First() {
+		err := i.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrNotFound
+	}
+	return i.Value(), i, nil
+}
+
+// initGetIter initializes get to iterate over the records of key in the batch
+// b and readState, newest first, as of seqNum or, if seqNum is zero, the
+// current visible seqnum. The readState must be grabbed before calling
+// initGetIter.
+func (d *DB) initGetIter(
+	get *getIter, key []byte, b *Batch, seqNum uint64, readState *readState,
+) {
+	// Determine the seqnum to read at after grabbing the read state (current and
+	// memtables).
+	if seqNum == 0 {
+		seqNum = d.mu.versions.visibleSeqNum.Load()
+	}
+
 	*get = getIter{
 		comparer: d.opts.Comparer,
 		newIters: d.newIters,
@@ -595,30 +724,230 @@ func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer,
 		}
 		get.mem = get.mem[:n-1]
 	}
+}
 
-	i := &buf.dbi
-	pointIter := get
-	*i = Iterator{
-		ctx:          context.Background(),
-		getIterAlloc: buf,
-		iter:         pointIter,
-		pointIter:    pointIter,
-		merge:        d.merge,
-		comparer:     *d.opts.Comparer,
-		readState:    readState,
-		keyBuf:       buf.keyBuf,
+// ReadOptions configures a read performed by DB.GetWithOptions.
+type ReadOptions struct {
+	// RawMergeOperands, if true, returns the unmerged operands of a key whose
+	// newest record is a MERGE in GetResult.MergeOperands, rather than running
+	// the Merger to compute its value. It's intended for debugging. If the
+	// newest record of the key is not a MERGE, GetWithOptions returns
+	// ErrNotFound if the key is deleted and an error otherwise.
+	RawMergeOperands bool
+	// MaxMergeOperands, if positive, bounds the number of MERGE records of the
+	// key that are merged, or returned if RawMergeOperands is set. If the key's
+	// chain of MERGE records exceeds it, GetWithOptions returns
+	// ErrTooManyMergeOperands rather than processing the whole chain.
+	MaxMergeOperands int
+}
+
+// GetResult is the result of DB.GetWithOptions.
+type GetResult struct {
+	// Value is the value of the key. It's nil if ReadOptions.RawMergeOperands
+	// is set.
+	Value []byte
+	// MergeOperands are the operands of the key, in the order they were
+	// applied, if ReadOptions.RawMergeOperands is set. If the oldest MERGE is
+	// preceded by a SET, the value of the SET is the first operand.
+	MergeOperands [][]byte
+}
+
+// GetWithOptions is like Get, but configured by o.
+//
+// The caller should not modify the contents of the returned slices. They will
+// remain valid until the returned Closer is closed. On success, the caller
+// MUST call closer.Close() or a memory leak will occur.
+func (d *DB) GetWithOptions(key []byte, o *ReadOptions) (GetResult, io.Closer, error) {
+	if o == nil {
+		o = &ReadOptions{}
+	}
+	if !o.RawMergeOperands {
+		value, closer, err := d.getInternal(key, nil /* batch */, nil /* snapshot */, o.MaxMergeOperands)
+		return GetResult{Value: value}, closer, err
+	}
+	operands, err := d.getMergeOperands(key, o.MaxMergeOperands)
+	if err != nil {
+		return GetResult{}, nil, err
 	}
+	return GetResult{MergeOperands: operands}, noopCloser{}, nil
+}
 
-	if !i.First() {
-		err := i.Close()
+// getMergeOperands returns copies of the operands of key, whose newest record
+// must be a MERGE, in application order. Like the merge of MERGE records
+// performed by iterators, it accumulates MERGE records newest first until a
+// record of another kind is reached, but returns the operands instead of
+// finishing the merge. If maxMergeOperands is positive and the key has more
+// MERGE records, it returns ErrTooManyMergeOperands.
+func (d *DB) getMergeOperands(key []byte, maxMergeOperands int) (operands [][]byte, err error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	d.rangeStats.recordRead(key)
+	readState := d.loadReadState()
+	defer readState.unref()
+	var get getIter
+	d.initGetIter(&get, key, nil /* batch */, 0 /* seqNum */, readState)
+	defer func() {
+		err = firstError(err, get.Close())
+	}()
+
+	kv := get.First()
+	switch {
+	case kv == nil:
+		if err := get.Error(); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotFound
+	case kv.Kind() == InternalKeyKindDelete || kv.Kind() == InternalKeyKindSingleDelete ||
+		kv.Kind() == InternalKeyKindDeleteSized:
+		return nil, ErrNotFound
+	case kv.Kind() != InternalKeyKindMerge:
+		return nil, errors.Errorf("pebble: newest record of key %s is a %s, not a MERGE",
+			d.opts.Comparer.FormatKey(key), kv.Kind())
+	}
+	appendValue := func(kv *base.InternalKV) error {
+		v, _, err := kv.Value(nil)
 		if err != nil {
-			return nil, nil, err
+			return err
 		}
-		return nil, nil, ErrNotFound
+		operands = append(operands, append([]byte(nil), v...))
+		return nil
 	}
-	return i.Value(), i, nil
+	for ; kv != nil && kv.Kind() == InternalKeyKindMerge; kv = get.Next() {
+		if maxMergeOperands > 0 && len(operands) == maxMergeOperands {
+			return nil, ErrTooManyMergeOperands
+		}
+		if err := appendValue(kv); err != nil {
+			return nil, err
+		}
+	}
+	if kv == nil {
+		if err := get.Error(); err != nil {
+			return nil, err
+		}
+	} else if kv.Kind() == InternalKeyKindSet || kv.Kind() == InternalKeyKindSetWithDelete {
+		if err := appendValue(kv); err != nil {
+			return nil, err
+		}
+	}
+	slices.Reverse(operands)
+	return operands, nil
+}
+
+// VersionedValue is an internal record of a key, as returned by
+// DB.GetVersions.
+type VersionedValue struct {
+	// Value is the value of the record. It's nil for point deletions.
+	Value []byte
+	// SeqNum is the sequence number of the record.
+	SeqNum uint64
+	// Kind is the kind of the record, such as InternalKeyKindSet or
+	// InternalKeyKindMerge.
+	Kind InternalKeyKind
+}
+
+// GetVersions returns up to n of the newest internal records of key that are
+// visible, in decreasing sequence number order, rather than only the value
+// that Get would return. It stops after the first point deletion, which is
+// included, since older records are deleted. Records deleted by a range
+// deletion are not returned. GetVersions returns ErrNotFound if there are no
+// such records.
+//
+// Keys may only have multiple records in the LSM until compactions drop the
+// records shadowed by newer ones that aren't needed by open snapshots, so the
+// records returned for a key depend on the shape of the LSM as well as on
+// the writes to the key. The values are copies, which the caller owns.
+func (d *DB) GetVersions(key []byte, n int) (versions []VersionedValue, err error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if n <= 0 {
+		return nil, errors.Errorf("pebble: invalid number of versions %d", n)
+	}
+	d.rangeStats.recordRead(key)
+	readState := d.loadReadState()
+	defer readState.unref()
+	var get getIter
+	d.initGetIter(&get, key, nil /* batch */, 0 /* seqNum */, readState)
+	defer func() {
+		err = firstError(err, get.Close())
+	}()
+
+	for kv := get.First(); kv != nil && len(versions) < n; kv = get.Next() {
+		version := VersionedValue{SeqNum: kv.SeqNum(), Kind: kv.Kind()}
+		switch kv.Kind() {
+		case InternalKeyKindDelete, InternalKeyKindSingleDelete, InternalKeyKindDeleteSized:
+			return append(versions, version), nil
+		}
+		v, _, err := kv.Value(nil)
+		if err != nil {
+			return nil, err
+		}
+		version.Value = append([]byte(nil), v...)
+		versions = append(versions, version)
+	}
+	if err := get.Error(); err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, ErrNotFound
+	}
+	return versions, nil
 }
 
+// MayContain returns false if the DB definitely doesn't contain key, and true
+// if it may. It's a cheap, probabilistic alternative to Get for when false
+// positives are tolerable: it looks the key up in the memtables, but only
+// consults the filters of the sstables whose bounds contain the key, without
+// reading their data blocks. An sstable without a filter, such as one in a
+// level configured without a FilterPolicy, may always contain the key.
+//
+// MayContain is conservative. A key that's deleted, whether by a point or a
+// range deletion, may still be reported as present, as may a key whose
+// lookup encounters an error.
+func (d *DB) MayContain(key []byte) bool {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	readState := d.loadReadState()
+	defer readState.unref()
+
+	for _, mem := range readState.memtables {
+		m, ok := mem.flushable.(*memTable)
+		if !ok {
+			// Ingested sstables waiting to be flushed.
+			return true
+		}
+		iter := m.newIter(nil)
+		kv := iter.SeekGE(key, base.SeekGEFlagsNone)
+		found := kv != nil && d.equal(kv.K.UserKey, key)
+		if err := iter.Close(); err != nil || found {
+			return true
+		}
+	}
+
+	prefix := key[:d.opts.Comparer.Split(key)]
+	for level := range readState.current.Levels {
+		overlaps := readState.current.Overlaps(level, base.UserKeyBoundsInclusive(key, key))
+		iter := overlaps.Iter()
+		for m := iter.First(); m != nil; m = iter.Next() {
+			if !m.HasPointKeys || d.cmp(key, m.SmallestPointKey.UserKey) < 0 ||
+				d.cmp(key, m.LargestPointKey.UserKey) > 0 {
+				continue
+			}
+			if mayContain, err := d.tableCache.mayContainPrefix(m, prefix); err != nil || mayContain {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// noopCloser is an io.Closer for results that don't retain any resources.
+type noopCloser struct{}
+
+func (noopCloser) Close() error { return nil }
+
 // Set sets the value for the given key. It overwrites any previous value
 // for that key; a DB is not a multi-map.
 //
@@ -691,7 +1020,10 @@ func (d *DB) SingleDelete(key []byte, opts *WriteOptions) error {
 // returns.
 func (d *DB) DeleteRange(start, end []byte, opts *WriteOptions) error {
 	b := newBatch(d)
-	_ = b.DeleteRange(start, end, opts)
+	if err := b.DeleteRange(start, end, opts); err != nil {
+		_ = b.Close()
+		return err
+	}
 	if err := d.Apply(b, opts); err != nil {
 		return err
 	}
@@ -737,7 +1069,10 @@ func (d *DB) LogData(data []byte, opts *WriteOptions) error {
 // It is safe to modify the contents of the arguments after RangeKeySet returns.
 func (d *DB) RangeKeySet(start, end, suffix, value []byte, opts *WriteOptions) error {
 	b := newBatch(d)
-	_ = b.RangeKeySet(start, end, suffix, value, opts)
+	if err := b.RangeKeySet(start, end, suffix, value, opts); err != nil {
+		_ = b.Close()
+		return err
+	}
 	if err := d.Apply(b, opts); err != nil {
 		return err
 	}
@@ -755,7 +1090,10 @@ func (d *DB) RangeKeySet(start, end, suffix, value []byte, opts *WriteOptions) e
 // returns.
 func (d *DB) RangeKeyUnset(start, end, suffix []byte, opts *WriteOptions) error {
 	b := newBatch(d)
-	_ = b.RangeKeyUnset(start, end, suffix, opts)
+	if err := b.RangeKeyUnset(start, end, suffix, opts); err != nil {
+		_ = b.Close()
+		return err
+	}
 	if err := d.Apply(b, opts); err != nil {
 		return err
 	}
@@ -772,7 +1110,30 @@ func (d *DB) RangeKeyUnset(start, end, suffix []byte, opts *WriteOptions) error
 // returns.
 func (d *DB) RangeKeyDelete(start, end []byte, opts *WriteOptions) error {
 	b := newBatch(d)
-	_ = b.RangeKeyDelete(start, end, opts)
+	if err := b.RangeKeyDelete(start, end, opts); err != nil {
+		_ = b.Close()
+		return err
+	}
+	if err := d.Apply(b, opts); err != nil {
+		return err
+	}
+	// Only release the batch on success.
+	return b.Close()
+}
+
+// DeleteRangeAndRangeKeys deletes all of the point keys and all of the range
+// keys in the range [start,end) (inclusive on start, exclusive on end). It is
+// a convenience for wiping a span entirely, equivalent to atomically applying
+// both DeleteRange and RangeKeyDelete over the span.
+//
+// It is safe to modify the contents of the arguments after
+// DeleteRangeAndRangeKeys returns.
+func (d *DB) DeleteRangeAndRangeKeys(start, end []byte, opts *WriteOptions) error {
+	b := newBatch(d)
+	if err := b.DeleteRangeAndRangeKeys(start, end, opts); err != nil {
+		_ = b.Close()
+		return err
+	}
 	if err := d.Apply(b, opts); err != nil {
 		return err
 	}
@@ -789,6 +1150,28 @@ func (d *DB) RangeKeyDelete(start, end []byte, opts *WriteOptions) error {
 //
 // Apply returns ErrInvalidBatch if the provided batch is invalid in any way.
 func (d *DB) Apply(batch *Batch, opts *WriteOptions) error {
+	_, err := d.applyInternal(batch, opts, false)
+	return err
+}
+
+// ApplyResult describes the outcome of DB.ApplyWithResult.
+type ApplyResult struct {
+	// SeqNum is the sequence number assigned to the first record of the batch.
+	// Subsequent records are assigned subsequent sequence numbers. It is zero
+	// if the batch was empty.
+	SeqNum uint64
+	// Synced is true if the batch is known to have been synced to the WAL by
+	// the time ApplyWithResult returned. That's the case if the batch was
+	// applied with WriteOptions.Sync, and may be the case without it if the
+	// batch was group committed with, or otherwise preceded in the WAL by, a
+	// batch whose sync completed. Synced is false for empty batches.
+	Synced bool
+}
+
+// ApplyWithResult is like Apply, but also reports the sequence number
+// assigned to the batch and whether the batch is known to be durable. See
+// ApplyResult.
+func (d *DB) ApplyWithResult(batch *Batch, opts *WriteOptions) (ApplyResult, error) {
 	return d.applyInternal(batch, opts, false)
 }
 
@@ -808,11 +1191,97 @@ func (d *DB) ApplyNoSyncWait(batch *Batch, opts *WriteOptions) error {
 	if !opts.Sync {
 		return errors.Errorf("cannot request asynchonous apply when WriteOptions.Sync is false")
 	}
-	return d.applyInternal(batch, opts, true)
+	_, err := d.applyInternal(batch, opts, true)
+	return err
+}
+
+// ApplyChunked applies the operations contained in a large batch to the DB in
+// parts of about chunkBytes bytes each, in order, so that the whole batch
+// needn't be committed at once. Each part is applied atomically as with Apply,
+// but the batch as a whole is not: concurrent readers may observe some of the
+// parts but not others, and if ApplyChunked returns an error, the parts
+// preceding the failed one remain applied. A single operation larger than
+// chunkBytes is applied by itself. chunkBytes must be positive, and must not
+// exceed Options.MaxBatchSize, if set.
+//
+// The batch must not be indexed, and is not modified: the caller remains
+// responsible for closing it.
+func (d *DB) ApplyChunked(batch *Batch, chunkBytes int, opts *WriteOptions) error {
+	if batch.index != nil {
+		return errors.New("pebble: cannot apply an indexed batch in chunks")
+	}
+	if chunkBytes <= 0 {
+		return errors.Errorf("pebble: invalid chunk size %d", chunkBytes)
+	}
+	if d.opts.MaxBatchSize > 0 && chunkBytes > d.opts.MaxBatchSize {
+		return errors.Errorf("pebble: chunk size %d exceeds Options.MaxBatchSize %d",
+			chunkBytes, d.opts.MaxBatchSize)
+	}
+	// Each chunk is a copy of a run of the batch's records, prefixed by a batch
+	// header. The copies are not reused, since a large chunk may be retained by
+	// the flushable queue after being applied.
+	var chunk []byte
+	var count uint32
+	apply := func() error {
+		batchrepr.SetCount(chunk, count)
+		b := d.NewBatch()
+		defer b.Close()
+		if err := b.SetRepr(chunk); err != nil {
+			return err
+		}
+		chunk, count = nil, 0
+		return d.Apply(b, opts)
+	}
+	for r := batch.Reader(); len(r) > 0; {
+		rec := r
+		kind, _, _, ok, err := r.Next()
+		if !ok {
+			return err
+		}
+		rec = rec[:len(rec)-len(r)]
+		if chunk != nil && len(chunk)+len(rec) > chunkBytes {
+			if err := apply(); err != nil {
+				return err
+			}
+		}
+		if chunk == nil {
+			chunk = make([]byte, batchrepr.HeaderLen, batchrepr.HeaderLen+min(chunkBytes, len(r)+len(rec)))
+		}
+		chunk = append(chunk, rec...)
+		// LogData records aren't assigned a sequence number, and so aren't
+		// included in the count of the batch header.
+		if kind != InternalKeyKindLogData {
+			count++
+		}
+	}
+	if chunk == nil {
+		return nil
+	}
+	return apply()
+}
+
+// diskAvailCheckInterval is the minimum interval between refreshes of the free
+// disk space estimate performed by the commit path.
+const diskAvailCheckInterval = time.Second
+
+// checkFreeDiskSpace returns ErrDiskFull if the free space on the disk is
+// below Options.MinFreeDiskBytes. The free space estimate is refreshed at most
+// once per diskAvailCheckInterval by the commit path; flushes, compactions and
+// file deletions refresh it too.
+func (d *DB) checkFreeDiskSpace() error {
+	now := d.timeNow().UnixNano()
+	if last := d.diskAvailCheckedAt.Load(); now-last >= int64(diskAvailCheckInterval) &&
+		d.diskAvailCheckedAt.CompareAndSwap(last, now) {
+		d.calculateDiskAvailableBytes()
+	}
+	if d.diskAvailBytes.Load() < uint64(d.opts.MinFreeDiskBytes) {
+		return ErrDiskFull
+	}
+	return nil
 }
 
 // REQUIRES: noSyncWait => opts.Sync
-func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) error {
+func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) (ApplyResult, error) {
 	if err := d.closed.Load(); err != nil {
 		panic(err)
 	}
@@ -823,15 +1292,27 @@ func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) er
 		panic("pebble: batch already applied")
 	}
 	if d.opts.ReadOnly {
-		return ErrReadOnly
+		return ApplyResult{}, ErrReadOnly
 	}
 	if batch.db != nil && batch.db != d {
 		panic(fmt.Sprintf("pebble: batch db mismatch: %p != %p", batch.db, d))
 	}
+	if d.opts.MaxBatchSize > 0 && batch.Len() > d.opts.MaxBatchSize {
+		return ApplyResult{}, errors.Wrapf(ErrBatchExceedsMaxSize, "%d > %d bytes",
+			batch.Len(), d.opts.MaxBatchSize)
+	}
+	if d.opts.MinFreeDiskBytes > 0 {
+		if err := d.checkFreeDiskSpace(); err != nil {
+			return ApplyResult{}, err
+		}
+	}
+	if err := d.waitForL0Headroom(opts.GetContext()); err != nil {
+		return ApplyResult{}, err
+	}
 
 	sync := opts.GetSync()
 	if sync && d.opts.DisableWAL {
-		return errors.New("pebble: WAL disabled")
+		return ApplyResult{}, errors.New("pebble: WAL disabled")
 	}
 
 	if fmv := d.FormatMajorVersion(); fmv < batch.minimumFormatMajorVersion {
@@ -843,28 +1324,37 @@ func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) er
 
 	if batch.countRangeKeys > 0 {
 		if d.split == nil {
-			return errNoSplit
+			return ApplyResult{}, errNoSplit
 		}
 	}
 	batch.committing = true
 
 	if batch.db == nil {
 		if err := batch.refreshMemTableSize(); err != nil {
-			return err
+			return ApplyResult{}, err
 		}
 	}
 	if batch.memTableSize >= d.largeBatchThreshold {
 		var err error
 		batch.flushable, err = newFlushableBatch(batch, d.opts.Comparer)
 		if err != nil {
-			return err
+			return ApplyResult{}, err
 		}
 	}
+	d.rangeStats.recordBatch(batch)
 	if err := d.commit.Commit(batch, sync, noSyncWait); err != nil {
+		if errors.Is(err, errInvalidSeqNumAllocation) {
+			return ApplyResult{}, err
+		}
 		// There isn't much we can do on an error here. The commit pipeline will be
 		// horked at this point.
 		d.opts.Logger.Fatalf("pebble: fatal commit error: %v", err)
 	}
+	var res ApplyResult
+	if !batch.Empty() {
+		res.SeqNum = batch.SeqNum()
+		res.Synced = d.commit.synced(res.SeqNum, batch.Count())
+	}
 	// If this is a large batch, we need to clear the batch contents as the
 	// flushable batch may still be present in the flushables queue.
 	//
@@ -875,7 +1365,7 @@ func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) er
 	if batch.flushable != nil {
 		batch.data = nil
 	}
-	return nil
+	return res, nil
 }
 
 func (d *DB) commitApply(b *Batch, mem *memTable) error {
@@ -888,6 +1378,17 @@ func (d *DB) commitApply(b *Batch, mem *memTable) error {
 		return err
 	}
 
+	// If this is the first batch applied to the memtable, record its time and,
+	// if the database is configured to bound the age of memtable entries,
+	// schedule a delayed flush.
+	if mem.oldestEntryTime.Load() == 0 &&
+		mem.oldestEntryTime.CompareAndSwap(0, d.timeNow().UnixNano()) &&
+		d.opts.MemTableMaxAge > 0 {
+		d.mu.Lock()
+		d.maybeScheduleDelayedFlush(mem, d.opts.MemTableMaxAge)
+		d.mu.Unlock()
+	}
+
 	// If the batch contains range tombstones and the database is configured
 	// to flush range deletions, schedule a delayed flush so that disk space
 	// may be reclaimed without additional writes or an explicit flush.
@@ -914,6 +1415,32 @@ func (d *DB) commitApply(b *Batch, mem *memTable) error {
 	return nil
 }
 
+// recordWrittenKeys adds the number of keys of each kind within the batch to
+// d.writtenKindsCount, and raises the high-water marks of the sizes of the
+// keys and values committed to the DB to those of the batch.
+func (d *DB) recordWrittenKeys(b *Batch) {
+	var counts [InternalKeyKindMax + 1]uint64
+	var maxKeySize, maxValueSize uint64
+	for r := b.Reader(); ; {
+		kind, ukey, value, ok, err := r.Next()
+		if !ok || err != nil {
+			break
+		}
+		if kind <= InternalKeyKindMax {
+			counts[kind]++
+		}
+		keySize, valueSize := writtenKeySizes(kind, ukey, value)
+		maxKeySize = max(maxKeySize, keySize)
+		maxValueSize = max(maxValueSize, valueSize)
+	}
+	for kind, n := range counts {
+		if n > 0 {
+			d.writtenKindsCount[kind].Add(n)
+		}
+	}
+	d.mu.versions.raiseMaxKeySizes(maxKeySize, maxValueSize)
+}
+
 func (d *DB) commitWrite(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*memTable, error) {
 	var size int64
 	repr := b.Repr()
@@ -967,6 +1494,9 @@ func (d *DB) commitWrite(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*mem
 	if err != nil {
 		return nil, err
 	}
+	if !b.ingestedSSTBatch {
+		d.recordWrittenKeys(b)
+	}
 	if d.opts.DisableWAL {
 		return mem, nil
 	}
@@ -1016,6 +1546,9 @@ type snapshotIterOpts struct {
 	seqNum    uint64
 	vers      *version
 	readState *readState
+	// readStatePinned is set if readState is pinned by a ReadSession for the
+	// lifetime of the iterator, which then doesn't reference it.
+	readStatePinned bool
 }
 
 type batchIterOpts struct {
@@ -1024,6 +1557,8 @@ type batchIterOpts struct {
 type newIterOpts struct {
 	snapshot snapshotIterOpts
 	batch    batchIterOpts
+	// mergedSources are merged beneath the LSM. See DB.NewMergedIter.
+	mergedSources []*mergedSourceIter
 }
 
 // newIter constructs a new iterator, merging in batch iterators as an extra
@@ -1063,7 +1598,9 @@ func (d *DB) newIter(
 		if internalOpts.snapshot.vers == nil {
 			if internalOpts.snapshot.readState != nil {
 				readState = internalOpts.snapshot.readState
-				readState.ref()
+				if !internalOpts.snapshot.readStatePinned {
+					readState.ref()
+				}
 			} else {
 				// NB: loadReadState() calls readState.ref().
 				readState = d.loadReadState()
@@ -1092,6 +1629,7 @@ func (d *DB) newIter(
 		merge:               d.merge,
 		comparer:            *d.opts.Comparer,
 		readState:           readState,
+		readStatePinned:     internalOpts.snapshot.readStatePinned,
 		version:             internalOpts.snapshot.vers,
 		keyBuf:              buf.keyBuf,
 		prefixOrFullSeekKey: buf.prefixOrFullSeekKey,
@@ -1100,7 +1638,12 @@ func (d *DB) newIter(
 		newIters:            newIters,
 		newIterRangeKey:     newIterRangeKey,
 		seqNum:              seqNum,
+		readsSnapshot:       internalOpts.snapshot.seqNum != 0,
 		batchOnlyIter:       internalOpts.batch.batchOnly,
+		mergedSources:       internalOpts.mergedSources,
+	}
+	if !internalOpts.batch.batchOnly {
+		dbi.rangeStats = d.rangeStats
 	}
 	if o != nil {
 		dbi.opts = *o
@@ -1152,7 +1695,7 @@ func finishInitializingIter(ctx context.Context, buf *iterAlloc) *Iterator {
 	}
 
 	if dbi.opts.rangeKeys() {
-		dbi.rangeKeyMasking.init(dbi, dbi.comparer.Compare, dbi.comparer.Split)
+		dbi.rangeKeyMasking.init(dbi, &dbi.comparer)
 
 		// When iterating over both point and range keys, don't create the
 		// range-key iterator stack immediately if we can avoid it. This
@@ -1426,6 +1969,7 @@ func (i *Iterator) constructPointIter(
 			numMergingLevels++
 			numLevelIters++
 		}
+		numMergingLevels += len(i.mergedSources)
 	}
 
 	if numMergingLevels > cap(mlevels) {
@@ -1501,6 +2045,27 @@ func (i *Iterator) constructPointIter(
 			}
 			addLevelIterForFiles(current.Levels[level].Iter(), manifest.Level(level))
 		}
+
+		// Last are the sources merged by DB.NewMergedIter, which rank below
+		// the LSM.
+		for _, src := range i.mergedSources {
+			src.SetBounds(i.opts.LowerBound, i.opts.UpperBound)
+			mlevels[mlevelsIndex].iter = src
+			mlevelsIndex++
+		}
+	}
+	if i.opts.Tracer != nil {
+		for j := range mlevels {
+			label := "memtable"
+			if mlevels[j].levelIter != nil {
+				label = mlevels[j].levelIter.level.String()
+			} else if mlevels[j].iter == internalIterator(&i.batchPointIter) {
+				label = "batch"
+			} else if _, ok := mlevels[j].iter.(*mergedSourceIter); ok {
+				label = "merged-source"
+			}
+			mlevels[j].iter = newTracingIter(mlevels[j].iter, mlevels[j].levelIter, label, i.opts.Tracer)
+		}
 	}
 	buf.merging.init(&i.opts, &i.stats.InternalStats, i.comparer.Compare, i.comparer.Split, mlevels...)
 	if len(mlevels) <= cap(buf.levelsPositioned) {
@@ -1509,6 +2074,9 @@ func (i *Iterator) constructPointIter(
 	buf.merging.snapshot = i.seqNum
 	buf.merging.batchSnapshot = i.batchSeqNum
 	buf.merging.combinedIterState = &i.lazyCombinedIter.combinedIterState
+	if i.readState != nil && i.readState.db.opts.RecordSeekDistances {
+		buf.merging.seekDistances = &i.seekDistances
+	}
 	i.pointIter = invalidating.MaybeWrapIfInvariants(&buf.merging).(topLevelIterator)
 	i.merging = &buf.merging
 }
@@ -1620,6 +2188,9 @@ func (d *DB) Close() error {
 	if err := d.closed.Load(); err != nil {
 		panic(err)
 	}
+	// Another DB may be opened in the directory once this one is closed,
+	// whether or not closing it succeeds.
+	defer unregisterOpenDir(d.openDirKey)
 
 	// Clear the finalizer that is used to check that an unreferenced DB has been
 	// closed. We're closing the DB here, so the check performed by that
@@ -1630,6 +2201,8 @@ func (d *DB) Close() error {
 
 	d.closed.Store(errors.WithStack(ErrClosed))
 	close(d.closedCh)
+	// Wake up any commits or ingestions stalled in waitForL0Headroom.
+	d.mu.compact.cond.Broadcast()
 
 	defer d.opts.Cache.Unref()
 
@@ -1741,8 +2314,32 @@ func (d *DB) Close() error {
 	return err
 }
 
+// CompactOptions configures a manual compaction performed by
+// DB.CompactWithOptions.
+type CompactOptions struct {
+	// Parallelize splits the compaction of each level into compactions of
+	// non-overlapping key ranges that may run concurrently.
+	Parallelize bool
+	// OutputMetadata, if non-nil, is the table metadata to attach to every
+	// sstable written by the compaction, replacing the metadata of its inputs.
+	// It may be read back with DB.SSTables through SSTableInfo.Metadata, and is
+	// carried over by later compactions according to
+	// Options.MergeTableMetadata. Its encoding may not exceed
+	// MaxTableMetadataSize.
+	//
+	// Setting OutputMetadata forces the tables in the range to be rewritten,
+	// including those in the bottommost level.
+	OutputMetadata map[string]string
+}
+
 // Compact the specified range of keys in the database.
 func (d *DB) Compact(start, end []byte, parallelize bool) error {
+	return d.CompactWithOptions(start, end, CompactOptions{Parallelize: parallelize})
+}
+
+// CompactWithOptions compacts the specified range of keys in the database, as
+// configured by opts.
+func (d *DB) CompactWithOptions(start, end []byte, opts CompactOptions) error {
 	if err := d.closed.Load(); err != nil {
 		panic(err)
 	}
@@ -1753,6 +2350,10 @@ func (d *DB) Compact(start, end []byte, parallelize bool) error {
 		return errors.Errorf("Compact start %s is not less than end %s",
 			d.opts.Comparer.FormatKey(start), d.opts.Comparer.FormatKey(end))
 	}
+	if n := len(encodeTableMetadata(opts.OutputMetadata)); n > MaxTableMetadataSize {
+		return errors.Errorf("pebble: table metadata is %d bytes, exceeding the maximum of %d",
+			n, MaxTableMetadataSize)
+	}
 
 	d.mu.Lock()
 	maxLevelWithFiles := 1
@@ -1813,8 +2414,7 @@ func (d *DB) Compact(start, end []byte, parallelize bool) error {
 
 	for level := 0; level < maxLevelWithFiles; {
 		for {
-			if err := d.manualCompact(
-				start, end, level, parallelize); err != nil {
+			if err := d.manualCompact(start, end, level, opts); err != nil {
 				if errors.Is(err, ErrCancelledCompaction) {
 					continue
 				}
@@ -1823,16 +2423,18 @@ func (d *DB) Compact(start, end []byte, parallelize bool) error {
 			break
 		}
 		level++
-		if level == numLevels-1 {
+		if level == numLevels-1 && opts.OutputMetadata == nil {
 			// A manual compaction of the bottommost level occurred.
-			// There is no next level to try and compact.
+			// There is no next level to try and compact. Tables that
+			// were already in the bottommost level must still be
+			// rewritten to attach OutputMetadata, however.
 			break
 		}
 	}
 	return nil
 }
 
-func (d *DB) manualCompact(start, end []byte, level int, parallelize bool) error {
+func (d *DB) manualCompact(start, end []byte, level int, opts CompactOptions) error {
 	d.mu.Lock()
 	curr := d.mu.versions.currentVersion()
 	files := curr.Overlaps(level, base.UserKeyBoundsInclusive(start, end))
@@ -1840,10 +2442,16 @@ func (d *DB) manualCompact(start, end []byte, level int, parallelize bool) error
 		d.mu.Unlock()
 		return nil
 	}
+	if d.mu.compact.paused && !d.opts.QueueManualCompactionsWhilePaused {
+		d.mu.Unlock()
+		return ErrCompactionsPaused
+	}
 
 	var compactions []*manualCompaction
-	if parallelize {
+	if opts.Parallelize {
 		compactions = append(compactions, d.splitManualCompaction(start, end, level)...)
+	} else if d.opts.MaxCompactionInputFiles > 0 {
+		compactions = append(compactions, d.splitManualCompactionByInputFiles(start, end, level)...)
 	} else {
 		compactions = append(compactions, &manualCompaction{
 			level: level,
@@ -1852,6 +2460,9 @@ func (d *DB) manualCompact(start, end []byte, level int, parallelize bool) error
 			end:   end,
 		})
 	}
+	for _, c := range compactions {
+		c.outputMetadata = opts.OutputMetadata
+	}
 	d.mu.compact.manual = append(d.mu.compact.manual, compactions...)
 	d.maybeScheduleCompaction()
 	d.mu.Unlock()
@@ -1871,6 +2482,418 @@ func (d *DB) manualCompact(start, end []byte, level int, parallelize bool) error
 	return nil
 }
 
+// PauseCompactions stops the scheduling of new compactions, including
+// automatic, manual, delete-only and download compactions, and waits for
+// in-progress compactions to complete. Flushes continue to be scheduled, so
+// writes are not stalled until L0 reaches Options.L0StopWritesThreshold.
+// Manual compactions requested while paused either fail with
+// ErrCompactionsPaused or are queued, according to
+// Options.QueueManualCompactionsWhilePaused.
+//
+// Combined with DB.DisableFileDeletions, this is useful to freeze the shape of
+// the LSM, for example while taking a backup. Calling PauseCompactions while
+// compactions are already paused is a no-op.
+func (d *DB) PauseCompactions() {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mu.compact.paused = true
+	for d.mu.compact.compactingCount > 0 || d.mu.compact.downloadingCount > 0 {
+		d.mu.compact.cond.Wait()
+	}
+}
+
+// ResumeCompactions resumes the scheduling of compactions paused by
+// PauseCompactions, including any manual compactions queued in the interim.
+// Calling ResumeCompactions while compactions are not paused is a no-op.
+func (d *DB) ResumeCompactions() {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.mu.compact.paused {
+		return
+	}
+	d.mu.compact.paused = false
+	// Wake up any callers waiting for compactions to be allowed; see
+	// waitForCompactionsAllowedLocked.
+	d.mu.compact.cond.Broadcast()
+	d.maybeScheduleCompaction()
+}
+
+// waitForCompactionsAllowedLocked waits until compactions may be scheduled, for
+// callers that schedule compactions directly rather than queueing manual
+// compactions. It waits while the DB is quiesced, and while compactions are
+// paused if Options.QueueManualCompactionsWhilePaused is set; otherwise it
+// returns ErrCompactionsPaused if compactions are paused. DB.mu must be held,
+// and is dropped while waiting.
+func (d *DB) waitForCompactionsAllowedLocked() error {
+	for {
+		if err := d.closed.Load(); err != nil {
+			return err.(error)
+		}
+		if d.mu.compact.paused && !d.opts.QueueManualCompactionsWhilePaused {
+			return ErrCompactionsPaused
+		}
+		if !d.mu.compact.quiesced && !d.mu.compact.paused {
+			return nil
+		}
+		d.mu.compact.cond.Wait()
+	}
+}
+
+// ErrQuiesced is returned by DB.Quiesce if the DB is already quiesced.
+var ErrQuiesced = errors.New("pebble: DB is already quiesced")
+
+// Quiesce brings the DB to a consistent on-disk state and holds it there until
+// the returned release function is called, for example while an external
+// filesystem or VM snapshot is taken. Quiesce flushes the memtables, pauses
+// flushes, compactions, ingestions and file deletions, waits for any that are
+// in progress to complete and syncs the data directory. Until release is
+// called, no sstables, manifests or OPTIONS files are created, modified or
+// deleted.
+//
+// Writes continue to be committed to the WAL and memtable while the DB is
+// quiesced, but stall once the memtables are full. Operations that wait for a
+// flush, compaction or ingestion, such as DB.Flush, DB.Compact and DB.Ingest,
+// block until release is called. Unlike PauseCompactions, Quiesce also stops
+// flushes.
+//
+// Only one call to Quiesce may be in effect at a time; others return
+// ErrQuiesced. The release function must be called before the DB is closed,
+// and calls after the first are no-ops.
+func (d *DB) Quiesce() (release func(), _ error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return nil, ErrReadOnly
+	}
+	d.mu.Lock()
+	quiesced := d.mu.compact.quiesced
+	d.mu.Unlock()
+	if quiesced {
+		// Flushing would block until the DB is released.
+		return nil, ErrQuiesced
+	}
+	if err := d.Flush(); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	if d.mu.compact.quiesced {
+		d.mu.Unlock()
+		return nil, ErrQuiesced
+	}
+	// Stop scheduling flushes and compactions and admitting ingestions, and
+	// wait for those in progress to complete. Memtables that filled up since
+	// the flush above remain in memory.
+	d.mu.compact.quiesced = true
+	for d.mu.compact.flushing || d.mu.compact.compactingCount > 0 ||
+		d.mu.compact.downloadingCount > 0 || d.mu.compact.ingestingCount > 0 ||
+		d.mu.compact.droppingKeysCount > 0 {
+		d.mu.compact.cond.Wait()
+	}
+	d.disableFileDeletions()
+	d.mu.Unlock()
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			d.mu.compact.quiesced = false
+			d.enableFileDeletions()
+			d.mu.compact.cond.Broadcast()
+			d.maybeScheduleFlush()
+			d.maybeScheduleCompaction()
+		})
+	}
+	if err := d.dataDir.Sync(); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// PinRange marks the sstables overlapping the key range [start, end) at any
+// level as ineligible for compaction, so that they remain in the LSM unchanged
+// until the returned unpin function is called. PinRange first waits for any
+// in-progress compactions of these sstables to complete.
+//
+// Compactions that would include a pinned sstable are not picked, including
+// manual compactions, downloads and delete-only compactions, which wait until
+// the sstable is unpinned. Compactions of other sstables in the same level are
+// picked as usual, although L0 compactions may be delayed if the preferred L0
+// compaction would include a pinned sstable. Flushes and ingestions are not
+// affected: sstables they add to the range aren't pinned, but they are blocked
+// from compacting into a level with pinned sstables. Ingestions that excise a
+// pinned sstable are also not prevented.
+//
+// The unpin function makes the sstables eligible for compaction again, unless
+// they're pinned by another call. It may be called more than once.
+func (d *DB) PinRange(start, end []byte) (unpin func(), _ error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.cmp(start, end) >= 0 {
+		return nil, errors.Errorf("pebble: invalid pinned range [%q, %q)", start, end)
+	}
+	bounds := base.UserKeyBoundsEndExclusive(start, end)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var pinned []*fileMetadata
+	for {
+		pinned = pinned[:0]
+		compacting := false
+		vers := d.mu.versions.currentVersion()
+		for level := range vers.Levels {
+			overlaps := vers.Overlaps(level, bounds)
+			iter := overlaps.Iter()
+			for f := iter.First(); f != nil; f = iter.Next() {
+				compacting = compacting || f.IsCompacting()
+				pinned = append(pinned, f)
+			}
+		}
+		if !compacting {
+			break
+		}
+		d.mu.compact.cond.Wait()
+	}
+	for _, f := range pinned {
+		f.PinCount++
+	}
+	var unpinned bool
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if unpinned {
+			return
+		}
+		unpinned = true
+		for _, f := range pinned {
+			f.PinCount--
+		}
+		// Wake up any compactions or callers waiting for the files.
+		d.mu.compact.cond.Broadcast()
+		d.maybeScheduleCompaction()
+	}, nil
+}
+
+// CompactionID identifies an in-progress compaction. IDs are unique for the
+// lifetime of a DB, but are not persisted across restarts.
+type CompactionID uint64
+
+// CompactionDescriptor describes an in-progress compaction. See
+// DB.InProgressCompactions.
+type CompactionDescriptor struct {
+	ID CompactionID
+	// Reason is the kind of the compaction, as in CompactionInfo.Reason.
+	Reason string
+	// Input contains the levels and tables being compacted.
+	Input []LevelInfo
+	// OutputLevel is the level the compaction is writing to.
+	OutputLevel int
+	// BytesWritten is the number of bytes written to the compaction's output
+	// tables so far.
+	BytesWritten int64
+	// StartTime is the time the compaction began.
+	StartTime time.Time
+}
+
+// ErrCompactionNotFound is returned by DB.CancelCompaction if there is no
+// in-progress compaction with the given ID, or if the compaction has already
+// been applied to the LSM.
+var ErrCompactionNotFound = errors.New("pebble: compaction not found")
+
+// InProgressCompactions returns a description of each in-progress
+// compaction, in the order they were started. Flushes are not included.
+// Compactions that have already been applied to the LSM and are only
+// cleaning up are not included either.
+func (d *DB) InProgressCompactions() []CompactionDescriptor {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var descs []CompactionDescriptor
+	for c := range d.mu.compact.inProgress {
+		if c.kind == compactionKindFlush || c.kind == compactionKindIngestedFlushable || c.versionEditApplied {
+			continue
+		}
+		info := c.makeInfo(0 /* jobID */)
+		descs = append(descs, CompactionDescriptor{
+			ID:           c.id,
+			Reason:       info.Reason,
+			Input:        info.Input,
+			OutputLevel:  info.Output.Level,
+			BytesWritten: c.bytesWritten.Load(),
+			StartTime:    c.beganAt,
+		})
+	}
+	slices.SortFunc(descs, func(a, b CompactionDescriptor) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return descs
+}
+
+// CancelCompaction aborts the in-progress compaction with the given ID. The
+// compaction stops at its next output table boundary, or before being applied
+// to the LSM, whichever comes first; its outputs are deleted, the version is
+// left unchanged, and its input tables become eligible for compaction again.
+// CancelCompaction does not wait for the compaction to stop.
+//
+// A cancelled automatic compaction may be picked again immediately, and a
+// cancelled manual compaction requested through DB.Compact is retried. Use
+// DB.PauseCompactions to prevent compactions from being rescheduled.
+//
+// ErrCompactionNotFound is returned if there is no such compaction or it has
+// already been applied to the LSM.
+func (d *DB) CancelCompaction(id CompactionID) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// The cancel bool may only be written by holders of the manifest lock.
+	// Acquiring it ensures the compaction is either yet to check the bool
+	// before applying its version edit, or has already applied it.
+	d.mu.versions.logLock()
+	defer d.mu.versions.logUnlock()
+	for c := range d.mu.compact.inProgress {
+		if c.id != id {
+			continue
+		}
+		if c.kind == compactionKindFlush || c.kind == compactionKindIngestedFlushable || c.versionEditApplied {
+			break
+		}
+		c.cancel.Store(true)
+		return nil
+	}
+	return ErrCompactionNotFound
+}
+
+// CompactL0Stats describes the work performed by DB.CompactL0.
+type CompactL0Stats struct {
+	// StartSublevels is the number of L0 sublevels when CompactL0 was called.
+	StartSublevels int
+	// EndSublevels is the number of L0 sublevels when CompactL0 returned.
+	EndSublevels int
+	// Compactions is the number of manual L0 compactions that CompactL0
+	// scheduled.
+	Compactions int
+}
+
+// ErrL0CompactionStalled is returned by DB.CompactL0 when an L0 compaction
+// fails to reduce the number of L0 sublevels.
+var ErrL0CompactionStalled = errors.New("pebble: L0 compactions are not reducing L0 sublevels")
+
+// CompactL0 proactively flattens L0, for example in preparation for a
+// read-latency-sensitive period. It repeatedly schedules manual compactions of
+// L0 into Lbase until the number of L0 sublevels drops below
+// Options.L0CompactionThreshold, blocking until the target is reached, an
+// error occurs, or ctx is canceled. If a compaction leaves no fewer sublevels
+// than before it, for example because flushes are adding sublevels as fast as
+// they are compacted away, CompactL0 gives up and returns
+// ErrL0CompactionStalled.
+//
+// The manual compactions are scheduled through the same queue as DB.Compact
+// and are picked alongside automatic compactions: files that are already
+// being compacted by an automatic compaction are not picked again, and the
+// sublevel count is recomputed after every compaction so that L0 compactions
+// that completed concurrently count towards the target.
+//
+// If ctx is canceled, a manual compaction that has not yet started is removed
+// from the queue; one that has already started runs to completion in the
+// background.
+func (d *DB) CompactL0(ctx context.Context) (CompactL0Stats, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	var stats CompactL0Stats
+	if d.opts.ReadOnly {
+		return stats, ErrReadOnly
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats.StartSublevels = len(d.mu.versions.currentVersion().L0SublevelFiles)
+	prevSublevels := -1
+	for {
+		cur := d.mu.versions.currentVersion()
+		stats.EndSublevels = len(cur.L0SublevelFiles)
+		if stats.EndSublevels < d.opts.L0CompactionThreshold || cur.Levels[0].Empty() {
+			return stats, nil
+		}
+		if prevSublevels >= 0 && stats.EndSublevels >= prevSublevels {
+			// The last compaction made no progress; give up rather than
+			// spinning.
+			return stats, ErrL0CompactionStalled
+		}
+		prevSublevels = stats.EndSublevels
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		if d.mu.compact.paused && !d.opts.QueueManualCompactionsWhilePaused {
+			return stats, ErrCompactionsPaused
+		}
+
+		// Compact the entire user key span of L0.
+		iter := cur.Levels[0].Iter()
+		var start, end []byte
+		for f := iter.First(); f != nil; f = iter.Next() {
+			if start == nil || d.cmp(f.Smallest.UserKey, start) < 0 {
+				start = f.Smallest.UserKey
+			}
+			if end == nil || d.cmp(f.Largest.UserKey, end) > 0 {
+				end = f.Largest.UserKey
+			}
+		}
+		manual := &manualCompaction{
+			level: 0,
+			done:  make(chan error, 1),
+			start: start,
+			end:   end,
+		}
+		d.mu.compact.manual = append(d.mu.compact.manual, manual)
+		stats.Compactions++
+		d.maybeScheduleCompaction()
+
+		d.mu.Unlock()
+		var err error
+		select {
+		case err = <-manual.done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		d.mu.Lock()
+
+		if ctx.Err() != nil {
+			// Remove the compaction from the queue if it hasn't been picked
+			// yet.
+			for i := range d.mu.compact.manual {
+				if d.mu.compact.manual[i] == manual {
+					d.mu.compact.manual = append(d.mu.compact.manual[:i], d.mu.compact.manual[i+1:]...)
+					break
+				}
+			}
+			stats.EndSublevels = len(d.mu.versions.currentVersion().L0SublevelFiles)
+			return stats, err
+		}
+		if errors.Is(err, ErrCancelledCompaction) {
+			// The compaction was cancelled (e.g. by a concurrent ingestion);
+			// retry without counting it against the progress check.
+			prevSublevels = -1
+		} else if err != nil {
+			stats.EndSublevels = len(d.mu.versions.currentVersion().L0SublevelFiles)
+			return stats, err
+		}
+	}
+}
+
 // splitManualCompaction splits a manual compaction over [start,end] on level
 // such that the resulting compactions have no key overlap.
 func (d *DB) splitManualCompaction(
@@ -1895,6 +2918,49 @@ func (d *DB) splitManualCompaction(
 	return splitCompactions
 }
 
+// splitManualCompactionByInputFiles splits a manual compaction of the key
+// range [start, end] of the given level into compactions of contiguous key
+// ranges with at most Options.MaxCompactionInputFiles input files each. The
+// key ranges are groups of consecutive in-use key ranges of the level and
+// the output level, which a single in-use key range may exceed.
+func (d *DB) splitManualCompactionByInputFiles(
+	start, end []byte, level int,
+) (splitCompactions []*manualCompaction) {
+	curr := d.mu.versions.currentVersion()
+	outputLevel := min(level+1, numLevels-1)
+	if level == 0 {
+		outputLevel = d.mu.versions.picker.getBaseLevel()
+	}
+	keyRanges := curr.CalculateInuseKeyRanges(level, outputLevel, start, end)
+	var inputFiles int
+	for _, keyRange := range keyRanges {
+		levelFiles := curr.Overlaps(level, keyRange)
+		if levelFiles.Empty() {
+			// The key range is only in use in the output level.
+			continue
+		}
+		n := levelFiles.Len()
+		if outputLevel != level {
+			outputFiles := curr.Overlaps(outputLevel, keyRange)
+			n += outputFiles.Len()
+		}
+		if len(splitCompactions) > 0 && inputFiles+n <= d.opts.MaxCompactionInputFiles {
+			splitCompactions[len(splitCompactions)-1].end = keyRange.End.Key
+			inputFiles += n
+			continue
+		}
+		splitCompactions = append(splitCompactions, &manualCompaction{
+			level: level,
+			done:  make(chan error, 1),
+			start: keyRange.Start,
+			end:   keyRange.End.Key,
+			split: true,
+		})
+		inputFiles = n
+	}
+	return splitCompactions
+}
+
 // Flush the memtable to stable storage.
 func (d *DB) Flush() error {
 	flushDone, err := d.AsyncFlush()
@@ -1929,6 +2995,12 @@ func (d *DB) AsyncFlush() (<-chan struct{}, error) {
 	return flushed, nil
 }
 
+// MetricsSnapshot returns a JSON-serializable snapshot of the database's
+// metrics. It is equivalent to d.Metrics().Snapshot().
+func (d *DB) MetricsSnapshot() MetricsSnapshot {
+	return d.Metrics().Snapshot()
+}
+
 // Metrics returns metrics about the database.
 func (d *DB) Metrics() *Metrics {
 	metrics := &Metrics{}
@@ -1939,10 +3011,14 @@ func (d *DB) Metrics() *Metrics {
 	*metrics = d.mu.versions.metrics
 	metrics.Compact.EstimatedDebt = d.mu.versions.picker.estimatedCompactionDebt(0)
 	metrics.Compact.InProgressBytes = d.mu.versions.atomicInProgressBytes.Load()
+	metrics.Compact.Paused = d.mu.compact.paused
+	metrics.Compact.Concurrency = d.mu.compact.concurrency
 	// TODO(radu): split this to separate the download compactions.
 	metrics.Compact.NumInProgress = int64(d.mu.compact.compactingCount + d.mu.compact.downloadingCount)
 	metrics.Compact.MarkedFiles = vers.Stats.MarkedForCompaction
 	metrics.Compact.Duration = d.mu.compact.duration
+	metrics.L0WriteStall.Count = d.mu.l0WriteStall.count
+	metrics.L0WriteStall.Duration = d.mu.l0WriteStall.duration
 	for c := range d.mu.compact.inProgress {
 		if c.kind != compactionKindFlush {
 			metrics.Compact.Duration += d.timeNow().Sub(c.beganAt)
@@ -1951,11 +3027,19 @@ func (d *DB) Metrics() *Metrics {
 
 	for _, m := range d.mu.mem.queue {
 		metrics.MemTable.Size += m.totalBytes()
+		if mem, ok := m.flushable.(*memTable); ok {
+			if t := mem.oldestEntryTime.Load(); t != 0 {
+				age := d.timeNow().Sub(time.Unix(0, t))
+				metrics.MemTable.OldestEntryAge = max(metrics.MemTable.OldestEntryAge, age)
+			}
+		}
 	}
 	metrics.Snapshots.Count = d.mu.snapshots.count()
 	if metrics.Snapshots.Count > 0 {
 		metrics.Snapshots.EarliestSeqNum = d.mu.snapshots.earliest()
+		metrics.SnapshotPinnedBytes = snapshotPinnedBytes(vers, metrics.Snapshots.EarliestSeqNum)
 	}
+	metrics.ColdDataBytes = d.mu.coldData.size
 	metrics.Snapshots.PinnedKeys = d.mu.snapshots.cumulativePinnedCount
 	metrics.Snapshots.PinnedSize = d.mu.snapshots.cumulativePinnedSize
 	metrics.MemTable.Count = int64(len(d.mu.mem.queue))
@@ -1981,7 +3065,8 @@ func (d *DB) Metrics() *Metrics {
 
 	if p := d.mu.versions.picker; p != nil {
 		compactions := d.getInProgressCompactionInfoLocked(nil)
-		for level, score := range p.getScores(compactions) {
+		scores, _ := p.getScores(compactions)
+		for level, score := range scores {
 			metrics.Levels[level].Score = score
 		}
 	}
@@ -1997,6 +3082,14 @@ func (d *DB) Metrics() *Metrics {
 	// TODO(jackson): Consider making these metrics optional.
 	metrics.Keys.RangeKeySetsCount = countRangeKeySetFragments(vers)
 	metrics.Keys.TombstoneCount = countTombstones(vers)
+	for kind := range metrics.Keys.WrittenKindsCount {
+		metrics.Keys.WrittenKindsCount[kind] = d.writtenKindsCount[kind].Load()
+	}
+	metrics.Keys.MaxKeySize = d.mu.versions.maxKeySize.Load()
+	metrics.Keys.MaxValueSize = d.mu.versions.maxValueSize.Load()
+	metrics.SeekDistanceHistogram = d.seekDistances.load()
+	metrics.ObjStore.ReadRetries = d.objStoreReadRetries.Load()
+	metrics.ObjStore.FailedRetryableReads = d.objStoreFailedReads.Load()
 
 	d.mu.versions.logLock()
 	metrics.private.manifestFileSize = uint64(d.mu.versions.manifest.Size())
@@ -2032,10 +3125,40 @@ func (d *DB) Metrics() *Metrics {
 	metrics.SecondaryCacheMetrics = d.objProvider.Metrics()
 
 	metrics.Uptime = d.timeNow().Sub(d.openedAt)
+	metrics.DiskAvailBytes = d.diskAvailBytes.Load()
 
 	return metrics
 }
 
+// CompactionScores returns the compaction score of each level, indexed by
+// level, as computed by the compaction picker for the current version and the
+// in-progress compactions. These are the scores reported by
+// Metrics.Levels[i].Score: a level with a score of at least 1 is a candidate
+// for a score-based compaction. CompactionScores also returns the level that
+// the picker prioritizes when picking the next score-based compaction, or -1
+// if no level needs compacting. The picker may still pick a compaction from a
+// lower-priority level, for example if the level's files are already being
+// compacted.
+//
+// CompactionScores doesn't schedule a compaction. It's useful for tuning
+// options such as TargetFileSize and LBaseMaxBytes by observing which level
+// is the bottleneck.
+func (d *DB) CompactionScores() (scores []float64, level int) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	scores = make([]float64, numLevels)
+	level = -1
+	if p := d.mu.versions.picker; p != nil {
+		var levelScores [numLevels]float64
+		levelScores, level = p.getScores(d.getInProgressCompactionInfoLocked(nil))
+		copy(scores, levelScores[:])
+	}
+	return scores, level
+}
+
 // sstablesOptions hold the optional parameters to retrieve TableInfo for all sstables.
 type sstablesOptions struct {
 	// set to true will return the sstable properties in TableInfo
@@ -2120,6 +3243,16 @@ type SSTableInfo struct {
 	// Properties is the sstable properties of this table. If Virtual is true,
 	// then the Properties are associated with the backing sst.
 	Properties *sstable.Properties
+	// Metadata is the table metadata attached to this table by
+	// CompactOptions.OutputMetadata or Options.MergeTableMetadata, or nil if it
+	// has none. It's only populated when the WithProperties option is used. If
+	// Virtual is true, then the Metadata is associated with the backing sst.
+	Metadata map[string]string
+	// ContentHash is the hash of the sstable's keys and values recorded when
+	// Options.ComputeTableContentHash is set, or empty if it has none. It's
+	// only populated when the WithProperties option is used, and is always
+	// empty for virtual sstables, which hold a subset of their backing's keys.
+	ContentHash string
 }
 
 // SSTables retrieves the current sstables. The returned slice is indexed by
@@ -2174,6 +3307,12 @@ func (d *DB) SSTables(opts ...SSTablesOption) ([][]SSTableInfo, error) {
 					return nil, err
 				}
 				destTables[j].Properties = p
+				if destTables[j].Metadata, err = decodeTableMetadata(p.UserProperties); err != nil {
+					return nil, err
+				}
+				if !m.Virtual {
+					destTables[j].ContentHash = p.ContentHash
+				}
 			}
 			destTables[j].Virtual = m.Virtual
 			destTables[j].BackingSSTNum = m.FileBacking.DiskFileNum
@@ -2226,6 +3365,48 @@ func (d *DB) SSTables(opts ...SSTablesOption) ([][]SSTableInfo, error) {
 	return destLevels, nil
 }
 
+// VersionFingerprint returns a hash of the sstables that make up the current
+// version of the LSM. For every level, the hash incorporates each file's file
+// number, smallest and largest keys and sequence number range, in the order in
+// which they appear in the level.
+//
+// Two stores whose LSMs contain the same files, as is the case for stores
+// restored from the same snapshot, have the same fingerprint. The fingerprint
+// is cheap to compute and can be used to detect divergence between replicas
+// that should be identical; a mismatch says nothing about whether the stores
+// contain the same logical data.
+func (d *DB) VersionFingerprint() uint64 {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	h := xxhash.New()
+	var buf []byte
+	appendKey := func(buf []byte, k InternalKey) []byte {
+		buf = binary.AppendUvarint(buf, uint64(len(k.UserKey)))
+		buf = append(buf, k.UserKey...)
+		return binary.LittleEndian.AppendUint64(buf, k.Trailer)
+	}
+	v := d.mu.versions.currentVersion()
+	for level := range v.Levels {
+		buf = binary.AppendUvarint(buf[:0], uint64(level))
+		buf = binary.AppendUvarint(buf, uint64(v.Levels[level].Len()))
+		_, _ = h.Write(buf)
+		iter := v.Levels[level].Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			buf = binary.AppendUvarint(buf[:0], uint64(f.FileNum))
+			buf = appendKey(buf, f.Smallest)
+			buf = appendKey(buf, f.Largest)
+			buf = binary.AppendUvarint(buf, f.SmallestSeqNum)
+			buf = binary.AppendUvarint(buf, f.LargestSeqNum)
+			_, _ = h.Write(buf)
+		}
+	}
+	return h.Sum64()
+}
+
 // EstimateDiskUsage returns the estimated filesystem space used in bytes for
 // storing the range `[start, end]`. The estimation is computed as follows:
 //
@@ -2514,6 +3695,67 @@ func (d *DB) maybeInduceWriteStall(b *Batch) {
 	}
 }
 
+// updateL0WriteStallLocked updates d.l0WriteStalled for the current version:
+// writes stall when the number of L0 sublevels reaches
+// Options.L0StopWritesThreshold, and resume once compactions bring it below
+// Options.L0ResumeWritesThreshold. d.mu must be held.
+func (d *DB) updateL0WriteStallLocked() {
+	if d.opts.L0ResumeWritesThreshold <= 0 {
+		return
+	}
+	l0ReadAmp := d.mu.versions.currentVersion().L0Sublevels.ReadAmplification()
+	if l0ReadAmp >= d.opts.L0StopWritesThreshold {
+		d.l0WriteStalled.Store(true)
+	} else if l0ReadAmp < d.opts.L0ResumeWritesThreshold && d.l0WriteStalled.Load() {
+		d.l0WriteStalled.Store(false)
+		// Wake up the stalled commits and ingestions.
+		d.mu.compact.cond.Broadcast()
+	}
+}
+
+// waitForL0Headroom blocks a new batch commit or ingestion while L0 is
+// stalled by Options.L0ResumeWritesThreshold (see updateL0WriteStallLocked).
+// It returns early with ctx's error if ctx is done, or with ErrClosed if the
+// DB is closed.
+func (d *DB) waitForL0Headroom(ctx context.Context) error {
+	if !d.l0WriteStalled.Load() {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var start time.Time
+	defer func() {
+		if !start.IsZero() {
+			d.mu.l0WriteStall.duration += time.Since(start)
+		}
+	}()
+	for {
+		if d.closed.Load() != nil {
+			return ErrClosed
+		}
+		if !d.l0WriteStalled.Load() {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if start.IsZero() {
+			start = time.Now()
+			d.mu.l0WriteStall.count++
+			// Wake up the wait when ctx is done. The broadcast happens under
+			// d.mu so that it can't be lost between the check of ctx above and
+			// the wait below.
+			stop := context.AfterFunc(ctx, func() {
+				d.mu.Lock()
+				defer d.mu.Unlock()
+				d.mu.compact.cond.Broadcast()
+			})
+			defer stop()
+		}
+		d.mu.compact.cond.Wait()
+	}
+}
+
 // makeRoomForWrite rotates the current mutable memtable, ensuring that the
 // resulting mutable memtable has room to hold the contents of the provided
 // Batch. The current memtable is rotated (marked as immutable) and a new
@@ -22,6 +22,7 @@ import (
 	"github.com/cockroachdb/datadriven"
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/fifo"
+	"github.com/cockroachdb/pebble/bloom"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/cache"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
@@ -488,6 +489,212 @@ func TestGetMerge(t *testing.T) {
 	require.NoError(t, d.Close())
 }
 
+func TestGetRawMergeOperands(t *testing.T) {
+	d, err := Open("", testingRandomized(t, &Options{
+		FS: vfs.NewMem(),
+	}))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	raw := &ReadOptions{RawMergeOperands: true}
+	get := func(key string, o *ReadOptions) (GetResult, error) {
+		res, closer, err := d.GetWithOptions([]byte(key), o)
+		if err == nil {
+			require.NoError(t, closer.Close())
+		}
+		return res, err
+	}
+
+	// The operands of a key with only MERGE records, spread over the memtable
+	// and sstables, are returned in application order.
+	require.NoError(t, d.Merge([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Merge([]byte("a"), []byte("2"), nil))
+	require.NoError(t, d.Merge([]byte("a"), []byte("3"), nil))
+	res, err := get("a", raw)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("1"), []byte("2"), []byte("3")}, res.MergeOperands)
+	require.Nil(t, res.Value)
+	res, err = get("a", nil)
+	require.NoError(t, err)
+	require.Equal(t, "123", string(res.Value))
+
+	// A SET below the MERGEs is the first operand, and records below a DEL
+	// are excluded.
+	require.NoError(t, d.Set([]byte("b"), []byte("old"), nil))
+	require.NoError(t, d.Delete([]byte("b"), nil))
+	require.NoError(t, d.Merge([]byte("b"), []byte("x"), nil))
+	res, err = get("b", raw)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("x")}, res.MergeOperands)
+	require.NoError(t, d.Set([]byte("c"), []byte("base"), nil))
+	require.NoError(t, d.Merge([]byte("c"), []byte("y"), nil))
+	res, err = get("c", raw)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("base"), []byte("y")}, res.MergeOperands)
+
+	// Merge operands shadowed by a range deletion are excluded.
+	require.NoError(t, d.DeleteRange([]byte("c"), []byte("d"), nil))
+	require.NoError(t, d.Merge([]byte("c"), []byte("z"), nil))
+	res, err = get("c", raw)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("z")}, res.MergeOperands)
+
+	// Keys whose newest record isn't a MERGE.
+	require.NoError(t, d.Set([]byte("d"), []byte("v"), nil))
+	_, err = get("d", raw)
+	require.EqualError(t, err, "pebble: newest record of key d is a SET, not a MERGE")
+	require.NoError(t, d.Delete([]byte("d"), nil))
+	_, err = get("d", raw)
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = get("e", raw)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestGetVersions(t *testing.T) {
+	d, err := Open("", testingRandomized(t, &Options{
+		FS: vfs.NewMem(),
+	}))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	versions := func(key string, n int) string {
+		vs, err := d.GetVersions([]byte(key), n)
+		if err != nil {
+			return err.Error()
+		}
+		var res []string
+		for _, v := range vs {
+			res = append(res, fmt.Sprintf("%s#%d=%s", v.Kind, v.SeqNum, v.Value))
+		}
+		return strings.Join(res, " ")
+	}
+
+	// The records of a key, spread over the memtable and sstables, are
+	// returned newest first.
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("a"), []byte("2"), nil))
+	require.NoError(t, d.Merge([]byte("a"), []byte("3"), nil))
+	require.Equal(t, "MERGE#12=3 SET#11=2 SET#10=1", versions("a", 5))
+	require.Equal(t, "MERGE#12=3 SET#11=2", versions("a", 2))
+
+	// Records below the first point deletion, and those deleted by a range
+	// deletion, are excluded.
+	require.NoError(t, d.Delete([]byte("a"), nil))
+	require.NoError(t, d.Set([]byte("a"), []byte("4"), nil))
+	require.Equal(t, "SET#14=4 DEL#13=", versions("a", 5))
+	require.NoError(t, d.DeleteRange([]byte("a"), []byte("b"), nil))
+	require.NoError(t, d.Set([]byte("a"), []byte("5"), nil))
+	require.Equal(t, "SET#16=5", versions("a", 5))
+
+	require.Equal(t, "pebble: not found", versions("b", 1))
+	require.Equal(t, "pebble: invalid number of versions 0", versions("a", 0))
+}
+
+func TestMayContain(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		Levels:                      []LevelOptions{{FilterPolicy: bloom.FilterPolicy(10)}},
+		DisableAutomaticCompactions: true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Write the even keys to an sstable, which is compacted into L6, and
+	// another one that stays in L0.
+	key := func(i int) []byte { return []byte(fmt.Sprintf("k%03d", i)) }
+	for i := 0; i < 200; i += 2 {
+		require.NoError(t, d.Set(key(i), nil, nil))
+	}
+	require.NoError(t, d.Compact(key(0), key(200), false))
+	for i := 200; i < 400; i += 2 {
+		require.NoError(t, d.Set(key(i), nil, nil))
+	}
+	require.NoError(t, d.Flush())
+	require.Equal(t, int64(1), d.Metrics().Levels[0].NumFiles)
+
+	// Present keys may be contained, and the filters rule out most absent
+	// keys within the sstables' bounds, as well as the keys outside of them.
+	var falsePositives int
+	for i := 0; i < 400; i++ {
+		if i%2 == 0 {
+			require.True(t, d.MayContain(key(i)))
+		} else if d.MayContain(key(i)) {
+			falsePositives++
+		}
+	}
+	require.Less(t, falsePositives, 20)
+	require.False(t, d.MayContain([]byte("a")))
+	require.False(t, d.MayContain([]byte("z")))
+
+	// Keys in the memtable may be contained, even if they're deleted, as may
+	// keys deleted by range deletions.
+	require.NoError(t, d.Set([]byte("a"), nil, nil))
+	require.NoError(t, d.Delete([]byte("z"), nil))
+	require.True(t, d.MayContain([]byte("a")))
+	require.True(t, d.MayContain([]byte("z")))
+	require.NoError(t, d.DeleteRange(key(0), key(400), nil))
+	require.NoError(t, d.Flush())
+	require.True(t, d.MayContain(key(0)))
+}
+
+func TestMaxMergeOperands(t *testing.T) {
+	d, err := Open("", testingRandomized(t, &Options{
+		FS: vfs.NewMem(),
+	}))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// "a" has a SET followed by three MERGEs, and "b" a single MERGE.
+	require.NoError(t, d.Set([]byte("a"), []byte("0"), nil))
+	require.NoError(t, d.Flush())
+	for _, v := range []string{"1", "2", "3"} {
+		require.NoError(t, d.Merge([]byte("a"), []byte(v), nil))
+	}
+	require.NoError(t, d.Merge([]byte("b"), []byte("x"), nil))
+
+	get := func(key string, o *ReadOptions) (GetResult, error) {
+		res, closer, err := d.GetWithOptions([]byte(key), o)
+		if err == nil {
+			require.NoError(t, closer.Close())
+		}
+		return res, err
+	}
+	res, err := get("a", &ReadOptions{MaxMergeOperands: 3})
+	require.NoError(t, err)
+	require.Equal(t, "0123", string(res.Value))
+	_, err = get("a", &ReadOptions{MaxMergeOperands: 2})
+	require.ErrorIs(t, err, ErrTooManyMergeOperands)
+	res, err = get("a", &ReadOptions{RawMergeOperands: true, MaxMergeOperands: 3})
+	require.NoError(t, err)
+	require.Len(t, res.MergeOperands, 4)
+	_, err = get("a", &ReadOptions{RawMergeOperands: true, MaxMergeOperands: 2})
+	require.ErrorIs(t, err, ErrTooManyMergeOperands)
+	res, err = get("b", &ReadOptions{MaxMergeOperands: 1})
+	require.NoError(t, err)
+	require.Equal(t, "x", string(res.Value))
+
+	// Iteration in either direction stops at the key with too many operands.
+	iter, err := d.NewIter(&IterOptions{MaxMergeOperands: 2})
+	require.NoError(t, err)
+	require.False(t, iter.First())
+	require.ErrorIs(t, iter.Error(), ErrTooManyMergeOperands)
+	require.True(t, iter.Last())
+	require.Equal(t, "x", string(iter.Value()))
+	require.False(t, iter.Prev())
+	require.ErrorIs(t, iter.Error(), ErrTooManyMergeOperands)
+
+	// Raising the limit through SetOptions allows the key to be read.
+	iter.SetOptions(&IterOptions{MaxMergeOperands: 3})
+	require.True(t, iter.First())
+	require.Equal(t, "0123", string(iter.Value()))
+	require.True(t, iter.Last())
+	require.True(t, iter.Prev())
+	require.Equal(t, "0123", string(iter.Value()))
+	require.NoError(t, iter.Close())
+}
+
 func TestMergeOrderSameAfterFlush(t *testing.T) {
 	// Ensure compaction iterator (used by flush) and user iterator process merge
 	// operands in the same order
@@ -1392,6 +1599,42 @@ func TestSSTables(t *testing.T) {
 	}
 }
 
+func TestSSTablesContentHash(t *testing.T) {
+	// hashes returns the content hashes of the sstables of a DB holding a=1 and
+	// b=2, after writing the given number of other keys beforehand, in a
+	// separate sstable, so that a and b get different sequence numbers.
+	hashes := func(opts *Options, otherKeys int) map[string]string {
+		opts.FS = vfs.NewMem()
+		d, err := Open("", opts)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, d.Close()) }()
+		for i := 0; i < otherKeys; i++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("z%d", i)), nil, nil))
+		}
+		require.NoError(t, d.Flush())
+		require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+		require.NoError(t, d.Set([]byte("b"), []byte("2"), nil))
+		require.NoError(t, d.Flush())
+
+		tableInfos, err := d.SSTables(WithProperties())
+		require.NoError(t, err)
+		res := make(map[string]string)
+		for _, levelTables := range tableInfos {
+			for _, info := range levelTables {
+				res[string(info.Smallest.UserKey)] = info.ContentHash
+			}
+		}
+		return res
+	}
+
+	h1 := hashes(&Options{ComputeTableContentHash: true}, 1)
+	h2 := hashes(&Options{ComputeTableContentHash: true}, 2)
+	require.NotEmpty(t, h1["a"])
+	require.Equal(t, h1["a"], h2["a"])
+	require.NotEqual(t, h1["z0"], h2["z0"])
+	require.Empty(t, hashes(&Options{}, 1)["a"])
+}
+
 type testTracer struct {
 	enabledOnlyForNonBackgroundContext bool
 	buf                                strings.Builder
@@ -2444,3 +2687,245 @@ func TestLoadBlockSema(t *testing.T) {
 		})
 	}
 }
+
+func TestVersionFingerprint(t *testing.T) {
+	mem := vfs.NewMem()
+	open := func(dir string) *DB {
+		d, err := Open(dir, &Options{FS: mem, DisableAutomaticCompactions: true})
+		require.NoError(t, err)
+		return d
+	}
+	populate := func(d *DB) {
+		for _, k := range []string{"a", "b", "c"} {
+			require.NoError(t, d.Set([]byte(k), []byte(k), nil))
+			require.NoError(t, d.Flush())
+		}
+	}
+
+	d1 := open("d1")
+	defer func() { require.NoError(t, d1.Close()) }()
+	empty := d1.VersionFingerprint()
+	populate(d1)
+	fp := d1.VersionFingerprint()
+	require.NotEqual(t, empty, fp)
+	// Writes that haven't been flushed don't affect the fingerprint.
+	require.NoError(t, d1.Set([]byte("d"), []byte("d"), nil))
+	require.Equal(t, fp, d1.VersionFingerprint())
+
+	// An identically constructed store has the same fingerprint.
+	d2 := open("d2")
+	defer func() { require.NoError(t, d2.Close()) }()
+	populate(d2)
+	require.Equal(t, fp, d2.VersionFingerprint())
+
+	// A store restored from a checkpoint has the same fingerprint.
+	require.NoError(t, d2.Checkpoint("checkpoint"))
+	d3 := open("checkpoint")
+	require.Equal(t, fp, d3.VersionFingerprint())
+	require.NoError(t, d3.Close())
+
+	// Diverging LSMs yield different fingerprints.
+	require.NoError(t, d2.Compact([]byte("a"), []byte("d"), false /* parallelize */))
+	require.NotEqual(t, fp, d2.VersionFingerprint())
+}
+
+// diskUsageFS wraps a vfs.FS, reporting a configurable amount of free space.
+type diskUsageFS struct {
+	vfs.FS
+	avail atomic.Uint64
+}
+
+func (fs *diskUsageFS) GetDiskUsage(path string) (vfs.DiskUsage, error) {
+	avail := fs.avail.Load()
+	return vfs.DiskUsage{AvailBytes: avail, TotalBytes: avail, UsedBytes: 0}, nil
+}
+
+func TestMinFreeDiskBytes(t *testing.T) {
+	fs := &diskUsageFS{FS: vfs.NewMem()}
+	fs.avail.Store(100 << 20)
+	d, err := Open("", &Options{
+		FS:               fs,
+		MinFreeDiskBytes: 10 << 20,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	var now atomic.Int64
+	now.Store(time.Now().UnixNano())
+	d.timeNow = func() time.Time { return time.Unix(0, now.Load()) }
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.Equal(t, uint64(100<<20), d.Metrics().DiskAvailBytes)
+
+	// The free space drops below the threshold. The estimate isn't refreshed
+	// until the check interval elapses.
+	fs.avail.Store(5 << 20)
+	require.NoError(t, d.Set([]byte("b"), []byte("1"), nil))
+	now.Add(int64(diskAvailCheckInterval))
+	require.ErrorIs(t, d.Set([]byte("c"), []byte("1"), nil), ErrDiskFull)
+	require.Equal(t, uint64(5<<20), d.Metrics().DiskAvailBytes)
+	require.Equal(t, uint64(5<<20), d.MetricsSnapshot().DiskAvailBytes)
+
+	// Flushes and compactions still proceed.
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false /* parallelize */))
+
+	// Writes resume once space has been reclaimed.
+	fs.avail.Store(50 << 20)
+	now.Add(int64(diskAvailCheckInterval))
+	require.NoError(t, d.Set([]byte("c"), []byte("1"), nil))
+	_, closer, err := d.Get([]byte("c"))
+	require.NoError(t, err)
+	require.NoError(t, closer.Close())
+}
+
+func TestApplyWithResult(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	apply := func(sync bool, keys ...string) ApplyResult {
+		b := d.NewBatch()
+		for _, k := range keys {
+			require.NoError(t, b.Set([]byte(k), nil, nil))
+		}
+		res, err := d.ApplyWithResult(b, &WriteOptions{Sync: sync})
+		require.NoError(t, err)
+		require.NoError(t, b.Close())
+		return res
+	}
+
+	// An empty batch is assigned no sequence number.
+	require.Equal(t, ApplyResult{}, apply(true))
+
+	seqNum := d.mu.versions.visibleSeqNum.Load()
+	res := apply(false, "a", "b")
+	require.Equal(t, ApplyResult{SeqNum: seqNum}, res)
+	require.Equal(t, ApplyResult{SeqNum: seqNum + 2, Synced: true}, apply(true, "c"))
+	// The synced batch made the preceding batch durable too.
+	require.True(t, d.commit.synced(res.SeqNum, 2))
+
+	res = apply(false, "d")
+	require.Equal(t, ApplyResult{SeqNum: seqNum + 3}, res)
+	require.False(t, d.commit.synced(res.SeqNum, 1))
+	require.NoError(t, d.Set([]byte("e"), nil, Sync))
+	require.True(t, d.commit.synced(res.SeqNum, 1))
+}
+
+func TestApplyChunked(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem(), MaxBatchSize: 1 << 10})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	b := d.NewBatch()
+	defer func() { require.NoError(t, b.Close()) }()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, b.Set([]byte(fmt.Sprintf("k%03d", i)), bytes.Repeat([]byte("v"), 50), nil))
+	}
+	require.NoError(t, b.Delete([]byte("k010"), nil))
+	require.NoError(t, b.DeleteRange([]byte("k020"), []byte("k030"), nil))
+	require.NoError(t, b.Set([]byte("big"), bytes.Repeat([]byte("v"), 800), nil))
+
+	// The batch as a whole is too large to apply.
+	require.ErrorIs(t, d.Apply(b, nil), ErrBatchExceedsMaxSize)
+	require.Error(t, d.ApplyChunked(b, 0, nil))
+	require.Error(t, d.ApplyChunked(b, -1, nil))
+	require.ErrorContains(t, d.ApplyChunked(b, 2<<10, nil), "exceeds Options.MaxBatchSize")
+	ib := d.NewIndexedBatch()
+	require.Error(t, d.ApplyChunked(ib, 1<<10, nil))
+	require.NoError(t, ib.Close())
+
+	seqNum := d.mu.versions.visibleSeqNum.Load()
+	require.NoError(t, d.ApplyChunked(b, 1<<10, nil))
+	// Every operation was applied, in order.
+	require.Equal(t, seqNum+uint64(b.Count()), d.mu.versions.visibleSeqNum.Load())
+	iter, err := d.NewIter(nil)
+	require.NoError(t, err)
+	var n int
+	for valid := iter.First(); valid; valid = iter.Next() {
+		n++
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, 100-1-10+1, n)
+
+	// An operation larger than the chunk size is applied by itself, unless it's
+	// larger than MaxBatchSize.
+	b2 := d.NewBatch()
+	require.NoError(t, b2.Set([]byte("a"), bytes.Repeat([]byte("v"), 200), nil))
+	require.NoError(t, b2.Set([]byte("b"), bytes.Repeat([]byte("v"), 2<<10), nil))
+	require.ErrorIs(t, d.ApplyChunked(b2, 100, nil), ErrBatchExceedsMaxSize)
+	require.NoError(t, b2.Close())
+	_, closer, err := d.Get([]byte("a"))
+	require.NoError(t, err)
+	require.NoError(t, closer.Close())
+	_, _, err = d.Get([]byte("b"))
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// LogData records don't consume sequence numbers.
+	b3 := d.NewBatch()
+	defer func() { require.NoError(t, b3.Close()) }()
+	require.NoError(t, b3.LogData([]byte("log"), nil))
+	require.NoError(t, b3.Set([]byte("c"), nil, nil))
+	require.NoError(t, b3.LogData([]byte("log"), nil))
+	require.NoError(t, b3.Set([]byte("d"), nil, nil))
+	seqNum = d.mu.versions.visibleSeqNum.Load()
+	require.NoError(t, d.ApplyChunked(b3, 1<<10, nil))
+	require.Equal(t, seqNum+2, d.mu.versions.visibleSeqNum.Load())
+}
+
+func TestL0ResumeWritesThreshold(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{
+		FS:                          mem,
+		DisableAutomaticCompactions: true,
+		L0CompactionThreshold:       1,
+		L0StopWritesThreshold:       2,
+		L0ResumeWritesThreshold:     1,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Writes proceed until L0 reaches L0StopWritesThreshold sublevels.
+	for i := 0; i < 2; i++ {
+		require.NoError(t, d.Set([]byte("a"), nil, nil))
+		require.NoError(t, d.Flush())
+	}
+	require.Equal(t, int32(2), d.Metrics().Levels[0].Sublevels)
+
+	// Commits and ingestions stall, and may be canceled.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = d.Set([]byte("b"), nil, &WriteOptions{Context: ctx})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	f, err := mem.Create("ext.sst", vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	w := sstable.NewWriter(objstorageprovider.NewFileWritable(f), sstable.WriterOptions{
+		TableFormat: d.FormatMajorVersion().MaxTableFormat(),
+	})
+	require.NoError(t, w.Set([]byte("c"), nil))
+	require.NoError(t, w.Close())
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err = d.IngestWithContext(ctx, []string{"ext.sst"})
+	require.ErrorIs(t, err, context.Canceled)
+	m := d.Metrics()
+	require.Equal(t, uint64(2), m.L0WriteStall.Count)
+	require.GreaterOrEqual(t, m.L0WriteStall.Duration, 20*time.Millisecond)
+
+	// A stalled write resumes once compactions bring L0 below
+	// L0ResumeWritesThreshold.
+	setErr := make(chan error, 1)
+	go func() { setErr <- d.Set([]byte("b"), nil, nil) }()
+	select {
+	case err := <-setErr:
+		t.Fatalf("write did not stall: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	require.NoError(t, d.Compact([]byte("a"), []byte("b"), false /* parallelize */))
+	require.NoError(t, <-setErr)
+	_, err = d.IngestWithContext(context.Background(), []string{"ext.sst"})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), d.Metrics().L0WriteStall.Count)
+	require.Equal(t, uint64(3), d.MetricsSnapshot().L0WriteStallCount)
+	require.False(t, d.l0WriteStalled.Load())
+}
@@ -415,7 +415,7 @@ func firstExternalFileInLevelIter(
 func (d *DB) tryLaunchDownloadForFile(
 	vers *version, env compactionEnv, download *downloadSpanTask, level int, f *fileMetadata,
 ) (doneCh chan error, ok bool) {
-	if f.IsCompacting() {
+	if f.IsCompacting() || f.IsPinned() {
 		return nil, false
 	}
 	if download.testing.launchDownloadCompaction != nil {
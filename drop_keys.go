@@ -0,0 +1,183 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/manifest"
+)
+
+// DropKeysBelow deletes all the keys less than key without compacting them.
+// It's intended for trimming data that has fallen out of a retention window,
+// such as the oldest keys of an append-only time series, at a fraction of the
+// cost of a DeleteRange and the compactions that reclaim its space.
+//
+// The memtables are flushed first, after which a single version edit drops
+// the sstables that lie entirely below key and excises the keys below key from
+// the sstables that straddle it, which are replaced by virtual sstables over
+// their remaining keys. No sstable is rewritten. Keys written concurrently
+// with the call may or may not be dropped.
+//
+// As with IngestAndExcise, the dropped keys are removed from the view of open
+// Snapshots too, and compactions in progress over the dropped keys are
+// cancelled. EventuallyFileOnlySnapshots whose protected ranges include keys
+// below key are made file-only before the keys are dropped, so that they keep
+// observing them. DropKeysBelow requires a format major version of at least
+// FormatVirtualSSTables.
+func (d *DB) DropKeysBelow(key []byte) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	if v := d.FormatMajorVersion(); v < FormatVirtualSSTables {
+		return errors.Errorf(
+			"store has format major version %d; DropKeysBelow requires at least %d",
+			v, FormatVirtualSSTables,
+		)
+	}
+	if err := d.Flush(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for {
+		// As with ingestions, the DB can't be quiesced while the version edit
+		// is being applied; see DB.Quiesce.
+		if d.mu.compact.quiesced {
+			d.mu.compact.cond.Wait()
+			continue
+		}
+		// An EventuallyFileOnlySnapshot that isn't file-only yet transitions to
+		// the version current when the memtables it depends on are flushed,
+		// which must not be missing the dropped keys. The flush above
+		// transitioned those open at the time, but more may have been opened
+		// since.
+		if !d.efosBelowLocked(key) {
+			break
+		}
+		d.mu.Unlock()
+		err := d.Flush()
+		d.mu.Lock()
+		if err != nil {
+			return err
+		}
+	}
+	d.mu.compact.droppingKeysCount++
+	defer func() {
+		d.mu.compact.droppingKeysCount--
+		d.mu.compact.cond.Broadcast()
+	}()
+	jobID := d.newJobIDLocked()
+
+	// Lock the manifest for writing so that no flush or compaction edits the
+	// LSM between the files being excised and the edit being applied.
+	// logAndApply unconditionally releases the manifest lock, but any earlier
+	// returns must unlock the manifest.
+	d.mu.versions.logLock()
+	current := d.mu.versions.currentVersion()
+
+	// The span to excise starts at the smallest key in the LSM.
+	var start []byte
+	for level := range current.Levels {
+		iter := current.Levels[level].Iter()
+		for m := iter.First(); m != nil; m = iter.Next() {
+			if start == nil || d.cmp(m.Smallest.UserKey, start) < 0 {
+				start = m.Smallest.UserKey
+			}
+			if level > 0 {
+				// Files in L1 and below are sorted and don't overlap.
+				break
+			}
+		}
+	}
+	if start == nil || d.cmp(start, key) >= 0 {
+		d.mu.versions.logUnlock()
+		return nil
+	}
+	exciseSpan := KeyRange{Start: start, End: key}
+
+	ve := &versionEdit{
+		DeletedFiles: map[manifest.DeletedFileEntry]*manifest.FileMetadata{},
+	}
+	metrics := make(map[int]*LevelMetrics)
+	for level := range current.Levels {
+		overlaps := current.Overlaps(level, exciseSpan.UserKeyBounds())
+		iter := overlaps.Iter()
+		for m := iter.First(); m != nil; m = iter.Next() {
+			newFiles, err := d.excise(exciseSpan.UserKeyBounds(), m, ve, level)
+			if err != nil {
+				d.mu.versions.logUnlock()
+				return err
+			}
+			if _, ok := ve.DeletedFiles[deletedFileEntry{
+				Level:   level,
+				FileNum: m.FileNum,
+			}]; !ok {
+				// We did not excise this file.
+				continue
+			}
+			levelMetrics := metrics[level]
+			if levelMetrics == nil {
+				levelMetrics = &LevelMetrics{}
+				metrics[level] = levelMetrics
+			}
+			levelMetrics.NumFiles--
+			levelMetrics.Size -= int64(m.Size)
+			for i := range newFiles {
+				levelMetrics.NumFiles++
+				levelMetrics.Size += int64(newFiles[i].Meta.Size)
+			}
+		}
+	}
+	if len(ve.DeletedFiles) == 0 {
+		d.mu.versions.logUnlock()
+		return nil
+	}
+	// Compactions over the excised span can't apply their version edits once
+	// their inputs are deleted. Flushes in progress only hold keys written after
+	// the memtables were flushed above, and are left to complete.
+	for c := range d.mu.compact.inProgress {
+		if c.versionEditApplied || c.kind == compactionKindFlush {
+			continue
+		}
+		if exciseSpan.OverlapsInternalKeyRange(d.cmp, c.smallest, c.largest) {
+			c.cancel.Store(true)
+		}
+	}
+
+	if err := d.mu.versions.logAndApply(jobID, ve, metrics, false /* forceRotation */, func() []compactionInfo {
+		return d.getInProgressCompactionInfoLocked(nil)
+	}); err != nil {
+		return err
+	}
+	d.updateReadStateLocked(d.opts.DebugCheck)
+	// The excised files are now obsolete, unless they back virtual sstables.
+	d.deleteObsoleteFiles(jobID)
+	d.updateTableStatsLocked(ve.NewFiles)
+	d.maybeScheduleCompaction()
+	return nil
+}
+
+// efosBelowLocked returns whether any EventuallyFileOnlySnapshot that hasn't
+// transitioned to a file-only snapshot protects a key range containing keys
+// less than key. DB.mu must be held.
+func (d *DB) efosBelowLocked(key []byte) bool {
+	// EventuallyFileOnlySnapshots are only in the list of snapshots until they
+	// transition.
+	for s := d.mu.snapshots.root.next; s != &d.mu.snapshots.root; s = s.next {
+		if s.efos == nil {
+			continue
+		}
+		for i := range s.efos.protectedRanges {
+			if d.cmp(s.efos.protectedRanges[i].Start, key) < 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
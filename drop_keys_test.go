@@ -0,0 +1,91 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDropKeysBelow(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		FormatMajorVersion:          FormatNewest,
+		DisableAutomaticCompactions: true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Write three sstables, [a,f], [g,l] and [m,r], and leave a key below the
+	// dropped keys in the memtable.
+	for _, keys := range []string{"abcdef", "ghijkl", "mnopqr"} {
+		for _, k := range keys {
+			require.NoError(t, d.Set([]byte{byte(k)}, nil, nil))
+		}
+		require.NoError(t, d.Flush())
+	}
+	require.NoError(t, d.Set([]byte("b2"), nil, nil))
+
+	// Nothing is dropped below the smallest key, though the memtable is flushed.
+	require.NoError(t, d.DropKeysBelow([]byte("a")))
+	require.Equal(t, int64(4), d.Metrics().Levels[0].NumFiles)
+
+	// The first sstable and the flushed one are dropped, and the second one is
+	// excised.
+	require.NoError(t, d.DropKeysBelow([]byte("i")))
+	m := d.Metrics()
+	require.Equal(t, int64(2), m.Levels[0].NumFiles)
+	require.Equal(t, uint64(1), m.Levels[0].NumVirtualFiles)
+	require.Zero(t, m.Total().TablesCompacted)
+
+	iter, err := d.NewIter(nil)
+	require.NoError(t, err)
+	var keys []byte
+	for valid := iter.First(); valid; valid = iter.Next() {
+		keys = append(keys, iter.Key()...)
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, "ijklmnopqr", string(keys))
+	_, _, err = d.Get([]byte("b2"))
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// Keys written after the call are unaffected.
+	require.NoError(t, d.Set([]byte("a"), nil, nil))
+	_, closer, err := d.Get([]byte("a"))
+	require.NoError(t, err)
+	require.NoError(t, closer.Close())
+}
+
+func TestDropKeysBelowEventuallyFileOnlySnapshot(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		FormatMajorVersion:          FormatNewest,
+		DisableAutomaticCompactions: true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), nil, nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("b"), nil, nil))
+	// The EFOS depends on the memtable holding "b", so it isn't file-only yet.
+	efos := d.NewEventuallyFileOnlySnapshot([]KeyRange{{Start: []byte("a"), End: []byte("z")}})
+	defer func() { require.NoError(t, efos.Close()) }()
+	require.False(t, efos.hasTransitioned())
+
+	// The EFOS is made file-only before the keys are dropped, and continues to
+	// observe them.
+	require.NoError(t, d.DropKeysBelow([]byte("c")))
+	require.True(t, efos.hasTransitioned())
+	for _, k := range []string{"a", "b"} {
+		_, closer, err := efos.Get([]byte(k))
+		require.NoError(t, err)
+		require.NoError(t, closer.Close())
+		_, _, err = d.Get([]byte(k))
+		require.ErrorIs(t, err, ErrNotFound)
+	}
+}
@@ -84,6 +84,21 @@ type CompactionInfo struct {
 	SingleLevelOverlappingRatio float64
 	MultiLevelOverlappingRatio  float64
 
+	// InputKeyCount is the number of point keys read from the input tables.
+	// It's set for the compaction end event, and is zero for compactions that
+	// don't rewrite their input's keys, such as moves and delete-only
+	// compactions.
+	InputKeyCount uint64
+	// OutputKeyCount is the number of point keys written to the output tables.
+	OutputKeyCount uint64
+	// DroppedKeyCount is the number of input point keys that were elided
+	// rather than written, because they were shadowed by newer keys or deleted
+	// by tombstones, or they were tombstones that were themselves elided. Input
+	// keys merged into the value of a newer MERGE key are not counted as
+	// dropped, so DroppedKeyCount equals InputKeyCount - OutputKeyCount only if
+	// the compaction merged no keys.
+	DroppedKeyCount uint64
+
 	// Annotations specifies additional info to appear in a compaction's event log line
 	Annotations compactionAnnotations
 }
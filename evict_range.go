@@ -0,0 +1,49 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// EvictRange removes from the block cache all the cached blocks of the
+// sstables that overlap the key range [start, end), including data, index and
+// filter blocks. For a virtual sstable, the blocks of its whole backing
+// sstable are removed. It's intended for use after deleting sensitive data,
+// for example through a range deletion followed by a compaction of the range
+// or through IngestAndExcise, so that the blocks holding it don't linger in
+// memory.
+//
+// EvictRange only affects the sstables in the current version of the LSM.
+// Blocks that are in use by iterators, or that are read again after
+// EvictRange returns, remain in or return to the cache. It doesn't affect the
+// OS page cache, nor the secondary cache of sstables on remote storage.
+func (d *DB) EvictRange(start, end []byte) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.cmp(start, end) >= 0 {
+		return errors.Errorf("pebble: invalid range [%s, %s)",
+			d.opts.Comparer.FormatKey(start), d.opts.Comparer.FormatKey(end))
+	}
+	rs := d.loadReadState()
+	defer rs.unref()
+	bounds := base.UserKeyBoundsEndExclusive(start, end)
+	evicted := make(map[base.DiskFileNum]struct{})
+	for level := range rs.current.Levels {
+		files := rs.current.Overlaps(level, bounds)
+		iter := files.Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			fileNum := f.FileBacking.DiskFileNum
+			if _, ok := evicted[fileNum]; ok {
+				continue
+			}
+			evicted[fileNum] = struct{}{}
+			d.opts.Cache.EvictFile(d.cacheID, fileNum)
+		}
+	}
+	return nil
+}
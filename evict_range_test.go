@@ -0,0 +1,57 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvictRange(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem(), DisableAutomaticCompactions: true})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Write two sstables, holding a and z keys.
+	for _, prefix := range []string{"a", "z"} {
+		for i := 0; i < 100; i++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("%s%03d", prefix, i)), []byte("secret"), nil))
+		}
+		require.NoError(t, d.Flush())
+	}
+	// scan reads the keys with the given prefix, and returns the number of
+	// block cache misses it incurred.
+	scan := func(prefix string) int64 {
+		before := d.Metrics().BlockCache.Misses
+		iter, err := d.NewIter(&IterOptions{
+			LowerBound: []byte(prefix),
+			UpperBound: []byte(prefix + "\xff"),
+		})
+		require.NoError(t, err)
+		n := 0
+		for valid := iter.First(); valid; valid = iter.Next() {
+			n++
+		}
+		require.Equal(t, 100, n)
+		require.NoError(t, iter.Close())
+		return d.Metrics().BlockCache.Misses - before
+	}
+	require.Greater(t, scan("a"), int64(0))
+	require.Greater(t, scan("z"), int64(0))
+	require.Zero(t, scan("a"))
+	require.Zero(t, scan("z"))
+
+	// Only the blocks of the sstable overlapping the range are evicted.
+	count := d.Metrics().BlockCache.Count
+	require.NoError(t, d.EvictRange([]byte("a"), []byte("b")))
+	require.Less(t, d.Metrics().BlockCache.Count, count)
+	require.Zero(t, scan("z"))
+	require.Greater(t, scan("a"), int64(0))
+
+	require.Error(t, d.EvictRange([]byte("b"), []byte("a")))
+}
@@ -0,0 +1,270 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"os"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// ExportRange writes the live keys in [start, end) to one or more new
+// sstables in destDir, and returns the paths of the sstables in key order.
+// destDir must not already exist.
+//
+// The sstables contain a consistent view of the range as of the time of the
+// call: deletions and range deletions are resolved and merges are applied, so
+// every point key is written as a SET and every range key as a RANGEKEYSET,
+// all at sequence number zero. The sstables don't overlap, and may be ingested
+// together with DB.Ingest into any DB using the same Comparer and a format
+// major version that supports the table format of this DB.
+//
+// On error, destDir and any sstables written to it are removed.
+func (d *DB) ExportRange(start, end []byte, destDir string) (paths []string, err error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.cmp(start, end) >= 0 {
+		return nil, errors.Errorf("ExportRange start %s is not less than end %s",
+			d.opts.Comparer.FormatKey(start), d.opts.Comparer.FormatKey(end))
+	}
+	fs := d.opts.FS
+	if _, err := fs.Stat(destDir); !oserror.IsNotExist(err) {
+		if err == nil {
+			return nil, &os.PathError{
+				Op:   "export",
+				Path: destDir,
+				Err:  oserror.ErrExist,
+			}
+		}
+		return nil, err
+	}
+	if err := fs.MkdirAll(destDir, 0755); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = fs.RemoveAll(destDir)
+			paths = nil
+		}
+	}()
+
+	iter, err := d.NewIter(&IterOptions{
+		LowerBound: start,
+		UpperBound: end,
+		KeyTypes:   IterKeyTypePointsAndRanges,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = firstError(err, iter.Close())
+	}()
+
+	writerOpts := d.opts.MakeWriterOptions(numLevels-1, d.FormatMajorVersion().MaxTableFormat())
+	targetFileSize := uint64(d.opts.Level(numLevels - 1).TargetFileSize)
+	var w *sstable.Writer
+	defer func() {
+		if w != nil {
+			err = firstError(err, w.Close())
+		}
+	}()
+	// rangeKeyEnd is the end key of the last range key span written. The output
+	// is only split at keys at or beyond it, so that the sstables don't overlap.
+	var rangeKeyEnd []byte
+	for valid := iter.First(); valid; valid = iter.Next() {
+		key := iter.Key()
+		if w != nil && w.EstimatedSize() >= targetFileSize && d.cmp(key, rangeKeyEnd) >= 0 {
+			err := w.Close()
+			w = nil
+			if err != nil {
+				return paths, err
+			}
+		}
+		if w == nil {
+			path := base.MakeFilepath(fs, destDir, fileTypeTable, base.DiskFileNum(len(paths)+1))
+			f, err := fs.Create(path, vfs.WriteCategoryUnspecified)
+			if err != nil {
+				return paths, err
+			}
+			paths = append(paths, path)
+			w = sstable.NewWriter(objstorageprovider.NewFileWritable(f), writerOpts)
+		}
+
+		hasPoint, hasRange := iter.HasPointAndRange()
+		if hasRange && iter.RangeKeyChanged() {
+			rangeStart, rangeEnd := iter.RangeBounds()
+			for _, rk := range iter.RangeKeys() {
+				if err := w.RangeKeySet(rangeStart, rangeEnd, rk.Suffix, rk.Value); err != nil {
+					return paths, err
+				}
+			}
+			rangeKeyEnd = append(rangeKeyEnd[:0], rangeEnd...)
+		}
+		if hasPoint {
+			value, err := iter.ValueAndErr()
+			if err != nil {
+				return paths, err
+			}
+			if err := w.Set(key, value); err != nil {
+				return paths, err
+			}
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return paths, err
+	}
+	if w != nil {
+		err := w.Close()
+		w = nil
+		if err != nil {
+			return paths, err
+		}
+	}
+
+	dir, err := fs.OpenDir(destDir)
+	if err != nil {
+		return paths, err
+	}
+	return paths, firstError(dir.Sync(), dir.Close())
+}
+
+// ExportIter streams the live point keys of a DB in either ascending or
+// descending key order, as of the sequence number at which it was created.
+// Like ExportRange, it resolves deletions, range deletions and merges, so each
+// key is yielded at most once with its current value. Values are only
+// retrieved when requested by Value, allowing ValueLen to be inspected
+// cheaply. An ExportIter is not safe for concurrent use.
+type ExportIter struct {
+	iter       *Iterator
+	reverse    bool
+	positioned bool
+	// err is the error encountered by ShadowedVersionCount, if any.
+	err error
+}
+
+// NewExportIter returns an ExportIter over the point keys within the bounds
+// of o, yielding keys from largest to smallest if reverse is true. Only
+// IterKeyTypePointsOnly is supported.
+func (d *DB) NewExportIter(o *IterOptions, reverse bool) (*ExportIter, error) {
+	if o != nil && o.KeyTypes != IterKeyTypePointsOnly {
+		return nil, errors.Errorf("pebble: export iterators only support point keys")
+	}
+	iter, err := d.NewIter(o)
+	if err != nil {
+		return nil, err
+	}
+	return &ExportIter{iter: iter, reverse: reverse}, nil
+}
+
+// Next moves the iterator to the next key in export order, positioning it at
+// the first key on the first call. It returns whether the iterator is
+// positioned at a key.
+func (e *ExportIter) Next() bool {
+	if !e.positioned {
+		e.positioned = true
+		if e.reverse {
+			return e.iter.Last()
+		}
+		return e.iter.First()
+	}
+	if e.reverse {
+		return e.iter.Prev()
+	}
+	return e.iter.Next()
+}
+
+// Key returns the key at the current position. The caller should not modify
+// the contents of the returned slice, and it is only valid until the next call
+// to Next.
+func (e *ExportIter) Key() []byte {
+	return e.iter.Key()
+}
+
+// ValueLen returns the length of the value at the current position, without
+// retrieving the value.
+func (e *ExportIter) ValueLen() int {
+	lv := e.iter.LazyValue()
+	return lv.Len()
+}
+
+// Value retrieves and returns the value at the current position. The caller
+// should not modify the contents of the returned slice, and it is only valid
+// until the next call to Next.
+func (e *ExportIter) Value() ([]byte, error) {
+	return e.iter.ValueAndErr()
+}
+
+// SeqNum returns the sequence number at which the iterator reads the DB.
+func (e *ExportIter) SeqNum() uint64 {
+	return e.iter.seqNum
+}
+
+// ShadowedVersionCount returns the number of the internal records of the key
+// at the current position that are shadowed and did not contribute to its
+// value: its older versions and point deletions, with a range deletion that
+// shadows its older records counted as a single record. The records below a
+// range deletion, and those already dropped by compactions, are not counted.
+// A high count points to a key with heavy version churn, which compacting its
+// range would reclaim.
+//
+// The count is computed by reading the records of the key at the iterator's
+// sequence number from each level of the LSM, as DB.Get does, which costs
+// about as much as a Get. If an error occurs, ShadowedVersionCount returns
+// zero and the error is returned by Error.
+func (e *ExportIter) ShadowedVersionCount() int {
+	if e.err != nil || !e.iter.Valid() {
+		return 0
+	}
+	d := e.iter.readState.db
+	var get getIter
+	d.initGetIter(&get, e.iter.Key(), nil /* batch */, 0 /* seqNum */, e.iter.readState)
+	get.snapshot = e.iter.seqNum
+	// Obsolete points are the shadowed records of interest, so don't hide them.
+	get.iterOpts.snapshotForHideObsoletePoints = 0
+
+	// The newest records contribute to the value: a run of MERGE records, up
+	// to and including the SET that ends it, if any.
+	var shadowed int
+	merging := true
+	for kv := get.First(); kv != nil; kv = get.Next() {
+		if merging {
+			switch kv.Kind() {
+			case InternalKeyKindMerge:
+				continue
+			case InternalKeyKindSet, InternalKeyKindSetWithDelete:
+				merging = false
+				continue
+			}
+			merging = false
+		}
+		shadowed++
+	}
+	if get.tombstoned {
+		shadowed++
+	}
+	if e.err = firstError(get.Error(), get.Close()); e.err != nil {
+		return 0
+	}
+	return shadowed
+}
+
+// Error returns any accumulated error.
+func (e *ExportIter) Error() error {
+	if e.err != nil {
+		return e.err
+	}
+	return e.iter.Error()
+}
+
+// Close closes the iterator and returns any accumulated error.
+func (e *ExportIter) Close() error {
+	return firstError(e.err, e.iter.Close())
+}
@@ -0,0 +1,187 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble/internal/testkeys"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportRange(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := &Options{
+		FS:                 mem,
+		Comparer:           testkeys.Comparer,
+		FormatMajorVersion: FormatNewest,
+		Levels:             []LevelOptions{{BlockSize: 1, TargetFileSize: 1}},
+	}
+	d, err := Open("src", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	for c := 'a'; c <= 'z'; c++ {
+		require.NoError(t, d.Set([]byte{byte(c)}, []byte(strings.Repeat(string(c), 100)), nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Delete([]byte("d"), nil))
+	require.NoError(t, d.Merge([]byte("e"), []byte("-merged"), nil))
+	require.NoError(t, d.DeleteRange([]byte("g"), []byte("i"), nil))
+	require.NoError(t, d.RangeKeySet([]byte("j"), []byte("l"), []byte("@5"), []byte("rk"), nil))
+	require.NoError(t, d.RangeKeySet([]byte("k"), []byte("q"), []byte("@3"), []byte("rk2"), nil))
+
+	// Changes after the export are not included.
+	snapshot := func(d *DB) string {
+		iter, err := d.NewIter(&IterOptions{
+			LowerBound: []byte("c"),
+			UpperBound: []byte("m"),
+			KeyTypes:   IterKeyTypePointsAndRanges,
+		})
+		require.NoError(t, err)
+		defer func() { require.NoError(t, iter.Close()) }()
+		var buf strings.Builder
+		for valid := iter.First(); valid; valid = iter.Next() {
+			hasPoint, hasRange := iter.HasPointAndRange()
+			fmt.Fprintf(&buf, "%s:", iter.Key())
+			if hasPoint {
+				fmt.Fprintf(&buf, " %s", iter.Value())
+			}
+			if hasRange {
+				start, end := iter.RangeBounds()
+				fmt.Fprintf(&buf, " [%s-%s)", start, end)
+				for _, rk := range iter.RangeKeys() {
+					fmt.Fprintf(&buf, " %s=%s", rk.Suffix, rk.Value)
+				}
+			}
+			buf.WriteString("\n")
+		}
+		return buf.String()
+	}
+	expected := snapshot(d)
+
+	paths, err := d.ExportRange([]byte("c"), []byte("m"), "export")
+	require.NoError(t, err)
+	require.Greater(t, len(paths), 1)
+	require.NoError(t, d.Set([]byte("f"), []byte("after"), nil))
+
+	// The destination directory must not already exist.
+	_, err = d.ExportRange([]byte("c"), []byte("m"), "export")
+	require.True(t, oserror.IsExist(err), "%v", err)
+	_, err = d.ExportRange([]byte("m"), []byte("c"), "export2")
+	require.Error(t, err)
+
+	// The exported sstables can be ingested into a fresh DB.
+	d2, err := Open("dst", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d2.Close()) }()
+	require.NoError(t, d2.Ingest(paths))
+	// The sstables don't overlap, so they're all ingested into L6.
+	require.Equal(t, int64(len(paths)), d2.Metrics().Levels[6].NumFiles)
+	require.Equal(t, expected, snapshot(d2))
+	require.Contains(t, expected, "e: "+strings.Repeat("e", 100)+"-merged\n")
+	require.NotContains(t, expected, "d:")
+	require.NotContains(t, expected, "g:")
+}
+
+func TestExportIter(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	for c := 'a'; c <= 'j'; c++ {
+		require.NoError(t, d.Set([]byte{byte(c)}, []byte(strings.Repeat(string(c), int(c-'a'+1))), nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.DeleteRange([]byte("b"), []byte("d"), nil))
+	require.NoError(t, d.Merge([]byte("e"), []byte("-merged"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Delete([]byte("g"), nil))
+	require.NoError(t, d.DeleteRange([]byte("h"), []byte("j"), nil))
+	require.NoError(t, d.Set([]byte("i"), []byte("new"), nil))
+
+	export := func(o *IterOptions, reverse bool) []string {
+		iter, err := d.NewExportIter(o, reverse)
+		require.NoError(t, err)
+		// Changes after the iterator is created are not included.
+		require.NoError(t, d.Set([]byte("f"), []byte("later"), nil))
+		require.NoError(t, d.Set([]byte("z"), []byte("later"), nil))
+		defer func() {
+			require.NoError(t, d.Set([]byte("f"), []byte("ffffff"), nil))
+			require.NoError(t, d.Delete([]byte("z"), nil))
+		}()
+
+		var res []string
+		for iter.Next() {
+			n := iter.ValueLen()
+			v, err := iter.Value()
+			require.NoError(t, err)
+			require.Equal(t, n, len(v))
+			res = append(res, fmt.Sprintf("%s:%s", iter.Key(), v))
+		}
+		require.NoError(t, iter.Close())
+		return res
+	}
+
+	forward := []string{"a:a", "d:dddd", "e:eeeee-merged", "f:ffffff", "i:new", "j:jjjjjjjjjj"}
+	require.Equal(t, forward, export(nil, false))
+	var reverse []string
+	for i := len(forward) - 1; i >= 0; i-- {
+		reverse = append(reverse, forward[i])
+	}
+	require.Equal(t, reverse, export(nil, true))
+	require.Equal(t, []string{"i:new", "f:ffffff", "e:eeeee-merged"},
+		export(&IterOptions{LowerBound: []byte("e"), UpperBound: []byte("j")}, true))
+
+	_, err = d.NewExportIter(&IterOptions{KeyTypes: IterKeyTypePointsAndRanges}, false)
+	require.Error(t, err)
+}
+
+func TestExportIterShadowedVersionCount(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem(), DisableAutomaticCompactions: true})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Versions are spread across the memtable and flushed sstables.
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("c"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("d"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("a"), []byte("2"), nil))
+	require.NoError(t, d.Delete([]byte("b"), nil))
+	require.NoError(t, d.Set([]byte("c"), []byte("2"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("a"), []byte("3"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("3"), nil))
+	require.NoError(t, d.Merge([]byte("c"), []byte("3"), nil))
+	require.NoError(t, d.Merge([]byte("c"), []byte("4"), nil))
+	require.NoError(t, d.DeleteRange([]byte("d"), []byte("e"), nil))
+	require.NoError(t, d.Set([]byte("d"), []byte("3"), nil))
+	require.NoError(t, d.Set([]byte("e"), []byte("1"), nil))
+
+	iter, err := d.NewExportIter(nil, false /* reverse */)
+	require.NoError(t, err)
+	got := make(map[string]int)
+	for iter.Next() {
+		got[string(iter.Key())] = iter.ShadowedVersionCount()
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, map[string]int{
+		// Two older SETs.
+		"a": 2,
+		// The DEL and the SET below it.
+		"b": 2,
+		// The MERGEs and the SET below them contribute, but not the oldest SET.
+		"c": 1,
+		// The range deletion, which hides the older SET.
+		"d": 1,
+		"e": 0,
+	}, got)
+}
@@ -0,0 +1,51 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+// MemtableInfo describes an immutable memtable that's ready to be flushed, as
+// passed to Options.FlushSelector.
+type MemtableInfo struct {
+	// Size is the number of bytes in use by the memtable.
+	Size uint64
+	// L0Overlaps is the number of L0 sstables whose key ranges overlap the keys
+	// of the memtable.
+	L0Overlaps int
+}
+
+// selectFlushLocked returns the number of memtables at the head of the queue
+// to flush, given the n that are ready to be flushed, as chosen by
+// Options.FlushSelector. Since memtables must be flushed oldest first for
+// their WALs to be reclaimed, the flush includes the selected memtable and
+// all older memtables.
+//
+// d.mu must be held when calling this.
+func (d *DB) selectFlushLocked(n int) int {
+	var l0 []bounded
+	iter := d.mu.versions.currentVersion().Levels[0].Iter()
+	for f := iter.First(); f != nil; f = iter.Next() {
+		l0 = append(l0, f)
+	}
+	candidates := make([]MemtableInfo, n)
+	for i := range candidates {
+		mem := d.mu.mem.queue[i]
+		candidates[i].Size = mem.inuseBytes()
+		mem.computePossibleOverlaps(func(bounded) shouldContinue {
+			candidates[i].L0Overlaps++
+			return continueIteration
+		}, l0...)
+	}
+	i := d.opts.FlushSelector(candidates)
+	if i < 0 || i >= n {
+		d.opts.Logger.Errorf("pebble: FlushSelector selected memtable %d of %d; flushing all of them", i, n)
+		return n
+	}
+	// Flushable batches share the WAL of the memtable preceding them, so they
+	// must be flushed along with it.
+	selected := i + 1
+	for selected < n && d.mu.mem.queue[selected].logNum == d.mu.mem.queue[selected-1].logNum {
+		selected++
+	}
+	return selected
+}
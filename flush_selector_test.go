@@ -0,0 +1,86 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlushSelector(t *testing.T) {
+	var mu sync.Mutex
+	var candidates [][]MemtableInfo
+	var flushed []int
+	selected := 1
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		FlushSelector: func(c []MemtableInfo) int {
+			mu.Lock()
+			defer mu.Unlock()
+			candidates = append(candidates, append([]MemtableInfo(nil), c...))
+			return selected
+		},
+		EventListener: &EventListener{
+			FlushEnd: func(info FlushInfo) {
+				mu.Lock()
+				defer mu.Unlock()
+				flushed = append(flushed, info.Input)
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), nil, nil))
+	require.NoError(t, d.Set([]byte("c"), nil, nil))
+	require.NoError(t, d.Flush())
+
+	// queueAndFlush queues a memtable containing each of the keys, and then
+	// flushes them.
+	queueAndFlush := func(keys ...string) {
+		d.mu.Lock()
+		d.mu.compact.flushing = true
+		d.mu.Unlock()
+		var chs []<-chan struct{}
+		for _, k := range keys {
+			require.NoError(t, d.Set([]byte(k), nil, nil))
+			ch, err := d.AsyncFlush()
+			require.NoError(t, err)
+			chs = append(chs, ch)
+		}
+		d.mu.Lock()
+		d.mu.compact.flushing = false
+		d.maybeScheduleFlush()
+		d.mu.Unlock()
+		for _, ch := range chs {
+			<-ch
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, c := range candidates {
+			for i := range c {
+				require.Greater(t, c[i].Size, uint64(0))
+				c[i].Size = 0
+			}
+		}
+	}
+
+	// The second memtable overlaps the L0 sstable. Selecting it flushes it
+	// along with the older memtable, and the newest memtable is flushed
+	// separately. The first flush is that of the L0 sstable.
+	queueAndFlush("x", "b", "y")
+	require.Equal(t, [][]MemtableInfo{{{}, {L0Overlaps: 1}, {}}}, candidates)
+	require.Equal(t, []int{1, 2, 1}, flushed)
+
+	// An invalid selection flushes all the memtables.
+	candidates, flushed, selected = nil, nil, 3
+	queueAndFlush("x", "y", "z")
+	require.Len(t, candidates, 1)
+	require.Equal(t, []int{3}, flushed)
+}
@@ -115,3 +115,85 @@ func TestFlushEmptyKey(t *testing.T) {
 	require.NoError(t, closer.Close())
 	require.NoError(t, d.Close())
 }
+
+func TestFlushMemTableMaxAge(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:             vfs.NewMem(),
+		MemTableMaxAge: 20 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// An empty memtable is never flushed.
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, int64(0), d.Metrics().Flush.Count)
+	require.Zero(t, d.Metrics().MemTable.OldestEntryAge)
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("2"), nil))
+	require.Positive(t, d.Metrics().MemTable.OldestEntryAge)
+	require.Eventually(t, func() bool {
+		return d.Metrics().Levels[0].NumFiles == 1
+	}, 10*time.Second, time.Millisecond)
+	m := d.Metrics()
+	require.Equal(t, int64(1), m.Flush.Count)
+	require.Zero(t, m.MemTable.OldestEntryAge)
+	require.Zero(t, d.MetricsSnapshot().MemTableOldestEntryAgeNanos)
+
+	// The new mutable memtable is flushed once it's written to.
+	require.NoError(t, d.Set([]byte("c"), []byte("3"), nil))
+	require.Eventually(t, func() bool {
+		return d.Metrics().Flush.Count == 2
+	}, 10*time.Second, time.Millisecond)
+}
+
+func TestDeterministicFlushOutput(t *testing.T) {
+	// flush writes the same keys to a DB and flushes them, returning the bounds
+	// of the flush's output sstables. If populateL0 is set, the DB's L0 first
+	// holds other sstables that overlap the keys.
+	flush := func(deterministic, populateL0 bool) []string {
+		var outputs []string
+		opts := &Options{
+			FS:                          vfs.NewMem(),
+			DisableAutomaticCompactions: true,
+			DeterministicFlushOutput:    deterministic,
+			FlushSplitBytes:             1 << 10,
+			EventListener: &EventListener{
+				FlushEnd: func(info FlushInfo) {
+					outputs = outputs[:0]
+					for _, o := range info.Output {
+						outputs = append(outputs, fmt.Sprintf("%s-%s", o.Smallest.UserKey, o.Largest.UserKey))
+					}
+				},
+			},
+		}
+		opts.Levels = make([]LevelOptions, numLevels)
+		for i := range opts.Levels {
+			opts.Levels[i].TargetFileSize = 16 << 10
+		}
+		d, err := Open("", opts)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, d.Close()) }()
+		if populateL0 {
+			for i := 0; i < 4; i++ {
+				for j := i; j < 2000; j += 10 {
+					require.NoError(t, d.Set([]byte(fmt.Sprintf("k%04d", j)), make([]byte, 100), nil))
+				}
+				require.NoError(t, d.Flush())
+			}
+		}
+		for j := 0; j < 2000; j++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("k%04d", j)), make([]byte, 100), nil))
+		}
+		require.NoError(t, d.Flush())
+		require.NoError(t, d.CheckLevels(nil /* stats */))
+		return outputs
+	}
+
+	// By default, the L0 sublevels' flush split keys split the flush further.
+	require.NotEqual(t, flush(false, false), flush(false, true))
+
+	want := flush(true, false)
+	require.Greater(t, len(want), 1)
+	require.Equal(t, want, flush(true, true))
+}
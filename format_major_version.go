@@ -187,6 +187,20 @@ const (
 
 	// TODO(msbutler): add major version for synthetic suffixes
 
+	// FormatMaxKeyValueSizes is a format major version that persists the
+	// high-water marks of the sizes of the keys and values committed to the DB
+	// (see Metrics.Keys.MaxKeySize) in a new, backward-incompatible field of
+	// the Manifest, and therefore requires a format major version.
+	FormatMaxKeyValueSizes
+
+	// FormatCompressionDictionaries is a format major version that adds support
+	// for sstables whose data blocks are compressed using a zstd dictionary
+	// stored in the sstable (see LevelOptions.CompressionDictionary). Older
+	// versions of Pebble can't decompress such blocks, so the dictionary is
+	// only used with the sstable format TableFormatPebblev5, which requires a
+	// format major version.
+	FormatCompressionDictionaries
+
 	// -- Add new versions here --
 
 	// FormatNewest is the most recent format major version.
@@ -222,8 +236,11 @@ func (v FormatMajorVersion) MaxTableFormat() sstable.TableFormat {
 	switch v {
 	case FormatDefault, FormatFlushableIngest, FormatPrePebblev1MarkedCompacted:
 		return sstable.TableFormatPebblev3
-	case FormatDeleteSizedAndObsolete, FormatVirtualSSTables, FormatSyntheticPrefixSuffix:
+	case FormatDeleteSizedAndObsolete, FormatVirtualSSTables, FormatSyntheticPrefixSuffix,
+		FormatMaxKeyValueSizes:
 		return sstable.TableFormatPebblev4
+	case FormatCompressionDictionaries:
+		return sstable.TableFormatPebblev5
 	default:
 		panic(fmt.Sprintf("pebble: unsupported format major version: %s", v))
 	}
@@ -234,7 +251,8 @@ func (v FormatMajorVersion) MaxTableFormat() sstable.TableFormat {
 func (v FormatMajorVersion) MinTableFormat() sstable.TableFormat {
 	switch v {
 	case FormatDefault, FormatFlushableIngest, FormatPrePebblev1MarkedCompacted,
-		FormatDeleteSizedAndObsolete, FormatVirtualSSTables, FormatSyntheticPrefixSuffix:
+		FormatDeleteSizedAndObsolete, FormatVirtualSSTables, FormatSyntheticPrefixSuffix,
+		FormatMaxKeyValueSizes, FormatCompressionDictionaries:
 		return sstable.TableFormatPebblev1
 	default:
 		panic(fmt.Sprintf("pebble: unsupported format major version: %s", v))
@@ -271,6 +289,12 @@ var formatMajorVersionMigrations = map[FormatMajorVersion]func(*DB) error{
 	FormatSyntheticPrefixSuffix: func(d *DB) error {
 		return d.finalizeFormatVersUpgrade(FormatSyntheticPrefixSuffix)
 	},
+	FormatMaxKeyValueSizes: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(FormatMaxKeyValueSizes)
+	},
+	FormatCompressionDictionaries: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(FormatCompressionDictionaries)
+	},
 }
 
 const formatVersionMarkerName = `format-version`
@@ -400,6 +424,12 @@ func (d *DB) writeFormatVersionMarker(formatVers FormatMajorVersion) error {
 func (d *DB) compactMarkedFilesLocked() error {
 	curr := d.mu.versions.currentVersion()
 	for curr.Stats.MarkedForCompaction > 0 {
+		// No compaction is scheduled while the DB is quiesced or compactions
+		// are paused, so wait until they're allowed.
+		if err := d.waitForCompactionsAllowedLocked(); err != nil {
+			return err
+		}
+
 		// Attempt to schedule a compaction to rewrite a file marked for
 		// compaction.
 		d.maybeScheduleCompactionPicker(func(picker compactionPicker, env compactionEnv) *pickedCompaction {
@@ -266,6 +266,7 @@ func (g *getIter) getSSTableIterators(
 	if err != nil {
 		return emptyIter, nil, err
 	}
+	m.Reads.Add(1)
 	return iters.Point(), iters.RangeDeletion(), nil
 }
 
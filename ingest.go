@@ -252,6 +252,19 @@ func ingestLoad1(
 	readable objstorage.Readable,
 	cacheID uint64,
 	fileNum base.FileNum,
+) (*fileMetadata, error) {
+	return loadTableMeta(opts, fmv, readable, cacheID, fileNum, ingestValidateKey)
+}
+
+// loadTableMeta creates the FileMetadata for one sstable, computing its bounds
+// from its contents. Each key bounding the sstable is checked by validateKey.
+func loadTableMeta(
+	opts *Options,
+	fmv FormatMajorVersion,
+	readable objstorage.Readable,
+	cacheID uint64,
+	fileNum base.FileNum,
+	validateKey func(opts *Options, key *InternalKey) error,
 ) (*fileMetadata, error) {
 	cacheOpts := private.SSTableCacheOpts(cacheID, base.PhysicalTableDiskFileNum(fileNum)).(sstable.ReaderOption)
 	r, err := sstable.NewReader(readable, opts.MakeReaderOptions(), cacheOpts)
@@ -297,7 +310,7 @@ func ingestLoad1(
 		defer iter.Close()
 		var smallest InternalKey
 		if kv := iter.First(); kv != nil {
-			if err := ingestValidateKey(opts, &kv.K); err != nil {
+			if err := validateKey(opts, &kv.K); err != nil {
 				return nil, err
 			}
 			smallest = kv.K.Clone()
@@ -306,7 +319,7 @@ func ingestLoad1(
 			return nil, err
 		}
 		if kv := iter.Last(); kv != nil {
-			if err := ingestValidateKey(opts, &kv.K); err != nil {
+			if err := validateKey(opts, &kv.K); err != nil {
 				return nil, err
 			}
 			meta.ExtendPointKeyBounds(opts.Comparer.Compare, smallest, kv.K.Clone())
@@ -327,7 +340,7 @@ func ingestLoad1(
 			return nil, err
 		} else if s != nil {
 			key := s.SmallestKey()
-			if err := ingestValidateKey(opts, &key); err != nil {
+			if err := validateKey(opts, &key); err != nil {
 				return nil, err
 			}
 			smallest = key.Clone()
@@ -336,7 +349,7 @@ func ingestLoad1(
 			return nil, err
 		} else if s != nil {
 			k := s.SmallestKey()
-			if err := ingestValidateKey(opts, &k); err != nil {
+			if err := validateKey(opts, &k); err != nil {
 				return nil, err
 			}
 			largest := s.LargestKey().Clone()
@@ -357,7 +370,7 @@ func ingestLoad1(
 				return nil, err
 			} else if s != nil {
 				key := s.SmallestKey()
-				if err := ingestValidateKey(opts, &key); err != nil {
+				if err := validateKey(opts, &key); err != nil {
 					return nil, err
 				}
 				smallest = key.Clone()
@@ -366,7 +379,7 @@ func ingestLoad1(
 				return nil, err
 			} else if s != nil {
 				k := s.SmallestKey()
-				if err := ingestValidateKey(opts, &k); err != nil {
+				if err := validateKey(opts, &k); err != nil {
 					return nil, err
 				}
 				// As range keys are fragmented, the end key of the last range key in
@@ -1029,10 +1042,51 @@ func (d *DB) Ingest(paths []string) error {
 	if d.opts.ReadOnly {
 		return ErrReadOnly
 	}
-	_, err := d.ingest(paths, nil /* shared */, KeyRange{}, false, nil /* external */)
+	_, err := d.ingest(context.Background(), paths, nil /* shared */, KeyRange{}, false, nil /* external */, IngestOptions{})
 	return err
 }
 
+// IngestWithContext does the same as IngestWithStats, but stops waiting and
+// fails with ctx's error if ctx is done while the ingestion is stalled by
+// Options.L0ResumeWritesThreshold.
+func (d *DB) IngestWithContext(ctx context.Context, paths []string) (IngestOperationStats, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return IngestOperationStats{}, ErrReadOnly
+	}
+	return d.ingest(ctx, paths, nil /* shared */, KeyRange{}, false, nil /* external */, IngestOptions{})
+}
+
+// IngestOptions configures an ingestion performed by DB.IngestWithOptions.
+type IngestOptions struct {
+	// CompactAfterIngest, if true, makes the ingestion wait until the ingested
+	// sstables have been compacted out of L0 before returning, scheduling
+	// compactions of L0 scoped to the key range of the ingested sstables still
+	// in L0 as necessary. Ingested sstables otherwise remain in L0 until picked
+	// by automatic compactions, increasing read amplification, which matters
+	// if the ingested key range is read heavily right after the ingestion.
+	// Ingested sstables placed below L0 require no compaction.
+	CompactAfterIngest bool
+}
+
+// IngestWithOptions does the same as IngestWithContext, configured by opts.
+// If opts.CompactAfterIngest is set and ctx is done before the ingested
+// sstables have been compacted out of L0, IngestWithOptions returns ctx's
+// error, although the ingestion itself is complete.
+func (d *DB) IngestWithOptions(
+	ctx context.Context, paths []string, opts IngestOptions,
+) (IngestOperationStats, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return IngestOperationStats{}, ErrReadOnly
+	}
+	return d.ingest(ctx, paths, nil /* shared */, KeyRange{}, false, nil /* external */, opts)
+}
+
 // IngestOperationStats provides some information about where in the LSM the
 // bytes were ingested.
 type IngestOperationStats struct {
@@ -1047,6 +1101,12 @@ type IngestOperationStats struct {
 	// MemtableOverlappingFiles is the count of ingested sstables
 	// that overlapped keys in the memtables.
 	MemtableOverlappingFiles int
+	// Level is the smallest-numbered level the ingested sstables were placed
+	// in, or -1 if they were ingested as flushables and will be placed in the
+	// LSM when flushed. With IngestOptions.CompactAfterIngest, it's the
+	// smallest-numbered level holding the ingested sstables, or the sstables
+	// they were compacted into, once they left L0.
+	Level int
 }
 
 // ExternalFile are external sstables that can be referenced through
@@ -1117,7 +1177,7 @@ func (d *DB) IngestWithStats(paths []string) (IngestOperationStats, error) {
 	if d.opts.ReadOnly {
 		return IngestOperationStats{}, ErrReadOnly
 	}
-	return d.ingest(paths, nil, KeyRange{}, false, nil)
+	return d.ingest(context.Background(), paths, nil, KeyRange{}, false, nil, IngestOptions{})
 }
 
 // IngestExternalFiles does the same as IngestWithStats, and additionally
@@ -1135,7 +1195,7 @@ func (d *DB) IngestExternalFiles(external []ExternalFile) (IngestOperationStats,
 	if d.opts.Experimental.RemoteStorage == nil {
 		return IngestOperationStats{}, errors.New("pebble: cannot ingest external files without shared storage configured")
 	}
-	return d.ingest(nil, nil, KeyRange{}, false, external)
+	return d.ingest(context.Background(), nil, nil, KeyRange{}, false, external, IngestOptions{})
 }
 
 // IngestAndExcise does the same as IngestWithStats, and additionally accepts a
@@ -1176,7 +1236,7 @@ func (d *DB) IngestAndExcise(
 			v, FormatMinForSharedObjects,
 		)
 	}
-	return d.ingest(paths, shared, exciseSpan, sstsContainExciseTombstone, external)
+	return d.ingest(context.Background(), paths, shared, exciseSpan, sstsContainExciseTombstone, external, IngestOptions{})
 }
 
 // Both DB.mu and commitPipeline.mu must be held while this is called.
@@ -1298,11 +1358,13 @@ func (d *DB) handleIngestAsFlushable(
 
 // See comment at Ingest() for details on how this works.
 func (d *DB) ingest(
+	ctx context.Context,
 	paths []string,
 	shared []SharedSSTMeta,
 	exciseSpan KeyRange,
 	sstsContainExciseTombstone bool,
 	external []ExternalFile,
+	opts IngestOptions,
 ) (IngestOperationStats, error) {
 	if len(shared) > 0 && d.opts.Experimental.RemoteStorage == nil {
 		panic("cannot ingest shared sstables with nil SharedStorage")
@@ -1320,13 +1382,28 @@ func (d *DB) ingest(
 			}
 		}
 	}
-	ctx := context.Background()
+	if err := d.waitForL0Headroom(ctx); err != nil {
+		return IngestOperationStats{}, err
+	}
 	// Allocate file numbers for all of the files being ingested and mark them as
 	// pending in order to prevent them from being deleted. Note that this causes
 	// the file number ordering to be out of alignment with sequence number
 	// ordering. The sorting of L0 tables by sequence number avoids relying on
 	// that (busted) invariant.
 	d.mu.Lock()
+	// Wait for the DB to be released if it's quiesced; see DB.Quiesce. The
+	// ingestion is then counted until it's complete, so that the DB can't be
+	// quiesced while it's linking sstables or applying its version edit.
+	for d.mu.compact.quiesced {
+		d.mu.compact.cond.Wait()
+	}
+	d.mu.compact.ingestingCount++
+	defer func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.mu.compact.ingestingCount--
+		d.mu.compact.cond.Broadcast()
+	}()
 	pendingOutputs := make([]base.FileNum, len(paths)+len(shared)+len(external))
 	for i := 0; i < len(paths)+len(shared)+len(external); i++ {
 		pendingOutputs[i] = d.mu.versions.getNextFileNum()
@@ -1608,7 +1685,9 @@ func (d *DB) ingest(
 		seqNumCount++
 	}
 	d.commit.ingestSem <- struct{}{}
-	d.commit.AllocateSeqNum(seqNumCount, prepare, apply)
+	if allocErr := d.commit.AllocateSeqNum(seqNumCount, prepare, apply); allocErr != nil {
+		err = allocErr
+	}
 	<-d.commit.ingestSem
 
 	if err != nil {
@@ -1644,9 +1723,11 @@ func (d *DB) ingest(
 			TableInfo
 			Level int
 		}, len(ve.NewFiles))
+		stats.Level = numLevels
 		for i := range ve.NewFiles {
 			e := &ve.NewFiles[i]
 			info.Tables[i].Level = e.Level
+			stats.Level = min(stats.Level, e.Level)
 			info.Tables[i].TableInfo = e.Meta.TableInfo()
 			stats.Bytes += e.Meta.Size
 			if e.Level == 0 {
@@ -1662,6 +1743,7 @@ func (d *DB) ingest(
 			TableInfo
 			Level int
 		}, len(loadResult.local))
+		stats.Level = -1
 		for i, f := range loadResult.local {
 			info.Tables[i].Level = -1
 			info.Tables[i].TableInfo = f.TableInfo()
@@ -1682,9 +1764,133 @@ func (d *DB) ingest(
 	}
 	d.opts.EventListener.TableIngested(info)
 
+	if err == nil && opts.CompactAfterIngest {
+		stats.Level, err = d.compactIngestedOutOfL0(ctx, loadResult, asFlushable)
+	}
 	return stats, err
 }
 
+// compactIngestedOutOfL0 waits until the ingested sstables have left L0,
+// first flushing them if they were ingested as flushables, and scheduling
+// manual compactions of the ingested sstables remaining in L0. It returns the
+// smallest-numbered level holding the ingested sstables or the sstables they
+// were compacted into. See IngestOptions.CompactAfterIngest.
+func (d *DB) compactIngestedOutOfL0(
+	ctx context.Context, loadResult ingestLoadResult, asFlushable bool,
+) (level int, _ error) {
+	if asFlushable {
+		// The ingested sstables join the LSM once the flushable is flushed.
+		flushed, err := d.AsyncFlush()
+		if err != nil {
+			return -1, err
+		}
+		select {
+		case <-flushed:
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		}
+	}
+
+	ingested := make(map[base.FileNum]struct{}, loadResult.fileCount())
+	var smallest, largest []byte
+	addFile := func(m *fileMetadata) {
+		ingested[m.FileNum] = struct{}{}
+		if smallest == nil || d.cmp(m.Smallest.UserKey, smallest) < 0 {
+			smallest = m.Smallest.UserKey
+		}
+		if largest == nil || d.cmp(m.Largest.UserKey, largest) > 0 {
+			largest = m.Largest.UserKey
+		}
+	}
+	for i := range loadResult.local {
+		addFile(loadResult.local[i].fileMetadata)
+	}
+	for i := range loadResult.shared {
+		addFile(loadResult.shared[i].fileMetadata)
+	}
+	for i := range loadResult.external {
+		addFile(loadResult.external[i].fileMetadata)
+	}
+
+	bounds := base.UserKeyBoundsInclusive(smallest, largest)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	compacted := false
+	for {
+		// Find the key range of the ingested sstables still in L0.
+		cur := d.mu.versions.currentVersion()
+		var start, end []byte
+		l0 := cur.Overlaps(0, bounds)
+		iter := l0.Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			if _, ok := ingested[f.FileNum]; !ok {
+				continue
+			}
+			if start == nil || d.cmp(f.Smallest.UserKey, start) < 0 {
+				start = f.Smallest.UserKey
+			}
+			if end == nil || d.cmp(f.Largest.UserKey, end) > 0 {
+				end = f.Largest.UserKey
+			}
+		}
+		if start == nil {
+			// L0 compactions output to the base level, so that's the level of
+			// any ingested sstables that were compacted.
+			baseLevel := d.mu.versions.picker.getBaseLevel()
+			for l := 1; l < numLevels; l++ {
+				if compacted && l == baseLevel {
+					return l, nil
+				}
+				files := cur.Overlaps(l, bounds)
+				iter := files.Iter()
+				for f := iter.First(); f != nil; f = iter.Next() {
+					if _, ok := ingested[f.FileNum]; ok {
+						return l, nil
+					}
+				}
+			}
+			return baseLevel, nil
+		}
+		if d.mu.compact.paused && !d.opts.QueueManualCompactionsWhilePaused {
+			return 0, ErrCompactionsPaused
+		}
+
+		manual := &manualCompaction{
+			level: 0,
+			done:  make(chan error, 1),
+			start: start,
+			end:   end,
+		}
+		d.mu.compact.manual = append(d.mu.compact.manual, manual)
+		d.maybeScheduleCompaction()
+		d.mu.Unlock()
+		var err error
+		select {
+		case err = <-manual.done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		d.mu.Lock()
+		if ctx.Err() != nil {
+			// Remove the compaction from the queue if it hasn't been picked
+			// yet.
+			for i := range d.mu.compact.manual {
+				if d.mu.compact.manual[i] == manual {
+					d.mu.compact.manual = append(d.mu.compact.manual[:i], d.mu.compact.manual[i+1:]...)
+					break
+				}
+			}
+			return 0, ctx.Err()
+		}
+		// A cancelled compaction (e.g. by a concurrent ingestion) is retried.
+		if err != nil && !errors.Is(err, ErrCancelledCompaction) {
+			return 0, err
+		}
+		compacted = true
+	}
+}
+
 // excise updates ve to include a replacement of the file m with new virtual
 // sstables that exclude exciseSpan, returning a slice of newly-created files if
 // any. If the entirety of m is deleted by exciseSpan, no new sstables are added
@@ -0,0 +1,246 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// KVStreamFormat identifies the encoding of a stream of keys read by
+// DB.IngestStream.
+type KVStreamFormat int
+
+const (
+	// KVStreamFormatBatchRecords encodes each record as in the representation
+	// of a Batch: a byte holding the InternalKeyKind, followed by the key and,
+	// for kinds with values, the value, each prefixed by its length as a
+	// uvarint. The records of Batch.Repr, following its 12-byte header, are
+	// thus a valid stream if they are sorted.
+	//
+	// The supported kinds are SET, MERGE and DEL point keys, and RANGEDEL range
+	// deletions, whose value is the exclusive end key of the range.
+	KVStreamFormatBatchRecords KVStreamFormat = iota
+)
+
+// IngestStream builds sstables from a stream of records sorted by key, read
+// from r until EOF, and ingests them as with DB.Ingest. The sstables are split
+// at the target file size of the bottommost level, and are written straight to
+// the DB's directory, from which they're linked into the DB.
+//
+// The point keys must be strictly increasing per the Comparer, and each range
+// deletion must start at or after the key of the preceding record. Input out
+// of order is rejected before anything is ingested. As with all ingested
+// sstables, the range deletions delete keys already in the DB, but not point
+// keys of the stream. Keys and values longer than Options.MaxBatchSize, if
+// set, are rejected as invalid records.
+func (d *DB) IngestStream(r io.Reader, format KVStreamFormat) (err error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	if format != KVStreamFormatBatchRecords {
+		return errors.Errorf("pebble: unknown stream format %d", format)
+	}
+
+	fs := d.opts.FS
+	var paths []string
+	defer func() {
+		// A successful ingestion removes the files once they're linked into the
+		// DB.
+		if err == nil {
+			return
+		}
+		for _, path := range paths {
+			if err2 := fs.Remove(path); err2 != nil && !oserror.IsNotExist(err2) {
+				d.opts.Logger.Errorf("pebble: removing %s: %v", path, err2)
+			}
+		}
+	}()
+
+	writerOpts := d.opts.MakeWriterOptions(numLevels-1, d.FormatMajorVersion().MaxTableFormat())
+	targetFileSize := uint64(d.opts.Level(numLevels - 1).TargetFileSize)
+	var w *sstable.Writer
+	defer func() {
+		if w != nil {
+			err = firstError(err, w.Close())
+		}
+	}()
+	// prevKey is the key of the preceding record, and prevPoint that of the
+	// preceding point key. rangeDelEnd is the largest end key of the range
+	// deletions written to the current sstable. So that the sstables don't
+	// overlap, the current sstable is only split at keys after prevKey, which
+	// a range deletion may start at, and at or beyond rangeDelEnd.
+	var prevKey, prevPoint, rangeDelEnd []byte
+	var hasPoint bool
+	// Keys and values are bounded as in a batch.
+	sr := kvStreamReader{r: bufio.NewReader(r), maxLen: maxBatchSize - 1}
+	if d.opts.MaxBatchSize > 0 {
+		sr.maxLen = uint64(d.opts.MaxBatchSize)
+	}
+	for {
+		kind, key, value, ok, err := sr.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		switch kind {
+		case InternalKeyKindSet, InternalKeyKindMerge, InternalKeyKindDelete:
+			if hasPoint && d.cmp(key, prevPoint) <= 0 {
+				return errors.Errorf("pebble: stream key %s is not after %s",
+					d.opts.Comparer.FormatKey(key), d.opts.Comparer.FormatKey(prevPoint))
+			}
+		case InternalKeyKindRangeDelete:
+			if d.cmp(key, value) >= 0 {
+				return errors.Errorf("pebble: stream range deletion start %s is not less than end %s",
+					d.opts.Comparer.FormatKey(key), d.opts.Comparer.FormatKey(value))
+			}
+		default:
+			return errors.Errorf("pebble: unsupported stream record kind %s", kind)
+		}
+		if prevKey != nil && d.cmp(key, prevKey) < 0 {
+			return errors.Errorf("pebble: stream key %s is before %s",
+				d.opts.Comparer.FormatKey(key), d.opts.Comparer.FormatKey(prevKey))
+		}
+
+		if w != nil && w.EstimatedSize() >= targetFileSize &&
+			d.cmp(key, prevKey) > 0 && d.cmp(key, rangeDelEnd) >= 0 {
+			err := w.Close()
+			w = nil
+			if err != nil {
+				return err
+			}
+		}
+		if w == nil {
+			d.mu.Lock()
+			fileNum := d.mu.versions.getNextDiskFileNum()
+			d.mu.Unlock()
+			path := base.MakeFilepath(fs, d.dirname, fileTypeTemp, fileNum)
+			f, err := fs.Create(path, vfs.WriteCategoryUnspecified)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, path)
+			w = sstable.NewWriter(objstorageprovider.NewFileWritable(f), writerOpts)
+			rangeDelEnd = rangeDelEnd[:0]
+		}
+
+		switch kind {
+		case InternalKeyKindSet:
+			err = w.Set(key, value)
+		case InternalKeyKindMerge:
+			err = w.Merge(key, value)
+		case InternalKeyKindDelete:
+			err = w.Delete(key)
+		case InternalKeyKindRangeDelete:
+			err = w.DeleteRange(key, value)
+			if d.cmp(value, rangeDelEnd) > 0 {
+				rangeDelEnd = append(rangeDelEnd[:0], value...)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		prevKey = append(prevKey[:0], key...)
+		if kind != InternalKeyKindRangeDelete {
+			prevPoint = append(prevPoint[:0], key...)
+			hasPoint = true
+		}
+	}
+	if w == nil {
+		return nil
+	}
+	err = w.Close()
+	w = nil
+	if err != nil {
+		return err
+	}
+	_, err = d.ingest(context.Background(), paths, nil /* shared */, KeyRange{}, false, nil /* external */, IngestOptions{})
+	return err
+}
+
+// kvStreamReader decodes the records of a stream in the
+// KVStreamFormatBatchRecords format.
+type kvStreamReader struct {
+	r   *bufio.Reader
+	buf []byte
+	// maxLen bounds the length of each key and value, which is otherwise
+	// taken from the stream.
+	maxLen uint64
+}
+
+// next returns the next record of the stream, or ok=false at the end of the
+// stream. The key and value are only valid until the next call.
+func (s *kvStreamReader) next() (kind InternalKeyKind, key, value []byte, ok bool, err error) {
+	b, err := s.r.ReadByte()
+	if err == io.EOF {
+		return 0, nil, nil, false, nil
+	} else if err != nil {
+		return 0, nil, nil, false, err
+	}
+	kind = InternalKeyKind(b)
+	s.buf = s.buf[:0]
+	var keyLen int
+	if s.buf, keyLen, err = s.readVarString(s.buf); err != nil {
+		return 0, nil, nil, false, err
+	}
+	switch kind {
+	case InternalKeyKindSet, InternalKeyKindMerge, InternalKeyKindRangeDelete:
+		if s.buf, _, err = s.readVarString(s.buf); err != nil {
+			return 0, nil, nil, false, err
+		}
+	}
+	return kind, s.buf[:keyLen], s.buf[keyLen:], true, nil
+}
+
+// readVarString appends a uvarint-length-prefixed string of the stream to buf,
+// returning its length.
+func (s *kvStreamReader) readVarString(buf []byte) ([]byte, int, error) {
+	n, err := binary.ReadUvarint(s.r)
+	if err != nil {
+		return buf, 0, errors.Wrap(noEOF(err), "pebble: invalid stream record")
+	}
+	if n > s.maxLen {
+		return buf, 0, errors.Errorf("pebble: invalid stream record: length %d exceeds %d", n, s.maxLen)
+	}
+	// The string is read in chunks so that a corrupt length doesn't allocate
+	// more memory than the stream holds.
+	for remaining := int(n); remaining > 0; {
+		chunk := min(remaining, kvStreamReadChunkSize)
+		start := len(buf)
+		buf = append(buf, make([]byte, chunk)...)
+		if _, err := io.ReadFull(s.r, buf[start:]); err != nil {
+			return buf, 0, errors.Wrap(noEOF(err), "pebble: invalid stream record")
+		}
+		remaining -= chunk
+	}
+	return buf, int(n), nil
+}
+
+// kvStreamReadChunkSize is the size of the chunks in which kvStreamReader
+// reads keys and values.
+const kvStreamReadChunkSize = 64 << 10
+
+// noEOF converts io.EOF, which within a record means it was truncated, to
+// io.ErrUnexpectedEOF.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,157 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble/batchrepr"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestStream(t *testing.T) {
+	fs := vfs.NewMem()
+	opts := &Options{FS: fs, DisableAutomaticCompactions: true, Logger: testLogger{t}}
+	opts.Levels = make([]LevelOptions, numLevels)
+	opts.Levels[numLevels-1].TargetFileSize = 4 << 10
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	require.NoError(t, d.Set([]byte("a"), []byte("old"), nil))
+	require.NoError(t, d.Set([]byte("k0500x"), []byte("old"), nil))
+	require.NoError(t, d.Set([]byte("m"), []byte("old"), nil))
+
+	// stream returns a stream of the records of the batch, which builds them.
+	stream := func(build func(b *Batch)) *bytes.Reader {
+		b := d.NewBatch()
+		build(b)
+		return bytes.NewReader(b.Repr()[batchrepr.HeaderLen:])
+	}
+	contents := func() []string {
+		iter, err := d.NewIter(nil)
+		require.NoError(t, err)
+		var res []string
+		for valid := iter.First(); valid; valid = iter.Next() {
+			res = append(res, fmt.Sprintf("%s:%s", iter.Key(), iter.Value()))
+		}
+		require.NoError(t, iter.Close())
+		return res
+	}
+	before := contents()
+
+	// Out of order and malformed streams are rejected without ingesting
+	// anything.
+	for _, tc := range []struct {
+		build func(b *Batch)
+		err   string
+	}{
+		{func(b *Batch) {
+			require.NoError(t, b.Set([]byte("b"), nil, nil))
+			require.NoError(t, b.Set([]byte("a"), nil, nil))
+		}, "is not after"},
+		{func(b *Batch) {
+			require.NoError(t, b.Set([]byte("b"), nil, nil))
+			require.NoError(t, b.Set([]byte("b"), nil, nil))
+		}, "is not after"},
+		{func(b *Batch) {
+			require.NoError(t, b.Set([]byte("c"), nil, nil))
+			require.NoError(t, b.DeleteRange([]byte("b"), []byte("d"), nil))
+		}, "is before"},
+		{func(b *Batch) {
+			require.NoError(t, b.DeleteRange([]byte("d"), []byte("b"), nil))
+		}, "is not less than end"},
+		{func(b *Batch) {
+			require.NoError(t, b.SingleDelete([]byte("b"), nil))
+		}, "unsupported stream record kind"},
+	} {
+		err := d.IngestStream(stream(tc.build), KVStreamFormatBatchRecords)
+		require.ErrorContains(t, err, tc.err)
+	}
+	r := stream(func(b *Batch) { require.NoError(t, b.Set([]byte("b"), []byte("value"), nil)) })
+	truncated := make([]byte, r.Len()-1)
+	_, _ = r.Read(truncated)
+	require.ErrorContains(t, d.IngestStream(bytes.NewReader(truncated), KVStreamFormatBatchRecords), "invalid stream record")
+	// A corrupt length is rejected without allocating it.
+	huge := binary.AppendUvarint([]byte{byte(InternalKeyKindSet)}, math.MaxUint64)
+	require.ErrorContains(t, d.IngestStream(bytes.NewReader(huge), KVStreamFormatBatchRecords), "exceeds")
+	huge = binary.AppendUvarint([]byte{byte(InternalKeyKindSet)}, 1<<30)
+	require.ErrorContains(t, d.IngestStream(bytes.NewReader(huge), KVStreamFormatBatchRecords), "invalid stream record")
+	require.Equal(t, before, contents())
+
+	// An empty stream ingests nothing.
+	require.NoError(t, d.IngestStream(bytes.NewReader(nil), KVStreamFormatBatchRecords))
+
+	require.NoError(t, d.IngestStream(stream(func(b *Batch) {
+		require.NoError(t, b.Delete([]byte("a"), nil))
+		for i := 0; i < 1000; i++ {
+			key := []byte(fmt.Sprintf("k%04d", i))
+			if i == 500 {
+				// Deletes k0500x, but not the keys of the stream.
+				require.NoError(t, b.DeleteRange(key, []byte("k0501"), nil))
+			}
+			require.NoError(t, b.Set(key, []byte(strings.Repeat("v", 20)), nil))
+		}
+		require.NoError(t, b.Merge([]byte("l"), []byte("merged"), nil))
+	}), KVStreamFormatBatchRecords))
+
+	var want []string
+	for i := 0; i < 1000; i++ {
+		want = append(want, fmt.Sprintf("k%04d:%s", i, strings.Repeat("v", 20)))
+	}
+	want = append(want, "l:merged", "m:old")
+	require.Equal(t, want, contents())
+	require.NoError(t, d.Flush())
+	tables, err := d.SSTables()
+	require.NoError(t, err)
+	var n int
+	for _, level := range tables {
+		n += len(level)
+	}
+	require.Greater(t, n, 2)
+
+	// The temporary files were removed.
+	ls, err := fs.List("")
+	require.NoError(t, err)
+	for _, name := range ls {
+		require.NotContains(t, name, "dbtmp")
+	}
+}
+
+func TestIngestStreamSplit(t *testing.T) {
+	opts := &Options{FS: vfs.NewMem(), DisableAutomaticCompactions: true, Logger: testLogger{t}}
+	opts.Levels = make([]LevelOptions, numLevels)
+	// Split the stream after every record where possible.
+	opts.Levels[numLevels-1].TargetFileSize = 1
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// A range deletion starting at the key of the preceding record stays in
+	// its sstable, which would otherwise overlap the next one.
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("a"), []byte("v"), nil))
+	require.NoError(t, b.Set([]byte("k"), []byte("v"), nil))
+	require.NoError(t, b.DeleteRange([]byte("k"), []byte("m"), nil))
+	require.NoError(t, b.Set([]byte("z"), []byte("v"), nil))
+	require.NoError(t, d.IngestStream(bytes.NewReader(b.Repr()[batchrepr.HeaderLen:]), KVStreamFormatBatchRecords))
+
+	iter, err := d.NewIter(nil)
+	require.NoError(t, err)
+	var keys []string
+	for valid := iter.First(); valid; valid = iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, []string{"a", "k", "z"}, keys)
+	tables, err := d.SSTables()
+	require.NoError(t, err)
+	require.Len(t, tables[numLevels-1], 3)
+}
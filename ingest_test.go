@@ -2809,6 +2809,7 @@ func TestIngestStats(t *testing.T) {
 		} else {
 			require.EqualValues(t, 0, stats.ApproxIngestedIntoL0Bytes)
 		}
+		require.Equal(t, expectedLevel, stats.Level)
 		require.Less(t, uint64(0), stats.Bytes)
 	}
 	ingest(6, "a")
@@ -2818,6 +2819,62 @@ func TestIngestStats(t *testing.T) {
 	require.NoError(t, d.Close())
 }
 
+func TestIngestCompactAfterIngest(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{
+		FS:                          mem,
+		DisableAutomaticCompactions: true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	ingest := func(ctx context.Context, keys ...string) (IngestOperationStats, error) {
+		t.Helper()
+		f, err := mem.Create("ext", vfs.WriteCategoryUnspecified)
+		require.NoError(t, err)
+		w := sstable.NewWriter(objstorageprovider.NewFileWritable(f), sstable.WriterOptions{})
+		for _, k := range keys {
+			require.NoError(t, w.Set([]byte(k), []byte(k)))
+		}
+		require.NoError(t, w.Close())
+		return d.IngestWithOptions(ctx, []string{"ext"}, IngestOptions{CompactAfterIngest: true})
+	}
+
+	// The ingested sstable overlaps an L0 sstable, so it's ingested into L0
+	// and then compacted into the base level along with it.
+	require.NoError(t, d.Set([]byte("b"), nil, nil))
+	require.NoError(t, d.Flush())
+	stats, err := ingest(context.Background(), "a", "c")
+	require.NoError(t, err)
+	require.Equal(t, 6, stats.Level)
+	require.Zero(t, d.Metrics().Levels[0].NumFiles)
+
+	// An ingested sstable overlapping the memtable is flushed first.
+	require.NoError(t, d.Set([]byte("c"), nil, nil))
+	stats, err = ingest(context.Background(), "c", "d")
+	require.NoError(t, err)
+	require.Equal(t, 6, stats.Level)
+	require.Zero(t, d.Metrics().Levels[0].NumFiles)
+
+	// An ingested sstable placed below L0 requires no compaction.
+	stats, err = ingest(context.Background(), "e")
+	require.NoError(t, err)
+	require.Equal(t, 6, stats.Level)
+
+	// Waiting for the compaction may be canceled, leaving the ingested sstable
+	// in L0.
+	require.NoError(t, d.Set([]byte("f"), nil, nil))
+	require.NoError(t, d.Flush())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ingest(ctx, "f")
+	require.ErrorIs(t, err, context.Canceled)
+	v, closer, err := d.Get([]byte("f"))
+	require.NoError(t, err)
+	require.Equal(t, "f", string(v))
+	require.NoError(t, closer.Close())
+}
+
 func TestIngestFlushQueuedLargeBatch(t *testing.T) {
 	// Verify that ingestion forces a flush of a queued large batch.
 
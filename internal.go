@@ -37,6 +37,19 @@ type InternalKey = base.InternalKey
 
 type internalIterator = base.InternalIterator
 
+// InternalIterator exports the base.InternalIterator interface, for
+// implementing the sources merged by DB.NewMergedIter.
+type InternalIterator = base.InternalIterator
+
+// InternalKV exports the base.InternalKV type.
+type InternalKV = base.InternalKV
+
+// SeekGEFlags exports the base.SeekGEFlags type.
+type SeekGEFlags = base.SeekGEFlags
+
+// SeekLTFlags exports the base.SeekLTFlags type.
+type SeekLTFlags = base.SeekLTFlags
+
 type topLevelIterator = base.TopLevelIterator
 
 // ErrCorruption is a marker to indicate that data in a file (WAL, MANIFEST,
@@ -22,6 +22,17 @@ import (
 // key after Split.
 type Compare func(a, b []byte) int
 
+// CompareRangeSuffixes returns -1, 0, or +1 depending on whether the range key
+// suffix a is 'less than', 'equal to' or 'greater than' the suffix b. The
+// empty slice must be 'less than' any non-empty slice.
+//
+// CompareRangeSuffixes orders the RANGEKEYSETs within a range key span
+// returned by an Iterator, and is used by range key masking to compare range
+// key suffixes with IterOptions.RangeKeyMasking.Suffix and with the suffixes of
+// the point keys they may mask. It allows range key suffixes (for example, MVCC
+// timestamps) to be ordered differently from the point keys containing them.
+type CompareRangeSuffixes func(a, b []byte) int
+
 // Equal returns true if a and b are equivalent.
 //
 // For a given Compare, Equal(a,b)=true iff Compare(a,b)=0; that is, Equal is a
@@ -152,6 +163,8 @@ type Comparer struct {
 	// Split defaults to a trivial implementation that returns the full key length
 	// if it is not specified.
 	Split Split
+	// CompareRangeSuffixes defaults to Compare if it is not specified.
+	CompareRangeSuffixes CompareRangeSuffixes
 
 	// FormatValue is optional.
 	FormatValue FormatValue
@@ -176,7 +189,7 @@ func (c *Comparer) EnsureDefaults() *Comparer {
 	if c.Compare == nil || c.AbbreviatedKey == nil || c.Separator == nil || c.Successor == nil || c.Name == "" {
 		panic("invalid Comparer: mandatory field not set")
 	}
-	if c.Equal != nil && c.Split != nil && c.FormatKey != nil {
+	if c.Equal != nil && c.Split != nil && c.FormatKey != nil && c.CompareRangeSuffixes != nil {
 		return c
 	}
 	n := &Comparer{}
@@ -193,14 +206,18 @@ func (c *Comparer) EnsureDefaults() *Comparer {
 	if n.FormatKey == nil {
 		n.FormatKey = DefaultFormatter
 	}
+	if n.CompareRangeSuffixes == nil {
+		n.CompareRangeSuffixes = CompareRangeSuffixes(n.Compare)
+	}
 	return n
 }
 
 // DefaultComparer is the default implementation of the Comparer interface.
 // It uses the natural ordering, consistent with bytes.Compare.
 var DefaultComparer = &Comparer{
-	Compare: bytes.Compare,
-	Equal:   bytes.Equal,
+	Compare:              bytes.Compare,
+	Equal:                bytes.Equal,
+	CompareRangeSuffixes: bytes.Compare,
 
 	AbbreviatedKey: func(key []byte) uint64 {
 		if len(key) >= 8 {
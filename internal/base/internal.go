@@ -419,6 +419,28 @@ func Visible(seqNum uint64, snapshot, batchSnapshot uint64) bool {
 		seqNum == InternalKeySeqNumMax
 }
 
+// VisibleSeqNum returns true if a key with sequence number keySeqNum is visible
+// to a reader at readSeqNum or at any of the provided snapshot sequence
+// numbers. Equivalently, it returns whether the snapshot stripe containing the
+// key is below readSeqNum or one of the snapshots, such that some reader can
+// still observe it.
+//
+// As with Visible, a key is visible at a sequence number if its sequence
+// number is strictly less than it. Keys with the batch bit set, including
+// InternalKeySeqNumMax, are always visible, since batch keys are only ever
+// observed by the batch's own reads.
+func VisibleSeqNum(snapshots []uint64, readSeqNum uint64, keySeqNum uint64) bool {
+	if Visible(keySeqNum, readSeqNum, InternalKeySeqNumMax) {
+		return true
+	}
+	for _, s := range snapshots {
+		if keySeqNum < s {
+			return true
+		}
+	}
+	return false
+}
+
 // SetKind sets the kind component of the key.
 func (k *InternalKey) SetKind(kind InternalKeyKind) {
 	k.Trailer = (k.Trailer &^ 0xff) | uint64(kind)
@@ -224,3 +224,28 @@ func TestIsExclusiveSentinel(t *testing.T) {
 		})
 	}
 }
+
+func TestVisibleSeqNum(t *testing.T) {
+	testCases := []struct {
+		snapshots  []uint64
+		readSeqNum uint64
+		keySeqNum  uint64
+		want       bool
+	}{
+		{readSeqNum: 10, keySeqNum: 9, want: true},
+		{readSeqNum: 10, keySeqNum: 10, want: false},
+		{readSeqNum: 10, keySeqNum: 11, want: false},
+		{snapshots: []uint64{5, 12}, readSeqNum: 10, keySeqNum: 11, want: true},
+		{snapshots: []uint64{5, 12}, readSeqNum: 10, keySeqNum: 12, want: false},
+		{snapshots: []uint64{5}, readSeqNum: 10, keySeqNum: 4, want: true},
+		{readSeqNum: 10, keySeqNum: 20 | InternalKeySeqNumBatch, want: true},
+		{readSeqNum: 10, keySeqNum: InternalKeySeqNumMax, want: true},
+	}
+	for _, tc := range testCases {
+		got := VisibleSeqNum(tc.snapshots, tc.readSeqNum, tc.keySeqNum)
+		if got != tc.want {
+			t.Errorf("VisibleSeqNum(%v, %d, %d) = %t, want %t",
+				tc.snapshots, tc.readSeqNum, tc.keySeqNum, got, tc.want)
+		}
+	}
+}
@@ -683,6 +683,25 @@ type Cache struct {
 //	defer c.Unref()
 //	d, err := pebble.Open(pebble.Options{Cache: c})
 func New(size int64) *Cache {
+	return newShards(size, defaultShards(size))
+}
+
+// NewWithShards creates a new cache of the specified size, like New, but with
+// the specified number of shards rather than a default derived from
+// GOMAXPROCS and the cache size. More shards reduce lock contention between
+// concurrent accesses to the cache, at the cost of each shard being given a
+// smaller fraction of the cache's capacity. A shards value less than 1 selects
+// the default.
+func NewWithShards(size int64, shards int) *Cache {
+	if shards < 1 {
+		shards = defaultShards(size)
+	}
+	return newShards(size, shards)
+}
+
+// defaultShards returns the number of shards New uses for a cache of the
+// specified size.
+func defaultShards(size int64) int {
 	// How many cache shards should we create?
 	//
 	// Note that the probability two processors will try to access the same
@@ -710,7 +729,7 @@ func New(size int64) *Cache {
 	if m > 4 && int(size)/m < minimumShardSize {
 		m = 4
 	}
-	return newShards(size, m)
+	return m
 }
 
 func newShards(size int64, shards int) *Cache {
@@ -250,6 +250,59 @@ func BenchmarkCacheGet(b *testing.B) {
 	})
 }
 
+// BenchmarkCacheGetShards measures Get throughput at high concurrency for
+// varying shard counts. Fewer shards cause goroutines to contend on the shard
+// locks.
+func BenchmarkCacheGetShards(b *testing.B) {
+	const size = 100000
+	for _, shards := range []int{1, 4, 16, 64, 256} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			// Oversize the cache so that no shard evicts blocks, regardless of
+			// how unevenly the blocks are distributed.
+			cache := NewWithShards(4*size, shards)
+			defer cache.Unref()
+
+			for i := 0; i < size; i++ {
+				v := testValue(cache, "a", 1)
+				cache.Set(1, base.DiskFileNum(0), uint64(i), v).Release()
+			}
+
+			b.ResetTimer()
+			b.SetParallelism(4)
+			b.RunParallel(func(pb *testing.PB) {
+				rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+
+				for pb.Next() {
+					h := cache.Get(1, base.DiskFileNum(0), uint64(rng.Intn(size)))
+					if h.Get() == nil {
+						b.Fatal("failed to lookup value")
+					}
+					h.Release()
+				}
+			})
+		})
+	}
+}
+
+func TestNewWithShards(t *testing.T) {
+	c := NewWithShards(100, 7)
+	defer c.Unref()
+	require.Len(t, c.shards, 7)
+	require.Equal(t, int64(100/7), c.shards[0].maxSize)
+
+	// Blocks are spread across all of the configured shards.
+	used := make(map[*shard]struct{})
+	for i := 0; i < 1000; i++ {
+		used[c.getShard(1, base.DiskFileNum(i), uint64(i))] = struct{}{}
+	}
+	require.Len(t, used, 7)
+
+	// A non-positive shard count selects the default.
+	d := NewWithShards(100, 0)
+	defer d.Unref()
+	require.Len(t, d.shards, defaultShards(100))
+}
+
 func TestReserveColdTarget(t *testing.T) {
 	// If coldTarget isn't updated when we call shard.Reserve,
 	// then we unnecessarily remove nodes from the
@@ -289,6 +289,17 @@ func (c *IterConfig) ensureDefaults() {
 type IterStats struct {
 	// Count of DELSIZED keys that were missized.
 	CountMissizedDels uint64
+	// Count of point keys read from the input iterator.
+	CountInputKeys uint64
+	// Bytes in the keys and values of the point keys read from the input
+	// iterator. For values stored in value blocks, this is the size of the
+	// value rather than that of its handle.
+	CountInputBytes uint64
+	// Count of point keys returned by the compaction iterator.
+	CountOutputKeys uint64
+	// Count of input point keys that were merged into a newer MERGE key by the
+	// Merger, rather than being returned themselves.
+	CountMergedKeys uint64
 }
 
 type iterPos int8
@@ -366,6 +377,7 @@ func (i *Iter) First() (*base.InternalKey, []byte) {
 	}
 	i.iterKV = i.iter.First()
 	if i.iterKV != nil {
+		i.countInputKey()
 		i.iterValue, _, i.err = i.iterKV.Value(nil)
 		if i.err != nil {
 			return nil, nil
@@ -381,6 +393,15 @@ func (i *Iter) First() (*base.InternalKey, []byte) {
 // returns a RANGEDEL or a range key, the caller can use Span() to get the
 // corresponding span.
 func (i *Iter) Next() (*base.InternalKey, []byte) {
+	key, value := i.next()
+	if key != nil && !rangekey.IsRangeKey(key.Kind()) && key.Kind() != base.InternalKeyKindRangeDelete {
+		i.stats.CountOutputKeys++
+	}
+	return key, value
+}
+
+// next implements Next, except for counting the output keys.
+func (i *Iter) next() (*base.InternalKey, []byte) {
 	if i.err != nil {
 		return nil, nil
 	}
@@ -665,6 +686,7 @@ func (i *Iter) skipInStripe() {
 func (i *Iter) iterNext() bool {
 	i.iterKV = i.iter.Next()
 	if i.iterKV != nil {
+		i.countInputKey()
 		i.iterValue, _, i.err = i.iterKV.Value(nil)
 		if i.err != nil {
 			i.iterKV = nil
@@ -673,6 +695,15 @@ func (i *Iter) iterNext() bool {
 	return i.iterKV != nil
 }
 
+// countInputKey counts i.iterKV in the stats if it's a point key, rather than
+// one of the interleaved range deletion or range key boundaries.
+func (i *Iter) countInputKey() {
+	if !rangekey.IsRangeKey(i.iterKV.Kind()) && i.iterKV.Kind() != base.InternalKeyKindRangeDelete {
+		i.stats.CountInputKeys++
+		i.stats.CountInputBytes += uint64(i.iterKV.K.Size() + i.iterKV.V.Len())
+	}
+}
+
 // stripeChangeType indicates how the snapshot stripe changed relative to the
 // previous key. If the snapshot stripe changed, it also indicates whether the
 // new stripe was entered because the iterator progressed onto an entirely new
@@ -876,6 +907,7 @@ func (i *Iter) mergeNext(valueMerger base.ValueMerger) {
 			if i.err != nil {
 				return
 			}
+			i.stats.CountMergedKeys++
 			i.key.SetKind(base.InternalKeyKindSet)
 			i.skip = true
 			return
@@ -887,6 +919,7 @@ func (i *Iter) mergeNext(valueMerger base.ValueMerger) {
 			if i.err != nil {
 				return
 			}
+			i.stats.CountMergedKeys++
 
 		default:
 			i.err = base.CorruptionErrorf("invalid internal key kind: %d", errors.Safe(i.iterKV.Kind()))
@@ -52,6 +52,11 @@ type Stats struct {
 	CumulativePinnedKeys uint64
 	CumulativePinnedSize uint64
 	CountMissizedDels    uint64
+	// CountInputKeys, CountOutputKeys and CountMergedKeys are the point key
+	// counts of the compaction iterator (see IterStats).
+	CountInputKeys  uint64
+	CountOutputKeys uint64
+	CountMergedKeys uint64
 }
 
 // RunnerConfig contains the parameters needed for the Runner.
@@ -79,6 +84,10 @@ type RunnerConfig struct {
 	// during compaction. In practice, the sizes can vary between 50%-200% of this
 	// value.
 	TargetOutputFileSize uint64
+
+	// PointKeyWritten, if set, is called after each point key is added to an
+	// output table.
+	PointKeyWritten func(key *base.InternalKey)
 }
 
 // Runner is a helper for running the "data" part of a compaction (where we use
@@ -204,6 +213,9 @@ func (r *Runner) writeKeysToTable(tw *sstable.Writer) (splitKey []byte, _ error)
 		if err := tw.AddWithForceObsolete(*key, value, r.iter.ForceObsoleteDueToRangeDel()); err != nil {
 			return nil, err
 		}
+		if r.cfg.PointKeyWritten != nil {
+			r.cfg.PointKeyWritten(key)
+		}
 		if r.iter.SnapshotPinned() {
 			// The kv pair we just added to the sstable was only surfaced by
 			// the compaction iterator because an open snapshot prevented
@@ -238,7 +250,11 @@ func (r *Runner) Finish() Result {
 	r.err = errors.CombineErrors(r.err, r.iter.Close())
 	// The compaction iterator keeps track of a count of the number of DELSIZED
 	// keys that encoded an incorrect size.
-	r.stats.CountMissizedDels = r.iter.Stats().CountMissizedDels
+	iterStats := r.iter.Stats()
+	r.stats.CountMissizedDels = iterStats.CountMissizedDels
+	r.stats.CountInputKeys = iterStats.CountInputKeys
+	r.stats.CountOutputKeys = iterStats.CountOutputKeys
+	r.stats.CountMergedKeys = iterStats.CountMergedKeys
 	return Result{
 		Err:    r.err,
 		Tables: r.tables,
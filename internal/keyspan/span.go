@@ -81,8 +81,7 @@ func (k Key) SeqNum() uint64 {
 // visible, because non-visible batch span keys are filtered when they're
 // fragmented.
 func (k Key) VisibleAt(snapshot uint64) bool {
-	seq := k.SeqNum()
-	return seq < snapshot || seq&base.InternalKeySeqNumBatch != 0
+	return base.VisibleSeqNum(nil /* snapshots */, snapshot, k.SeqNum())
 }
 
 // Kind returns the kind component of the key.
@@ -385,14 +384,11 @@ func (s *Span) CoversAt(snapshot, seqNum uint64) bool {
 	if s.KeysOrder != ByTrailerDesc {
 		panic("pebble: span's keys unexpectedly not in trailer order")
 	}
-	// NB: A key is visible at `snapshot` if its sequence number is strictly
-	// less than `snapshot`. See base.Visible.
+	// NB: Only visible batch keys are included when an Iterator's batch spans
+	// are fragmented, so base.VisibleSeqNum treating them as always visible is
+	// correct.
 	for i := range s.Keys {
-		if kseq := s.Keys[i].SeqNum(); kseq&base.InternalKeySeqNumBatch != 0 {
-			// Only visible batch keys are included when an Iterator's batch spans
-			// are fragmented. They must always be visible.
-			return kseq > seqNum
-		} else if kseq < snapshot {
+		if kseq := s.Keys[i].SeqNum(); base.VisibleSeqNum(nil /* snapshots */, snapshot, kseq) {
 			return kseq > seqNum
 		}
 	}
@@ -132,28 +132,13 @@ func (i *truncatingIter) nextSpanWithinBounds(
 			}
 			return nil, false, err
 		}
-		// Intersect [span.Start, span.End) with [i.bounds.Start, i.bounds.End.Key).
-		spanBoundsChanged = false
-		start := span.Start
-		if i.cmp(start, i.bounds.Start) < 0 {
-			spanBoundsChanged = true
-			start = i.bounds.Start
-		}
-		end := span.End
-		if i.cmp(end, i.bounds.End.Key) > 0 {
-			spanBoundsChanged = true
-			end = i.bounds.End.Key
-		}
+		var truncated Span
+		truncated, spanBoundsChanged = truncateSpan(i.cmp, span, i.bounds)
 		if !spanBoundsChanged {
 			return span, false, nil
 		}
-		if i.cmp(start, end) < 0 {
-			i.span = Span{
-				Start:     start,
-				End:       end,
-				Keys:      span.Keys,
-				KeysOrder: span.KeysOrder,
-			}
+		if truncated.Valid() {
+			i.span = truncated
 			return &i.span, true, nil
 		}
 		// Span is outside of bounds, find the next one.
@@ -171,3 +156,56 @@ func (i *truncatingIter) nextSpanWithinBounds(
 func (i *truncatingIter) WrapChildren(wrap WrapFn) {
 	i.iter = wrap(i.iter)
 }
+
+// TruncateToFileBounds returns the portion of span within the bounds of the
+// file with the given smallest and largest keys, or the zero Span if span lies
+// outside the file. It implements the truncation that Pebble applies to the
+// spans read from a file, for tools that read files directly: a file's spans
+// must only apply within its bounds, and spans in files written by older
+// versions of Pebble may extend beyond them.
+//
+// If fileLargest is an exclusive sentinel key, the span is truncated to end at
+// its user key. Otherwise the file's bounds are inclusive of the largest user
+// key; a span can't represent an inclusive end key, and Pebble never writes a
+// span containing the largest user key of such a file, so the span is
+// truncated to end at the largest user key.
+func TruncateToFileBounds(
+	span Span, fileSmallest, fileLargest base.InternalKey, cmp base.Compare,
+) Span {
+	truncated, changed := truncateSpan(cmp, &span, base.UserKeyBoundsFromInternal(fileSmallest, fileLargest))
+	if !changed {
+		return span
+	}
+	if !truncated.Valid() {
+		return Span{}
+	}
+	return truncated
+}
+
+// truncateSpan intersects [span.Start, span.End) with [bounds.Start,
+// bounds.End.Key), returning whether the span's bounds changed. If they did,
+// the returned span may be invalid, if there's no intersection.
+func truncateSpan(cmp base.Compare, span *Span, bounds base.UserKeyBounds) (_ Span, changed bool) {
+	start := span.Start
+	if cmp(start, bounds.Start) < 0 {
+		changed = true
+		start = bounds.Start
+	}
+	end := span.End
+	if cmp(end, bounds.End.Key) > 0 {
+		changed = true
+		end = bounds.End.Key
+	}
+	if !changed {
+		return *span, false
+	}
+	if cmp(start, end) >= 0 {
+		return Span{}, true
+	}
+	return Span{
+		Start:     start,
+		End:       end,
+		Keys:      span.Keys,
+		KeysOrder: span.KeysOrder,
+	}, true
+}
@@ -80,3 +80,32 @@ func TestTruncate(t *testing.T) {
 		}
 	})
 }
+
+func TestTruncateToFileBounds(t *testing.T) {
+	cmp := base.DefaultComparer.Compare
+	span := Span{
+		Start: []byte("c"),
+		End:   []byte("m"),
+		Keys:  []Key{{Trailer: base.MakeTrailer(5, base.InternalKeyKindRangeDelete)}},
+	}
+	point := func(k string) base.InternalKey {
+		return base.MakeInternalKey([]byte(k), 1, base.InternalKeyKindSet)
+	}
+	sentinel := func(k string) base.InternalKey {
+		return base.MakeRangeDeleteSentinelKey([]byte(k))
+	}
+	testCases := []struct {
+		smallest, largest base.InternalKey
+		expected          string
+	}{
+		{point("a"), point("z"), "c-m:{(#5,RANGEDEL)}"},
+		{point("e"), sentinel("h"), "e-h:{(#5,RANGEDEL)}"},
+		{point("a"), point("f"), "c-f:{(#5,RANGEDEL)}"},
+		{point("m"), point("z"), "<invalid>"},
+		{point("a"), sentinel("c"), "<invalid>"},
+	}
+	for _, tc := range testCases {
+		truncated := TruncateToFileBounds(span, tc.smallest, tc.largest, cmp)
+		require.Equal(t, tc.expected, truncated.String(), "bounds %s-%s", tc.smallest, tc.largest)
+	}
+}
@@ -160,6 +160,10 @@ type FileMetadata struct {
 	// in pebble.Iterator after every after every positioning operation
 	// that returns a user key (eg. Next, Prev, SeekGE, SeekLT, etc).
 	AllowedSeeks atomic.Int64
+	// Reads is the number of times the table has been opened by reads other
+	// than compactions since the DB was opened, used to identify cold data.
+	// It's not persisted.
+	Reads atomic.Uint64
 
 	// statsValid indicates if stats have been loaded for the table. The
 	// TableStats structure is populated only if valid is true.
@@ -239,6 +243,15 @@ type FileMetadata struct {
 	L0Index          int
 	minIntervalIndex int
 	maxIntervalIndex int
+	// PinCount is the number of outstanding DB.PinRange calls that pinned this
+	// file. A pinned file is ineligible for compaction. Protected by DB.mu.
+	PinCount int
+	// SnapshotStripes is the number of snapshots open when the file was
+	// written by a flush or compaction whose sequence numbers split the file's
+	// sequence number range, each of which may have required the file to
+	// preserve another version of the keys it overwrote. It's not persisted,
+	// since snapshots don't survive restarts. Protected by DB.mu.
+	SnapshotStripes int
 
 	// NB: the alignment of this struct is 8 bytes. We pack all the bools to
 	// ensure an optimal packing.
@@ -538,6 +551,12 @@ func (m *FileMetadata) IsCompacting() bool {
 	return m.CompactionState == CompactionStateCompacting
 }
 
+// IsPinned returns true if this file has been pinned by DB.PinRange, making it
+// ineligible for compaction. Protected by DB.mu.
+func (m *FileMetadata) IsPinned() bool {
+	return m.PinCount > 0
+}
+
 // StatsValid returns true if the table stats have been populated. If StatValid
 // returns true, the Stats field may be read (with or without holding the
 // database mutex).
@@ -57,6 +57,7 @@ const (
 	tagNewFile5            = 104 // Range keys.
 	tagCreatedBackingTable = 105
 	tagRemovedBackingTable = 106
+	tagMaxKeyValueSize     = 107
 
 	// The custom tags sub-format used by tagNewFile4 and above. All tags less
 	// than customTagNonSafeIgnoreMask are safe to ignore and their format must be
@@ -118,6 +119,11 @@ type VersionEdit struct {
 	// recovery) may contain sequence numbers greater than this value.
 	LastSeqNum uint64
 
+	// MaxKeySize and MaxValueSize are the high-water marks of the sizes of the
+	// keys and values that have been committed to the DB.
+	MaxKeySize   uint64
+	MaxValueSize uint64
+
 	// A file num may be present in both deleted files and new files when it
 	// is moved from a lower level to a higher level (when the compaction
 	// found that there was no overlapping file at the higher level).
@@ -202,6 +208,17 @@ func (v *VersionEdit) Decode(r io.Reader) error {
 			}
 			v.LastSeqNum = n
 
+		case tagMaxKeyValueSize:
+			keySize, err := d.readUvarint()
+			if err != nil {
+				return err
+			}
+			valueSize, err := d.readUvarint()
+			if err != nil {
+				return err
+			}
+			v.MaxKeySize, v.MaxValueSize = keySize, valueSize
+
 		case tagCompactPointer:
 			if _, err := d.readLevel(); err != nil {
 				return err
@@ -495,6 +512,10 @@ func (v *VersionEdit) string(verbose bool, fmtKey base.FormatKey) string {
 	if v.LastSeqNum != 0 {
 		fmt.Fprintf(&buf, "  last-seq-num:  %d\n", v.LastSeqNum)
 	}
+	if v.MaxKeySize != 0 || v.MaxValueSize != 0 {
+		fmt.Fprintf(&buf, "  max-key-size:  %d\n", v.MaxKeySize)
+		fmt.Fprintf(&buf, "  max-val-size:  %d\n", v.MaxValueSize)
+	}
 	entries := make([]DeletedFileEntry, 0, len(v.DeletedFiles))
 	for df := range v.DeletedFiles {
 		entries = append(entries, df)
@@ -636,6 +657,11 @@ func (v *VersionEdit) Encode(w io.Writer) error {
 		e.writeUvarint(tagLastSequence)
 		e.writeUvarint(v.LastSeqNum)
 	}
+	if v.MaxKeySize != 0 || v.MaxValueSize != 0 {
+		e.writeUvarint(tagMaxKeyValueSize)
+		e.writeUvarint(v.MaxKeySize)
+		e.writeUvarint(v.MaxValueSize)
+	}
 	for x := range v.DeletedFiles {
 		e.writeUvarint(tagDeletedFile)
 		e.writeUvarint(uint64(x.Level))
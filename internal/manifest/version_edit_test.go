@@ -84,6 +84,8 @@ func TestVERoundTripAndAccumulate(t *testing.T) {
 		ObsoletePrevLogNum:   33,
 		NextFileNum:          44,
 		LastSeqNum:           55,
+		MaxKeySize:           66,
+		MaxValueSize:         77,
 		CreatedBackingTables: []*FileBacking{m1.FileBacking},
 		NewFiles: []NewFileEntry{
 			{
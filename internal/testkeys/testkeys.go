@@ -44,8 +44,9 @@ var MaxSuffixLen = 1 + len(fmt.Sprintf("%d", int64(math.MaxInt64)))
 
 // Comparer is the comparer for test keys generated by this package.
 var Comparer = &base.Comparer{
-	Compare: compare,
-	Equal:   func(a, b []byte) bool { return compare(a, b) == 0 },
+	Compare:              compare,
+	Equal:                func(a, b []byte) bool { return compare(a, b) == 0 },
+	CompareRangeSuffixes: compare,
 	AbbreviatedKey: func(k []byte) uint64 {
 		return base.DefaultComparer.AbbreviatedKey(k[:split(k)])
 	},
@@ -0,0 +1,202 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// IterTraceOp identifies the internal iterator operation recorded by an
+// IterTraceEvent.
+type IterTraceOp int8
+
+// The operations recorded by IterOptions.Tracer.
+const (
+	IterTraceSeekGE IterTraceOp = iota
+	IterTraceSeekPrefixGE
+	IterTraceSeekLT
+	IterTraceFirst
+	IterTraceLast
+	IterTraceNext
+	IterTraceNextPrefix
+	IterTracePrev
+)
+
+// String implements fmt.Stringer.
+func (op IterTraceOp) String() string {
+	switch op {
+	case IterTraceSeekGE:
+		return "SeekGE"
+	case IterTraceSeekPrefixGE:
+		return "SeekPrefixGE"
+	case IterTraceSeekLT:
+		return "SeekLT"
+	case IterTraceFirst:
+		return "First"
+	case IterTraceLast:
+		return "Last"
+	case IterTraceNext:
+		return "Next"
+	case IterTraceNextPrefix:
+		return "NextPrefix"
+	case IterTracePrev:
+		return "Prev"
+	default:
+		return fmt.Sprintf("IterTraceOp(%d)", int8(op))
+	}
+}
+
+// IterTraceEvent describes a single positioning operation performed by an
+// Iterator's merging iterator on one of its levels. See IterOptions.Tracer.
+type IterTraceEvent struct {
+	Op IterTraceOp
+	// Level identifies the level of the merging iterator: "batch",
+	// "memtable", or the LSM level, such as "L0.1" for an L0 sublevel or "L6".
+	Level string
+	// FileNum is the sstable the level is positioned within after the
+	// operation. It is zero for the batch and memtable levels, and for
+	// sstable levels that were exhausted by the operation.
+	FileNum base.FileNum
+	// SeekKey is the search key of seek operations, and the successor key of
+	// NextPrefix operations. It is nil for other operations.
+	SeekKey []byte
+	// Key is the key the level is positioned at after the operation, or nil
+	// if the level was exhausted.
+	Key *InternalKey
+}
+
+// IterTrace is a timeline of IterTraceEvents. Its Record method may be used
+// as an IterOptions.Tracer.
+type IterTrace []IterTraceEvent
+
+// Record appends a copy of ev to the trace. Unlike the event passed to
+// IterOptions.Tracer, the copy remains valid after Record returns.
+func (t *IterTrace) Record(ev IterTraceEvent) {
+	if ev.SeekKey != nil {
+		ev.SeekKey = append([]byte(nil), ev.SeekKey...)
+	}
+	if ev.Key != nil {
+		k := ev.Key.Clone()
+		ev.Key = &k
+	}
+	*t = append(*t, ev)
+}
+
+// String formats the trace as a human-readable timeline, one event per line.
+func (t IterTrace) String() string {
+	return t.Format(base.DefaultFormatter)
+}
+
+// Format formats the trace as a human-readable timeline, one event per line,
+// using formatKey to format user keys.
+func (t IterTrace) Format(formatKey base.FormatKey) string {
+	var buf strings.Builder
+	for i := range t {
+		ev := &t[i]
+		fmt.Fprintf(&buf, "%4d: %-8s", i, ev.Level)
+		if ev.FileNum != 0 {
+			fmt.Fprintf(&buf, " %s", ev.FileNum)
+		}
+		fmt.Fprintf(&buf, " %s(", ev.Op)
+		if ev.SeekKey != nil {
+			fmt.Fprintf(&buf, "%s", formatKey(ev.SeekKey))
+		}
+		buf.WriteString(") -> ")
+		if ev.Key != nil {
+			fmt.Fprintf(&buf, "%s\n", ev.Key.Pretty(formatKey))
+		} else {
+			buf.WriteString("exhausted\n")
+		}
+	}
+	return buf.String()
+}
+
+// tracingIter wraps one level of a merging iterator, reporting each
+// positioning operation to a tracer. It's only used when IterOptions.Tracer
+// is set, so iterators that aren't traced pay no cost.
+type tracingIter struct {
+	iter internalIterator
+	// levelIter is non-nil if iter is backed by a levelIter, in which case it's
+	// consulted for the current file.
+	levelIter *levelIter
+	level     string
+	tracer    func(IterTraceEvent)
+}
+
+var _ internalIterator = (*tracingIter)(nil)
+
+func newTracingIter(
+	iter internalIterator, li *levelIter, level string, tracer func(IterTraceEvent),
+) *tracingIter {
+	return &tracingIter{iter: iter, levelIter: li, level: level, tracer: tracer}
+}
+
+func (t *tracingIter) trace(op IterTraceOp, seekKey []byte, kv *base.InternalKV) *base.InternalKV {
+	ev := IterTraceEvent{Op: op, Level: t.level, SeekKey: seekKey}
+	if t.levelIter != nil && t.levelIter.iterFile != nil {
+		ev.FileNum = t.levelIter.iterFile.FileNum
+	}
+	if kv != nil {
+		ev.Key = &kv.K
+	}
+	t.tracer(ev)
+	return kv
+}
+
+func (t *tracingIter) SeekGE(key []byte, flags base.SeekGEFlags) *base.InternalKV {
+	return t.trace(IterTraceSeekGE, key, t.iter.SeekGE(key, flags))
+}
+
+func (t *tracingIter) SeekPrefixGE(prefix, key []byte, flags base.SeekGEFlags) *base.InternalKV {
+	return t.trace(IterTraceSeekPrefixGE, key, t.iter.SeekPrefixGE(prefix, key, flags))
+}
+
+func (t *tracingIter) SeekLT(key []byte, flags base.SeekLTFlags) *base.InternalKV {
+	return t.trace(IterTraceSeekLT, key, t.iter.SeekLT(key, flags))
+}
+
+func (t *tracingIter) First() *base.InternalKV {
+	return t.trace(IterTraceFirst, nil, t.iter.First())
+}
+
+func (t *tracingIter) Last() *base.InternalKV {
+	return t.trace(IterTraceLast, nil, t.iter.Last())
+}
+
+func (t *tracingIter) Next() *base.InternalKV {
+	return t.trace(IterTraceNext, nil, t.iter.Next())
+}
+
+func (t *tracingIter) NextPrefix(succKey []byte) *base.InternalKV {
+	return t.trace(IterTraceNextPrefix, succKey, t.iter.NextPrefix(succKey))
+}
+
+func (t *tracingIter) Prev() *base.InternalKV {
+	return t.trace(IterTracePrev, nil, t.iter.Prev())
+}
+
+func (t *tracingIter) Error() error {
+	return t.iter.Error()
+}
+
+func (t *tracingIter) Close() error {
+	return t.iter.Close()
+}
+
+func (t *tracingIter) SetBounds(lower, upper []byte) {
+	t.iter.SetBounds(lower, upper)
+}
+
+func (t *tracingIter) SetContext(ctx context.Context) {
+	t.iter.SetContext(ctx)
+}
+
+func (t *tracingIter) String() string {
+	return t.iter.String()
+}
@@ -87,6 +87,15 @@ const readBytesPeriod uint64 = 1 << 16
 
 var errReversePrefixIteration = errors.New("pebble: unsupported reverse prefix iteration")
 
+// ErrTooManyMergeOperands is returned by reads that encounter a key with more
+// MERGE records than allowed by IterOptions.MaxMergeOperands or
+// ReadOptions.MaxMergeOperands.
+var ErrTooManyMergeOperands = errors.New("pebble: too many merge operands")
+
+// ErrIteratorDeadlineExceeded is returned by iterators whose
+// IterOptions.Deadline has passed.
+var ErrIteratorDeadlineExceeded = errors.New("pebble: iterator deadline exceeded")
+
 // IteratorMetrics holds per-iterator metrics. These do not change over the
 // lifetime of the iterator.
 type IteratorMetrics struct {
@@ -203,6 +212,16 @@ type Iterator struct {
 	// Either readState or version is set, but not both.
 	readState *readState
 	version   *version
+	// readStatePinned is set if readState is pinned by a ReadSession, in which
+	// case the iterator holds no reference to it.
+	readStatePinned bool
+	// deadlineExceeded is set once IterOptions.Deadline has passed and the
+	// iterator released its iterator stacks and its readState or version. See
+	// releaseIfDeadlineExceeded.
+	deadlineExceeded bool
+	// readsSnapshot is set if the iterator reads a Snapshot or
+	// EventuallyFileOnlySnapshot, whose sequence number Refresh can't advance.
+	readsSnapshot bool
 	// rangeKey holds iteration state specific to iteration over range keys.
 	// The range key field may be nil if the Iterator has never been configured
 	// to iterate over range keys. Its non-nilness cannot be used to determine
@@ -223,7 +242,10 @@ type Iterator struct {
 	fetcher  base.LazyFetcher
 	// For use in LazyValue.Value.
 	lazyValueBuf []byte
-	valueCloser  io.Closer
+	// distinctValueBuf holds the value of the key Next is skipping from, if
+	// IterOptions.DistinctValues is set.
+	distinctValueBuf []byte
+	valueCloser      io.Closer
 	// boundsBuf holds two buffers used to store the lower and upper bounds.
 	// Whenever the Iterator's bounds change, the new bounds are copied into
 	// boundsBuf[boundsBufIdx]. The two bounds share a slice to reduce
@@ -238,7 +260,14 @@ type Iterator struct {
 	prefixOrFullSeekKey []byte
 	readSampling        readSampling
 	stats               IteratorStats
-	externalReaders     [][]*sstable.Reader
+	// seekDistances records the distances of the iterator's seeks, which are
+	// added to the DB's Metrics.SeekDistanceHistogram on Close. Unlike stats,
+	// it isn't reset by ResetStats.
+	seekDistances   SeekDistanceHistogram
+	externalReaders [][]*sstable.Reader
+	// mergedSources are the sources merged beneath the LSM by
+	// DB.NewMergedIter, which are closed by Close.
+	mergedSources []*mergedSourceIter
 
 	// Following fields used when constructing an iterator stack, eg, in Clone
 	// and SetOptions or when re-fragmenting a batch's range keys/range dels.
@@ -313,11 +342,17 @@ type Iterator struct {
 	batchJustRefreshed bool
 	// batchOnlyIter is set to true for Batch.NewBatchOnlyIter.
 	batchOnlyIter bool
+	// rangeStats counts the seeks of the iterator, or is nil if the DB doesn't
+	// collect range statistics.
+	rangeStats *rangeStats
 	// Used in some tests to disable the random disabling of seek optimizations.
 	forceEnableSeekOpt bool
 	// Set to true if NextPrefix is not currently permitted. Defaults to false
 	// in case an iterator never had any bounds.
 	nextPrefixNotPermittedByUpperBound bool
+	// suffixReadAtBuf is used to construct seek keys when skipping versions
+	// that are not visible at IterOptions.SuffixReadAt.
+	suffixReadAtBuf []byte
 }
 
 // cmp is a convenience shorthand for the i.comparer.Compare function.
@@ -772,7 +807,11 @@ func (i *Iterator) nextUserKey() {
 		// distributed writes. We expect it to trigger very frequently when
 		// iterating through ingested sstables, which contain keys that all have
 		// the same sequence number.
-		if done || i.iterKV == nil || i.iterKV.K.Trailer >= trailer {
+		//
+		// The optimization doesn't hold with merged sources, whose keys all have
+		// a zero sequence number and may share user keys with each other and
+		// the LSM.
+		if i.iterKV == nil || (i.mergedSources == nil && (done || i.iterKV.K.Trailer >= trailer)) {
 			break
 		}
 		if !i.equal(i.key, i.iterKV.K.UserKey) {
@@ -803,6 +842,9 @@ func (i *Iterator) maybeSampleRead() {
 		i.sampleRead()
 		return
 	}
+	if i.readState.db.opts.DeterministicCompaction {
+		return
+	}
 	samplingPeriod := int32(int64(readBytesPeriod) * i.readState.db.opts.Experimental.ReadSamplingMultiplier)
 	if samplingPeriod <= 0 {
 		return
@@ -906,6 +948,8 @@ func (i *Iterator) findPrevEntry(limit []byte) {
 	}
 
 	var valueMerger ValueMerger
+	// mergeOperands counts the MERGE records merged by valueMerger.
+	var mergeOperands int
 	firstLoopIter := true
 	rangeKeyBoundary := false
 	// The code below compares with limit in multiple places. As documented in
@@ -1052,6 +1096,14 @@ func (i *Iterator) findPrevEntry(limit []byte) {
 			continue
 
 		case InternalKeyKindMerge:
+			if i.iterValidityState == IterExhausted || valueMerger == nil {
+				mergeOperands = 0
+			}
+			if mergeOperands++; i.opts.MaxMergeOperands > 0 && mergeOperands > i.opts.MaxMergeOperands {
+				i.err = ErrTooManyMergeOperands
+				i.iterValidityState = IterExhausted
+				return
+			}
 			if i.iterValidityState == IterExhausted {
 				i.keyBuf = append(i.keyBuf[:0], key.UserKey...)
 				i.key = i.keyBuf
@@ -1176,6 +1228,7 @@ func (i *Iterator) mergeNext(key InternalKey, valueMerger ValueMerger) {
 	i.key = i.keyBuf
 
 	// Loop looking for older values for this key and merging them.
+	mergeOperands := 1
 	for {
 		i.iterKV = i.iter.Next()
 		i.stats.ForwardStepCount[InternalIterCall]++
@@ -1215,6 +1268,10 @@ func (i *Iterator) mergeNext(key InternalKey, valueMerger ValueMerger) {
 		case InternalKeyKindMerge:
 			// We've hit another Merge value. Merge with the existing value and
 			// continue looping.
+			if mergeOperands++; i.opts.MaxMergeOperands > 0 && mergeOperands > i.opts.MaxMergeOperands {
+				i.err = ErrTooManyMergeOperands
+				return
+			}
 			var iterValue []byte
 			iterValue, _, i.err = i.iterKV.Value(nil)
 			if i.err != nil {
@@ -1242,7 +1299,11 @@ func (i *Iterator) mergeNext(key InternalKey, valueMerger ValueMerger) {
 // than or equal to the given key. Returns true if the iterator is pointing at
 // a valid entry and false otherwise.
 func (i *Iterator) SeekGE(key []byte) bool {
-	return i.SeekGEWithLimit(key, nil) == IterValid
+	valid := i.SeekGEWithLimit(key, nil) == IterValid
+	if i.opts.SuffixReadAt != nil {
+		return i.suffixReadAtForward()
+	}
+	return valid
 }
 
 // SeekGEWithLimit moves the iterator to the first key/value pair whose key is
@@ -1257,6 +1318,14 @@ func (i *Iterator) SeekGE(key []byte) bool {
 // guarantees it will surface any range keys with bounds overlapping the
 // keyspace [key, limit).
 func (i *Iterator) SeekGEWithLimit(key []byte, limit []byte) IterValidityState {
+	validity := i.seekGEWithLimit(key, limit)
+	i.releaseIfDeadlineExceeded()
+	return validity
+}
+
+func (i *Iterator) seekGEWithLimit(key []byte, limit []byte) IterValidityState {
+	i.rangeStats.recordRead(key)
+	i.rangeKeyMasking.maskedPoints = 0
 	if i.rangeKey != nil {
 		// NB: Check Valid() before clearing requiresReposition.
 		i.rangeKey.prevPosHadRangeKey = i.rangeKey.hasRangeKey && i.Valid()
@@ -1406,6 +1475,17 @@ func (i *Iterator) SeekGEWithLimit(key []byte, limit []byte) IterValidityState {
 // ImmediateSuccessor method. For example, a SeekPrefixGE("a@9") call with the
 // prefix "a" will truncate range key bounds to [a,ImmediateSuccessor(a)].
 func (i *Iterator) SeekPrefixGE(key []byte) bool {
+	i.rangeStats.recordRead(key)
+	valid := i.seekPrefixGE(key)
+	if i.opts.SuffixReadAt != nil {
+		valid = i.suffixReadAtForward()
+	}
+	i.releaseIfDeadlineExceeded()
+	return valid
+}
+
+func (i *Iterator) seekPrefixGE(key []byte) bool {
+	i.rangeKeyMasking.maskedPoints = 0
 	if i.rangeKey != nil {
 		// NB: Check Valid() before clearing requiresReposition.
 		i.rangeKey.prevPosHadRangeKey = i.rangeKey.hasRangeKey && i.Valid()
@@ -1518,7 +1598,11 @@ func disableSeekOpt(key []byte, ptr uintptr) bool {
 // the given key. Returns true if the iterator is pointing at a valid entry and
 // false otherwise.
 func (i *Iterator) SeekLT(key []byte) bool {
-	return i.SeekLTWithLimit(key, nil) == IterValid
+	valid := i.SeekLTWithLimit(key, nil) == IterValid
+	if i.opts.SuffixReadAt != nil {
+		return i.suffixReadAtReverse()
+	}
+	return valid
 }
 
 // SeekLTWithLimit moves the iterator to the last key/value pair whose key is
@@ -1533,6 +1617,14 @@ func (i *Iterator) SeekLT(key []byte) bool {
 // guarantees it will surface any range keys with bounds overlapping the
 // keyspace up to limit.
 func (i *Iterator) SeekLTWithLimit(key []byte, limit []byte) IterValidityState {
+	validity := i.seekLTWithLimit(key, limit)
+	i.releaseIfDeadlineExceeded()
+	return validity
+}
+
+func (i *Iterator) seekLTWithLimit(key []byte, limit []byte) IterValidityState {
+	i.rangeStats.recordRead(key)
+	i.rangeKeyMasking.maskedPoints = 0
 	if i.rangeKey != nil {
 		// NB: Check Valid() before clearing requiresReposition.
 		i.rangeKey.prevPosHadRangeKey = i.rangeKey.hasRangeKey && i.Valid()
@@ -1615,6 +1707,13 @@ func (i *Iterator) SeekLTWithLimit(key []byte, limit []byte) IterValidityState {
 // First moves the iterator the first key/value pair. Returns true if the
 // iterator is pointing at a valid entry and false otherwise.
 func (i *Iterator) First() bool {
+	valid := i.first()
+	i.releaseIfDeadlineExceeded()
+	return valid
+}
+
+func (i *Iterator) first() bool {
+	i.rangeKeyMasking.maskedPoints = 0
 	if i.rangeKey != nil {
 		// NB: Check Valid() before clearing requiresReposition.
 		i.rangeKey.prevPosHadRangeKey = i.rangeKey.hasRangeKey && i.Valid()
@@ -1645,12 +1744,22 @@ func (i *Iterator) First() bool {
 	}
 	i.findNextEntry(nil)
 	i.maybeSampleRead()
+	if i.opts.SuffixReadAt != nil {
+		return i.suffixReadAtForward()
+	}
 	return i.iterValidityState == IterValid
 }
 
 // Last moves the iterator the last key/value pair. Returns true if the
 // iterator is pointing at a valid entry and false otherwise.
 func (i *Iterator) Last() bool {
+	valid := i.last()
+	i.releaseIfDeadlineExceeded()
+	return valid
+}
+
+func (i *Iterator) last() bool {
+	i.rangeKeyMasking.maskedPoints = 0
 	if i.rangeKey != nil {
 		// NB: Check Valid() before clearing requiresReposition.
 		i.rangeKey.prevPosHadRangeKey = i.rangeKey.hasRangeKey && i.Valid()
@@ -1680,13 +1789,66 @@ func (i *Iterator) Last() bool {
 	}
 	i.findPrevEntry(nil)
 	i.maybeSampleRead()
+	if i.opts.SuffixReadAt != nil {
+		return i.suffixReadAtReverse()
+	}
 	return i.iterValidityState == IterValid
 }
 
 // Next moves the iterator to the next key/value pair. Returns true if the
 // iterator is pointing at a valid entry and false otherwise.
+//
+// If IterOptions.SuffixReadAt is set, Next behaves like NextPrefix. If
+// IterOptions.DistinctValues is set, Next skips keys whose values equal that
+// of the current key.
 func (i *Iterator) Next() bool {
-	return i.nextWithLimit(nil) == IterValid
+	if i.opts.DistinctValues {
+		return i.nextDistinctValue()
+	}
+	return i.step()
+}
+
+// step moves the iterator to the next key/value pair for Next.
+func (i *Iterator) step() bool {
+	if i.opts.SuffixReadAt != nil {
+		return i.NextPrefix()
+	}
+	valid := i.nextWithLimit(nil) == IterValid
+	i.releaseIfDeadlineExceeded()
+	return valid
+}
+
+// nextDistinctValue implements Next for IterOptions.DistinctValues. It steps
+// the iterator past the point keys whose values equal the value of the point
+// key at the current position. Positions without a point key, and positions
+// at which the range keys change, are never skipped, so that skipping keys is
+// invisible to RangeKeyChanged.
+func (i *Iterator) nextDistinctValue() bool {
+	if hasPoint, _ := i.HasPointAndRange(); !hasPoint {
+		return i.step()
+	}
+	v, err := i.ValueAndErr()
+	if err != nil {
+		return false
+	}
+	i.distinctValueBuf = append(i.distinctValueBuf[:0], v...)
+	equal := i.opts.ValueEqual
+	if equal == nil {
+		equal = bytes.Equal
+	}
+	for i.step() {
+		if hasPoint, _ := i.HasPointAndRange(); !hasPoint || i.RangeKeyChanged() {
+			return true
+		}
+		v, err := i.ValueAndErr()
+		if err != nil {
+			return false
+		}
+		if !equal(i.distinctValueBuf, v) {
+			return true
+		}
+	}
+	return false
 }
 
 // NextWithLimit moves the iterator to the next key/value pair.
@@ -1700,7 +1862,9 @@ func (i *Iterator) Next() bool {
 // guarantees it will surface any range keys with bounds overlapping the
 // keyspace up to limit.
 func (i *Iterator) NextWithLimit(limit []byte) IterValidityState {
-	return i.nextWithLimit(limit)
+	validity := i.nextWithLimit(limit)
+	i.releaseIfDeadlineExceeded()
+	return validity
 }
 
 // NextPrefix moves the iterator to the next key/value pair with a key
@@ -1730,7 +1894,69 @@ func (i *Iterator) NextPrefix() bool {
 	if i.Error() != nil {
 		return false
 	}
-	return i.nextPrefix() == IterValid
+	valid := i.nextPrefix() == IterValid
+	if i.opts.SuffixReadAt != nil {
+		valid = i.suffixReadAtForward()
+	}
+	i.releaseIfDeadlineExceeded()
+	return valid
+}
+
+// suffixVisible returns true if a key with the provided suffix is visible at
+// IterOptions.SuffixReadAt. Suffixes sort in the same order as the keys that
+// contain them, so with a comparer that orders newer versions first, the
+// visible versions are those that sort at or after SuffixReadAt.
+func (i *Iterator) suffixVisible(suffix []byte) bool {
+	return i.cmp(suffix, i.opts.SuffixReadAt) >= 0
+}
+
+// suffixReadAtForward is invoked after a forward positioning operation when
+// IterOptions.SuffixReadAt is set. If the iterator is positioned on a point
+// key that is not visible at SuffixReadAt, it seeks to the newest visible
+// version of the key's prefix, repeating if the prefix has no visible
+// versions. Positions without a point key are left untouched.
+func (i *Iterator) suffixReadAtForward() bool {
+	for i.iterValidityState == IterValid {
+		if hasPoint, _ := i.HasPointAndRange(); !hasPoint {
+			return true
+		}
+		n := i.comparer.Split(i.key)
+		if i.suffixVisible(i.key[n:]) {
+			return true
+		}
+		// Every key with the same prefix that is >= prefix+SuffixReadAt is
+		// visible, so a single seek lands on the newest visible version or on
+		// a subsequent prefix.
+		i.suffixReadAtBuf = append(append(i.suffixReadAtBuf[:0], i.key[:n]...), i.opts.SuffixReadAt...)
+		if i.hasPrefix {
+			i.seekPrefixGE(i.suffixReadAtBuf)
+		} else {
+			i.SeekGEWithLimit(i.suffixReadAtBuf, nil)
+		}
+	}
+	return false
+}
+
+// suffixReadAtReverse is the analogue of suffixReadAtForward for reverse
+// positioning operations. Reverse iteration encounters the oldest version of
+// a prefix first, so if that version is visible, the iterator seeks forward
+// to the newest visible version; otherwise no version of the prefix is
+// visible and the iterator moves to the previous prefix.
+func (i *Iterator) suffixReadAtReverse() bool {
+	for i.iterValidityState == IterValid {
+		if hasPoint, _ := i.HasPointAndRange(); !hasPoint {
+			return true
+		}
+		n := i.comparer.Split(i.key)
+		i.suffixReadAtBuf = append(i.suffixReadAtBuf[:0], i.key[:n]...)
+		if !i.suffixVisible(i.key[n:]) {
+			i.SeekLTWithLimit(i.suffixReadAtBuf, nil)
+			continue
+		}
+		i.suffixReadAtBuf = append(i.suffixReadAtBuf, i.opts.SuffixReadAt...)
+		return i.SeekGEWithLimit(i.suffixReadAtBuf, nil) == IterValid
+	}
+	return false
 }
 
 func (i *Iterator) nextPrefix() IterValidityState {
@@ -1977,7 +2203,22 @@ func (i *Iterator) nextWithLimit(limit []byte) IterValidityState {
 
 // Prev moves the iterator to the previous key/value pair. Returns true if the
 // iterator is pointing at a valid entry and false otherwise.
+//
+// If IterOptions.SuffixReadAt is set, Prev moves to the newest visible version
+// of the previous prefix.
 func (i *Iterator) Prev() bool {
+	if i.opts.SuffixReadAt != nil {
+		if hasPoint, _ := i.HasPointAndRange(); hasPoint && !i.hasPrefix {
+			// All of the current prefix's visible versions sort after the
+			// prefix itself.
+			n := i.comparer.Split(i.key)
+			i.suffixReadAtBuf = append(i.suffixReadAtBuf[:0], i.key[:n]...)
+			i.SeekLTWithLimit(i.suffixReadAtBuf, nil)
+		} else {
+			i.PrevWithLimit(nil)
+		}
+		return i.suffixReadAtReverse()
+	}
 	return i.PrevWithLimit(nil) == IterValid
 }
 
@@ -1992,6 +2233,12 @@ func (i *Iterator) Prev() bool {
 // guarantees it will surface any range keys with bounds overlapping the
 // keyspace up to limit.
 func (i *Iterator) PrevWithLimit(limit []byte) IterValidityState {
+	validity := i.prevWithLimit(limit)
+	i.releaseIfDeadlineExceeded()
+	return validity
+}
+
+func (i *Iterator) prevWithLimit(limit []byte) IterValidityState {
 	i.stats.ReverseStepCount[InterfaceCall]++
 	if i.err != nil {
 		return i.iterValidityState
@@ -2192,7 +2439,7 @@ func (i *Iterator) saveRangeKey() {
 		if invariants.Enabled {
 			if s.Keys[j].Kind() != base.InternalKeyKindRangeKeySet {
 				panic("pebble: user iteration encountered non-RangeKeySet key kind")
-			} else if j > 0 && i.cmp(s.Keys[j].Suffix, s.Keys[j-1].Suffix) < 0 {
+			} else if j > 0 && i.comparer.CompareRangeSuffixes(s.Keys[j].Suffix, s.Keys[j-1].Suffix) < 0 {
 				panic("pebble: user iteration encountered range keys not in suffix order")
 			}
 		}
@@ -2352,37 +2599,16 @@ func (i *Iterator) Close() error {
 	}
 	err := i.err
 
-	if i.readState != nil {
-		if i.readSampling.pendingCompactions.size > 0 {
-			// Copy pending read compactions using db.mu.Lock()
-			i.readState.db.mu.Lock()
-			i.readState.db.mu.compact.readCompactions.combine(&i.readSampling.pendingCompactions, i.cmp)
-			reschedule := i.readState.db.mu.compact.rescheduleReadCompaction
-			i.readState.db.mu.compact.rescheduleReadCompaction = false
-			concurrentCompactions := i.readState.db.mu.compact.compactingCount
-			i.readState.db.mu.Unlock()
-
-			if reschedule && concurrentCompactions == 0 {
-				// In a read heavy workload, flushes may not happen frequently enough to
-				// schedule compactions.
-				i.readState.db.compactionSchedulers.Add(1)
-				go i.readState.db.maybeScheduleCompactionAsync()
-			}
-		}
-
-		i.readState.unref()
-		i.readState = nil
-	}
-
-	if i.version != nil {
-		i.version.Unref()
-	}
+	i.releaseReadState()
 
 	for _, readers := range i.externalReaders {
 		for _, r := range readers {
 			err = firstError(err, r.Close())
 		}
 	}
+	for _, src := range i.mergedSources {
+		err = firstError(err, src.iter.Close())
+	}
 
 	// Close the closer for the current value if one was open.
 	if i.valueCloser != nil {
@@ -2439,6 +2665,72 @@ func (i *Iterator) Close() error {
 	return err
 }
 
+// releaseReadState releases the iterator's reference to its readState or
+// version, passing on the seek distances and read compactions it accumulated.
+// The iterator stacks must already be closed.
+func (i *Iterator) releaseReadState() {
+	if i.readState != nil {
+		i.readState.db.seekDistances.add(&i.seekDistances)
+
+		if i.readSampling.pendingCompactions.size > 0 {
+			// Copy pending read compactions using db.mu.Lock()
+			i.readState.db.mu.Lock()
+			i.readState.db.mu.compact.readCompactions.combine(&i.readSampling.pendingCompactions, i.cmp)
+			reschedule := i.readState.db.mu.compact.rescheduleReadCompaction
+			i.readState.db.mu.compact.rescheduleReadCompaction = false
+			concurrentCompactions := i.readState.db.mu.compact.compactingCount
+			i.readState.db.mu.Unlock()
+
+			if reschedule && concurrentCompactions == 0 {
+				// In a read heavy workload, flushes may not happen frequently enough to
+				// schedule compactions.
+				i.readState.db.compactionSchedulers.Add(1)
+				go i.readState.db.maybeScheduleCompactionAsync()
+			}
+		}
+
+		if !i.readStatePinned {
+			i.readState.unref()
+		}
+		i.readState = nil
+	}
+
+	if i.version != nil {
+		i.version.Unref()
+		i.version = nil
+	}
+}
+
+// releaseIfDeadlineExceeded is called by the positioning methods before they
+// return. Once IterOptions.Deadline has passed, it closes the iterator stacks
+// and releases the readState or version, so that an iterator abandoned
+// mid-scan doesn't hold onto the sstables that compactions made obsolete. The
+// stacks are replaced by an errorIter, so the iterator stays exhausted, with
+// Error returning ErrIteratorDeadlineExceeded, until it's closed.
+func (i *Iterator) releaseIfDeadlineExceeded() {
+	if i.merging == nil || !i.merging.deadlineExceeded {
+		return
+	}
+	// As in Close, close the iterators before releasing the readState. Errors
+	// closing them are subsumed by ErrIteratorDeadlineExceeded.
+	_ = i.iter.Close()
+	if i.pointIter != nil {
+		_ = i.pointIter.Close()
+		i.pointIter = nil
+	}
+	if i.rangeKey != nil && i.rangeKey.rangeKeyIter != nil {
+		_ = i.rangeKey.rangeKeyIter.Close()
+		i.rangeKey.rangeKeyIter = nil
+	}
+	i.releaseReadState()
+	i.iter = &errorIter{err: ErrIteratorDeadlineExceeded}
+	i.merging = nil
+	i.iterKV = nil
+	i.iterValidityState = IterExhausted
+	i.err = ErrIteratorDeadlineExceeded
+	i.deadlineExceeded = true
+}
+
 // SetBounds sets the lower and upper bounds for the iterator. Once SetBounds
 // returns, the caller is free to mutate the provided slices.
 //
@@ -2452,6 +2744,11 @@ func (i *Iterator) SetBounds(lower, upper []byte) {
 	// positioning method to reposition the iterator.
 	i.requiresReposition = true
 
+	if i.deadlineExceeded {
+		// The iterator stacks were released; see releaseIfDeadlineExceeded.
+		return
+	}
+
 	if ((i.opts.LowerBound == nil) == (lower == nil)) &&
 		((i.opts.UpperBound == nil) == (upper == nil)) &&
 		i.equal(i.opts.LowerBound, lower) &&
@@ -2550,6 +2847,9 @@ func (i *Iterator) processBounds(lower, upper []byte) {
 // to SeekGE, SeekPrefixGE, SeekLT, First, or Last.
 //
 // If only lower and upper bounds need to be modified, prefer SetBounds.
+//
+// SetOptions has no effect once IterOptions.Deadline has passed, since the
+// iterator has then released the state it reads.
 func (i *Iterator) SetOptions(o *IterOptions) {
 	if i.externalReaders != nil {
 		if err := validateExternalIterOpts(o); err != nil {
@@ -2564,6 +2864,11 @@ func (i *Iterator) SetOptions(o *IterOptions) {
 	// positioning method to reposition the iterator.
 	i.requiresReposition = true
 
+	if i.deadlineExceeded {
+		// The iterator stacks were released; see releaseIfDeadlineExceeded.
+		return
+	}
+
 	// Check if global state requires we close all internal iterators.
 	//
 	// If the Iterator is in an error state, invalidate the existing iterators
@@ -2585,7 +2890,8 @@ func (i *Iterator) SetOptions(o *IterOptions) {
 	// reconstruct it.
 	if i.pointIter != nil && (closeBoth || len(o.PointKeyFilters) > 0 || len(i.opts.PointKeyFilters) > 0 ||
 		o.RangeKeyMasking.Filter != nil || i.opts.RangeKeyMasking.Filter != nil || o.SkipPoint != nil ||
-		i.opts.SkipPoint != nil) {
+		i.opts.SkipPoint != nil || o.Tracer != nil || i.opts.Tracer != nil ||
+		!o.Deadline.Equal(i.opts.Deadline)) {
 		i.err = firstError(i.err, i.pointIter.Close())
 		i.pointIter = nil
 	}
@@ -2685,7 +2991,11 @@ func (i *Iterator) SetOptions(o *IterOptions) {
 		(i.pointIter != nil || !i.opts.pointKeys()) &&
 		(i.rangeKey != nil || !i.opts.rangeKeys() || i.opts.KeyTypes == IterKeyTypePointsAndRanges) &&
 		i.equal(o.RangeKeyMasking.Suffix, i.opts.RangeKeyMasking.Suffix) &&
-		o.UseL6Filters == i.opts.UseL6Filters {
+		o.UseL6Filters == i.opts.UseL6Filters &&
+		o.PreferredStorageLocality == i.opts.PreferredStorageLocality &&
+		o.MaxMergeOperands == i.opts.MaxMergeOperands &&
+		(o.SuffixReadAt == nil) == (i.opts.SuffixReadAt == nil) &&
+		i.equal(o.SuffixReadAt, i.opts.SuffixReadAt) {
 		// The options are identical, so we can likely use the fast path. In
 		// addition to all the above constraints, we cannot use the fast path if
 		// configured to perform lazy combined iteration but an indexed batch
@@ -2758,6 +3068,16 @@ func (i *Iterator) invalidate() {
 	}
 }
 
+// MaskedKeyCount returns the number of point keys that range-key masking (see
+// IterOptions.RangeKeyMasking) has hidden since the last SeekGE, SeekPrefixGE,
+// SeekLT, First or Last. Only point keys that were read and then skipped are
+// counted; point keys in blocks excluded wholesale by
+// RangeKeyMasking.Filter are never surfaced to the iterator and are not
+// included.
+func (i *Iterator) MaskedKeyCount() int {
+	return i.rangeKeyMasking.maskedPoints
+}
+
 // Metrics returns per-iterator metrics.
 func (i *Iterator) Metrics() IteratorMetrics {
 	m := IteratorMetrics{
@@ -2774,6 +3094,23 @@ func (i *Iterator) ResetStats() {
 	i.stats = IteratorStats{}
 }
 
+// LastSeekLevelCount returns the number of levels of the LSM that the most
+// recent SeekGE, SeekPrefixGE or SeekLT positioned at a key. Each memtable,
+// L0 sublevel and level below L0 (as well as an indexed batch) counts as a
+// level. Levels are not counted if they have no key within the iterator
+// bounds at or beyond the seek key, if they were excluded by a bloom filter
+// during a prefix seek, or if they were skipped because a range tombstone in
+// a higher level covers the seek key. A seek that the iterator satisfied
+// without repositioning its levels, such as a repeated seek to the same key,
+// reports the count of the seek that last positioned them. It returns 0 if no
+// seek has been performed.
+func (i *Iterator) LastSeekLevelCount() int {
+	if i.merging == nil {
+		return 0
+	}
+	return i.merging.seekLevelCount
+}
+
 // Stats returns the current stats.
 func (i *Iterator) Stats() IteratorStats {
 	return i.stats
@@ -2824,6 +3161,12 @@ func (i *Iterator) CloneWithContext(ctx context.Context, opts CloneOptions) (*It
 	if i.batchOnlyIter {
 		return nil, errors.Errorf("cannot Clone a batch-only Iterator")
 	}
+	if i.mergedSources != nil {
+		return nil, errors.Errorf("cannot Clone an Iterator with merged sources")
+	}
+	if i.deadlineExceeded {
+		return nil, ErrIteratorDeadlineExceeded
+	}
 	readState := i.readState
 	vers := i.version
 	if readState == nil && vers == nil {
@@ -2861,6 +3204,8 @@ func (i *Iterator) CloneWithContext(ctx context.Context, opts CloneOptions) (*It
 		newIters:            i.newIters,
 		newIterRangeKey:     i.newIterRangeKey,
 		seqNum:              i.seqNum,
+		readsSnapshot:       i.readsSnapshot,
+		rangeStats:          i.rangeStats,
 	}
 	dbi.processBounds(dbi.opts.LowerBound, dbi.opts.UpperBound)
 
@@ -0,0 +1,71 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"encoding/binary"
+
+	"github.com/cockroachdb/errors"
+)
+
+// iterPositionVersion is the version of the encoding of the tokens returned by
+// Iterator.SavePosition.
+const iterPositionVersion = 1
+
+// errInvalidIterPosition is returned for tokens that weren't produced by
+// Iterator.SavePosition.
+var errInvalidIterPosition = errors.New("pebble: invalid iterator position")
+
+// SavePosition returns an opaque token identifying the iterator's current
+// position, which may be persisted and passed to DB.NewIterAtPosition to
+// resume iteration after it, including from another process that opened the
+// same DB. The token records the current user key and the sequence number the
+// iterator reads at. The iterator must be valid.
+func (i *Iterator) SavePosition() ([]byte, error) {
+	if !i.Valid() {
+		return nil, errors.New("pebble: cannot save the position of an invalid iterator")
+	}
+	token := make([]byte, 1, 1+binary.MaxVarintLen64+len(i.key))
+	token[0] = iterPositionVersion
+	token = binary.AppendUvarint(token, i.seqNum)
+	return append(token, i.key...), nil
+}
+
+// NewIterAtPosition returns an iterator positioned at the first key after the
+// position saved by Iterator.SavePosition, with the given options. The iterator
+// is invalid if there are no such keys within its bounds, and it may be moved
+// like any other iterator.
+//
+// The returned iterator reads the current state of the DB, rather than the
+// state read by the iterator whose position was saved, so it includes writes
+// and deletions that happened in between. In particular, if the saved key was
+// since deleted, iteration resumes at the next key that still exists.
+func (d *DB) NewIterAtPosition(token []byte, o *IterOptions) (*Iterator, error) {
+	key, err := decodeIterPosition(token)
+	if err != nil {
+		return nil, err
+	}
+	iter, err := d.NewIter(o)
+	if err != nil {
+		return nil, err
+	}
+	if iter.SeekGE(key) && d.equal(iter.Key(), key) {
+		iter.Next()
+	}
+	return iter, nil
+}
+
+// decodeIterPosition returns the user key saved in a token produced by
+// Iterator.SavePosition. The saved sequence number isn't needed to resume
+// iteration, since the resumed iterator reads the current state of the DB.
+func decodeIterPosition(token []byte) (key []byte, _ error) {
+	if len(token) == 0 || token[0] != iterPositionVersion {
+		return nil, errInvalidIterPosition
+	}
+	if _, n := binary.Uvarint(token[1:]); n > 0 {
+		return token[1+n:], nil
+	}
+	return nil, errInvalidIterPosition
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIterAtPosition(t *testing.T) {
+	fs := vfs.NewMem()
+	d, err := Open("", &Options{FS: fs})
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%d", i)), nil, nil))
+	}
+
+	// rest returns the keys from the iterator's position onwards, and closes it.
+	rest := func(iter *Iterator) []string {
+		var keys []string
+		for valid := iter.Valid(); valid; valid = iter.Next() {
+			keys = append(keys, string(iter.Key()))
+		}
+		require.NoError(t, iter.Close())
+		return keys
+	}
+
+	iter, err := d.NewIter(nil)
+	require.NoError(t, err)
+	_, err = iter.SavePosition()
+	require.Error(t, err)
+	require.True(t, iter.SeekGE([]byte("k3")))
+	token, err := iter.SavePosition()
+	require.NoError(t, err)
+	require.True(t, iter.Last())
+	last, err := iter.SavePosition()
+	require.NoError(t, err)
+	require.NoError(t, iter.Close())
+
+	// Resuming at the position in another process sees the current state of the
+	// DB, including the deletion of the saved key.
+	require.NoError(t, d.Close())
+	d, err = Open("", &Options{FS: fs})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	iter, err = d.NewIterAtPosition(token, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"k4", "k5", "k6", "k7", "k8", "k9"}, rest(iter))
+	require.NoError(t, d.Delete([]byte("k3"), nil))
+	require.NoError(t, d.Delete([]byte("k4"), nil))
+	iter, err = d.NewIterAtPosition(token, &IterOptions{UpperBound: []byte("k7")})
+	require.NoError(t, err)
+	require.Equal(t, []string{"k5", "k6"}, rest(iter))
+	iter, err = d.NewIterAtPosition(last, nil)
+	require.NoError(t, err)
+	require.Empty(t, rest(iter))
+
+	_, err = d.NewIterAtPosition([]byte("k3"), nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import "github.com/cockroachdb/errors"
+
+// Refresh advances the iterator to the latest state of the DB, so that
+// subsequent positioning operations observe the writes committed since the
+// iterator was created or last refreshed, and repositions the iterator at its
+// current key. Refresh is useful for long-running scans that should pick up
+// newer writes without losing their position.
+//
+// Refresh intentionally breaks the snapshot isolation an iterator otherwise
+// provides: keys read before and after the call may reflect different states
+// of the DB. Keys the iterator has already passed are not revisited, even if
+// they were since modified. If the current key was deleted in the newer
+// state, the iterator is positioned at the next key in the direction of
+// iteration instead, and it is invalid if there is no such key within its
+// bounds. If the iterator wasn't positioned at a key, it must be repositioned
+// with an absolute positioning method after the call.
+//
+// Refresh returns an error if the iterator reads a Snapshot or
+// EventuallyFileOnlySnapshot, if it only reads a batch, or if it wasn't
+// created by DB.NewIter or Batch.NewIter. The view of an indexed batch is
+// unaffected; see SetOptions to refresh it.
+func (i *Iterator) Refresh() error {
+	if i.readState == nil || i.readsSnapshot || i.mergedSources != nil {
+		return errors.New("pebble: only iterators reading the latest state of a DB can be refreshed")
+	}
+	if i.err != nil {
+		return i.err
+	}
+	d := i.readState.db
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+
+	// Save the current position, which is lost when the iterator stacks are
+	// closed. The key may point into a block that's released when they are.
+	valid := i.iterValidityState == IterValid && !i.requiresReposition
+	reverse := i.pos == iterPosCurReverse || i.pos == iterPosPrev
+	prefix := i.hasPrefix
+	var key []byte
+	if valid {
+		key = append(key, i.Key()...)
+	}
+
+	// Close the iterator stacks before releasing the old readState, since
+	// sstables referenced by the readState may be deleted once it is released.
+	i.err = firstError(i.err, i.closeValueCloser())
+	if i.pointIter != nil {
+		i.err = firstError(i.err, i.pointIter.Close())
+		i.pointIter = nil
+	}
+	if i.rangeKey != nil {
+		i.err = firstError(i.err, i.rangeKey.rangeKeyIter.Close())
+		i.rangeKey = nil
+	}
+	if i.err != nil {
+		return i.err
+	}
+	readState := i.readState
+	// NB: loadReadState() calls readState.ref(). As in DB.newIter, determine
+	// the seqnum to read at after grabbing the read state.
+	i.readState = d.loadReadState()
+	i.seqNum = d.mu.versions.visibleSeqNum.Load()
+	readState.unref()
+
+	i.invalidate()
+	i.lazyCombinedIter.combinedIterState = combinedIterState{
+		initialized: !i.opts.rangeKeys(),
+	}
+	finishInitializingIter(i.ctx, i.alloc)
+	if !valid {
+		i.requiresReposition = true
+		return nil
+	}
+
+	switch {
+	case prefix:
+		i.SeekPrefixGE(key)
+	case !i.SeekGE(key) || !i.equal(i.Key(), key):
+		if reverse {
+			// The current key was deleted. Move to the preceding key, as the
+			// next call to Prev would have.
+			i.Prev()
+		}
+	}
+	return i.Error()
+}
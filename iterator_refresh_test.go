@@ -0,0 +1,74 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIteratorRefresh(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	for _, k := range []string{"a", "c", "e", "g"} {
+		require.NoError(t, d.Set([]byte(k), []byte("1"), nil))
+	}
+
+	iter, err := d.NewIter(nil)
+	require.NoError(t, err)
+	require.True(t, iter.SeekGE([]byte("c")))
+
+	// Writes committed after the iterator was created are invisible until it's
+	// refreshed, after which it remains at its current key. Keys it already
+	// passed aren't revisited.
+	require.NoError(t, d.Set([]byte("b"), []byte("2"), nil))
+	require.NoError(t, d.Set([]byte("c"), []byte("2"), nil))
+	require.NoError(t, d.Set([]byte("d"), []byte("2"), nil))
+	require.NoError(t, d.Flush())
+	require.True(t, iter.Next())
+	require.Equal(t, "e", string(iter.Key()))
+	require.True(t, iter.Prev())
+	require.NoError(t, iter.Refresh())
+	require.True(t, iter.Valid())
+	require.Equal(t, "c", string(iter.Key()))
+	require.Equal(t, "2", string(iter.Value()))
+	require.True(t, iter.Next())
+	require.Equal(t, "d", string(iter.Key()))
+
+	// If the current key was deleted, the iterator moves on to the next key.
+	require.NoError(t, d.Delete([]byte("d"), nil))
+	require.NoError(t, d.Delete([]byte("e"), nil))
+	require.NoError(t, iter.Refresh())
+	require.True(t, iter.Valid())
+	require.Equal(t, "g", string(iter.Key()))
+
+	// In reverse, the next key is the preceding one.
+	require.True(t, iter.Prev())
+	require.Equal(t, "c", string(iter.Key()))
+	require.NoError(t, d.Delete([]byte("c"), nil))
+	require.NoError(t, iter.Refresh())
+	require.True(t, iter.Valid())
+	require.Equal(t, "b", string(iter.Key()))
+
+	// An exhausted iterator must be repositioned.
+	require.False(t, iter.SeekGE([]byte("z")))
+	require.NoError(t, d.Set([]byte("z"), nil, nil))
+	require.NoError(t, iter.Refresh())
+	require.False(t, iter.Valid())
+	require.True(t, iter.Last())
+	require.Equal(t, "z", string(iter.Key()))
+	require.NoError(t, iter.Close())
+
+	// Iterators reading snapshots can't be refreshed.
+	snap := d.NewSnapshot()
+	defer func() { require.NoError(t, snap.Close()) }()
+	iter, err = snap.NewIter(nil)
+	require.NoError(t, err)
+	require.Error(t, iter.Refresh())
+	require.NoError(t, iter.Close())
+}
@@ -20,6 +20,7 @@ import (
 
 	"github.com/cockroachdb/datadriven"
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/bloom"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/bytealloc"
 	"github.com/cockroachdb/pebble/internal/invalidating"
@@ -2247,6 +2248,74 @@ func TestRangeKeyMaskingRandomized(t *testing.T) {
 	}
 }
 
+// TestRangeKeySuffixComparer tests that range key suffixes are ordered, and
+// compared during masking, using Comparer.CompareRangeSuffixes rather than
+// Comparer.Compare.
+func TestRangeKeySuffixComparer(t *testing.T) {
+	comparer := *testkeys.Comparer
+	comparer.Name = "reversed-range-suffixes"
+	// Order range key suffixes oldest first, the reverse of testkeys.
+	comparer.CompareRangeSuffixes = func(a, b []byte) int {
+		return testkeys.Comparer.Compare(b, a)
+	}
+	d, err := Open("", &Options{
+		FS:                 vfs.NewMem(),
+		Comparer:           &comparer,
+		FormatMajorVersion: internalFormatNewest,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.RangeKeySet([]byte("a"), []byte("c"), []byte("@5"), []byte("v5"), nil))
+	require.NoError(t, d.RangeKeySet([]byte("a"), []byte("c"), []byte("@3"), []byte("v3"), nil))
+	require.NoError(t, d.Set([]byte("b@2"), []byte("b2"), nil))
+	require.NoError(t, d.Set([]byte("b@4"), []byte("b4"), nil))
+	require.NoError(t, d.Set([]byte("b@6"), []byte("b6"), nil))
+
+	scan := func(o *IterOptions) []string {
+		iter, err := d.NewIter(o)
+		require.NoError(t, err)
+		var res []string
+		for valid := iter.First(); valid; valid = iter.Next() {
+			hasPoint, hasRange := iter.HasPointAndRange()
+			if hasPoint {
+				res = append(res, string(iter.Key()))
+			}
+			if hasRange && iter.RangeKeyChanged() {
+				start, end := iter.RangeBounds()
+				for _, rk := range iter.RangeKeys() {
+					res = append(res, fmt.Sprintf("[%s-%s)%s", start, end, rk.Suffix))
+				}
+			}
+		}
+		require.NoError(t, iter.Close())
+		return res
+	}
+	for _, flush := range []bool{false, true} {
+		if flush {
+			require.NoError(t, d.Flush())
+		}
+		// The range keys are ordered by CompareRangeSuffixes.
+		require.Equal(t, []string{"[a-c)@3", "[a-c)@5", "b@6", "b@4", "b@2"},
+			scan(&IterOptions{KeyTypes: IterKeyTypePointsAndRanges}))
+		// Masking compares the suffixes of range keys with the masking suffix
+		// and with the suffixes of point keys using CompareRangeSuffixes too, so
+		// that the range key at @3 masks the point keys at @4 and @6, which it
+		// orders after @3.
+		require.Equal(t, []string{"[a-c)@3", "[a-c)@5", "b@2"},
+			scan(&IterOptions{
+				KeyTypes:        IterKeyTypePointsAndRanges,
+				RangeKeyMasking: RangeKeyMasking{Suffix: []byte("@1")},
+			}))
+		// Neither range key masks with a masking suffix that it orders before.
+		require.Equal(t, []string{"[a-c)@3", "[a-c)@5", "b@6", "b@4", "b@2"},
+			scan(&IterOptions{
+				KeyTypes:        IterKeyTypePointsAndRanges,
+				RangeKeyMasking: RangeKeyMasking{Suffix: []byte("@9")},
+			}))
+	}
+}
+
 // BenchmarkIterator_RangeKeyMasking benchmarks a scan through a keyspace with
 // 10,000 random suffixed point keys, and three range keys covering most of the
 // keyspace. It varies the suffix of the range keys in subbenchmarks to exercise
@@ -2733,3 +2802,303 @@ func BenchmarkSeekPrefixTombstones(b *testing.B) {
 		iter.SeekPrefixGE(seekKey)
 	}
 }
+
+func TestIteratorMaskedKeyCount(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                 vfs.NewMem(),
+		Comparer:           testkeys.Comparer,
+		FormatMajorVersion: FormatNewest,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	for _, k := range []string{"a@1", "b@2", "b@9", "c@3", "d@9", "e@1"} {
+		require.NoError(t, d.Set([]byte(k), nil, nil))
+	}
+	// [b,d)@5 masks b@2 and c@3, but not b@9.
+	require.NoError(t, d.RangeKeySet([]byte("b"), []byte("d"), []byte("@5"), nil, nil))
+
+	iter, _ := d.NewIter(&IterOptions{
+		KeyTypes:        IterKeyTypePointsAndRanges,
+		RangeKeyMasking: RangeKeyMasking{Suffix: []byte("@10")},
+	})
+	defer func() { require.NoError(t, iter.Close()) }()
+
+	var visible []string
+	for valid := iter.First(); valid; valid = iter.Next() {
+		if hasPoint, _ := iter.HasPointAndRange(); hasPoint {
+			visible = append(visible, string(iter.Key()))
+		}
+	}
+	require.Equal(t, []string{"a@1", "b@9", "d@9", "e@1"}, visible)
+	require.Equal(t, 2, iter.MaskedKeyCount())
+
+	// Repositioning resets the count.
+	require.True(t, iter.SeekGE([]byte("d")))
+	require.Equal(t, 0, iter.MaskedKeyCount())
+	require.True(t, iter.SeekGE([]byte("b@9")))
+	require.True(t, iter.Next())
+	require.Equal(t, "d@9", string(iter.Key()))
+	require.Equal(t, 2, iter.MaskedKeyCount())
+	require.True(t, iter.Last())
+	require.Equal(t, 0, iter.MaskedKeyCount())
+}
+
+func TestIteratorLastSeekLevelCount(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		Levels:                      []LevelOptions{{FilterPolicy: bloom.FilterPolicy(10)}},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// L6: a c d, L0: c e, memtable: b.
+	for _, k := range []string{"a", "c", "d"} {
+		require.NoError(t, d.Set([]byte(k), nil, nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+	for _, k := range []string{"c", "e"} {
+		require.NoError(t, d.Set([]byte(k), nil, nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("b"), nil, nil))
+
+	iter, _ := d.NewIter(nil)
+	require.Equal(t, 0, iter.LastSeekLevelCount())
+	require.True(t, iter.SeekGE([]byte("a")))
+	require.Equal(t, 3, iter.LastSeekLevelCount())
+	require.True(t, iter.SeekGE([]byte("c")))
+	require.Equal(t, 2, iter.LastSeekLevelCount())
+	require.True(t, iter.SeekGE([]byte("e")))
+	require.Equal(t, 1, iter.LastSeekLevelCount())
+	require.True(t, iter.SeekLT([]byte("b")))
+	require.Equal(t, 1, iter.LastSeekLevelCount())
+	// The bloom filters exclude the L6 table, which contains c but not b.
+	require.True(t, iter.SeekPrefixGE([]byte("b")))
+	require.Equal(t, 1, iter.LastSeekLevelCount())
+	require.NoError(t, iter.Close())
+
+	// A range tombstone in the memtable covering the seek key causes the
+	// lower levels to be sought past it.
+	require.NoError(t, d.DeleteRange([]byte("a"), []byte("d"), nil))
+	iter, _ = d.NewIter(nil)
+	require.True(t, iter.SeekGE([]byte("a")))
+	require.Equal(t, "d", string(iter.Key()))
+	require.Equal(t, 3, iter.LastSeekLevelCount())
+	require.NoError(t, iter.Close())
+}
+
+func TestIteratorSuffixReadAt(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                 vfs.NewMem(),
+		Comparer:           testkeys.Comparer,
+		FormatMajorVersion: FormatNewest,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	keys := []string{"a@1", "a@2", "a@3", "a@4", "a@5", "b@2", "c@3", "c@7", "d", "e@1", "f@4"}
+	for i, k := range keys {
+		require.NoError(t, d.Set([]byte(k), []byte(k), nil))
+		// Spread the keys across the memtable and sstables.
+		if i%4 == 3 {
+			require.NoError(t, d.Flush())
+		}
+	}
+
+	iter, _ := d.NewIter(&IterOptions{SuffixReadAt: []byte("@3")})
+	defer func() { require.NoError(t, iter.Close()) }()
+	key := func(valid bool) string {
+		if !valid {
+			return "."
+		}
+		require.Equal(t, string(iter.Key()), string(iter.Value()))
+		return string(iter.Key())
+	}
+
+	var forward, reverse []string
+	for valid := iter.First(); valid; valid = iter.Next() {
+		forward = append(forward, key(valid))
+	}
+	for valid := iter.Last(); valid; valid = iter.Prev() {
+		reverse = append(reverse, key(valid))
+	}
+	require.Equal(t, []string{"a@3", "b@2", "c@3", "e@1"}, forward)
+	require.Equal(t, []string{"e@1", "c@3", "b@2", "a@3"}, reverse)
+
+	require.Equal(t, "b@2", key(iter.SeekGE([]byte("b"))))
+	require.Equal(t, "c@3", key(iter.SeekGE([]byte("c@5"))))
+	require.Equal(t, "e@1", key(iter.SeekGE([]byte("c@2"))))
+	require.Equal(t, "b@2", key(iter.SeekLT([]byte("c@3"))))
+	require.Equal(t, "c@3", key(iter.SeekLT([]byte("d"))))
+	require.Equal(t, "b@2", key(iter.Prev()))
+	require.Equal(t, "c@3", key(iter.Next()))
+	require.Equal(t, "e@1", key(iter.NextPrefix()))
+
+	require.Equal(t, "a@3", key(iter.SeekPrefixGE([]byte("a"))))
+	require.Equal(t, ".", key(iter.Next()))
+	require.Equal(t, ".", key(iter.SeekPrefixGE([]byte("f"))))
+	require.Equal(t, ".", key(iter.SeekPrefixGE([]byte("d"))))
+
+	// Changing the read suffix through SetOptions takes effect.
+	iter.SetOptions(&IterOptions{SuffixReadAt: []byte("@4")})
+	require.Equal(t, "a@4", key(iter.First()))
+	require.Equal(t, "f@4", key(iter.Last()))
+	iter.SetOptions(&IterOptions{})
+	require.Equal(t, "a@5", key(iter.First()))
+	require.Equal(t, "a@4", key(iter.Next()))
+}
+
+func TestIteratorTracer(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("c"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("d"), false /* parallelize */))
+	require.NoError(t, d.Set([]byte("b"), []byte("2"), nil))
+
+	var trace IterTrace
+	iter, _ := d.NewIter(&IterOptions{Tracer: trace.Record})
+	require.True(t, iter.SeekGE([]byte("b")))
+	require.True(t, iter.Next())
+	require.Equal(t, "c", string(iter.Key()))
+	require.NoError(t, iter.Close())
+
+	require.Equal(t, `   0: memtable SeekGE(b) -> b#12,SET
+   1: L6       000005 SeekGE(b) -> c#11,SET
+   2: memtable Next() -> exhausted
+`, trace.String())
+
+	// Iterators without a tracer are unaffected, and removing the tracer via
+	// SetOptions stops tracing.
+	trace = trace[:0]
+	iter, _ = d.NewIter(&IterOptions{Tracer: trace.Record})
+	iter.SetOptions(&IterOptions{})
+	require.True(t, iter.First())
+	require.NoError(t, iter.Close())
+	require.Empty(t, trace)
+}
+
+func TestIteratorDistinctValues(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                 vfs.NewMem(),
+		Comparer:           testkeys.Comparer,
+		FormatMajorVersion: FormatNewest,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	for _, kv := range []string{"a=x", "b=x", "c@3=y", "d=x", "e=x", "f=z", "g=z"} {
+		k, v, _ := strings.Cut(kv, "=")
+		require.NoError(t, d.Set([]byte(k), []byte(v), nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.RangeKeySet([]byte("c"), []byte("d"), []byte("@4"), nil, nil))
+
+	scan := func(o *IterOptions) string {
+		o.DistinctValues = true
+		iter, err := d.NewIter(o)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, iter.Close()) }()
+		var keys []string
+		for valid := iter.First(); valid; valid = iter.Next() {
+			keys = append(keys, string(iter.Key()))
+		}
+		return strings.Join(keys, " ")
+	}
+	require.Equal(t, "a c@3 d f", scan(&IterOptions{}))
+	require.Equal(t, "b c@3 d f", scan(&IterOptions{LowerBound: []byte("b"), UpperBound: []byte("g")}))
+	require.Equal(t, "a f", scan(&IterOptions{
+		ValueEqual: func(a, b []byte) bool { return (string(a) == "z") == (string(b) == "z") },
+	}))
+	// The masked point key c@3 is skipped, and the positions at which the range
+	// key starts and ends aren't.
+	require.Equal(t, "a c d f", scan(&IterOptions{
+		KeyTypes:        IterKeyTypePointsAndRanges,
+		RangeKeyMasking: RangeKeyMasking{Suffix: []byte("@9")},
+	}))
+
+	// Seeks aren't affected by the values of the preceding keys.
+	iter, err := d.NewIter(&IterOptions{DistinctValues: true})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, iter.Close()) }()
+	require.True(t, iter.SeekGE([]byte("e")))
+	require.Equal(t, "e", string(iter.Key()))
+	require.True(t, iter.Next())
+	require.Equal(t, "f", string(iter.Key()))
+	require.True(t, iter.Prev())
+	require.Equal(t, "e", string(iter.Key()))
+	require.True(t, iter.SeekLT([]byte("b")))
+	require.Equal(t, "a", string(iter.Key()))
+	require.True(t, iter.Next())
+	require.Equal(t, "c@3", string(iter.Key()))
+	require.False(t, iter.SeekGE([]byte("g")) && iter.Next())
+}
+
+func TestIteratorDeadline(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%04d", i)), nil, nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("k0000"), nil, nil))
+	require.NoError(t, d.Flush())
+
+	// An iterator whose deadline hasn't passed is unaffected.
+	iter, err := d.NewIter(&IterOptions{Deadline: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	n := 0
+	for valid := iter.First(); valid; valid = iter.Next() {
+		n++
+	}
+	require.Equal(t, 1000, n)
+	require.NoError(t, iter.Error())
+
+	// Once the deadline has passed, every positioning fails.
+	iter.SetOptions(&IterOptions{Deadline: time.Now().Add(-time.Second)})
+	require.False(t, iter.First())
+	require.ErrorIs(t, iter.Error(), ErrIteratorDeadlineExceeded)
+	require.False(t, iter.SeekGE([]byte("k0500")))
+	require.ErrorIs(t, iter.Error(), ErrIteratorDeadlineExceeded)
+	require.False(t, iter.Last())
+	require.ErrorIs(t, iter.Error(), ErrIteratorDeadlineExceeded)
+
+	// The iterator released the version it read, so the sstables that
+	// compactions make obsolete aren't zombies. Clearing the deadline doesn't
+	// make it usable again.
+	require.NoError(t, d.Compact([]byte("k"), []byte("l"), false /* parallelize */))
+	require.Zero(t, d.Metrics().Table.ZombieCount)
+	iter.SetOptions(&IterOptions{})
+	require.False(t, iter.SeekGE([]byte("k0500")))
+	require.ErrorIs(t, iter.Error(), ErrIteratorDeadlineExceeded)
+	_, err = iter.Clone(CloneOptions{})
+	require.ErrorIs(t, err, ErrIteratorDeadlineExceeded)
+	require.ErrorIs(t, iter.Close(), ErrIteratorDeadlineExceeded)
+
+	// A deadline that passes during a scan is noticed within
+	// iterDeadlineCheckKeys keys.
+	deadline := time.Now().Add(10 * time.Millisecond)
+	iter, err = d.NewIter(&IterOptions{Deadline: deadline})
+	require.NoError(t, err)
+	require.True(t, iter.First())
+	time.Sleep(time.Until(deadline) + time.Millisecond)
+	n = 0
+	for iter.Next() {
+		n++
+	}
+	require.LessOrEqual(t, n, iterDeadlineCheckKeys)
+	require.ErrorIs(t, iter.Error(), ErrIteratorDeadlineExceeded)
+	require.False(t, iter.SeekGE([]byte("k0000")))
+	require.ErrorIs(t, iter.Error(), ErrIteratorDeadlineExceeded)
+	require.ErrorIs(t, iter.Close(), ErrIteratorDeadlineExceeded)
+}
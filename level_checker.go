@@ -9,11 +9,14 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"strings"
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/keyspan"
 	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/sstable"
 )
 
 // This file implements DB.CheckLevels() which checks that every entry in the
@@ -52,6 +55,11 @@ type simpleMergingIterLevel struct {
 
 	iterKV    *base.InternalKV
 	tombstone *keyspan.Span
+	// l0 is true if the level is an L0 sublevel.
+	l0 bool
+	// recentKeys holds the last violationContextKeys keys the level stepped
+	// past, oldest first, if the simpleMergingIter's panicOnViolation is set.
+	recentKeys []InternalKey
 }
 
 type simpleMergingIter struct {
@@ -69,6 +77,46 @@ type simpleMergingIter struct {
 	numPoints int64
 	merge     Merge
 	formatKey base.FormatKey
+	// checkDuplicates enables the detection of identical InternalKeys at
+	// different levels. See WithDuplicateKeyCheck.
+	checkDuplicates bool
+	// maxKeyBufferReuse bounds the capacity of the buffers into which keys are
+	// cloned that is retained regardless of the key length. See cloneKey.
+	maxKeyBufferReuse int
+	// allowL0Overlap tolerates violations of the level invariant between L0
+	// sublevels, counting them in numL0Overlaps. See WithAllowL0Overlap.
+	allowL0Overlap bool
+	numL0Overlaps  int64
+	// keysStable references the keys of the levels' iterators directly rather
+	// than cloning them. See WithStableKeys.
+	keysStable bool
+	// panicOnViolation panics with a dump of the state of the levels when a
+	// violation is found. See WithPanicOnViolation.
+	panicOnViolation bool
+}
+
+// violationContextKeys is the number of keys preceding a violation that are
+// included for each level in the state dumped by WithPanicOnViolation, and
+// the number of tombstones on either side of a tombstone violation.
+const violationContextKeys = 4
+
+// keyBufferShrinkMultiple is the multiple of the length of a key that a key
+// buffer's capacity may exceed before the buffer is released, if its capacity
+// also exceeds simpleMergingIter.maxKeyBufferReuse.
+const keyBufferShrinkMultiple = 4
+
+// defaultMaxKeyBufferReuse is the default value of
+// checkConfig.maxKeyBufferReuse.
+const defaultMaxKeyBufferReuse = 64 << 10
+
+// cloneKey copies key into buf, reusing buf unless doing so would retain a
+// buffer much larger than key. Without this, a single huge key would leave
+// behind a buffer of its size for the remainder of the check.
+func (m *simpleMergingIter) cloneKey(buf, key []byte) []byte {
+	if cap(buf) > m.maxKeyBufferReuse && cap(buf) > keyBufferShrinkMultiple*len(key) {
+		buf = nil
+	}
+	return append(buf[:0], key...)
 }
 
 func (m *simpleMergingIter) init(
@@ -93,7 +141,10 @@ func (m *simpleMergingIter) init(
 				index: i,
 				value: l.iterKV.V,
 			}
-			item.key = l.iterKV.K.Clone()
+			item.key = l.iterKV.K
+			if !m.keysStable {
+				item.key = item.key.Clone()
+			}
 			m.heap.items = append(m.heap.items, item)
 		}
 	}
@@ -128,7 +179,8 @@ func (m *simpleMergingIter) step() bool {
 	item := &m.heap.items[0]
 	l := &m.levels[item.index]
 	// Sentinels are not relevant for this point checking.
-	if !item.key.IsExclusiveSentinel() && item.key.Visible(m.snapshot, base.InternalKeySeqNumMax) {
+	if !item.key.IsExclusiveSentinel() &&
+		base.VisibleSeqNum(nil /* snapshots */, m.snapshot, item.key.SeqNum()) {
 		// This is a visible point key.
 		if !m.handleVisiblePoint(item, l) {
 			return false
@@ -139,6 +191,9 @@ func (m *simpleMergingIter) step() bool {
 	// Next(). We save its debug string for potential use after it is closed -
 	// either in this current step() invocation or on the next invocation.
 	m.lastIterMsg = l.iter.String()
+	if m.panicOnViolation {
+		l.recordRecentKey(item.key)
+	}
 
 	// Step to the next point.
 	l.iterKV = l.iter.Next()
@@ -153,13 +208,17 @@ func (m *simpleMergingIter) step() bool {
 		// next sstable in the level, in which case item.key is previous sstable's
 		// last point key.
 		if !l.iterKV.K.IsExclusiveSentinel() && base.InternalCompare(m.heap.cmp, item.key, l.iterKV.K) >= 0 {
-			m.err = errors.Errorf("out of order keys %s >= %s in %s",
-				item.key.Pretty(m.formatKey), l.iterKV.K.Pretty(m.formatKey), l.iter)
+			m.violation(errors.Errorf("out of order keys %s >= %s in %s",
+				item.key.Pretty(m.formatKey), l.iterKV.K.Pretty(m.formatKey), l.iter))
 			return false
 		}
-		item.key = base.InternalKey{
-			Trailer: l.iterKV.K.Trailer,
-			UserKey: append(item.key.UserKey[:0], l.iterKV.K.UserKey...),
+		if m.keysStable {
+			item.key = l.iterKV.K
+		} else {
+			item.key = base.InternalKey{
+				Trailer: l.iterKV.K.Trailer,
+				UserKey: m.cloneKey(item.key.UserKey, l.iterKV.K.UserKey),
+			}
 		}
 		item.value = l.iterKV.V
 		if m.heap.len() > 1 {
@@ -199,19 +258,33 @@ func (m *simpleMergingIter) handleVisiblePoint(
 	m.numPoints++
 	keyChanged := m.heap.cmp(item.key.UserKey, m.lastKey.UserKey) != 0
 	if !keyChanged {
-		// At the same user key. We will see them in decreasing seqnum
-		// order so the lastLevel must not be lower.
-		if m.lastLevel > item.index {
-			m.err = errors.Errorf("found InternalKey %s in %s and InternalKey %s in %s",
+		// At the same user key. The same InternalKey at two levels indicates
+		// that the same key was written to the LSM twice, for example by an
+		// ingestion that was botched.
+		duplicate := m.checkDuplicates && item.key.Trailer == m.lastKey.Trailer
+		// We will see them in decreasing seqnum order so the lastLevel must not
+		// be lower.
+		inverted := m.lastLevel > item.index
+		// Both keys being in L0 sublevels is tolerated by WithAllowL0Overlap.
+		l0Overlap := m.allowL0Overlap && m.lastLevel >= 0 && l.l0 && m.levels[m.lastLevel].l0
+		if (duplicate || inverted) && l0Overlap {
+			m.numL0Overlaps++
+		} else if duplicate {
+			m.violation(base.CorruptionErrorf("duplicate InternalKey %s in %s and in %s",
+				item.key.Pretty(m.formatKey), m.lastIterMsg, l.iter))
+			return false
+		} else if inverted {
+			m.violation(errors.Errorf("found InternalKey %s in %s and InternalKey %s in %s",
 				item.key.Pretty(m.formatKey), l.iter, m.lastKey.Pretty(m.formatKey),
-				m.lastIterMsg)
+				m.lastIterMsg))
 			return false
 		}
+		m.lastKey.Trailer = item.key.Trailer
 		m.lastLevel = item.index
 	} else {
 		// The user key has changed.
 		m.lastKey.Trailer = item.key.Trailer
-		m.lastKey.UserKey = append(m.lastKey.UserKey[:0], item.key.UserKey...)
+		m.lastKey.UserKey = m.cloneKey(m.lastKey.UserKey, item.key.UserKey)
 		m.lastLevel = item.index
 	}
 	// Ongoing series of MERGE records ends with a MERGE record.
@@ -251,9 +324,9 @@ func (m *simpleMergingIter) handleVisiblePoint(
 		case InternalKeyKindMerge:
 			m.err = m.valueMerger.MergeOlder(itemValue)
 		default:
-			m.err = errors.Errorf("pebble: invalid internal key kind %s in %s",
+			m.violation(errors.Errorf("pebble: invalid internal key kind %s in %s",
 				item.key.Pretty(m.formatKey),
-				l.iter)
+				l.iter))
 			return false
 		}
 	} else if item.key.Kind() == InternalKeyKindMerge && m.err == nil {
@@ -273,15 +346,66 @@ func (m *simpleMergingIter) handleVisiblePoint(
 			continue
 		}
 		if lvl.tombstone.Contains(m.heap.cmp, item.key.UserKey) && lvl.tombstone.CoversAt(m.snapshot, item.key.SeqNum()) {
-			m.err = errors.Errorf("tombstone %s in %s deletes key %s in %s",
+			if m.allowL0Overlap && l.l0 && lvl.l0 {
+				m.numL0Overlaps++
+				continue
+			}
+			m.violation(errors.Errorf("tombstone %s in %s deletes key %s in %s",
 				lvl.tombstone.Pretty(m.formatKey), lvl.iter, item.key.Pretty(m.formatKey),
-				l.iter)
+				l.iter))
 			return false
 		}
 	}
 	return true
 }
 
+// recordRecentKey adds key to the level's recentKeys, dropping the oldest key
+// if there are already violationContextKeys of them.
+func (l *simpleMergingIterLevel) recordRecentKey(key InternalKey) {
+	if len(l.recentKeys) == violationContextKeys {
+		oldest := l.recentKeys[0]
+		copy(l.recentKeys, l.recentKeys[1:])
+		l.recentKeys = l.recentKeys[:violationContextKeys-1]
+		// Reuse the oldest key's buffer.
+		oldest.UserKey = append(oldest.UserKey[:0], key.UserKey...)
+		oldest.Trailer = key.Trailer
+		l.recentKeys = append(l.recentKeys, oldest)
+		return
+	}
+	l.recentKeys = append(l.recentKeys, key.Clone())
+}
+
+// violation records err, a violation found by the check. If panicOnViolation
+// is set, it panics with err and a dump of the recent keys, the current key
+// and the current tombstone of each level.
+func (m *simpleMergingIter) violation(err error) {
+	m.err = err
+	if !m.panicOnViolation {
+		return
+	}
+	var buf strings.Builder
+	for i := range m.levels {
+		l := &m.levels[i]
+		if l.iter != nil {
+			fmt.Fprintf(&buf, "level %d (%s):\n", i, l.iter)
+		} else {
+			fmt.Fprintf(&buf, "level %d (exhausted):\n", i)
+		}
+		buf.WriteString("  recent:")
+		for _, k := range l.recentKeys {
+			fmt.Fprintf(&buf, " %s", k.Pretty(m.formatKey))
+		}
+		buf.WriteString("\n")
+		if l.iterKV != nil {
+			fmt.Fprintf(&buf, "  current: %s\n", l.iterKV.K.Pretty(m.formatKey))
+		}
+		if l.tombstone != nil && !l.tombstone.Empty() {
+			fmt.Fprintf(&buf, "  tombstone: %s\n", l.tombstone.Pretty(m.formatKey))
+		}
+	}
+	panic(errors.Errorf("%v\n%s", err, buf.String()))
+}
+
 // Checking that range tombstones are mutually consistent is performed by
 // checkRangeTombstones(). See the overview comment at the top of the file.
 //
@@ -294,7 +418,10 @@ func (m *simpleMergingIter) handleVisiblePoint(
 // - Sort tombstones by start key and decreasing seqnum
 //   (tombstonesByStartKeyAndSeqnum) - all tombstones that have the same start
 //   key will have the same end key because they have been fragmented.
-// - Iterate and check (iterateAndCheckTombstones()).
+// - Iterate and check (iterateAndCheckTombstones()). If
+//   WithRangeDelValueCheck is used, this also checks that identical
+//   tombstones (the same fragment and trailer) found in different levels have
+//   equal values.
 //
 // Note that this simple approach requires holding all the tombstones across all
 // levels in-memory. A more sophisticated incremental approach could be devised,
@@ -328,9 +455,18 @@ func (v *tombstonesByStartKeyAndSeqnum) Swap(i, j int) {
 	v.buf[i], v.buf[j] = v.buf[j], v.buf[i]
 }
 
+// iterateAndCheckTombstones checks the fragmented tombstones for inversions,
+// returning the number of inversions between L0 sublevels that were tolerated
+// because allowL0Overlap is set. If panicOnViolation is set, a violation
+// panics with a dump of the tombstones surrounding it.
 func iterateAndCheckTombstones(
-	cmp Compare, formatKey base.FormatKey, tombstones []tombstoneWithLevel,
-) error {
+	cmp Compare,
+	formatKey base.FormatKey,
+	valueEqual func(a, b []byte) bool,
+	allowL0Overlap bool,
+	panicOnViolation bool,
+	tombstones []tombstoneWithLevel,
+) (l0Overlaps int64, _ error) {
 	sortBuf := tombstonesByStartKeyAndSeqnum{
 		cmp: cmp,
 		buf: tombstones,
@@ -341,15 +477,68 @@ func iterateAndCheckTombstones(
 	// encounter them in non-increasing seqnum order and so should encounter them
 	// in non-decreasing level order.
 	lastTombstone := tombstoneWithLevel{}
-	for _, t := range tombstones {
+	// sameStart is the index of the first tombstone sharing t's start key.
+	sameStart := 0
+	// violation returns err, the violation found at the i-th tombstone, after
+	// panicking if panicOnViolation is set.
+	violation := func(i int, err error) error {
+		if panicOnViolation {
+			var buf strings.Builder
+			for j := max(0, i-violationContextKeys); j < min(len(tombstones), i+violationContextKeys+1); j++ {
+				marker := " "
+				if j == i {
+					marker = ">"
+				}
+				fmt.Fprintf(&buf, "%s %s in %s\n", marker, tombstones[j].Span.Pretty(formatKey),
+					levelOrMemtable(tombstones[j].lsmLevel, tombstones[j].fileNum))
+			}
+			panic(errors.Errorf("%v\n%s", err, buf.String()))
+		}
+		return err
+	}
+	for i, t := range tombstones {
 		if cmp(lastTombstone.Start, t.Start) == 0 && lastTombstone.level > t.level {
-			return errors.Errorf("encountered tombstone %s in %s"+
-				" that has a lower seqnum than the same tombstone in %s",
-				t.Span.Pretty(formatKey), levelOrMemtable(t.lsmLevel, t.fileNum),
-				levelOrMemtable(lastTombstone.lsmLevel, lastTombstone.fileNum))
+			if allowL0Overlap && lastTombstone.lsmLevel == 0 && t.lsmLevel == 0 {
+				l0Overlaps++
+			} else {
+				return 0, violation(i, errors.Errorf("encountered tombstone %s in %s"+
+					" that has a lower seqnum than the same tombstone in %s",
+					t.Span.Pretty(formatKey), levelOrMemtable(t.lsmLevel, t.fileNum),
+					levelOrMemtable(lastTombstone.lsmLevel, lastTombstone.fileNum)))
+			}
+		}
+		if i == 0 || cmp(lastTombstone.Start, t.Start) != 0 {
+			sameStart = i
+		}
+		if valueEqual != nil {
+			for _, prev := range tombstones[sameStart:i] {
+				if err := checkTombstoneValues(formatKey, valueEqual, prev, t); err != nil {
+					return 0, violation(i, err)
+				}
+			}
 		}
 		lastTombstone = t
 	}
+	return l0Overlaps, nil
+}
+
+// checkTombstoneValues checks that the keys with equal trailers of a and b,
+// two fragments with the same bounds, have equal values.
+func checkTombstoneValues(
+	formatKey base.FormatKey, valueEqual func(a, b []byte) bool, a, b tombstoneWithLevel,
+) error {
+	if a.level == b.level {
+		return nil
+	}
+	for _, ak := range a.Keys {
+		for _, bk := range b.Keys {
+			if ak.Trailer == bk.Trailer && !valueEqual(ak.Value, bk.Value) {
+				return errors.Errorf("tombstone %s in %s and tombstone %s in %s have inconsistent values",
+					a.Span.Pretty(formatKey), levelOrMemtable(a.lsmLevel, a.fileNum),
+					b.Span.Pretty(formatKey), levelOrMemtable(b.lsmLevel, b.fileNum))
+			}
+		}
+	}
 	return nil
 }
 
@@ -362,6 +551,27 @@ type checkConfig struct {
 	stats     *CheckLevelsStats
 	merge     Merge
 	formatKey base.FormatKey
+	// checkDuplicates is set by WithDuplicateKeyCheck.
+	checkDuplicates bool
+	// maxKeyBufferReuse is set by WithMaxKeyBufferReuse.
+	maxKeyBufferReuse int
+	// allowL0Overlap is set by WithAllowL0Overlap.
+	allowL0Overlap bool
+	// skipRangeTombstones is set by WithSkipRangeTombstones.
+	skipRangeTombstones bool
+	// panicOnViolation is set by WithPanicOnViolation.
+	panicOnViolation bool
+	// continueOnFileError is set by WithContinueOnFileError.
+	continueOnFileError bool
+	// fileErrs holds the errors opening the sstables skipped because of
+	// continueOnFileError, at most one per file, and skippedFiles the files
+	// they belong to.
+	fileErrs     []error
+	skippedFiles map[base.FileNum]struct{}
+	// keysStable is set by WithStableKeys.
+	keysStable bool
+	// rangeDelValueEqual is set by WithRangeDelValueCheck.
+	rangeDelValueEqual func(a, b []byte) bool
 }
 
 // cmp is shorthand for comparer.Compare.
@@ -379,7 +589,7 @@ func checkRangeTombstones(c *checkConfig) error {
 			continue
 		}
 		tombstones, err = addTombstonesFromIter(
-			iter, level, -1, 0, tombstones, c.seqNum, c.cmp, c.formatKey,
+			iter, level, -1, nil /* file */, tombstones, c.seqNum, c.cmp, c.formatKey,
 		)
 		if err != nil {
 			return err
@@ -397,7 +607,7 @@ func checkRangeTombstones(c *checkConfig) error {
 			if err != nil {
 				return err
 			}
-			if tombstones, err = addTombstonesFromIter(iters.RangeDeletion(), level, lsmLevel, f.FileNum,
+			if tombstones, err = addTombstonesFromIter(iters.RangeDeletion(), level, lsmLevel, f,
 				tombstones, c.seqNum, c.cmp, c.formatKey); err != nil {
 				iters.CloseAll()
 				return err
@@ -430,7 +640,15 @@ func checkRangeTombstones(c *checkConfig) error {
 	// Fragment them all.
 	userKeys := collectAllUserKeys(c.cmp, tombstones)
 	tombstones = fragmentUsingUserKeys(c.cmp, tombstones, userKeys)
-	return iterateAndCheckTombstones(c.cmp, c.formatKey, tombstones)
+	l0Overlaps, err := iterateAndCheckTombstones(
+		c.cmp, c.formatKey, c.rangeDelValueEqual, c.allowL0Overlap, c.panicOnViolation, tombstones)
+	if err != nil {
+		return err
+	}
+	if c.stats != nil {
+		c.stats.NumL0Overlaps += l0Overlaps
+	}
+	return nil
 }
 
 func levelOrMemtable(lsmLevel int, fileNum FileNum) string {
@@ -440,11 +658,15 @@ func levelOrMemtable(lsmLevel int, fileNum FileNum) string {
 	return fmt.Sprintf("L%d: fileNum=%s", lsmLevel, fileNum)
 }
 
+// addTombstonesFromIter adds the tombstones visible at seqNum from the range
+// deletion iterator of the file f, or of a memtable if f is nil. The tombstones
+// of a file are checked to be ordered and fragmented, and then truncated to its
+// bounds.
 func addTombstonesFromIter(
 	iter keyspan.FragmentIterator,
 	level int,
 	lsmLevel int,
-	fileNum FileNum,
+	f *fileMetadata,
 	tombstones []tombstoneWithLevel,
 	seqNum uint64,
 	cmp Compare,
@@ -454,6 +676,10 @@ func addTombstonesFromIter(
 		err = firstError(err, iter.Close())
 	}()
 
+	var fileNum FileNum
+	if f != nil {
+		fileNum = f.FileNum
+	}
 	var prevTombstone keyspan.Span
 	tomb, err := iter.First()
 	for ; tomb != nil; tomb, err = iter.Next() {
@@ -471,6 +697,10 @@ func addTombstonesFromIter(
 		}
 		prevTombstone = t
 
+		// The tombstones of a file only apply within its bounds.
+		if f != nil {
+			t = keyspan.TruncateToFileBounds(t, f.Smallest, f.Largest, cmp)
+		}
 		if !t.Empty() {
 			tombstones = append(tombstones, tombstoneWithLevel{
 				Span:     t,
@@ -543,10 +773,229 @@ func fragmentUsingUserKeys(
 	return buf
 }
 
+// TombstoneInfo describes a range deletion tombstone. See
+// DB.TombstonesCovering.
+type TombstoneInfo struct {
+	// Level is the LSM level containing the tombstone, or -1 if the tombstone
+	// is in a memtable.
+	Level int
+	// Sublevel is the L0 sublevel containing the tombstone. It is only
+	// meaningful if Level is 0.
+	Sublevel int
+	// FileNum is the sstable containing the tombstone. It is zero if the
+	// tombstone is in a memtable.
+	FileNum FileNum
+	// Start and End are the bounds of the tombstone's fragment containing the
+	// key. End is exclusive.
+	Start, End []byte
+	SeqNum     uint64
+}
+
+// TombstonesCovering returns every range deletion tombstone, visible at the
+// current read state, whose span contains key: first those in the memtables,
+// from newest to oldest, and then those in sstables, by level. It is intended
+// for debugging failures reported by CheckLevels.
+func (d *DB) TombstonesCovering(key []byte) ([]TombstoneInfo, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	readState := d.loadReadState()
+	defer readState.unref()
+	seqNum := d.mu.versions.visibleSeqNum.Load()
+
+	var infos []TombstoneInfo
+	addFromIter := func(iter keyspan.FragmentIterator, level, sublevel int, fileNum FileNum) error {
+		t, err := iter.SeekGE(key)
+		if err != nil || t == nil || !t.Contains(d.cmp, key) {
+			return err
+		}
+		for _, k := range t.Visible(seqNum).Keys {
+			infos = append(infos, TombstoneInfo{
+				Level:    level,
+				Sublevel: sublevel,
+				FileNum:  fileNum,
+				Start:    append([]byte(nil), t.Start...),
+				End:      append([]byte(nil), t.End...),
+				SeqNum:   k.SeqNum(),
+			})
+		}
+		return nil
+	}
+
+	memtables := readState.memtables
+	for i := len(memtables) - 1; i >= 0; i-- {
+		if iter := memtables[i].newRangeDelIter(nil); iter != nil {
+			err := addFromIter(iter, -1, 0, 0)
+			if err = firstError(err, iter.Close()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	current := readState.current
+	bounds := base.UserKeyBoundsInclusive(key, key)
+	for level := range current.Levels {
+		overlaps := current.Overlaps(level, bounds)
+		files := overlaps.Iter()
+		for f := files.First(); f != nil; f = files.Next() {
+			iters, err := d.newIters(
+				context.Background(), f, &IterOptions{level: manifest.Level(level)},
+				internalIterOpts{}, iterRangeDeletions)
+			if err != nil {
+				return nil, err
+			}
+			if iter := iters.RangeDeletion(); iter != nil {
+				err = addFromIter(iter, level, f.SubLevel, f.FileNum)
+			}
+			if err = firstError(err, iters.CloseAll()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return infos, nil
+}
+
 // CheckLevelsStats provides basic stats on points and tombstones encountered.
 type CheckLevelsStats struct {
 	NumPoints     int64
 	NumTombstones int
+	// NumL0Overlaps is the number of violations of the level invariant between
+	// L0 sublevels that were tolerated. It is only non-zero when
+	// WithAllowL0Overlap is used.
+	NumL0Overlaps int64
+	// RangeKeyStats holds statistics of the range keys in the memtables and
+	// sstables.
+	RangeKeyStats CheckLevelsRangeKeyStats
+}
+
+// CheckLevelsRangeKeyStats holds statistics of the range keys visited by
+// DB.CheckLevels. Like NumTombstones, the counts include every key of every
+// span in the memtables and sstables, so a range key that was fragmented into
+// several spans, or written to several levels, is counted once per span.
+type CheckLevelsRangeKeyStats struct {
+	// NumSets, NumUnsets and NumDels are the number of RANGEKEYSET,
+	// RANGEKEYUNSET and RANGEKEYDEL keys.
+	NumSets   int
+	NumUnsets int
+	NumDels   int
+	// NumFragments is the number of distinct spans that result from
+	// fragmenting all of the spans at each other's bounds.
+	NumFragments int
+}
+
+// CheckLevelsOption sets an optional parameter of DB.CheckLevels.
+type CheckLevelsOption func(*checkConfig)
+
+// WithDuplicateKeyCheck enables the detection of identical InternalKeys (the
+// same user key and trailer) at different levels of the LSM, which is reported
+// as a corruption error naming the files containing both keys. The check is
+// disabled by default, since some stores knowingly allow ingestions to
+// produce such duplicates.
+func WithDuplicateKeyCheck() CheckLevelsOption {
+	return func(c *checkConfig) {
+		c.checkDuplicates = true
+	}
+}
+
+// WithMaxKeyBufferReuse sets the capacity, in bytes, up to which the buffers
+// that CheckLevels clones keys into are always reused. A buffer with a larger
+// capacity is released once it exceeds a small multiple of the length of the
+// key being cloned, so that an outlier huge key doesn't leave behind a buffer
+// of its size. The default is 64 KiB.
+func WithMaxKeyBufferReuse(bytes int) CheckLevelsOption {
+	return func(c *checkConfig) {
+		c.maxKeyBufferReuse = bytes
+	}
+}
+
+// WithAllowL0Overlap relaxes the checks of the level invariant between L0
+// sublevels, which may overlap while ingestions are in progress. Only the
+// following checks are relaxed, and only when both of the keys involved are
+// in L0 sublevels:
+//   - A point key in a newer sublevel with a lower seqnum than a point key with
+//     the same user key in an older sublevel.
+//   - A point key deleted by a range tombstone in an older sublevel.
+//   - A range tombstone in a newer sublevel with a lower seqnum than an
+//     overlapping range tombstone in an older sublevel.
+//   - The duplicate InternalKeys reported by WithDuplicateKeyCheck.
+//
+// Violations between L0 and the memtables or L1+, and within L1+, are still
+// reported as errors, as are all other checks. Tolerated violations are
+// counted in CheckLevelsStats.NumL0Overlaps.
+func WithAllowL0Overlap() CheckLevelsOption {
+	return func(c *checkConfig) {
+		c.allowL0Overlap = true
+	}
+}
+
+// WithSkipRangeTombstones skips the checks of range tombstones, for stores
+// known to contain none. The tombstones of the memtables and sstables are
+// neither positioned alongside the point keys, nor checked for consistency
+// with each other, which removes the cost of seeking range deletion iterators
+// at each point key, as well as the fragmenting of all the tombstones of the
+// LSM once the point keys have been checked. The range deletion iterator of
+// each memtable and sstable is still opened, only to verify that it's empty:
+// an error is returned if a range tombstone is encountered nonetheless, rather
+// than checking the point keys without it.
+func WithSkipRangeTombstones() CheckLevelsOption {
+	return func(c *checkConfig) {
+		c.skipRangeTombstones = true
+	}
+}
+
+// WithPanicOnViolation makes CheckLevels panic when it finds a violation of
+// one of its checks, instead of returning an error, for use by fuzzers and
+// other harnesses that want an artifact of the state at the point of failure.
+// The panic's error includes the violation along with a dump of the
+// surrounding state: for a point key violation, the last few keys stepped
+// past, the current key and the current range tombstone of each level, and
+// for a range tombstone violation, the fragmented tombstones on either side
+// of it. Errors unrelated to the checks, such as I/O errors, are still
+// returned.
+func WithPanicOnViolation() CheckLevelsOption {
+	return func(c *checkConfig) {
+		c.panicOnViolation = true
+	}
+}
+
+// WithContinueOnFileError makes CheckLevels skip the sstables that can't be
+// opened, such as missing or unreadable files, instead of stopping at the
+// first one, so that a single bad file doesn't prevent checking the rest of
+// the store. The errors opening the skipped files are returned once the check
+// completes, along with the first violation found, if any.
+//
+// The keys of a skipped file are absent from the check, so violations
+// involving them, such as a point key inverted with respect to a key or range
+// tombstone in the skipped file, may go unreported.
+func WithContinueOnFileError() CheckLevelsOption {
+	return func(c *checkConfig) {
+		c.continueOnFileError = true
+	}
+}
+
+// WithStableKeys has CheckLevels reference the keys returned by the iterators
+// of the levels instead of cloning them, saving the cost of copying each key.
+// This is only correct if each key remains valid until the following call to
+// Next on its iterator returns. That's the case for the keys of memtables, and
+// of sstables whose keys are stored without prefix compression (written with a
+// BlockRestartInterval of 1) and whose blocks remain in the block cache, as
+// when checking an offline, immutable store with a large enough cache. It's
+// unsafe in general, and in particular when checking a DB that's being written
+// to, since neither condition can be guaranteed.
+func WithStableKeys() CheckLevelsOption {
+	return func(c *checkConfig) {
+		c.keysStable = true
+	}
+}
+
+// WithRangeDelValueCheck checks that identical range tombstones (the same
+// fragment and trailer) at different levels have values that are equal
+// according to equal, for encodings that store metadata in range tombstone
+// values. Tombstones with unequal values are reported as an error naming the
+// files containing both. By default, range tombstone values aren't compared.
+func WithRangeDelValueCheck(equal func(a, b []byte) bool) CheckLevelsOption {
+	return func(c *checkConfig) {
+		c.rangeDelValueEqual = equal
+	}
 }
 
 // CheckLevels checks:
@@ -555,7 +1004,9 @@ type CheckLevelsStats struct {
 //   - Point keys in sstables are ordered.
 //   - Range delete tombstones in sstables are ordered and fragmented.
 //   - Successful processing of all MERGE records.
-func (d *DB) CheckLevels(stats *CheckLevelsStats) error {
+//   - Optionally, that no InternalKey appears at more than one level. See
+//     WithDuplicateKeyCheck.
+func (d *DB) CheckLevels(stats *CheckLevelsStats, opts ...CheckLevelsOption) error {
 	// Grab and reference the current readState.
 	readState := d.loadReadState()
 	defer readState.unref()
@@ -573,11 +1024,183 @@ func (d *DB) CheckLevels(stats *CheckLevelsStats) error {
 		stats:     stats,
 		merge:     d.merge,
 		formatKey: d.opts.Comparer.FormatKey,
+
+		maxKeyBufferReuse: defaultMaxKeyBufferReuse,
+	}
+	for _, opt := range opts {
+		opt(checkConfig)
 	}
 	return checkLevelsInternal(checkConfig)
 }
 
+// LevelFile is an sstable checked by CheckSSTables, and the level of the LSM
+// it's intended for.
+type LevelFile struct {
+	Path  string
+	Level int
+}
+
+// CheckSSTables performs the checks of DB.CheckLevels on a set of sstables
+// in opts.FS that aren't part of a DB, as if they formed the levels of an LSM
+// with no memtables. As required of the sstables of a DB, the sstables of each
+// level L1 and above must not overlap.
+//
+// Sstables whose keys all have a zero sequence number, such as those built
+// for ingestion by sstable.Writer, are assigned sequence numbers as if they
+// were ingested one at a time from the bottommost level up, and within L0 in
+// the order they're given, with later sstables newer. Other sstables keep the
+// sequence numbers of their keys.
+//
+// Errors identify each sstable by a file number one greater than its index in
+// files.
+func CheckSSTables(files []LevelFile, opts *Options) (err error) {
+	opts = opts.Clone().EnsureDefaults()
+	// readers holds the reader of each sstable, indexed by its file number
+	// minus one.
+	readers := make([]*sstable.Reader, len(files))
+	defer func() {
+		for _, r := range readers {
+			if r != nil {
+				err = firstError(err, r.Close())
+			}
+		}
+	}()
+
+	// openReadable opens the sstable at the path.
+	openReadable := func(path string) (objstorage.Readable, error) {
+		f, err := opts.FS.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return sstable.NewSimpleReadable(f)
+	}
+	var levels [numLevels][]*fileMetadata
+	var seqNum uint64
+	for i, lf := range files {
+		if lf.Level < 0 || lf.Level >= numLevels {
+			return errors.Errorf("pebble: invalid level %d for %s", lf.Level, lf.Path)
+		}
+		fileNum := base.FileNum(i + 1)
+		readable, err := openReadable(lf.Path)
+		if err != nil {
+			return err
+		}
+		// loadTableMeta closes the readable along with its reader.
+		meta, err := loadTableMeta(opts, FormatNewest, readable, 0 /* cacheID */, fileNum,
+			func(opts *Options, key *InternalKey) error {
+				if key.Kind() == InternalKeyKindInvalid {
+					return base.CorruptionErrorf("pebble: sstable has corrupted key: %s",
+						key.Pretty(opts.Comparer.FormatKey))
+				}
+				return nil
+			})
+		if err != nil {
+			return errors.Wrapf(err, "pebble: loading %s", lf.Path)
+		}
+		if meta == nil {
+			// The sstable is empty.
+			continue
+		}
+		if readable, err = openReadable(lf.Path); err != nil {
+			return err
+		}
+		if readers[i], err = sstable.NewReader(readable, opts.MakeReaderOptions()); err != nil {
+			return err
+		}
+		if err := loadTableSeqNums(meta, readers[i]); err != nil {
+			return errors.Wrapf(err, "pebble: loading %s", lf.Path)
+		}
+		levels[lf.Level] = append(levels[lf.Level], meta)
+		seqNum = max(seqNum, meta.LargestSeqNum)
+	}
+	for level := numLevels - 1; level >= 0; level-- {
+		for _, meta := range levels[level] {
+			if meta.LargestSeqNum != 0 {
+				continue
+			}
+			seqNum++
+			if err := setSeqNumInMetadata(meta, seqNum, opts.Comparer.Compare, opts.Comparer.FormatKey); err != nil {
+				return err
+			}
+		}
+	}
+
+	return checkTableLevels(opts, levels, func(m *fileMetadata) *sstable.Reader {
+		return readers[m.FileNum-1]
+	}, seqNum+1)
+}
+
+// checkTableLevels performs the checks of DB.CheckLevels on the LSM formed by
+// the sstables in levels, which are read by the readers returned by
+// readerFor, with the keys visible at seqNum. It sorts each level.
+func checkTableLevels(
+	opts *Options,
+	levels [numLevels][]*fileMetadata,
+	readerFor func(*fileMetadata) *sstable.Reader,
+	seqNum uint64,
+) error {
+	manifest.SortBySeqNum(levels[0])
+	for level := range levels {
+		var slice manifest.LevelSlice
+		if level == 0 {
+			slice = manifest.NewLevelSliceSeqSorted(levels[level])
+		} else {
+			manifest.SortBySmallest(levels[level], opts.Comparer.Compare)
+			slice = manifest.NewLevelSliceKeySorted(opts.Comparer.Compare, levels[level])
+		}
+		if err := manifest.CheckOrdering(opts.Comparer.Compare, opts.Comparer.FormatKey,
+			manifest.Level(level), slice.Iter()); err != nil {
+			return err
+		}
+	}
+	vers := manifest.NewVersion(opts.Comparer, opts.FlushSplitBytes, levels)
+
+	newIters := func(
+		_ context.Context, file *manifest.FileMetadata, _ *IterOptions, _ internalIterOpts, kinds iterKinds,
+	) (iters iterSet, err error) {
+		r := readerFor(file)
+		transforms := file.IterTransforms()
+		if kinds.Point() {
+			if iters.point, err = r.NewIter(transforms, nil /* lower */, nil /* upper */); err != nil {
+				return iterSet{}, err
+			}
+		}
+		if kinds.RangeDeletion() {
+			if iters.rangeDeletion, err = r.NewRawRangeDelIter(transforms); err != nil {
+				return iterSet{}, firstError(err, iters.CloseAll())
+			}
+		}
+		if kinds.RangeKey() {
+			if iters.rangeKey, err = r.NewRawRangeKeyIter(transforms); err != nil {
+				return iterSet{}, firstError(err, iters.CloseAll())
+			}
+		}
+		return iters, nil
+	}
+	c := &checkConfig{
+		logger:    opts.Logger,
+		comparer:  opts.Comparer,
+		readState: &readState{current: vers},
+		newIters:  newIters,
+		seqNum:    seqNum,
+		merge:     opts.Merger.Merge,
+		formatKey: opts.Comparer.FormatKey,
+
+		maxKeyBufferReuse: defaultMaxKeyBufferReuse,
+	}
+	return checkLevelsInternal(c)
+}
+
 func checkLevelsInternal(c *checkConfig) (err error) {
+	if c.continueOnFileError {
+		c.newIters = c.skipFileErrors(c.newIters)
+		defer func() {
+			if len(c.fileErrs) > 0 {
+				err = errors.Join(append(c.fileErrs, err)...)
+			}
+		}()
+	}
+
 	// Phase 1: Use a simpleMergingIter to step through all the points and ensure
 	// that points with the same user key at different levels are not inverted
 	// wrt sequence numbers and the same holds for tombstones that cover points.
@@ -607,6 +1230,30 @@ func checkLevelsInternal(c *checkConfig) (err error) {
 			iter:         mem.newIter(nil),
 			rangeDelIter: mem.newRangeDelIter(nil),
 		})
+		if c.skipRangeTombstones && mlevels[len(mlevels)-1].rangeDelIter != nil {
+			return errors.Errorf("pebble: range tombstone found in memtable while skipping range tombstones")
+		}
+	}
+
+	newIters := c.newIters
+	if c.skipRangeTombstones {
+		// Open the range deletion iterator of each sstable only to verify that
+		// it has no range tombstones.
+		newIters = func(
+			ctx context.Context, file *manifest.FileMetadata, opts *IterOptions,
+			internalOpts internalIterOpts, kinds iterKinds,
+		) (iterSet, error) {
+			iters, err := c.newIters(ctx, file, opts, internalOpts, kinds|iterRangeDeletions)
+			if err != nil {
+				return iterSet{}, err
+			}
+			if iters.rangeDeletion != nil {
+				err := errors.Errorf("pebble: range tombstone found in sstable %s while skipping range tombstones",
+					file.FileNum)
+				return iterSet{}, firstError(err, iters.CloseAll())
+			}
+			return iters, nil
+		}
 	}
 
 	current := c.readState.current
@@ -634,10 +1281,13 @@ func checkLevelsInternal(c *checkConfig) (err error) {
 		manifestIter := current.L0SublevelFiles[sublevel].Iter()
 		iterOpts := IterOptions{logger: c.logger}
 		li := &levelIter{}
-		li.init(context.Background(), iterOpts, c.comparer, c.newIters, manifestIter,
+		li.init(context.Background(), iterOpts, c.comparer, newIters, manifestIter,
 			manifest.L0Sublevel(sublevel), internalIterOpts{})
-		li.initRangeDel(&mlevelAlloc[0].rangeDelIter)
+		if !c.skipRangeTombstones {
+			li.initRangeDel(&mlevelAlloc[0].rangeDelIter)
+		}
 		mlevelAlloc[0].iter = li
+		mlevelAlloc[0].l0 = true
 		mlevelAlloc = mlevelAlloc[1:]
 	}
 	for level := 1; level < len(current.Levels); level++ {
@@ -647,15 +1297,21 @@ func checkLevelsInternal(c *checkConfig) (err error) {
 
 		iterOpts := IterOptions{logger: c.logger}
 		li := &levelIter{}
-		li.init(context.Background(), iterOpts, c.comparer, c.newIters,
+		li.init(context.Background(), iterOpts, c.comparer, newIters,
 			current.Levels[level].Iter(), manifest.Level(level), internalIterOpts{})
-		li.initRangeDel(&mlevelAlloc[0].rangeDelIter)
+		if !c.skipRangeTombstones {
+			li.initRangeDel(&mlevelAlloc[0].rangeDelIter)
+		}
 		mlevelAlloc[0].iter = li
 		mlevelAlloc = mlevelAlloc[1:]
 	}
 
-	mergingIter := &simpleMergingIter{}
+	mergingIter := &simpleMergingIter{keysStable: c.keysStable}
 	mergingIter.init(c.merge, c.cmp, c.seqNum, c.formatKey, mlevels...)
+	mergingIter.checkDuplicates = c.checkDuplicates
+	mergingIter.maxKeyBufferReuse = c.maxKeyBufferReuse
+	mergingIter.allowL0Overlap = c.allowL0Overlap
+	mergingIter.panicOnViolation = c.panicOnViolation
 	for cont := mergingIter.step(); cont; cont = mergingIter.step() {
 	}
 	if err := mergingIter.err; err != nil {
@@ -663,10 +1319,118 @@ func checkLevelsInternal(c *checkConfig) (err error) {
 	}
 	if c.stats != nil {
 		c.stats.NumPoints = mergingIter.numPoints
+		c.stats.NumL0Overlaps = mergingIter.numL0Overlaps
 	}
 
 	// Phase 2: Check that the tombstones are mutually consistent.
-	return checkRangeTombstones(c)
+	if !c.skipRangeTombstones {
+		if err := checkRangeTombstones(c); err != nil {
+			return err
+		}
+	}
+	if c.stats != nil {
+		return collectRangeKeyStats(c)
+	}
+	return nil
+}
+
+// skipFileErrors wraps newIters so that the sstables that can't be opened are
+// treated as empty, with no iterators of any kind, recording the error opening
+// each in c.fileErrs.
+func (c *checkConfig) skipFileErrors(newIters tableNewIters) tableNewIters {
+	return func(
+		ctx context.Context, file *manifest.FileMetadata, opts *IterOptions,
+		internalOpts internalIterOpts, kinds iterKinds,
+	) (iterSet, error) {
+		iters, err := newIters(ctx, file, opts, internalOpts, kinds)
+		if err == nil {
+			return iters, nil
+		}
+		// A file is opened by each phase of the check, but its error is only
+		// reported once.
+		if _, ok := c.skippedFiles[file.FileNum]; !ok {
+			if c.skippedFiles == nil {
+				c.skippedFiles = make(map[base.FileNum]struct{})
+			}
+			c.skippedFiles[file.FileNum] = struct{}{}
+			c.fileErrs = append(c.fileErrs, errors.Wrapf(err, "pebble: skipping sstable %s", file.FileNum))
+		}
+		return iterSet{}, nil
+	}
+}
+
+// collectRangeKeyStats populates c.stats.RangeKeyStats with the range keys of
+// the memtables and sstables visible at c.seqNum.
+func collectRangeKeyStats(c *checkConfig) error {
+	stats := &c.stats.RangeKeyStats
+	var spans []tombstoneWithLevel
+	addSpans := func(iter keyspan.FragmentIterator) (err error) {
+		defer func() {
+			err = firstError(err, iter.Close())
+		}()
+		s, err := iter.First()
+		for ; s != nil; s, err = iter.Next() {
+			v := s.Visible(c.seqNum)
+			if v.Empty() {
+				continue
+			}
+			for _, k := range v.Keys {
+				switch k.Kind() {
+				case InternalKeyKindRangeKeySet:
+					stats.NumSets++
+				case InternalKeyKindRangeKeyUnset:
+					stats.NumUnsets++
+				case InternalKeyKindRangeKeyDelete:
+					stats.NumDels++
+				}
+			}
+			spans = append(spans, tombstoneWithLevel{Span: v.DeepClone()})
+		}
+		return err
+	}
+
+	for _, mem := range c.readState.memtables {
+		if iter := mem.newRangeKeyIter(nil); iter != nil {
+			if err := addSpans(iter); err != nil {
+				return err
+			}
+		}
+	}
+	for level := range c.readState.current.Levels {
+		files := c.readState.current.Levels[level].Iter()
+		for f := files.First(); f != nil; f = files.Next() {
+			if !f.HasRangeKeys {
+				continue
+			}
+			iters, err := c.newIters(context.Background(), f, &IterOptions{level: manifest.Level(level)},
+				internalIterOpts{}, iterRangeKeys)
+			if err != nil {
+				return err
+			}
+			if iter := iters.RangeKey(); iter != nil {
+				if err := addSpans(iter); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// Fragmenting the spans at all of their bounds splits overlapping spans
+	// into identical fragments, so each distinct fragment has a distinct start
+	// key.
+	userKeys := collectAllUserKeys(c.cmp, spans)
+	fragments := fragmentUsingUserKeys(c.cmp, spans, userKeys)
+	starts := make([][]byte, len(fragments))
+	for i := range fragments {
+		starts[i] = fragments[i].Start
+	}
+	sort.Sort(&userKeysSort{cmp: c.cmp, buf: starts})
+	for i := range starts {
+		if i == 0 || c.cmp(starts[i-1], starts[i]) != 0 {
+			stats.NumFragments++
+		}
+	}
+	return nil
 }
 
 type simpleMergingIterItem struct {
@@ -23,6 +23,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/private"
 	"github.com/cockroachdb/pebble/internal/rangedel"
 	"github.com/cockroachdb/pebble/internal/testkeys"
+	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
@@ -92,6 +93,8 @@ func TestCheckLevelsCornerCases(t *testing.T) {
 
 	memFS := vfs.NewMem()
 	var levels [][]*fileMetadata
+	// hasL0 is set if levels[0] is L0 rather than L1.
+	var hasL0 bool
 	formatKey := testkeys.Comparer.FormatKey
 	// Indexed by fileNum
 	var readers []*sstable.Reader
@@ -137,9 +140,18 @@ func TestCheckLevelsCornerCases(t *testing.T) {
 		case "define":
 			lines := strings.Split(d.Input, "\n")
 			levels = levels[:0]
+			hasL0 = false
 			for i := 0; i < len(lines); i++ {
 				line := lines[i]
 				line = strings.TrimSpace(line)
+				if line == "L0" {
+					if len(levels) > 0 {
+						return "L0 must be the first level"
+					}
+					hasL0 = true
+					levels = append(levels, nil)
+					continue
+				}
 				if line == "L" {
 					// start next level
 					levels = append(levels, nil)
@@ -153,6 +165,13 @@ func TestCheckLevelsCornerCases(t *testing.T) {
 					FileNum: fileNum,
 				}).ExtendPointKeyBounds(testkeys.Comparer.Compare, smallestKey, largestKey)
 				m.InitPhysicalBacking()
+				if hasL0 && len(levels) == 1 {
+					// Order the L0 files into sublevels by the order in which they
+					// are defined.
+					m.SmallestSeqNum = uint64(fileNum)
+					m.LargestSeqNum = uint64(fileNum)
+					m.LargestSeqNumAbsolute = uint64(fileNum)
+				}
 				*li = append(*li, m)
 
 				i++
@@ -235,7 +254,11 @@ func TestCheckLevelsCornerCases(t *testing.T) {
 			// Version.DebugString().
 			var buf bytes.Buffer
 			for i, l := range levels {
-				fmt.Fprintf(&buf, "Level %d\n", i+1)
+				level := i + 1
+				if hasL0 {
+					level = i
+				}
+				fmt.Fprintf(&buf, "Level %d\n", level)
 				for j, f := range l {
 					fmt.Fprintf(&buf, "  file %d: [%s-%s]\n", j, f.Smallest.String(), f.Largest.String())
 				}
@@ -243,8 +266,15 @@ func TestCheckLevelsCornerCases(t *testing.T) {
 			return buf.String()
 		case "check":
 			merge := DefaultMerger.Merge
+			var checkDuplicates, allowL0Overlap, panicOnViolation bool
 			for _, arg := range d.CmdArgs {
 				switch arg.Key {
+				case "check-duplicates":
+					checkDuplicates = true
+				case "panic-on-violation":
+					panicOnViolation = true
+				case "allow-l0-overlap":
+					allowL0Overlap = true
 				case "merger":
 					if len(arg.Vals) != 1 {
 						return fmt.Sprintf("expected one arg value, got %d", len(arg.Vals))
@@ -260,8 +290,12 @@ func TestCheckLevelsCornerCases(t *testing.T) {
 
 			var files [numLevels][]*fileMetadata
 			for i := range levels {
-				// Start from level 1 in this test.
-				files[i+1] = levels[i]
+				// Start from level 1 in this test, unless L0 is defined.
+				if hasL0 {
+					files[i] = levels[i]
+				} else {
+					files[i+1] = levels[i]
+				}
 			}
 			version := manifest.NewVersion(
 				testkeys.Comparer,
@@ -269,19 +303,410 @@ func TestCheckLevelsCornerCases(t *testing.T) {
 				files)
 			readState := &readState{current: version}
 			c := &checkConfig{
-				comparer:  testkeys.Comparer,
-				readState: readState,
-				newIters:  newIters,
-				seqNum:    InternalKeySeqNumMax,
-				merge:     merge,
-				formatKey: formatKey,
+				comparer:        testkeys.Comparer,
+				readState:       readState,
+				newIters:        newIters,
+				seqNum:          InternalKeySeqNumMax,
+				merge:           merge,
+				formatKey:       formatKey,
+				checkDuplicates: checkDuplicates,
+				allowL0Overlap:  allowL0Overlap,
+				stats:           &CheckLevelsStats{},
+
+				panicOnViolation: panicOnViolation,
+			}
+			if panicOnViolation {
+				var err error
+				func() {
+					defer func() {
+						if r := recover(); r != nil {
+							err = errors.Errorf("panic: %v", r)
+						}
+					}()
+					err = checkLevelsInternal(c)
+				}()
+				if err != nil {
+					return err.Error()
+				}
+				return ""
 			}
 			if err := checkLevelsInternal(c); err != nil {
 				return err.Error()
 			}
+			if allowL0Overlap {
+				return fmt.Sprintf("tolerated %d L0 overlaps\n", c.stats.NumL0Overlaps)
+			}
 			return ""
 		default:
 			return fmt.Sprintf("unknown command: %s", d.Cmd)
 		}
 	})
 }
+
+func TestTombstonesCovering(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.DeleteRange([]byte("a"), []byte("m"), nil))
+	require.NoError(t, d.Compact([]byte("a"), []byte("m"), false /* parallelize */))
+	require.NoError(t, d.DeleteRange([]byte("c"), []byte("f"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.DeleteRange([]byte("d"), []byte("e"), nil))
+
+	tables, err := d.SSTables()
+	require.NoError(t, err)
+	require.Len(t, tables[0], 1)
+	require.Len(t, tables[6], 1)
+
+	infos, err := d.TombstonesCovering([]byte("d"))
+	require.NoError(t, err)
+	require.Equal(t, []TombstoneInfo{
+		{Level: -1, Start: []byte("d"), End: []byte("e"), SeqNum: 12},
+		{Level: 0, FileNum: tables[0][0].FileNum, Start: []byte("c"), End: []byte("f"), SeqNum: 11},
+		{Level: 6, FileNum: tables[6][0].FileNum, Start: []byte("a"), End: []byte("m"), SeqNum: 10},
+	}, infos)
+
+	infos, err = d.TombstonesCovering([]byte("m"))
+	require.NoError(t, err)
+	require.Empty(t, infos)
+}
+
+func TestCheckTombstoneValues(t *testing.T) {
+	tombstone := func(level int, seqNum uint64, value string) tombstoneWithLevel {
+		return tombstoneWithLevel{
+			Span: keyspan.Span{
+				Start: []byte("a"),
+				End:   []byte("c"),
+				Keys: []keyspan.Key{{
+					Trailer: base.MakeTrailer(seqNum, base.InternalKeyKindRangeDelete),
+					Value:   []byte(value),
+				}},
+			},
+			level:    level,
+			lsmLevel: level,
+			fileNum:  base.FileNum(level),
+		}
+	}
+	check := func(valueEqual func(a, b []byte) bool, tombstones ...tombstoneWithLevel) error {
+		_, err := iterateAndCheckTombstones(testkeys.Comparer.Compare, testkeys.Comparer.FormatKey,
+			valueEqual, false /* allowL0Overlap */, false /* panicOnViolation */, tombstones)
+		return err
+	}
+
+	// Without a value comparison, values are ignored.
+	require.NoError(t, check(nil, tombstone(1, 5, "x"), tombstone(2, 5, "y")))
+	// Identical tombstones must have equal values.
+	require.NoError(t, check(bytes.Equal, tombstone(1, 5, "x"), tombstone(2, 5, "x")))
+	require.EqualError(t, check(bytes.Equal, tombstone(1, 5, "x"), tombstone(2, 5, "y")),
+		"tombstone a-c:{(#5,RANGEDEL,,x)} in L1: fileNum=000001 and tombstone a-c:{(#5,RANGEDEL,,y)} "+
+			"in L2: fileNum=000002 have inconsistent values")
+	// Tombstones with different seqnums are not compared.
+	require.NoError(t, check(bytes.Equal, tombstone(1, 6, "x"), tombstone(2, 5, "y")))
+}
+
+func TestSimpleMergingIterCloneKey(t *testing.T) {
+	m := &simpleMergingIter{maxKeyBufferReuse: 1 << 10}
+	// Small buffers are always reused.
+	buf := m.cloneKey(make([]byte, 0, 512), []byte("a"))
+	require.Equal(t, 512, cap(buf))
+	// Large buffers are reused for keys of a comparable size.
+	buf = m.cloneKey(make([]byte, 0, 4<<10), bytes.Repeat([]byte("a"), 1<<10))
+	require.Equal(t, 4<<10, cap(buf))
+	// Large buffers are released for much smaller keys.
+	buf = m.cloneKey(buf, []byte("b"))
+	require.Equal(t, []byte("b"), buf)
+	require.Less(t, cap(buf), 4<<10)
+}
+
+// BenchmarkCheckLevelsOutlierKey benchmarks CheckLevels over many small keys
+// and a single multi-megabyte key, with and without bounding the reuse of the
+// buffers that keys are cloned into.
+func BenchmarkCheckLevelsOutlierKey(b *testing.B) {
+	d, err := Open("", &Options{FS: vfs.NewMem(), DisableAutomaticCompactions: true})
+	require.NoError(b, err)
+	defer func() { require.NoError(b, d.Close()) }()
+
+	const numKeys = 10000
+	for i := 0; i < numKeys; i++ {
+		require.NoError(b, d.Set([]byte(fmt.Sprintf("key%06d", i)), []byte("value"), nil))
+		if i == numKeys/2 {
+			outlier := append([]byte(fmt.Sprintf("key%06d", i)), bytes.Repeat([]byte{'x'}, 4<<20)...)
+			require.NoError(b, d.Set(outlier, []byte("value"), nil))
+		}
+	}
+	require.NoError(b, d.Flush())
+
+	for _, maxReuse := range []int{defaultMaxKeyBufferReuse, 1 << 30} {
+		b.Run(fmt.Sprintf("max-reuse=%d", maxReuse), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var stats CheckLevelsStats
+				if err := d.CheckLevels(&stats, WithMaxKeyBufferReuse(maxReuse)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCheckLevelsKeysStable benchmarks CheckLevels over an offline store
+// whose keys are stable, with and without cloning the keys of the levels.
+func BenchmarkCheckLevelsKeysStable(b *testing.B) {
+	opts := &Options{
+		Cache:                       NewCache(256 << 20),
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+	}
+	defer opts.Cache.Unref()
+	opts.Levels = make([]LevelOptions, numLevels)
+	for i := range opts.Levels {
+		// Without prefix compression, the keys of sstables reference their
+		// blocks, which the cache retains.
+		opts.Levels[i].BlockRestartInterval = 1
+	}
+	d, err := Open("", opts)
+	require.NoError(b, err)
+	defer func() { require.NoError(b, d.Close()) }()
+
+	// Write keys to L6 and overwrite some of them in L0.
+	const numKeys = 200000
+	for i := 0; i < numKeys; i++ {
+		require.NoError(b, d.Set([]byte(fmt.Sprintf("key%08d", i)), []byte("value"), nil))
+	}
+	require.NoError(b, d.Compact([]byte("key"), []byte("kez"), false))
+	for i := 0; i < numKeys; i += 10 {
+		require.NoError(b, d.Set([]byte(fmt.Sprintf("key%08d", i)), []byte("new"), nil))
+	}
+	require.NoError(b, d.Flush())
+
+	for _, keysStable := range []bool{false, true} {
+		b.Run(fmt.Sprintf("keys-stable=%t", keysStable), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var stats CheckLevelsStats
+				var opts []CheckLevelsOption
+				if keysStable {
+					opts = append(opts, WithStableKeys())
+				}
+				err := d.CheckLevels(&stats, opts...)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if stats.NumPoints != numKeys+numKeys/10 {
+					b.Fatalf("checked %d points", stats.NumPoints)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckLevelsRangeKeyStats(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		Comparer:                    testkeys.Comparer,
+		FormatMajorVersion:          FormatNewest,
+		DisableAutomaticCompactions: true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.RangeKeySet([]byte("a"), []byte("d"), []byte("@1"), []byte("v"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.RangeKeyUnset([]byte("b"), []byte("c"), []byte("@1"), nil))
+	require.NoError(t, d.RangeKeySet([]byte("b"), []byte("c"), []byte("@2"), []byte("v"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.RangeKeyDelete([]byte("c"), []byte("f"), nil))
+
+	var stats CheckLevelsStats
+	require.NoError(t, d.CheckLevels(&stats))
+	// The spans [a,d), [b,c) and [c,f) are fragmented into [a,b), [b,c), [c,d)
+	// and [d,f).
+	require.Equal(t, CheckLevelsRangeKeyStats{
+		NumSets:      2,
+		NumUnsets:    1,
+		NumDels:      1,
+		NumFragments: 4,
+	}, stats.RangeKeyStats)
+}
+
+func TestCheckLevelsSkipRangeTombstones(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem(), DisableAutomaticCompactions: true})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("b"), false /* parallelize */))
+	require.NoError(t, d.Set([]byte("a"), []byte("2"), nil))
+	require.NoError(t, d.Merge([]byte("b"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Merge([]byte("b"), []byte("2"), nil))
+	var stats CheckLevelsStats
+	require.NoError(t, d.CheckLevels(&stats, WithSkipRangeTombstones()))
+	require.Equal(t, int64(4), stats.NumPoints)
+
+	// Range tombstones are reported as errors, whether in a memtable or an
+	// sstable.
+	require.NoError(t, d.DeleteRange([]byte("c"), []byte("d"), nil))
+	require.ErrorContains(t, d.CheckLevels(nil, WithSkipRangeTombstones()), "range tombstone found in memtable")
+	require.NoError(t, d.Flush())
+	require.ErrorContains(t, d.CheckLevels(nil, WithSkipRangeTombstones()), "range tombstone found in sstable")
+	require.NoError(t, d.CheckLevels(nil))
+}
+
+func TestCheckLevelsCompressionDictionary(t *testing.T) {
+	// The dictionary is only used at format major versions whose sstables
+	// readers are guaranteed to be able to decompress.
+	for _, fmv := range []FormatMajorVersion{FormatCompressionDictionaries - 1, FormatCompressionDictionaries} {
+		t.Run(fmv.String(), func(t *testing.T) {
+			opts := &Options{
+				FS:                          vfs.NewMem(),
+				FormatMajorVersion:          fmv,
+				DisableAutomaticCompactions: true,
+			}
+			opts.Levels = make([]LevelOptions, numLevels)
+			for i := range opts.Levels {
+				opts.Levels[i].Compression = func() Compression { return ZstdCompression }
+				opts.Levels[i].CompressionDictionary = []byte(strings.Repeat("value-of-key-", 32))
+			}
+			d, err := Open("", opts)
+			require.NoError(t, err)
+			defer func() { require.NoError(t, d.Close()) }()
+
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("key-%04d", i)
+				require.NoError(t, d.Set([]byte(key), []byte("value-of-"+key), nil))
+			}
+			require.NoError(t, d.Flush())
+			require.NoError(t, d.Compact([]byte("key"), []byte("key-9999"), false /* parallelize */))
+
+			// Reading the tables requires the dictionary stored within them.
+			var stats CheckLevelsStats
+			require.NoError(t, d.CheckLevels(&stats))
+			require.Equal(t, int64(1000), stats.NumPoints)
+			v := d.mu.versions.currentVersion()
+			require.Equal(t, 1, v.Levels[numLevels-1].Len())
+			iter := v.Levels[numLevels-1].Iter()
+			meta := iter.First()
+			f, err := d.objProvider.OpenForReading(
+				context.Background(), base.FileTypeTable, meta.FileBacking.DiskFileNum, objstorage.OpenOptions{})
+			require.NoError(t, err)
+			r, err := sstable.NewReader(f, sstable.ReaderOptions{})
+			require.NoError(t, err)
+			defer func() { require.NoError(t, r.Close()) }()
+			l, err := r.Layout()
+			require.NoError(t, err)
+			require.Equal(t, fmv >= FormatCompressionDictionaries, l.CompressionDict.Length != 0)
+			require.NoError(t, r.ValidateBlockChecksums())
+		})
+	}
+}
+
+func TestCheckSSTables(t *testing.T) {
+	fs := vfs.NewMem()
+	opts := &Options{FS: fs}
+	// write writes an sstable with the given point keys, each of the form
+	// "key.seqnum", and range deletions, each of the form "start-end".
+	write := func(path string, points []string, rangeDels ...string) {
+		f, err := fs.Create(path, vfs.WriteCategoryUnspecified)
+		require.NoError(t, err)
+		w := sstable.NewWriter(objstorageprovider.NewFileWritable(f), sstable.WriterOptions{
+			TableFormat: FormatNewest.MaxTableFormat(),
+		})
+		for _, p := range points {
+			key := base.ParseInternalKey(strings.Replace(p, ".", ".SET.", 1))
+			require.NoError(t, w.AddWithForceObsolete(key, []byte(p), false))
+		}
+		for _, rd := range rangeDels {
+			start, end, _ := strings.Cut(rd, "-")
+			require.NoError(t, w.DeleteRange([]byte(start), []byte(end)))
+		}
+		require.NoError(t, w.Close())
+	}
+	write("l6", []string{"a.0", "b.0", "c.0", "d.0"})
+	write("l1", []string{"b.0", "e.0"}, "c-d")
+	write("l1-overlap", []string{"d.0", "f.0"})
+	write("l0-a", []string{"a.0", "e.0"})
+	write("l0-b", []string{"a.0", "c.0"}, "b-f")
+	write("seqnum-old", []string{"a.1", "b.1"})
+	write("seqnum-new", []string{"a.5"})
+
+	require.NoError(t, CheckSSTables([]LevelFile{
+		{Path: "l6", Level: 6},
+		{Path: "l1", Level: 1},
+		{Path: "l0-a", Level: 0},
+		{Path: "l0-b", Level: 0},
+	}, opts))
+
+	// The sstables of L1+ must not overlap, unlike those of L0.
+	err := CheckSSTables([]LevelFile{{Path: "l1", Level: 1}, {Path: "l1-overlap", Level: 1}}, opts)
+	require.ErrorContains(t, err, "overlap")
+	require.NoError(t, CheckSSTables([]LevelFile{{Path: "l1", Level: 0}, {Path: "l1-overlap", Level: 0}}, opts))
+
+	// Sstables with sequence numbers keep them.
+	require.NoError(t, CheckSSTables([]LevelFile{
+		{Path: "seqnum-new", Level: 1},
+		{Path: "seqnum-old", Level: 2},
+	}, opts))
+	err = CheckSSTables([]LevelFile{{Path: "seqnum-old", Level: 1}, {Path: "seqnum-new", Level: 2}}, opts)
+	require.ErrorContains(t, err, "a#1,SET in L1: fileNum=000001 and InternalKey a#5,SET in L2: fileNum=000002")
+
+	require.Error(t, CheckSSTables([]LevelFile{{Path: "l6", Level: numLevels}}, opts))
+	require.Error(t, CheckSSTables([]LevelFile{{Path: "missing", Level: 6}}, opts))
+}
+
+func TestCheckLevelsContinueOnFileError(t *testing.T) {
+	fs := vfs.NewMem()
+	d, err := Open("", &Options{FS: fs, DisableAutomaticCompactions: true})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Write three sstables, deleting the keys of the first with a range
+	// tombstone in the second.
+	require.NoError(t, d.Set([]byte("a"), nil, nil))
+	require.NoError(t, d.Set([]byte("b"), nil, nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.DeleteRange([]byte("a"), []byte("c"), nil))
+	require.NoError(t, d.Set([]byte("c"), nil, nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("d"), nil, nil))
+	require.NoError(t, d.Set([]byte("e"), nil, nil))
+	require.NoError(t, d.Flush())
+
+	// Corrupt the second and third sstables, evicting them from the table cache.
+	// Missing sstables can't be tested, as they're fatal.
+	tables, err := d.SSTables()
+	require.NoError(t, err)
+	var corrupted []FileNum
+	for _, l := range tables {
+		for _, f := range l {
+			if string(f.Largest.UserKey) != "b" {
+				corrupted = append(corrupted, f.FileNum)
+			}
+		}
+	}
+	require.Len(t, corrupted, 2)
+	for _, fileNum := range corrupted {
+		diskFileNum := base.PhysicalTableDiskFileNum(fileNum)
+		f, err := fs.Create(base.MakeFilepath(fs, "", fileTypeTable, diskFileNum), vfs.WriteCategoryUnspecified)
+		require.NoError(t, err)
+		_, err = f.Write([]byte("not an sstable"))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		d.tableCache.evict(diskFileNum)
+	}
+
+	require.Error(t, d.CheckLevels(nil))
+	var stats CheckLevelsStats
+	err = d.CheckLevels(&stats, WithContinueOnFileError())
+	require.Error(t, err)
+	// Each skipped sstable is reported once, though it's opened by both the
+	// point key and range tombstone checks. The keys of the first sstable are
+	// checked, without the range tombstone deleting them.
+	for _, fileNum := range corrupted {
+		require.Equal(t, 1, strings.Count(err.Error(), fmt.Sprintf("skipping sstable %s", fileNum)))
+	}
+	require.Equal(t, int64(2), stats.NumPoints)
+	require.Zero(t, stats.NumTombstones)
+}
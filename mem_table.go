@@ -87,6 +87,9 @@ type memTable struct {
 	// guaranteed to be less than or equal to any seqnum stored in the memtable.
 	logSeqNum                    uint64
 	releaseAccountingReservation func()
+	// oldestEntryTime is the time, in Unix nanoseconds, at which the first
+	// batch was applied to the memtable, or zero if the memtable is empty.
+	oldestEntryTime atomic.Int64
 }
 
 func (m *memTable) free() {
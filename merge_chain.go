@@ -0,0 +1,143 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"slices"
+
+	"github.com/cockroachdb/errors"
+)
+
+// MergeChain describes the merge operands making up the value of a key, as
+// returned by DB.DebugMergeChain.
+type MergeChain struct {
+	// Steps holds the records merged to compute the key's value, newest first.
+	// This is the order in which they're passed to the ValueMerger: the first
+	// step is the operand that the ValueMerger is created with, and each
+	// subsequent step is passed to ValueMerger.MergeOlder.
+	Steps []MergeStep
+	// Value is the key's value, as returned by DB.Get. It's the Result of the
+	// last step.
+	Value []byte
+	// Deleted is true if the ValueMerger is a DeletableValueMerger that
+	// reported the result of the merge as non-existent, in which case DB.Get
+	// returns ErrNotFound.
+	Deleted bool
+}
+
+// MergeStep is a single record of a MergeChain.
+type MergeStep struct {
+	// SeqNum is the record's sequence number.
+	SeqNum uint64
+	// Kind is InternalKeyKindMerge for a merge operand. The oldest step may
+	// instead be the SET record that the chain of operands is merged into.
+	Kind InternalKeyKind
+	// Operand is the value of the record.
+	Operand []byte
+	// Result is the result of merging this record and the newer records of the
+	// chain. It's the value the ValueMerger finishes with, had the chain ended
+	// at this step. Results of steps other than the last are finished with
+	// includesBase=false, as a compaction that only sees part of the chain
+	// would, while the last is finished with includesBase=true, as reads are.
+	Result []byte
+}
+
+// DebugMergeChain returns the merge operands making up the current value of
+// key, along with the intermediate result of merging each of them. It reads
+// the same records as DB.Get, and drives the ValueMerger with them in the
+// same order, but records each step of the merge. The chain ends at the
+// oldest merge operand, at a SET record, or at a deletion, whichever comes
+// first. DebugMergeChain is intended for debugging unexpected merge results.
+//
+// DebugMergeChain returns ErrNotFound if key doesn't exist, and an error if
+// the key's newest record isn't a merge operand.
+func (d *DB) DebugMergeChain(key []byte) (MergeChain, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	// NB: As in DB.getInternal, the readState prevents the files in its
+	// version from being deleted while they're read.
+	readState := d.loadReadState()
+	defer readState.unref()
+	var get getIter
+	d.initGetIter(&get, key, nil /* batch */, 0 /* seqNum */, readState)
+
+	var chain MergeChain
+	var err error
+	var isSet bool
+	for kv := get.First(); kv != nil; kv = get.Next() {
+		kind := kv.Kind()
+		isSet = kind == InternalKeyKindSet || kind == InternalKeyKindSetWithDelete
+		if kind != InternalKeyKindMerge && (len(chain.Steps) == 0 || !isSet) {
+			// A deletion ends the chain, and a SET that's newer than any merge
+			// operand isn't part of one.
+			break
+		}
+		var v []byte
+		if v, _, err = kv.Value(nil); err != nil {
+			break
+		}
+		chain.Steps = append(chain.Steps, MergeStep{
+			SeqNum:  kv.SeqNum(),
+			Kind:    kind,
+			Operand: slices.Clone(v),
+		})
+		if kind != InternalKeyKindMerge {
+			break
+		}
+	}
+	if err = firstError(err, get.Close()); err != nil {
+		return MergeChain{}, err
+	}
+	if len(chain.Steps) == 0 {
+		if !isSet {
+			return MergeChain{}, ErrNotFound
+		}
+		return MergeChain{}, errors.Errorf("pebble: key %s is not a merge chain",
+			d.opts.Comparer.FormatKey(key))
+	}
+
+	// A ValueMerger must be finished once all the operands have been merged,
+	// so the result of each step is computed by replaying the chain up to it.
+	for i := range chain.Steps {
+		last := i == len(chain.Steps)-1
+		result, deleted, err := d.replayMergeChain(key, chain.Steps[:i+1], last /* includesBase */)
+		if err != nil {
+			return MergeChain{}, errors.Wrapf(err, "merging operand %d", errors.Safe(i))
+		}
+		chain.Steps[i].Result = result
+		if last {
+			chain.Value, chain.Deleted = result, deleted
+		}
+	}
+	return chain, nil
+}
+
+// replayMergeChain merges the operands of steps, newest first, and returns a
+// copy of the result.
+func (d *DB) replayMergeChain(
+	key []byte, steps []MergeStep, includesBase bool,
+) (_ []byte, deleted bool, _ error) {
+	valueMerger, err := d.merge(key, steps[0].Operand)
+	if err != nil {
+		return nil, false, err
+	}
+	for i := 1; i < len(steps); i++ {
+		if err := valueMerger.MergeOlder(steps[i].Operand); err != nil {
+			return nil, false, err
+		}
+	}
+	value, deleted, closer, err := finishValueMerger(valueMerger, includesBase)
+	if err != nil {
+		return nil, false, err
+	}
+	value = slices.Clone(value)
+	if closer != nil {
+		if err := closer.Close(); err != nil {
+			return nil, false, err
+		}
+	}
+	return value, deleted, nil
+}
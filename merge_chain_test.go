@@ -0,0 +1,61 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugMergeChain(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// The chain spans the memtable and sstables, and ends at the SET its
+	// operands are merged into. Flushing each record separately, with compactions
+	// disabled, keeps them from being merged before they're read.
+	require.NoError(t, d.Set([]byte("a"), []byte("x"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Merge([]byte("a"), []byte("y"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Merge([]byte("a"), []byte("z"), nil))
+	chain, err := d.DebugMergeChain([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, []MergeStep{
+		{SeqNum: 12, Kind: InternalKeyKindMerge, Operand: []byte("z"), Result: []byte("z")},
+		{SeqNum: 11, Kind: InternalKeyKindMerge, Operand: []byte("y"), Result: []byte("yz")},
+		{SeqNum: 10, Kind: InternalKeyKindSet, Operand: []byte("x"), Result: []byte("xyz")},
+	}, chain.Steps)
+	require.Equal(t, "xyz", string(chain.Value))
+	require.False(t, chain.Deleted)
+	v, closer, err := d.Get([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, chain.Value, v)
+	require.NoError(t, closer.Close())
+
+	// A deletion ends the chain.
+	require.NoError(t, d.Delete([]byte("a"), nil))
+	require.NoError(t, d.Merge([]byte("a"), []byte("w"), nil))
+	chain, err = d.DebugMergeChain([]byte("a"))
+	require.NoError(t, err)
+	require.Len(t, chain.Steps, 1)
+	require.Equal(t, "w", string(chain.Value))
+
+	// Keys without a merge chain.
+	require.NoError(t, d.Set([]byte("b"), []byte("x"), nil))
+	_, err = d.DebugMergeChain([]byte("b"))
+	require.ErrorContains(t, err, "not a merge chain")
+	require.NoError(t, d.Delete([]byte("b"), nil))
+	_, err = d.DebugMergeChain([]byte("b"))
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = d.DebugMergeChain([]byte("c"))
+	require.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,111 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// NewMergedIter returns an iterator over the DB merged with the given sources
+// of point keys, as though the sources were sstables beneath the bottommost
+// level of the LSM. It's like NewIter otherwise.
+//
+// This is an advanced and unsafe API. Each source must return point keys in
+// increasing internal key order per the DB's Comparer, with at most one key
+// per user key, and must honor the bounds set by SetBounds. The sequence
+// numbers of the sources' keys are ignored: the DB's keys take precedence over
+// theirs at equal user keys, and the keys of earlier sources over those of
+// later ones. Point and range deletions in the DB hide the keys of the
+// sources, but the sources' own deletions only hide the keys of later sources.
+// Sources may only return the kinds of point keys that may be written to a
+// Batch. None of this is validated.
+//
+// The sources are closed when the iterator is closed, and must not be used by
+// the caller until then. The iterator cannot be cloned.
+func (d *DB) NewMergedIter(o *IterOptions, sources ...InternalIterator) (*Iterator, error) {
+	merged := make([]*mergedSourceIter, len(sources))
+	for i := range sources {
+		merged[i] = &mergedSourceIter{iter: sources[i]}
+	}
+	return d.newIter(context.Background(), nil /* batch */, newIterOpts{mergedSources: merged}, o), nil
+}
+
+// mergedSourceIter wraps a source of DB.NewMergedIter, zeroing the sequence
+// numbers of its keys so that they rank beneath those of the LSM. The source
+// is closed by Iterator.Close rather than by Close, since the source outlives
+// the merging iterators it's added to when Iterator.SetOptions reconstructs
+// them.
+type mergedSourceIter struct {
+	iter InternalIterator
+	kv   base.InternalKV
+}
+
+var _ internalIterator = (*mergedSourceIter)(nil)
+
+func (i *mergedSourceIter) result(kv *base.InternalKV) *base.InternalKV {
+	if kv == nil {
+		return nil
+	}
+	i.kv = *kv
+	i.kv.K.SetSeqNum(0)
+	return &i.kv
+}
+
+func (i *mergedSourceIter) SeekGE(key []byte, flags base.SeekGEFlags) *base.InternalKV {
+	return i.result(i.iter.SeekGE(key, flags))
+}
+
+func (i *mergedSourceIter) SeekPrefixGE(
+	prefix, key []byte, flags base.SeekGEFlags,
+) *base.InternalKV {
+	return i.result(i.iter.SeekPrefixGE(prefix, key, flags))
+}
+
+func (i *mergedSourceIter) SeekLT(key []byte, flags base.SeekLTFlags) *base.InternalKV {
+	return i.result(i.iter.SeekLT(key, flags))
+}
+
+func (i *mergedSourceIter) First() *base.InternalKV {
+	return i.result(i.iter.First())
+}
+
+func (i *mergedSourceIter) Last() *base.InternalKV {
+	return i.result(i.iter.Last())
+}
+
+func (i *mergedSourceIter) Next() *base.InternalKV {
+	return i.result(i.iter.Next())
+}
+
+func (i *mergedSourceIter) NextPrefix(succKey []byte) *base.InternalKV {
+	return i.result(i.iter.NextPrefix(succKey))
+}
+
+func (i *mergedSourceIter) Prev() *base.InternalKV {
+	return i.result(i.iter.Prev())
+}
+
+func (i *mergedSourceIter) Error() error {
+	return i.iter.Error()
+}
+
+func (i *mergedSourceIter) Close() error {
+	return i.iter.Error()
+}
+
+func (i *mergedSourceIter) SetBounds(lower, upper []byte) {
+	i.iter.SetBounds(lower, upper)
+}
+
+func (i *mergedSourceIter) SetContext(ctx context.Context) {
+	i.iter.SetContext(ctx)
+}
+
+func (i *mergedSourceIter) String() string {
+	return fmt.Sprintf("merged-source(%s)", i.iter)
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMergedIter(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Compact b into L6, zeroing its sequence number.
+	require.NoError(t, d.Set([]byte("b"), []byte("old"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("b"), []byte("db"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+	require.NoError(t, d.Set([]byte("d"), []byte("db"), nil))
+	require.NoError(t, d.Delete([]byte("e"), nil))
+	require.NoError(t, d.DeleteRange([]byte("g"), []byte("i"), nil))
+
+	// newSource returns a source of SET keys from a list of key=value pairs,
+	// with arbitrary sequence numbers.
+	newSource := func(pairs string) InternalIterator {
+		var kvs []InternalKV
+		for i, pair := range strings.Fields(pairs) {
+			k, v, _ := strings.Cut(pair, "=")
+			kvs = append(kvs, InternalKV{
+				K: base.MakeInternalKey([]byte(k), uint64(100+i), InternalKeyKindSet),
+				V: base.MakeInPlaceValue([]byte(v)),
+			})
+		}
+		return base.NewFakeIter(kvs)
+	}
+	newIter := func(o *IterOptions) *Iterator {
+		iter, err := d.NewMergedIter(o,
+			newSource("a=s1 b=s1 d=s1 e=s1 f=s1 h=s1"),
+			newSource("a=s2 c=s2 f=s2 j=s2"))
+		require.NoError(t, err)
+		return iter
+	}
+	forward := func(iter *Iterator) string {
+		var b strings.Builder
+		for valid := iter.First(); valid; valid = iter.Next() {
+			b.WriteString(string(iter.Key()) + "=" + string(iter.Value()) + " ")
+		}
+		return strings.TrimSpace(b.String())
+	}
+	reverse := func(iter *Iterator) string {
+		var res []string
+		for valid := iter.Last(); valid; valid = iter.Prev() {
+			res = append(res, string(iter.Key())+"="+string(iter.Value()))
+		}
+		for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+			res[i], res[j] = res[j], res[i]
+		}
+		return strings.Join(res, " ")
+	}
+
+	// The DB's keys, including deletions, take precedence over the sources',
+	// and earlier sources take precedence over later ones.
+	const want = "a=s1 b=db c=s2 d=db f=s1 j=s2"
+	iter := newIter(nil)
+	require.Equal(t, want, forward(iter))
+	require.Equal(t, want, reverse(iter))
+	require.True(t, iter.SeekGE([]byte("e")))
+	require.Equal(t, "f", string(iter.Key()))
+	require.True(t, iter.SeekLT([]byte("f")))
+	require.Equal(t, "d", string(iter.Key()))
+	_, err = iter.Clone(CloneOptions{})
+	require.Error(t, err)
+	require.NoError(t, iter.Close())
+
+	iter = newIter(&IterOptions{LowerBound: []byte("b"), UpperBound: []byte("f")})
+	require.Equal(t, "b=db c=s2 d=db", forward(iter))
+	require.Equal(t, "b=db c=s2 d=db", reverse(iter))
+	iter.SetOptions(&IterOptions{KeyTypes: IterKeyTypePointsAndRanges})
+	require.Equal(t, want, forward(iter))
+	require.NoError(t, iter.Close())
+}
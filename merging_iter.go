@@ -9,6 +9,7 @@ import (
 	"context"
 	"fmt"
 	"runtime/debug"
+	"time"
 	"unsafe"
 
 	"github.com/cockroachdb/errors"
@@ -247,8 +248,36 @@ type mergingIter struct {
 
 	// Used in some tests to disable the random disabling of seek optimizations.
 	forceEnableSeekOpt bool
+
+	// lowerLevelsSkipped is set when a prefix seek skipped seeking the levels
+	// below a range tombstone that covered the remainder of the prefix (see
+	// seekGE). The skipped levels are left at stale positions, so the next
+	// seek must not use the TrySeekUsingNext optimization.
+	lowerLevelsSkipped bool
+
+	// seekLevelCount is the number of levels that were positioned at a key by
+	// the most recent SeekGE, SeekPrefixGE or SeekLT, i.e. the size of the heap
+	// after the seek. Levels excluded by bloom filters, exhausted, or skipped
+	// due to a covering range tombstone are not counted.
+	seekLevelCount int
+
+	// seekDistances, if non-nil, records the distance of each seek. See
+	// SeekDistanceHistogram.
+	seekDistances *SeekDistanceHistogram
+
+	// deadline is IterOptions.Deadline. deadlineCheckCountdown is the number
+	// of internal keys to step over before the clock is next checked, and
+	// deadlineExceeded records that the deadline has passed, after which every
+	// positioning fails.
+	deadline               time.Time
+	deadlineCheckCountdown int
+	deadlineExceeded       bool
 }
 
+// iterDeadlineCheckKeys is the number of internal keys a mergingIter steps
+// over between checks of IterOptions.Deadline.
+const iterDeadlineCheckKeys = 256
+
 // mergingIter implements the base.InternalIterator interface.
 var _ base.InternalIterator = (*mergingIter)(nil)
 
@@ -290,13 +319,17 @@ func (m *mergingIter) init(
 	if opts != nil {
 		m.lower = opts.LowerBound
 		m.upper = opts.UpperBound
+		m.deadline = opts.Deadline
 	}
+	m.deadlineCheckCountdown = 0
+	m.deadlineExceeded = false
 	m.snapshot = InternalKeySeqNumMax
 	m.batchSnapshot = InternalKeySeqNumMax
 	m.levels = levels
 	m.heap.cmp = cmp
 	m.split = split
 	m.stats = stats
+	m.seekLevelCount = 0
 	if cap(m.heap.items) < len(levels) {
 		m.heap.items = make([]*mergingIterLevel, 0, len(levels))
 	} else {
@@ -679,7 +712,7 @@ func (m *mergingIter) isNextEntryDeleted(item *mergingIterLevel) (bool, error) {
 // If an error occurs, m.err is updated to hold the error and findNextentry
 // returns a nil internal key.
 func (m *mergingIter) findNextEntry() *base.InternalKV {
-	for m.heap.len() > 0 && m.err == nil {
+	for m.err == nil && m.checkDeadline() && m.heap.len() > 0 {
 		item := m.heap.items[0]
 
 		// The levelIter internal iterator will interleave exclusive sentinel
@@ -737,6 +770,28 @@ func (m *mergingIter) findNextEntry() *base.InternalKV {
 	return nil
 }
 
+// checkDeadline is called for each internal key find[Next|Prev]Entry steps
+// over. Once every iterDeadlineCheckKeys keys, it checks whether the deadline
+// has passed. If it has, checkDeadline sets m.err and returns false.
+func (m *mergingIter) checkDeadline() bool {
+	if m.deadline.IsZero() {
+		return true
+	}
+	if !m.deadlineExceeded {
+		if m.deadlineCheckCountdown > 0 {
+			m.deadlineCheckCountdown--
+			return true
+		}
+		m.deadlineCheckCountdown = iterDeadlineCheckKeys
+		if !time.Now().After(m.deadline) {
+			return true
+		}
+		m.deadlineExceeded = true
+	}
+	m.err = ErrIteratorDeadlineExceeded
+	return false
+}
+
 // Steps to the prev entry. item is the current top item in the heap.
 func (m *mergingIter) prevEntry(l *mergingIterLevel) error {
 	oldTopLevel := l.index
@@ -842,7 +897,7 @@ func (m *mergingIter) isPrevEntryDeleted(item *mergingIterLevel) (bool, error) {
 // If an error occurs, m.err is updated to hold the error and findNextentry
 // returns a nil internal key.
 func (m *mergingIter) findPrevEntry() *base.InternalKV {
-	for m.heap.len() > 0 && m.err == nil {
+	for m.err == nil && m.checkDeadline() && m.heap.len() > 0 {
 		item := m.heap.items[0]
 
 		// The levelIter internal iterator will interleave exclusive sentinel
@@ -941,6 +996,10 @@ func (m *mergingIter) seekGE(key []byte, level int, flags base.SeekGEFlags) erro
 		disableSeekOpt(key, uintptr(unsafe.Pointer(m))) {
 		flags = flags.DisableTrySeekUsingNext()
 	}
+	if m.lowerLevelsSkipped {
+		flags = flags.DisableTrySeekUsingNext()
+		m.lowerLevelsSkipped = false
+	}
 
 	for ; level < len(m.levels); level++ {
 		if invariants.Enabled && m.lower != nil && m.heap.cmp(key, m.lower) < 0 {
@@ -991,6 +1050,23 @@ func (m *mergingIter) seekGE(key []byte, level int, flags base.SeekGEFlags) erro
 				// was greater than or equal to m.lower, the new key will
 				// continue to be greater than or equal to m.lower.
 				key = l.tombstone.End
+
+				// During a prefix seek, if the tombstone's end key has a larger
+				// prefix, the tombstone covers every remaining key with the
+				// seek prefix. Since the tombstone is visible and all keys in
+				// lower levels have lower sequence numbers, the tombstone
+				// deletes all of them (see the CoversAt check in
+				// isNextEntryDeleted). There is no need to seek the lower
+				// levels at all, which saves their filter and data block
+				// probes.
+				if m.prefix != nil && m.heap.cmp(m.split.Prefix(key), m.prefix) > 0 {
+					for i := level + 1; i < len(m.levels); i++ {
+						m.levels[i].iterKV = nil
+						m.levels[i].tombstone = nil
+					}
+					m.lowerLevelsSkipped = level+1 < len(m.levels)
+					break
+				}
 			}
 		}
 	}
@@ -1005,16 +1081,54 @@ func (m *mergingIter) String() string {
 // the upper bound. It is up to the caller to ensure that key is greater than
 // or equal to the lower bound.
 func (m *mergingIter) SeekGE(key []byte, flags base.SeekGEFlags) *base.InternalKV {
+	if m.seekDistances != nil {
+		if m.err = m.recordSeekDistance(key, flags); m.err != nil {
+			return nil
+		}
+	}
 	m.prefix = nil
 	m.err = m.seekGE(key, 0 /* start level */, flags)
+	m.seekLevelCount = m.heap.len()
 	if m.err != nil {
 		return nil
 	}
 	return m.findNextEntry()
 }
 
+// recordSeekDistance records the distance of a SeekGE to key in
+// m.seekDistances. The distance is only measured if the seek is known to be
+// monotonic, in which case each level is stepped forward past the keys before
+// key, up to a total of maxSeekDistance keys. This is permitted by the
+// TrySeekUsingNext contract, and the subsequent seek repositions the levels
+// and rebuilds the heap. An error encountered while stepping a level is
+// returned, and must be surfaced by the seek.
+func (m *mergingIter) recordSeekDistance(key []byte, flags base.SeekGEFlags) error {
+	if !flags.TrySeekUsingNext() || m.dir != 1 || m.lowerLevelsSkipped {
+		m.seekDistances.Unmeasured++
+		return nil
+	}
+	var distance int
+	for i := range m.levels {
+		l := &m.levels[i]
+		for distance < maxSeekDistance && l.iterKV != nil && m.heap.cmp(l.iterKV.K.UserKey, key) < 0 {
+			l.iterKV = l.iter.Next()
+			distance++
+			if l.iterKV == nil {
+				if err := l.iter.Error(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	m.seekDistances.record(distance)
+	return nil
+}
+
 // SeekPrefixGE implements base.InternalIterator.SeekPrefixGE.
 func (m *mergingIter) SeekPrefixGE(prefix, key []byte, flags base.SeekGEFlags) *base.InternalKV {
+	if m.seekDistances != nil {
+		m.seekDistances.Unmeasured++
+	}
 	return m.SeekPrefixGEStrict(prefix, key, flags)
 }
 
@@ -1025,6 +1139,7 @@ func (m *mergingIter) SeekPrefixGEStrict(
 ) *base.InternalKV {
 	m.prefix = prefix
 	m.err = m.seekGE(key, 0 /* start level */, flags)
+	m.seekLevelCount = m.heap.len()
 	if m.err != nil {
 		return nil
 	}
@@ -1098,8 +1213,12 @@ func (m *mergingIter) seekLT(key []byte, level int, flags base.SeekLTFlags) erro
 // the lower bound. It is up to the caller to ensure that key is less than the
 // upper bound.
 func (m *mergingIter) SeekLT(key []byte, flags base.SeekLTFlags) *base.InternalKV {
+	if m.seekDistances != nil {
+		m.seekDistances.Unmeasured++
+	}
 	m.prefix = nil
 	m.err = m.seekLT(key, 0 /* start level */, flags)
+	m.seekLevelCount = m.heap.len()
 	if m.err != nil {
 		return nil
 	}
@@ -26,6 +26,16 @@ func (h *mergingIterHeap) less(i, j int) bool {
 		}
 		return c < 0
 	}
+	// Keys with the same user key and sequence number at different levels are
+	// ordered by level, so that the higher level takes precedence. This only
+	// arises for keys with a zero sequence number, such as those of
+	// DB.NewMergedIter's sources, or for ingested duplicates.
+	if ikv.K.SeqNum() == jkv.K.SeqNum() && h.items[i].index != h.items[j].index {
+		if h.reverse {
+			return h.items[i].index > h.items[j].index
+		}
+		return h.items[i].index < h.items[j].index
+	}
 	if h.reverse {
 		return ikv.K.Trailer < jkv.K.Trailer
 	}
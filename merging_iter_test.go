@@ -766,3 +766,75 @@ func BenchmarkMergingIterSeqSeekPrefixGE(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkMergingIterSeekPrefixGERangeDeleted benchmarks prefix seeks into a
+// key range that has been deleted by a range tombstone in the top level. Prefix
+// seeks should not need to probe the lower levels' filters or data blocks.
+func BenchmarkMergingIterSeekPrefixGERangeDeleted(b *testing.B) {
+	const blockSize = 32 << 10
+	const restartInterval = 16
+	const levelCount = 5
+	readers, levelSlices, keys := buildLevelsForMergingIterSeqSeek(
+		b, blockSize, restartInterval, levelCount, 0 /* keyOffset */, false, true, false)
+	defer func() {
+		for i := range readers {
+			for j := range readers[i] {
+				readers[i][j].Close()
+			}
+		}
+	}()
+
+	for _, rangeDeleted := range []bool{false, true} {
+		b.Run(fmt.Sprintf("range-deleted=%t", rangeDeleted), func(b *testing.B) {
+			// The top level contains no point keys and, optionally, a range
+			// tombstone covering all the keys in the lower levels.
+			mils := make([]mergingIterLevel, len(levelSlices)+1)
+			mils[0].iter = base.NewFakeIter(nil)
+			if rangeDeleted {
+				mils[0].rangeDelIter = keyspan.NewIter(testkeys.Comparer.Compare, []keyspan.Span{{
+					Start: keys[0],
+					End:   append(append([]byte(nil), keys[len(keys)-1]...), 0),
+					Keys: []keyspan.Key{{
+						Trailer: base.MakeTrailer(uint64(levelCount+1), InternalKeyKindRangeDelete),
+					}},
+				}})
+			}
+			for i := len(readers) - 1; i >= 0; i-- {
+				levelIndex := i
+				level := len(readers) - i
+				newIters := func(
+					_ context.Context, file *manifest.FileMetadata, opts *IterOptions, _ internalIterOpts, _ iterKinds,
+				) (iterSet, error) {
+					iter, err := readers[levelIndex][file.FileNum].NewIter(
+						sstable.NoTransforms, opts.LowerBound, opts.UpperBound)
+					if err != nil {
+						return iterSet{}, err
+					}
+					rdIter, err := readers[levelIndex][file.FileNum].NewRawRangeDelIter(sstable.NoTransforms)
+					if err != nil {
+						iter.Close()
+						return iterSet{}, err
+					}
+					return iterSet{point: iter, rangeDeletion: rdIter}, err
+				}
+				l := newLevelIter(
+					context.Background(), IterOptions{}, testkeys.Comparer, newIters, levelSlices[i].Iter(),
+					manifest.Level(level), internalIterOpts{})
+				l.initRangeDel(&mils[level].rangeDelIter)
+				mils[level].iter = l
+			}
+			var stats base.InternalIteratorStats
+			m := &mergingIter{}
+			m.init(nil /* logger */, &stats, testkeys.Comparer.Compare,
+				func(a []byte) int { return len(a) }, mils...)
+			defer m.Close()
+
+			rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				k := keys[rng.Intn(len(keys))]
+				m.SeekPrefixGE(k, k, base.SeekGEFlagsNone)
+			}
+		})
+	}
+}
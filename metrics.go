@@ -7,6 +7,8 @@ package pebble
 import (
 	"fmt"
 	"math"
+	"math/bits"
+	"sync/atomic"
 	"time"
 
 	"github.com/cockroachdb/pebble/internal/base"
@@ -179,6 +181,19 @@ type Metrics struct {
 		// Duration records the cumulative duration of all compactions since the
 		// database was opened.
 		Duration time.Duration
+		// Paused is true if compactions are currently paused by
+		// DB.PauseCompactions.
+		Paused bool
+		// Concurrency is the maximum number of concurrent compactions chosen
+		// the last time compactions were scheduled. See
+		// Options.CompactionConcurrencyPolicy.
+		Concurrency int
+		// InputFiles is the total number of input files of the compactions
+		// counted by Count, and MaxInputFiles the largest number of input files
+		// of one of them. InputFiles/Count is the average number of input files
+		// per compaction. See Options.MaxCompactionInputFiles.
+		InputFiles    uint64
+		MaxInputFiles int
 	}
 
 	Ingest struct {
@@ -186,6 +201,15 @@ type Metrics struct {
 		Count uint64
 	}
 
+	// L0WriteStall describes the stall of batch commits and ingestions
+	// imposed by Options.L0ResumeWritesThreshold.
+	L0WriteStall struct {
+		// The cumulative number of commits and ingestions that were stalled.
+		Count uint64
+		// The cumulative time they spent stalled.
+		Duration time.Duration
+	}
+
 	Flush struct {
 		// The total number of flushes.
 		Count           int64
@@ -222,6 +246,10 @@ type Metrics struct {
 		ZombieSize uint64
 		// The count of zombie memtables.
 		ZombieCount int64
+		// OldestEntryAge is the time since the oldest entry that is yet to be
+		// flushed was written to a memtable, or zero if the memtables are empty.
+		// See Options.MemTableMaxAge.
+		OldestEntryAge time.Duration
 	}
 
 	Keys struct {
@@ -233,6 +261,22 @@ type Metrics struct {
 		// A cumulative total number of missized DELSIZED keys encountered by
 		// compactions since the database was opened.
 		MissizedTombstonesCount uint64
+		// The cumulative count of keys of each kind committed in batches since
+		// the database was opened, indexed by InternalKeyKind. Keys added by
+		// ingestions are not included.
+		WrittenKindsCount [InternalKeyKindMax + 1]uint64
+		// MaxKeySize and MaxValueSize are the sizes of the largest key and
+		// value ever committed in a batch. They're high-water marks persisted
+		// in the MANIFEST, so they never decrease, including across restarts,
+		// and are only reset by creating a new store. They're only persisted
+		// at FormatMaxKeyValueSizes and above; at lower format major versions,
+		// they only cover the keys committed since the DB was opened and those
+		// replayed from the WAL. The size of a range
+		// deletion or range key is that of the larger of its start and end
+		// keys, and only the values of SET, SETWITHDEL and MERGE keys are
+		// counted. Ingested keys are not included.
+		MaxKeySize   uint64
+		MaxValueSize uint64
 	}
 
 	Snapshots struct {
@@ -250,6 +294,23 @@ type Metrics struct {
 		PinnedSize uint64
 	}
 
+	// SnapshotPinnedBytes is an estimate of the number of bytes of data in
+	// sstables that could be dropped by compactions if the earliest open
+	// snapshot were released. It is computed from the seqnum ranges and
+	// deletion estimates of the tables in the current version: data deleted by
+	// tombstones newer than the earliest snapshot remains visible to the
+	// snapshot and so can't be elided. Data shadowed by newer SETs is not
+	// accounted for, and tables whose stats haven't been loaded are ignored.
+	// It's zero if there are no open snapshots.
+	SnapshotPinnedBytes uint64
+
+	// ColdDataBytes is the total size of the sstables that were cold as
+	// defined by Options.ColdDataThreshold, whether or not they had been
+	// demoted to shared storage yet, as of the last check for cold sstables,
+	// which happens once per Options.ColdDataPeriod. It's zero if
+	// Options.ColdDataThreshold isn't set.
+	ColdDataBytes uint64
+
 	Table struct {
 		// The number of bytes present in obsolete tables which are no longer
 		// referenced by the current DB state or any open iterators.
@@ -293,6 +354,25 @@ type Metrics struct {
 	TableIters int64
 	// Uptime is the total time since this DB was opened.
 	Uptime time.Duration
+	// DiskAvailBytes is the most recent estimate of the number of bytes
+	// available on the disk holding the data directory. It is math.MaxUint64
+	// if the FS does not support GetDiskUsage.
+	DiskAvailBytes uint64
+	// SeekDistanceHistogram buckets the seeks of the iterators closed since
+	// the DB was opened by the distance they moved. Open iterators are not
+	// included. Seeks are only recorded if Options.RecordSeekDistances is set.
+	SeekDistanceHistogram SeekDistanceHistogram
+
+	ObjStore struct {
+		// ReadRetries is the number of times a failed read of an sstable on
+		// remote storage was retried, per Options.ObjStoreRetryPolicy.
+		ReadRetries uint64
+		// FailedRetryableReads is the number of reads of sstables on remote
+		// storage that failed with retryable errors after exhausting their
+		// attempts, or whose context was done before they were retried. It's
+		// only counted if retries are enabled.
+		FailedRetryableReads uint64
+	}
 
 	WAL struct {
 		// Number of live WAL files.
@@ -333,6 +413,75 @@ type Metrics struct {
 	}
 }
 
+// NumSeekDistanceBuckets is the number of buckets of a SeekDistanceHistogram.
+const NumSeekDistanceBuckets = 6
+
+// SeekDistanceHistogram is a histogram of the distances of iterator seeks. The
+// distance of a forward seek that follows a forward positioning operation is
+// the number of internal keys, across all the levels of the LSM, from the
+// iterator's previous position up to the seek key, i.e. roughly the number of
+// steps that would have reached the seek key without seeking. A seek with a
+// small distance could be cheaply replaced by stepping the iterator, whereas a
+// seek with a large distance benefits from seeking.
+//
+// Only seeks that are known to be monotonic, i.e. SeekGE calls that are able to
+// use the TrySeekUsingNext optimization, are measured. Other seeks, including
+// SeekLT, SeekPrefixGE, and the first seek of an iterator, are counted as
+// Unmeasured.
+type SeekDistanceHistogram struct {
+	// Buckets[0] counts the seeks with distance 0, and Buckets[i] for i > 0
+	// those with distances in [2^(i-1), 2^i). The last bucket counts all the
+	// seeks with distances of at least 2^(NumSeekDistanceBuckets-2).
+	Buckets [NumSeekDistanceBuckets]uint64
+	// Unmeasured is the number of seeks whose distance was not measured.
+	Unmeasured uint64
+}
+
+// maxSeekDistance is the distance beyond which seeks aren't measured
+// precisely, since they all fall in the last bucket.
+const maxSeekDistance = 1 << (NumSeekDistanceBuckets - 2)
+
+// record records a seek of the given distance.
+func (h *SeekDistanceHistogram) record(distance int) {
+	h.Buckets[min(bits.Len(uint(distance)), NumSeekDistanceBuckets-1)]++
+}
+
+// Count returns the total number of seeks in the histogram.
+func (h *SeekDistanceHistogram) Count() uint64 {
+	n := h.Unmeasured
+	for _, c := range h.Buckets {
+		n += c
+	}
+	return n
+}
+
+// seekDistanceCounts aggregates the SeekDistanceHistograms of the iterators
+// of a DB.
+type seekDistanceCounts struct {
+	buckets    [NumSeekDistanceBuckets]atomic.Uint64
+	unmeasured atomic.Uint64
+}
+
+func (c *seekDistanceCounts) add(h *SeekDistanceHistogram) {
+	for i, n := range h.Buckets {
+		if n > 0 {
+			c.buckets[i].Add(n)
+		}
+	}
+	if h.Unmeasured > 0 {
+		c.unmeasured.Add(h.Unmeasured)
+	}
+}
+
+func (c *seekDistanceCounts) load() SeekDistanceHistogram {
+	var h SeekDistanceHistogram
+	for i := range c.buckets {
+		h.Buckets[i] = c.buckets[i].Load()
+	}
+	h.Unmeasured = c.unmeasured.Load()
+	return h
+}
+
 var (
 	// FsyncLatencyBuckets are prometheus histogram buckets suitable for a histogram
 	// that records latencies for fsyncs.
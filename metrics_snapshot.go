@@ -0,0 +1,346 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import "math"
+
+// MetricsSnapshot is a flat, JSON-serializable view of the numeric gauges and
+// counters in Metrics. Unlike Metrics, it contains no latency histograms,
+// unexported fields or nested anonymous structs, which makes it suitable for
+// shipping to a monitoring backend. Fixed-size arrays of counters, such as the
+// buckets of SeekDistanceHistogram, are reported as JSON arrays.
+//
+// The JSON field names form a stable schema: fields may be added, but
+// existing fields are not renamed or removed. Durations are reported in
+// nanoseconds.
+type MetricsSnapshot struct {
+	BlockCache CacheMetricsSnapshot `json:"block_cache"`
+	TableCache CacheMetricsSnapshot `json:"table_cache"`
+
+	CompactCount             int64  `json:"compact_count"`
+	CompactDefaultCount      int64  `json:"compact_default_count"`
+	CompactDeleteOnlyCount   int64  `json:"compact_delete_only_count"`
+	CompactElisionOnlyCount  int64  `json:"compact_elision_only_count"`
+	CompactCopyCount         int64  `json:"compact_copy_count"`
+	CompactMoveCount         int64  `json:"compact_move_count"`
+	CompactReadCount         int64  `json:"compact_read_count"`
+	CompactRewriteCount      int64  `json:"compact_rewrite_count"`
+	CompactMultiLevelCount   int64  `json:"compact_multi_level_count"`
+	CompactCounterLevelCount int64  `json:"compact_counter_level_count"`
+	CompactEstimatedDebt     uint64 `json:"compact_estimated_debt"`
+	CompactInProgressBytes   int64  `json:"compact_in_progress_bytes"`
+	CompactNumInProgress     int64  `json:"compact_num_in_progress"`
+	CompactMarkedFiles       int    `json:"compact_marked_files"`
+	CompactDurationNanos     int64  `json:"compact_duration_ns"`
+	CompactPaused            bool   `json:"compact_paused"`
+	CompactConcurrency       int    `json:"compact_concurrency"`
+	CompactInputFiles        uint64 `json:"compact_input_files"`
+	CompactMaxInputFiles     int    `json:"compact_max_input_files"`
+
+	IngestCount uint64 `json:"ingest_count"`
+
+	L0WriteStallCount         uint64 `json:"l0_write_stall_count"`
+	L0WriteStallDurationNanos int64  `json:"l0_write_stall_duration_ns"`
+
+	FlushCount              int64  `json:"flush_count"`
+	FlushBytes              int64  `json:"flush_bytes"`
+	FlushWorkDurationNanos  int64  `json:"flush_work_duration_ns"`
+	FlushIdleDurationNanos  int64  `json:"flush_idle_duration_ns"`
+	FlushNumInProgress      int64  `json:"flush_num_in_progress"`
+	FlushAsIngestCount      uint64 `json:"flush_as_ingest_count"`
+	FlushAsIngestTableCount uint64 `json:"flush_as_ingest_table_count"`
+	FlushAsIngestBytes      uint64 `json:"flush_as_ingest_bytes"`
+
+	FilterHits   int64 `json:"filter_hits"`
+	FilterMisses int64 `json:"filter_misses"`
+
+	// Levels is indexed by level and always has numLevels entries.
+	Levels []LevelMetricsSnapshot `json:"levels"`
+	// ReadAmp is the value of Metrics.ReadAmp.
+	ReadAmp int `json:"read_amp"`
+	// DiskSpaceUsage is the value of Metrics.DiskSpaceUsage.
+	DiskSpaceUsage uint64 `json:"disk_space_usage"`
+
+	MemTableSize                uint64 `json:"memtable_size"`
+	MemTableCount               int64  `json:"memtable_count"`
+	MemTableZombieSize          uint64 `json:"memtable_zombie_size"`
+	MemTableZombieCount         int64  `json:"memtable_zombie_count"`
+	MemTableOldestEntryAgeNanos int64  `json:"memtable_oldest_entry_age_ns"`
+
+	KeysRangeKeySetsCount       uint64 `json:"keys_range_key_sets_count"`
+	KeysTombstoneCount          uint64 `json:"keys_tombstone_count"`
+	KeysMissizedTombstonesCount uint64 `json:"keys_missized_tombstones_count"`
+	KeysMaxKeySize              uint64 `json:"keys_max_key_size"`
+	KeysMaxValueSize            uint64 `json:"keys_max_value_size"`
+	// KeysWrittenKindsCount is the value of Metrics.Keys.WrittenKindsCount,
+	// indexed by InternalKeyKind.
+	KeysWrittenKindsCount [InternalKeyKindMax + 1]uint64 `json:"keys_written_kinds_count"`
+
+	SnapshotsCount          int    `json:"snapshots_count"`
+	SnapshotsEarliestSeqNum uint64 `json:"snapshots_earliest_seq_num"`
+	SnapshotsPinnedKeys     uint64 `json:"snapshots_pinned_keys"`
+	SnapshotsPinnedSize     uint64 `json:"snapshots_pinned_size"`
+	SnapshotPinnedBytes     uint64 `json:"snapshot_pinned_bytes"`
+
+	ColdDataBytes uint64 `json:"cold_data_bytes"`
+
+	TableObsoleteSize           uint64 `json:"table_obsolete_size"`
+	TableObsoleteCount          int64  `json:"table_obsolete_count"`
+	TableZombieSize             uint64 `json:"table_zombie_size"`
+	TableZombieCount            int64  `json:"table_zombie_count"`
+	TableBackingTableCount      uint64 `json:"table_backing_table_count"`
+	TableBackingTableSize       uint64 `json:"table_backing_table_size"`
+	TableCompressedCountUnknown int64  `json:"table_compressed_count_unknown"`
+	TableCompressedCountSnappy  int64  `json:"table_compressed_count_snappy"`
+	TableCompressedCountZstd    int64  `json:"table_compressed_count_zstd"`
+	TableCompressedCountNone    int64  `json:"table_compressed_count_none"`
+	TableLocalLiveSize          uint64 `json:"table_local_live_size"`
+	TableLocalObsoleteSize      uint64 `json:"table_local_obsolete_size"`
+	TableLocalZombieSize        uint64 `json:"table_local_zombie_size"`
+
+	TableIters  int64 `json:"table_iters"`
+	UptimeNanos int64 `json:"uptime_ns"`
+	// DiskAvailBytes is the value of Metrics.DiskAvailBytes.
+	DiskAvailBytes uint64 `json:"disk_avail_bytes"`
+	// SeekDistanceBuckets and SeekDistanceUnmeasured are the values of
+	// Metrics.SeekDistanceHistogram.
+	SeekDistanceBuckets    [NumSeekDistanceBuckets]uint64 `json:"seek_distance_buckets"`
+	SeekDistanceUnmeasured uint64                         `json:"seek_distance_unmeasured"`
+
+	ObjStoreReadRetries          uint64 `json:"obj_store_read_retries"`
+	ObjStoreFailedRetryableReads uint64 `json:"obj_store_failed_retryable_reads"`
+
+	WALFiles                       int64  `json:"wal_files"`
+	WALObsoleteFiles               int64  `json:"wal_obsolete_files"`
+	WALObsoletePhysicalSize        uint64 `json:"wal_obsolete_physical_size"`
+	WALSize                        uint64 `json:"wal_size"`
+	WALPhysicalSize                uint64 `json:"wal_physical_size"`
+	WALBytesIn                     uint64 `json:"wal_bytes_in"`
+	WALBytesWritten                uint64 `json:"wal_bytes_written"`
+	WALFailoverDirSwitchCount      int64  `json:"wal_failover_dir_switch_count"`
+	WALFailoverPrimaryWriteNanos   int64  `json:"wal_failover_primary_write_duration_ns"`
+	WALFailoverSecondaryWriteNanos int64  `json:"wal_failover_secondary_write_duration_ns"`
+
+	LogWriterBytes             int64 `json:"log_writer_bytes"`
+	LogWriterWorkDurationNanos int64 `json:"log_writer_work_duration_ns"`
+	LogWriterIdleDurationNanos int64 `json:"log_writer_idle_duration_ns"`
+	LogWriterSyncRequests      int64 `json:"log_writer_sync_requests"`
+	LogWriterFsyncs            int64 `json:"log_writer_fsyncs"`
+
+	SecondaryCacheCount               int64 `json:"secondary_cache_count"`
+	SecondaryCacheSize                int64 `json:"secondary_cache_size"`
+	SecondaryCacheTotalReads          int64 `json:"secondary_cache_total_reads"`
+	SecondaryCacheMultiShardReads     int64 `json:"secondary_cache_multi_shard_reads"`
+	SecondaryCacheMultiBlockReads     int64 `json:"secondary_cache_multi_block_reads"`
+	SecondaryCacheReadsWithFullHit    int64 `json:"secondary_cache_reads_with_full_hit"`
+	SecondaryCacheReadsWithPartialHit int64 `json:"secondary_cache_reads_with_partial_hit"`
+	SecondaryCacheReadsWithNoHit      int64 `json:"secondary_cache_reads_with_no_hit"`
+	SecondaryCacheEvictions           int64 `json:"secondary_cache_evictions"`
+	SecondaryCacheWriteBackFailures   int64 `json:"secondary_cache_write_back_failures"`
+}
+
+// CacheMetricsSnapshot is the MetricsSnapshot representation of CacheMetrics.
+type CacheMetricsSnapshot struct {
+	Size   int64 `json:"size"`
+	Count  int64 `json:"count"`
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// LevelMetricsSnapshot is the MetricsSnapshot representation of LevelMetrics.
+type LevelMetricsSnapshot struct {
+	Sublevels               int32   `json:"sublevels"`
+	NumFiles                int64   `json:"num_files"`
+	NumVirtualFiles         uint64  `json:"num_virtual_files"`
+	Size                    int64   `json:"size"`
+	VirtualSize             uint64  `json:"virtual_size"`
+	Score                   float64 `json:"score"`
+	BytesIn                 uint64  `json:"bytes_in"`
+	BytesIngested           uint64  `json:"bytes_ingested"`
+	BytesMoved              uint64  `json:"bytes_moved"`
+	BytesRead               uint64  `json:"bytes_read"`
+	BytesCompacted          uint64  `json:"bytes_compacted"`
+	BytesFlushed            uint64  `json:"bytes_flushed"`
+	TablesCompacted         uint64  `json:"tables_compacted"`
+	TablesFlushed           uint64  `json:"tables_flushed"`
+	TablesIngested          uint64  `json:"tables_ingested"`
+	TablesMoved             uint64  `json:"tables_moved"`
+	MultiLevelBytesInTop    uint64  `json:"multi_level_bytes_in_top"`
+	MultiLevelBytesIn       uint64  `json:"multi_level_bytes_in"`
+	MultiLevelBytesRead     uint64  `json:"multi_level_bytes_read"`
+	ValueBlocksSize         uint64  `json:"value_blocks_size"`
+	BytesWrittenDataBlocks  uint64  `json:"bytes_written_data_blocks"`
+	BytesWrittenValueBlocks uint64  `json:"bytes_written_value_blocks"`
+}
+
+func makeCacheMetricsSnapshot(m *CacheMetrics) CacheMetricsSnapshot {
+	return CacheMetricsSnapshot{
+		Size:   m.Size,
+		Count:  m.Count,
+		Hits:   m.Hits,
+		Misses: m.Misses,
+	}
+}
+
+func makeLevelMetricsSnapshot(m *LevelMetrics) LevelMetricsSnapshot {
+	return LevelMetricsSnapshot{
+		Sublevels:               m.Sublevels,
+		NumFiles:                m.NumFiles,
+		NumVirtualFiles:         m.NumVirtualFiles,
+		Size:                    m.Size,
+		VirtualSize:             m.VirtualSize,
+		Score:                   finiteOrZero(m.Score),
+		BytesIn:                 m.BytesIn,
+		BytesIngested:           m.BytesIngested,
+		BytesMoved:              m.BytesMoved,
+		BytesRead:               m.BytesRead,
+		BytesCompacted:          m.BytesCompacted,
+		BytesFlushed:            m.BytesFlushed,
+		TablesCompacted:         m.TablesCompacted,
+		TablesFlushed:           m.TablesFlushed,
+		TablesIngested:          m.TablesIngested,
+		TablesMoved:             m.TablesMoved,
+		MultiLevelBytesInTop:    m.MultiLevel.BytesInTop,
+		MultiLevelBytesIn:       m.MultiLevel.BytesIn,
+		MultiLevelBytesRead:     m.MultiLevel.BytesRead,
+		ValueBlocksSize:         m.Additional.ValueBlocksSize,
+		BytesWrittenDataBlocks:  m.Additional.BytesWrittenDataBlocks,
+		BytesWrittenValueBlocks: m.Additional.BytesWrittenValueBlocks,
+	}
+}
+
+// finiteOrZero returns f, or zero if f is NaN or infinite. encoding/json
+// refuses to marshal non-finite floats.
+func finiteOrZero(f float64) float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+	return f
+}
+
+// Snapshot returns the MetricsSnapshot representation of m.
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	s := MetricsSnapshot{
+		BlockCache: makeCacheMetricsSnapshot(&m.BlockCache),
+		TableCache: makeCacheMetricsSnapshot(&m.TableCache),
+
+		CompactCount:             m.Compact.Count,
+		CompactDefaultCount:      m.Compact.DefaultCount,
+		CompactDeleteOnlyCount:   m.Compact.DeleteOnlyCount,
+		CompactElisionOnlyCount:  m.Compact.ElisionOnlyCount,
+		CompactCopyCount:         m.Compact.CopyCount,
+		CompactMoveCount:         m.Compact.MoveCount,
+		CompactReadCount:         m.Compact.ReadCount,
+		CompactRewriteCount:      m.Compact.RewriteCount,
+		CompactMultiLevelCount:   m.Compact.MultiLevelCount,
+		CompactCounterLevelCount: m.Compact.CounterLevelCount,
+		CompactEstimatedDebt:     m.Compact.EstimatedDebt,
+		CompactInProgressBytes:   m.Compact.InProgressBytes,
+		CompactNumInProgress:     m.Compact.NumInProgress,
+		CompactMarkedFiles:       m.Compact.MarkedFiles,
+		CompactDurationNanos:     m.Compact.Duration.Nanoseconds(),
+		CompactPaused:            m.Compact.Paused,
+		CompactConcurrency:       m.Compact.Concurrency,
+		CompactInputFiles:        m.Compact.InputFiles,
+		CompactMaxInputFiles:     m.Compact.MaxInputFiles,
+
+		IngestCount: m.Ingest.Count,
+
+		L0WriteStallCount:         m.L0WriteStall.Count,
+		L0WriteStallDurationNanos: m.L0WriteStall.Duration.Nanoseconds(),
+
+		FlushCount:              m.Flush.Count,
+		FlushBytes:              m.Flush.WriteThroughput.Bytes,
+		FlushWorkDurationNanos:  m.Flush.WriteThroughput.WorkDuration.Nanoseconds(),
+		FlushIdleDurationNanos:  m.Flush.WriteThroughput.IdleDuration.Nanoseconds(),
+		FlushNumInProgress:      m.Flush.NumInProgress,
+		FlushAsIngestCount:      m.Flush.AsIngestCount,
+		FlushAsIngestTableCount: m.Flush.AsIngestTableCount,
+		FlushAsIngestBytes:      m.Flush.AsIngestBytes,
+
+		FilterHits:   m.Filter.Hits,
+		FilterMisses: m.Filter.Misses,
+
+		Levels:         make([]LevelMetricsSnapshot, len(m.Levels)),
+		ReadAmp:        m.ReadAmp(),
+		DiskSpaceUsage: m.DiskSpaceUsage(),
+
+		MemTableSize:                m.MemTable.Size,
+		MemTableCount:               m.MemTable.Count,
+		MemTableZombieSize:          m.MemTable.ZombieSize,
+		MemTableZombieCount:         m.MemTable.ZombieCount,
+		MemTableOldestEntryAgeNanos: m.MemTable.OldestEntryAge.Nanoseconds(),
+
+		KeysRangeKeySetsCount:       m.Keys.RangeKeySetsCount,
+		KeysTombstoneCount:          m.Keys.TombstoneCount,
+		KeysMissizedTombstonesCount: m.Keys.MissizedTombstonesCount,
+		KeysMaxKeySize:              m.Keys.MaxKeySize,
+		KeysMaxValueSize:            m.Keys.MaxValueSize,
+		KeysWrittenKindsCount:       m.Keys.WrittenKindsCount,
+
+		SnapshotsCount:          m.Snapshots.Count,
+		SnapshotsEarliestSeqNum: m.Snapshots.EarliestSeqNum,
+		SnapshotsPinnedKeys:     m.Snapshots.PinnedKeys,
+		SnapshotsPinnedSize:     m.Snapshots.PinnedSize,
+		SnapshotPinnedBytes:     m.SnapshotPinnedBytes,
+
+		ColdDataBytes: m.ColdDataBytes,
+
+		TableObsoleteSize:           m.Table.ObsoleteSize,
+		TableObsoleteCount:          m.Table.ObsoleteCount,
+		TableZombieSize:             m.Table.ZombieSize,
+		TableZombieCount:            m.Table.ZombieCount,
+		TableBackingTableCount:      m.Table.BackingTableCount,
+		TableBackingTableSize:       m.Table.BackingTableSize,
+		TableCompressedCountUnknown: m.Table.CompressedCountUnknown,
+		TableCompressedCountSnappy:  m.Table.CompressedCountSnappy,
+		TableCompressedCountZstd:    m.Table.CompressedCountZstd,
+		TableCompressedCountNone:    m.Table.CompressedCountNone,
+		TableLocalLiveSize:          m.Table.Local.LiveSize,
+		TableLocalObsoleteSize:      m.Table.Local.ObsoleteSize,
+		TableLocalZombieSize:        m.Table.Local.ZombieSize,
+
+		TableIters:             m.TableIters,
+		UptimeNanos:            m.Uptime.Nanoseconds(),
+		DiskAvailBytes:         m.DiskAvailBytes,
+		SeekDistanceBuckets:    m.SeekDistanceHistogram.Buckets,
+		SeekDistanceUnmeasured: m.SeekDistanceHistogram.Unmeasured,
+
+		ObjStoreReadRetries:          m.ObjStore.ReadRetries,
+		ObjStoreFailedRetryableReads: m.ObjStore.FailedRetryableReads,
+
+		WALFiles:                       m.WAL.Files,
+		WALObsoleteFiles:               m.WAL.ObsoleteFiles,
+		WALObsoletePhysicalSize:        m.WAL.ObsoletePhysicalSize,
+		WALSize:                        m.WAL.Size,
+		WALPhysicalSize:                m.WAL.PhysicalSize,
+		WALBytesIn:                     m.WAL.BytesIn,
+		WALBytesWritten:                m.WAL.BytesWritten,
+		WALFailoverDirSwitchCount:      m.WAL.Failover.DirSwitchCount,
+		WALFailoverPrimaryWriteNanos:   m.WAL.Failover.PrimaryWriteDuration.Nanoseconds(),
+		WALFailoverSecondaryWriteNanos: m.WAL.Failover.SecondaryWriteDuration.Nanoseconds(),
+
+		LogWriterBytes:             m.LogWriter.WriteThroughput.Bytes,
+		LogWriterWorkDurationNanos: m.LogWriter.WriteThroughput.WorkDuration.Nanoseconds(),
+		LogWriterIdleDurationNanos: m.LogWriter.WriteThroughput.IdleDuration.Nanoseconds(),
+		LogWriterSyncRequests:      m.LogWriter.SyncRequests,
+		LogWriterFsyncs:            m.LogWriter.Fsyncs,
+
+		SecondaryCacheCount:               m.SecondaryCacheMetrics.Count,
+		SecondaryCacheSize:                m.SecondaryCacheMetrics.Size,
+		SecondaryCacheTotalReads:          m.SecondaryCacheMetrics.TotalReads,
+		SecondaryCacheMultiShardReads:     m.SecondaryCacheMetrics.MultiShardReads,
+		SecondaryCacheMultiBlockReads:     m.SecondaryCacheMetrics.MultiBlockReads,
+		SecondaryCacheReadsWithFullHit:    m.SecondaryCacheMetrics.ReadsWithFullHit,
+		SecondaryCacheReadsWithPartialHit: m.SecondaryCacheMetrics.ReadsWithPartialHit,
+		SecondaryCacheReadsWithNoHit:      m.SecondaryCacheMetrics.ReadsWithNoHit,
+		SecondaryCacheEvictions:           m.SecondaryCacheMetrics.Evictions,
+		SecondaryCacheWriteBackFailures:   m.SecondaryCacheMetrics.WriteBackFailures,
+	}
+	for i := range m.Levels {
+		s.Levels[i] = makeLevelMetricsSnapshot(&m.Levels[i])
+	}
+	return s
+}
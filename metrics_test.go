@@ -6,8 +6,11 @@ package pebble
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"math"
 	"math/rand"
+	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
@@ -499,3 +502,309 @@ func TestMetricsWALBytesWrittenMonotonicity(t *testing.T) {
 	}()
 	wg.Wait()
 }
+
+func TestMetricsSnapshot(t *testing.T) {
+	m := exampleMetrics()
+	m.Levels[1].Score = math.Inf(+1)
+	s := m.Snapshot()
+	require.Len(t, s.Levels, numLevels)
+	require.Equal(t, m.BlockCache.Hits, s.BlockCache.Hits)
+	require.Equal(t, m.Compact.Count, s.CompactCount)
+	require.Equal(t, m.Compact.Duration.Nanoseconds(), s.CompactDurationNanos)
+	require.Equal(t, m.Levels[0].NumFiles, s.Levels[0].NumFiles)
+	require.Equal(t, m.Levels[2].MultiLevel.BytesIn, s.Levels[2].MultiLevelBytesIn)
+	require.Equal(t, float64(0), s.Levels[1].Score)
+	require.Equal(t, m.WAL.BytesWritten, s.WALBytesWritten)
+	require.Equal(t, m.ReadAmp(), s.ReadAmp)
+	require.Equal(t, m.DiskSpaceUsage(), s.DiskSpaceUsage)
+
+	// The snapshot round-trips through JSON.
+	data, err := json.Marshal(s)
+	require.NoError(t, err)
+	var decoded MetricsSnapshot
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, s, decoded)
+
+	// A snapshot of a live DB is serializable.
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	s = d.MetricsSnapshot()
+	require.Equal(t, int64(1), s.Levels[0].NumFiles)
+	require.Equal(t, int64(1), s.FlushCount)
+	_, err = json.Marshal(s)
+	require.NoError(t, err)
+}
+
+// TestMetricsSnapshotCoversMetrics verifies that every exported numeric field
+// of Metrics is reported by MetricsSnapshot, so that adding a field to Metrics
+// without mapping it fails. It sets each field to a distinct value and looks
+// for that value among the fields of the snapshot.
+func TestMetricsSnapshotCoversMetrics(t *testing.T) {
+	// Fields of Metrics that are deliberately not part of MetricsSnapshot.
+	// Latency histograms (prometheus.Histogram) and unexported fields are
+	// skipped implicitly.
+	excluded := map[string]bool{
+		// Per-category aggregates, keyed by a category that isn't part of the
+		// stable schema.
+		"CategoryStats": true,
+	}
+
+	var m Metrics
+	var next int64 = 1_000_003
+	paths := make(map[string]int64)
+	var fill func(path string, v reflect.Value)
+	fill = func(path string, v reflect.Value) {
+		if excluded[path] {
+			return
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				f := v.Type().Field(i)
+				if !f.IsExported() {
+					continue
+				}
+				name := f.Name
+				if path != "" {
+					name = path + "." + name
+				}
+				fill(name, v.Field(i))
+			}
+		case reflect.Array:
+			for i := 0; i < v.Len(); i++ {
+				fill(fmt.Sprintf("%s[%d]", path, i), v.Index(i))
+			}
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			v.SetInt(next)
+			paths[path] = next
+			next += 7919
+		case reflect.Uint64:
+			v.SetUint(uint64(next))
+			paths[path] = next
+			next += 7919
+		case reflect.Float64:
+			v.SetFloat(float64(next))
+			paths[path] = next
+			next += 7919
+		case reflect.Bool:
+			v.SetBool(true)
+		case reflect.Interface:
+			// Latency histograms.
+		default:
+			t.Fatalf("%s: unexpected kind %s; map it in MetricsSnapshot or exclude it", path, v.Kind())
+		}
+	}
+	fill("", reflect.ValueOf(&m).Elem())
+
+	reported := make(map[int64]bool)
+	var collect func(v reflect.Value)
+	collect = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				collect(v.Field(i))
+			}
+		case reflect.Array, reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				collect(v.Index(i))
+			}
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			reported[v.Int()] = true
+		case reflect.Uint64:
+			reported[int64(v.Uint())] = true
+		case reflect.Float64:
+			reported[int64(v.Float())] = true
+		}
+	}
+	s := m.Snapshot()
+	collect(reflect.ValueOf(s))
+	for path, value := range paths {
+		if !reported[value] {
+			t.Errorf("Metrics.%s is not reported by MetricsSnapshot", path)
+		}
+	}
+	require.True(t, s.CompactPaused)
+}
+
+func TestMetricsSnapshotPinnedBytes(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem(), DisableAutomaticCompactions: true})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	rng := rand.New(rand.NewSource(1))
+	value := make([]byte, 1000)
+	for i := 0; i < 100; i++ {
+		rng.Read(value)
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%03d", i)), value, nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("k"), []byte("l"), false))
+
+	// Deletions older than the earliest snapshot don't pin any data.
+	require.NoError(t, d.DeleteRange([]byte("k000"), []byte("k010"), nil))
+	require.NoError(t, d.Flush())
+	d.mu.Lock()
+	d.waitTableStats()
+	d.mu.Unlock()
+	snap := d.NewSnapshot()
+	require.Zero(t, d.Metrics().SnapshotPinnedBytes)
+
+	// Deletions newer than the snapshot pin the data they delete.
+	require.NoError(t, d.DeleteRange([]byte("k050"), []byte("k100"), nil))
+	require.NoError(t, d.Flush())
+	d.mu.Lock()
+	d.waitTableStats()
+	d.mu.Unlock()
+	pinned := d.Metrics().SnapshotPinnedBytes
+	require.Greater(t, pinned, uint64(40*len(value)))
+	require.Equal(t, pinned, d.MetricsSnapshot().SnapshotPinnedBytes)
+
+	require.NoError(t, snap.Close())
+	require.Zero(t, d.Metrics().SnapshotPinnedBytes)
+}
+
+func TestMetricsWrittenKindsCount(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, b.Set([]byte("b"), []byte("1"), nil))
+	require.NoError(t, b.Merge([]byte("c"), []byte("1"), nil))
+	require.NoError(t, b.Delete([]byte("a"), nil))
+	require.NoError(t, b.DeleteRange([]byte("d"), []byte("e"), nil))
+	require.NoError(t, b.RangeKeySet([]byte("f"), []byte("g"), nil, []byte("1"), nil))
+	require.NoError(t, b.Commit(nil))
+	require.NoError(t, d.Set([]byte("h"), []byte("1"), nil))
+
+	var want [InternalKeyKindMax + 1]uint64
+	want[InternalKeyKindSet] = 3
+	want[InternalKeyKindMerge] = 1
+	want[InternalKeyKindDelete] = 1
+	want[InternalKeyKindRangeDelete] = 1
+	want[InternalKeyKindRangeKeySet] = 1
+	require.Equal(t, want, d.Metrics().Keys.WrittenKindsCount)
+	require.Equal(t, want, d.MetricsSnapshot().KeysWrittenKindsCount)
+
+	// Flushes and compactions don't affect the counts.
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+	require.Equal(t, want, d.Metrics().Keys.WrittenKindsCount)
+}
+
+func TestMetricsMaxKeyValueSize(t *testing.T) {
+	fs := vfs.NewMem()
+	opts := &Options{FS: fs, FormatMajorVersion: FormatMaxKeyValueSizes}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+
+	requireSizes := func(keySize, valueSize uint64) {
+		t.Helper()
+		m := d.Metrics()
+		require.Equal(t, keySize, m.Keys.MaxKeySize)
+		require.Equal(t, valueSize, m.Keys.MaxValueSize)
+		require.Equal(t, keySize, m.Snapshot().KeysMaxKeySize)
+		require.Equal(t, valueSize, m.Snapshot().KeysMaxValueSize)
+	}
+	requireSizes(0, 0)
+	require.NoError(t, d.Set([]byte("abc"), bytes.Repeat([]byte("v"), 10), nil))
+	requireSizes(3, 10)
+	require.NoError(t, d.Set([]byte("a"), []byte("v"), nil))
+	requireSizes(3, 10)
+	// The end keys of range deletions and range keys are counted.
+	require.NoError(t, d.DeleteRange([]byte("b"), []byte("bbbb"), nil))
+	requireSizes(4, 10)
+	require.NoError(t, d.RangeKeySet([]byte("c"), []byte("ccccc"), nil, bytes.Repeat([]byte("v"), 20), nil))
+	requireSizes(5, 10)
+	require.NoError(t, d.Merge([]byte("d"), bytes.Repeat([]byte("v"), 30), nil))
+	requireSizes(5, 30)
+
+	// The high-water marks survive a restart, whether they were persisted
+	// while flushing or are recovered from the WAL.
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set(bytes.Repeat([]byte("e"), 6), nil, nil))
+	require.NoError(t, d.Close())
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	requireSizes(6, 30)
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Close())
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	requireSizes(6, 30)
+
+	// Deleting the keys doesn't lower the high-water marks.
+	require.NoError(t, d.DeleteRange([]byte("a"), []byte("z"), nil))
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+	requireSizes(6, 30)
+	require.NoError(t, d.Close())
+
+	// Below FormatMaxKeyValueSizes, the high-water marks aren't persisted, so
+	// they're lost once the keys are flushed.
+	opts = &Options{FS: vfs.NewMem(), FormatMajorVersion: FormatMaxKeyValueSizes - 1}
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("abc"), nil, nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Close())
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	requireSizes(0, 0)
+	require.NoError(t, d.Close())
+}
+
+func TestMetricsSeekDistanceHistogram(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem(), RecordSeekDistances: true})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%03d", i)), nil, nil))
+	}
+	require.NoError(t, d.Flush())
+
+	seek := func(stride int) {
+		before := d.Metrics().SeekDistanceHistogram
+		iter, err := d.NewIter(nil)
+		require.NoError(t, err)
+		for i := 0; i < 100; i += stride {
+			require.True(t, iter.SeekGE([]byte(fmt.Sprintf("k%03d", i))))
+		}
+		// Seeks of open iterators aren't included.
+		require.Equal(t, before, d.Metrics().SeekDistanceHistogram)
+		require.NoError(t, iter.Close())
+	}
+	// The first seek of each iterator isn't measured. Each subsequent seek
+	// skips over the keys from the previous seek key up to the seek key.
+	seek(1)
+	var want SeekDistanceHistogram
+	want.Buckets[1] = 99
+	want.Unmeasured = 1
+	require.Equal(t, want, d.Metrics().SeekDistanceHistogram)
+	seek(3)
+	want.Buckets[2] += 33
+	want.Unmeasured++
+	require.Equal(t, want, d.Metrics().SeekDistanceHistogram)
+	seek(40)
+	want.Buckets[NumSeekDistanceBuckets-1] += 2
+	want.Unmeasured++
+	require.Equal(t, want, d.Metrics().SeekDistanceHistogram)
+
+	// Reverse seeks aren't measured.
+	iter, err := d.NewIter(nil)
+	require.NoError(t, err)
+	require.True(t, iter.SeekLT([]byte("k050")))
+	require.True(t, iter.SeekLT([]byte("k060")))
+	require.NoError(t, iter.Close())
+	want.Unmeasured += 2
+	require.Equal(t, want, d.Metrics().SeekDistanceHistogram)
+	require.Equal(t, want.Buckets, d.MetricsSnapshot().SeekDistanceBuckets)
+	require.Equal(t, want.Unmeasured, d.MetricsSnapshot().SeekDistanceUnmeasured)
+
+	// Seeks aren't recorded unless enabled.
+	d.opts.RecordSeekDistances = false
+	seek(1)
+	require.Equal(t, want, d.Metrics().SeekDistanceHistogram)
+}
@@ -215,6 +215,30 @@ const (
 	SharedNoCleanup
 )
 
+type preferredLocalityKey struct{}
+
+// WithPreferredLocality returns a context that carries a preferred storage
+// locality. Readables for remote objects consult the locality (see
+// PreferredLocality) on each read and, when the underlying
+// remote.ObjectReader supports it, direct the read to a replica in that
+// locality. An empty locality returns the context unchanged.
+func WithPreferredLocality(ctx context.Context, locality string) context.Context {
+	if locality == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, preferredLocalityKey{}, locality)
+}
+
+// PreferredLocality returns the preferred storage locality attached to the
+// context via WithPreferredLocality, or the empty string if there is none.
+func PreferredLocality(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	locality, _ := ctx.Value(preferredLocalityKey{}).(string)
+	return locality
+}
+
 // OpenOptions contains optional arguments for OpenForReading.
 type OpenOptions struct {
 	// MustExist triggers a fatal error if the file does not exist. The fatal
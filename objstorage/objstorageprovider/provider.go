@@ -43,6 +43,11 @@ type provider struct {
 		// but Sync was not yet called.
 		localObjectsChanged bool
 
+		// localDirsChanged is the set of subdirectories of FSDirName, per
+		// Settings.Local.SSTablePathFunc, in which non-remote objects were
+		// created but Sync was not yet called.
+		localDirsChanged map[string]struct{}
+
 		// knownObjects maintains information about objects that are known to the provider.
 		// It is initialized with the list of files in the manifest when we open a DB.
 		knownObjects map[base.DiskFileNum]objstorage.ObjectMetadata
@@ -96,6 +101,12 @@ type Settings struct {
 		// mode. This function is run whenever a local object is open for reading.
 		// If it is nil, DefaultReadaheadConfig is used.
 		ReadaheadConfigFn func() ReadaheadConfig
+
+		// SSTablePathFunc, if set, returns the path of a local sstable relative
+		// to FSDirName, allowing sstables to be placed in subdirectories. The
+		// last element of the path must be the sstable's standard file name. If
+		// it is nil, sstables are placed directly in FSDirName.
+		SSTablePathFunc func(fileNum base.DiskFileNum) string
 	}
 
 	// Fields here are set only if the provider is to support remote objects
@@ -130,6 +141,10 @@ type Settings struct {
 		// 2*runtime.GOMAXPROCS is used as the shard count.
 		CacheShardCount int
 
+		// ReadRetryPolicy configures the retrying of failed reads of remote
+		// objects. By default, failed reads are not retried.
+		ReadRetryPolicy RetryPolicy
+
 		// TODO(radu): allow the cache to live on another FS/location (e.g. to use
 		// instance-local SSD).
 	}
@@ -396,6 +411,9 @@ func (p *provider) LinkOrCopyFromLocal(
 			BytesPerSync:  p.st.BytesPerSync,
 		})
 		dstPath := p.vfsPath(dstFileType, dstFileNum)
+		if err := p.vfsMkdir(dstFileType, dstFileNum); err != nil {
+			return objstorage.ObjectMetadata{}, err
+		}
 		if err := vfs.LinkOrCopy(fs, srcFilePath, dstPath); err != nil {
 			return objstorage.ObjectMetadata{}, err
 		}
@@ -9,6 +9,7 @@ import (
 	"io"
 	"sync"
 
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider/sharedcache"
@@ -39,19 +40,29 @@ type remoteReadable struct {
 	size      int64
 	fileNum   base.DiskFileNum
 	cache     *sharedcache.Cache
+	// storage is the storage the object is read from, and retryPolicy the
+	// policy for retrying failed reads. retryPolicy is nil if reads aren't
+	// retried.
+	storage     remote.Storage
+	retryPolicy *RetryPolicy
 }
 
 var _ objstorage.Readable = (*remoteReadable)(nil)
 
 func (p *provider) newRemoteReadable(
-	objReader remote.ObjectReader, size int64, fileNum base.DiskFileNum,
+	objReader remote.ObjectReader, size int64, fileNum base.DiskFileNum, storage remote.Storage,
 ) *remoteReadable {
-	return &remoteReadable{
+	r := &remoteReadable{
 		objReader: objReader,
 		size:      size,
 		fileNum:   fileNum,
 		cache:     p.remote.cache,
+		storage:   storage,
+	}
+	if p.st.Remote.ReadRetryPolicy.MaxAttempts > 1 {
+		r.retryPolicy = &p.st.Remote.ReadRetryPolicy
 	}
+	return r
 }
 
 // ReadAt is part of the objstorage.Readable interface.
@@ -60,18 +71,53 @@ func (r *remoteReadable) ReadAt(ctx context.Context, p []byte, offset int64) err
 }
 
 // readInternal performs a read for the object, using the cache when
-// appropriate.
+// appropriate, and retrying failed reads per the RetryPolicy.
 func (r *remoteReadable) readInternal(
 	ctx context.Context, p []byte, offset int64, forCompaction bool,
 ) error {
+	if r.retryPolicy == nil {
+		return r.readOnce(ctx, p, offset, forCompaction)
+	}
+	return r.readWithRetry(ctx, func() error {
+		return r.readOnce(ctx, p, offset, forCompaction)
+	})
+}
+
+// readOnce performs a single attempt at a read for the object.
+func (r *remoteReadable) readOnce(
+	ctx context.Context, p []byte, offset int64, forCompaction bool,
+) error {
+	objReader := r.objReader
+	if locality := objstorage.PreferredLocality(ctx); locality != "" {
+		if lr, ok := objReader.(remote.LocalityAwareObjectReader); ok {
+			objReader = &localityObjectReader{LocalityAwareObjectReader: lr, locality: locality}
+		}
+	}
 	if r.cache != nil {
 		flags := sharedcache.ReadFlags{
 			// Don't add data to the cache if this read is for a compaction.
 			ReadOnly: forCompaction,
 		}
-		return r.cache.ReadAt(ctx, r.fileNum, p, offset, r.objReader, r.size, flags)
+		return r.cache.ReadAt(ctx, r.fileNum, p, offset, objReader, r.size, flags)
+	}
+	return objReader.ReadAt(ctx, p, offset)
+}
+
+// localityObjectReader wraps a remote.LocalityAwareObjectReader and directs
+// reads to the replica in the preferred locality, falling back to a regular
+// read if that locality is unavailable.
+type localityObjectReader struct {
+	remote.LocalityAwareObjectReader
+	locality string
+}
+
+// ReadAt is part of the remote.ObjectReader interface.
+func (r *localityObjectReader) ReadAt(ctx context.Context, p []byte, offset int64) error {
+	err := r.LocalityAwareObjectReader.ReadAtWithLocality(ctx, p, offset, r.locality)
+	if errors.Is(err, remote.ErrLocalityUnavailable) {
+		return r.LocalityAwareObjectReader.ReadAt(ctx, p, offset)
 	}
-	return r.objReader.ReadAt(ctx, p, offset)
+	return err
 }
 
 func (r *remoteReadable) Close() error {
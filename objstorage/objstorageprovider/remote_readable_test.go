@@ -11,9 +11,13 @@ import (
 	"math/rand"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cockroachdb/datadriven"
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/objstorage/remote"
 	"github.com/stretchr/testify/require"
 )
 
@@ -106,3 +110,116 @@ func TestRemoteReadHandle(t *testing.T) {
 		}
 	})
 }
+
+type testLocalityObjectReader struct {
+	testObjectReader
+	localities map[string]bool
+}
+
+func (r *testLocalityObjectReader) ReadAtWithLocality(
+	ctx context.Context, p []byte, offset int64, locality string,
+) error {
+	if !r.localities[locality] {
+		fmt.Fprintf(&r.b, "ReadAtWithLocality(%s): unavailable\n", locality)
+		return remote.ErrLocalityUnavailable
+	}
+	fmt.Fprintf(&r.b, "ReadAtWithLocality(%s, len=%d, offset=%d)\n", locality, len(p), offset)
+	copy(p, r.buf[offset:int(offset)+len(p)])
+	return nil
+}
+
+func TestRemoteReadablePreferredLocality(t *testing.T) {
+	or := &testLocalityObjectReader{localities: map[string]bool{"us-east": true}}
+	or.init(100)
+	rr := &remoteReadable{objReader: or, size: 100}
+
+	read := func(ctx context.Context) string {
+		b := make([]byte, 10)
+		require.NoError(t, rr.ReadAt(ctx, b, 5))
+		require.Equal(t, string(or.buf[5:15]), string(b))
+		str := or.b.String()
+		or.b.Reset()
+		return str
+	}
+	ctx := context.Background()
+	require.Equal(t, "ReadAt(len=10, offset=5)\n", read(ctx))
+	require.Equal(t, "ReadAtWithLocality(us-east, len=10, offset=5)\n",
+		read(objstorage.WithPreferredLocality(ctx, "us-east")))
+	require.Equal(t, "ReadAtWithLocality(us-west): unavailable\nReadAt(len=10, offset=5)\n",
+		read(objstorage.WithPreferredLocality(ctx, "us-west")))
+}
+
+// flakyObjectReader wraps a testObjectReader, failing the first failures
+// reads with err.
+type flakyObjectReader struct {
+	testObjectReader
+	failures int
+	err      error
+}
+
+func (r *flakyObjectReader) ReadAt(ctx context.Context, p []byte, offset int64) error {
+	if r.failures > 0 {
+		r.failures--
+		return r.err
+	}
+	return r.testObjectReader.ReadAt(ctx, p, offset)
+}
+
+func TestRemoteReadableRetry(t *testing.T) {
+	errUnavailable := errors.New("503 service unavailable")
+	errPermanent := errors.New("403 forbidden")
+	type retry struct {
+		err       error
+		willRetry bool
+	}
+	var retries []retry
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Microsecond,
+		IsRetryable: func(err error) bool {
+			return errors.Is(err, errUnavailable)
+		},
+		OnRetry: func(_ base.DiskFileNum, err error, willRetry bool) {
+			retries = append(retries, retry{err: err, willRetry: willRetry})
+		},
+	}
+	read := func(ctx context.Context, failures int, err error) error {
+		retries = nil
+		or := &flakyObjectReader{failures: failures, err: err}
+		or.init(100)
+		rr := &remoteReadable{objReader: or, size: 100, retryPolicy: &policy}
+		p := make([]byte, 10)
+		if err := rr.ReadAt(ctx, p, 5); err != nil {
+			return err
+		}
+		require.Equal(t, or.buf[5:15], p)
+		return nil
+	}
+
+	// Transient errors are retried until the read succeeds.
+	require.NoError(t, read(context.Background(), 2, errUnavailable))
+	require.Equal(t, []retry{{errUnavailable, true}, {errUnavailable, true}}, retries)
+
+	// The read fails once the attempts are exhausted.
+	require.ErrorIs(t, read(context.Background(), 3, errUnavailable), errUnavailable)
+	require.Equal(t, []retry{{errUnavailable, true}, {errUnavailable, true}, {errUnavailable, false}}, retries)
+
+	// Permanent errors aren't retried.
+	require.ErrorIs(t, read(context.Background(), 1, errPermanent), errPermanent)
+	require.Empty(t, retries)
+
+	// Reads whose context is done aren't retried.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, read(ctx, 1, errUnavailable), errUnavailable)
+	require.Equal(t, []retry{{errUnavailable, false}}, retries)
+
+	// By default, cancellations and corruption errors aren't retried.
+	policy.IsRetryable = nil
+	require.ErrorIs(t, read(context.Background(), 1, context.Canceled), context.Canceled)
+	require.Empty(t, retries)
+	require.ErrorIs(t, read(context.Background(), 1, base.ErrCorruption), base.ErrCorruption)
+	require.Empty(t, retries)
+	require.NoError(t, read(context.Background(), 1, errUnavailable))
+	require.Equal(t, []retry{{errUnavailable, true}}, retries)
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package objstorageprovider
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// RetryPolicy configures the retrying of failed reads of remote objects.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts at a read, including the
+	// first. If it is 0 or 1, failed reads are not retried.
+	MaxAttempts int
+	// InitialBackoff is the time to wait before the first retry. The wait
+	// doubles with each subsequent retry, up to MaxBackoff. If it is 0, the
+	// default of 10ms is used.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum time to wait between attempts. If it is 0, the
+	// default of 1s is used.
+	MaxBackoff time.Duration
+	// IsRetryable, if set, returns whether a read that failed with the given
+	// error should be retried. If not set, all errors are retried other than
+	// those for which the storage's IsNotExistError returns true, corruption
+	// errors, and errors due to the cancellation of the read's context.
+	IsRetryable func(err error) bool
+	// OnRetry, if set, is called with the error of each failed attempt that
+	// is retryable. willRetry is false if the read will not be retried
+	// because the attempts were exhausted, or the read's context was done.
+	OnRetry func(fileNum base.DiskFileNum, err error, willRetry bool)
+}
+
+const (
+	defaultRetryInitialBackoff = 10 * time.Millisecond
+	defaultRetryMaxBackoff     = time.Second
+)
+
+// readWithRetry performs a read of the remote object through read, retrying
+// per r.retryPolicy, which must be set.
+func (r *remoteReadable) readWithRetry(ctx context.Context, read func() error) error {
+	policy := r.retryPolicy
+	backoff := policy.InitialBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryInitialBackoff
+	}
+	maxBackoff := policy.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		err := read()
+		if err == nil || !r.isRetryable(ctx, err) {
+			return err
+		}
+		willRetry := attempt < policy.MaxAttempts && ctx.Err() == nil
+		if policy.OnRetry != nil {
+			policy.OnRetry(r.fileNum, err, willRetry)
+		}
+		if !willRetry {
+			return err
+		}
+		t := time.NewTimer(min(backoff, maxBackoff))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// isRetryable returns whether a read that failed with err should be retried.
+func (r *remoteReadable) isRetryable(ctx context.Context, err error) bool {
+	if r.retryPolicy.IsRetryable != nil {
+		return r.retryPolicy.IsRetryable(err)
+	}
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, base.ErrCorruption) {
+		return false
+	}
+	return r.storage == nil || !r.storage.IsNotExistError(err)
+}
@@ -8,15 +8,59 @@ import (
 	"context"
 
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/vfs"
 )
 
 func (p *provider) vfsPath(fileType base.FileType, fileNum base.DiskFileNum) string {
+	if rel, ok := p.vfsRelPath(fileType, fileNum); ok {
+		return p.st.FS.PathJoin(p.st.FSDirName, rel)
+	}
 	return base.MakeFilepath(p.st.FS, p.st.FSDirName, fileType, fileNum)
 }
 
+// vfsRelPath returns the path of a local object relative to FSDirName if it's
+// determined by Settings.Local.SSTablePathFunc.
+func (p *provider) vfsRelPath(fileType base.FileType, fileNum base.DiskFileNum) (string, bool) {
+	if fileType != base.FileTypeTable || p.st.Local.SSTablePathFunc == nil {
+		return "", false
+	}
+	return p.st.Local.SSTablePathFunc(fileNum), true
+}
+
+// vfsMkdir creates the subdirectories of FSDirName that a local object is
+// placed in by Settings.Local.SSTablePathFunc, if any, and records them to be
+// synced by vfsSync.
+func (p *provider) vfsMkdir(fileType base.FileType, fileNum base.DiskFileNum) error {
+	rel, ok := p.vfsRelPath(fileType, fileNum)
+	if !ok {
+		return nil
+	}
+	fs := p.st.FS
+	if fs.PathBase(rel) != base.MakeFilename(fileType, fileNum) {
+		return errors.Errorf("pebble: sstable path %q does not end in %s",
+			rel, base.MakeFilename(fileType, fileNum))
+	}
+	dir := fs.PathDir(rel)
+	if dir == "." {
+		return nil
+	}
+	if err := fs.MkdirAll(fs.PathJoin(p.st.FSDirName, dir), 0755); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.mu.localDirsChanged == nil {
+		p.mu.localDirsChanged = make(map[string]struct{})
+	}
+	for ; dir != "." && dir != fs.PathDir(dir); dir = fs.PathDir(dir) {
+		p.mu.localDirsChanged[fs.PathJoin(p.st.FSDirName, dir)] = struct{}{}
+	}
+	return nil
+}
+
 func (p *provider) vfsOpenForReading(
 	ctx context.Context,
 	fileType base.FileType,
@@ -45,6 +89,9 @@ func (p *provider) vfsCreate(
 	category vfs.DiskWriteCategory,
 ) (objstorage.Writable, objstorage.ObjectMetadata, error) {
 	filename := p.vfsPath(fileType, fileNum)
+	if err := p.vfsMkdir(fileType, fileNum); err != nil {
+		return nil, objstorage.ObjectMetadata{}, err
+	}
 	file, err := p.st.FS.Create(filename, category)
 	if err != nil {
 		return nil, objstorage.ObjectMetadata{}, err
@@ -75,6 +122,9 @@ func (p *provider) vfsInit() error {
 		}
 	}
 
+	if p.st.Local.SSTablePathFunc != nil {
+		return p.vfsInitSubdir("", listing)
+	}
 	for _, filename := range listing {
 		fileType, fileNum, ok := base.ParseFilename(p.st.FS, filename)
 		if ok && fileType == base.FileTypeTable {
@@ -88,24 +138,96 @@ func (p *provider) vfsInit() error {
 	return nil
 }
 
+// vfsInitSubdir finds the local FS objects in the given subdirectory of
+// FSDirName and its subdirectories, when sstables are placed by
+// Settings.Local.SSTablePathFunc. Only the sstables at the paths returned by
+// SSTablePathFunc are known objects, so that sstables elsewhere, such as in
+// an archive directory, are ignored.
+func (p *provider) vfsInitSubdir(dir string, listing []string) error {
+	fs := p.st.FS
+	for _, filename := range listing {
+		rel := filename
+		if dir != "" {
+			rel = fs.PathJoin(dir, filename)
+		}
+		fileType, fileNum, ok := base.ParseFilename(fs, filename)
+		if ok {
+			wantRel, ok := p.vfsRelPath(fileType, fileNum)
+			if ok && fs.PathJoin(p.st.FSDirName, wantRel) == fs.PathJoin(p.st.FSDirName, rel) {
+				p.mu.knownObjects[fileNum] = objstorage.ObjectMetadata{
+					FileType:    fileType,
+					DiskFileNum: fileNum,
+				}
+			}
+			continue
+		}
+		path := fs.PathJoin(p.st.FSDirName, rel)
+		stat, err := fs.Stat(path)
+		if err != nil {
+			if oserror.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if !stat.IsDir() {
+			continue
+		}
+		subListing, err := fs.List(path)
+		if err != nil {
+			return errors.Wrapf(err, "pebble: could not list store directory")
+		}
+		if err := p.vfsInitSubdir(rel, subListing); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (p *provider) vfsSync() error {
 	p.mu.Lock()
 	shouldSync := p.mu.localObjectsChanged
 	p.mu.localObjectsChanged = false
+	dirs := p.mu.localDirsChanged
+	p.mu.localDirsChanged = nil
 	p.mu.Unlock()
 
 	if !shouldSync {
 		return nil
 	}
-	if err := p.fsDir.Sync(); err != nil {
+	var err error
+	for dir := range dirs {
+		if err = p.vfsSyncDir(dir); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = p.fsDir.Sync()
+	}
+	if err != nil {
 		p.mu.Lock()
 		defer p.mu.Unlock()
 		p.mu.localObjectsChanged = true
+		for dir := range dirs {
+			if p.mu.localDirsChanged == nil {
+				p.mu.localDirsChanged = make(map[string]struct{})
+			}
+			p.mu.localDirsChanged[dir] = struct{}{}
+		}
 		return err
 	}
 	return nil
 }
 
+// vfsSyncDir syncs a subdirectory of FSDirName.
+func (p *provider) vfsSyncDir(dir string) error {
+	d, err := p.st.FS.OpenDir(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	return firstError(err, d.Close())
+}
+
 func (p *provider) vfsSize(fileType base.FileType, fileNum base.DiskFileNum) (int64, error) {
 	filename := p.vfsPath(fileType, fileNum)
 	stat, err := p.st.FS.Stat(filename)
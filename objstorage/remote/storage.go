@@ -8,6 +8,7 @@ import (
 	"context"
 	"io"
 
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/redact"
 )
 
@@ -132,6 +133,24 @@ type ObjectReader interface {
 	Close() error
 }
 
+// ErrLocalityUnavailable is returned by
+// LocalityAwareObjectReader.ReadAtWithLocality when no replica of the object is
+// reachable in the requested locality.
+var ErrLocalityUnavailable = errors.New("pebble: preferred storage locality unavailable")
+
+// LocalityAwareObjectReader is an optional interface that can be implemented by
+// an ObjectReader for objects that are reachable via multiple endpoints (e.g.
+// replicas in different regions) with different latencies.
+type LocalityAwareObjectReader interface {
+	ObjectReader
+
+	// ReadAtWithLocality is like ReadAt, but prefers reading from a replica in
+	// the given locality. If no such replica is available, it must return an
+	// error that satisfies errors.Is(err, ErrLocalityUnavailable); the caller
+	// then falls back to ReadAt.
+	ReadAtWithLocality(ctx context.Context, p []byte, offset int64, locality string) error
+}
+
 // ObjectKey is a (locator, object name) pair which uniquely identifies a remote
 // object and can be used as a map key.
 type ObjectKey struct {
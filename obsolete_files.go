@@ -7,6 +7,7 @@ package pebble
 import (
 	"cmp"
 	"context"
+	"fmt"
 	"runtime/pprof"
 	"slices"
 	"sync"
@@ -47,6 +48,8 @@ type cleanupManager struct {
 		completedJobs          int
 		completedJobsCond      sync.Cond
 		jobsQueueWarningIssued bool
+		// pendingJobs contains the enqueued jobs that haven't completed yet.
+		pendingJobs []*cleanupJob
 	}
 }
 
@@ -132,6 +135,7 @@ func (cm *cleanupManager) EnqueueJob(jobID JobID, obsoleteFiles []obsoleteFile)
 
 	cm.mu.Lock()
 	cm.mu.totalJobs++
+	cm.mu.pendingJobs = append(cm.mu.pendingJobs, job)
 	cm.maybeLogLocked()
 	cm.mu.Unlock()
 
@@ -153,6 +157,29 @@ func (cm *cleanupManager) Wait() {
 	}
 }
 
+// appendPendingFiles appends the files of the jobs that have been enqueued but
+// haven't completed yet to infos.
+func (cm *cleanupManager) appendPendingFiles(infos []ObsoleteFileInfo) []ObsoleteFileInfo {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	for _, job := range cm.mu.pendingJobs {
+		for _, of := range job.obsoleteFiles {
+			info := ObsoleteFileInfo{
+				FileType: of.fileType,
+				FileNum:  of.nonLogFile.fileNum,
+				Size:     of.nonLogFile.fileSize,
+				Reason:   ObsoleteFileQueuedForDeletion,
+			}
+			if of.fileType == fileTypeLog {
+				info.FileNum = base.DiskFileNum(of.logFile.NumWAL)
+				info.Size = of.logFile.ApproxFileSize
+			}
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
 // mainLoop runs the manager's background goroutine.
 func (cm *cleanupManager) mainLoop() {
 	defer cm.waitGroup.Done()
@@ -178,6 +205,9 @@ func (cm *cleanupManager) mainLoop() {
 		}
 		cm.mu.Lock()
 		cm.mu.completedJobs++
+		if i := slices.Index(cm.mu.pendingJobs, job); i >= 0 {
+			cm.mu.pendingJobs = slices.Delete(cm.mu.pendingJobs, i, i+1)
+		}
 		cm.mu.completedJobsCond.Broadcast()
 		cm.maybeLogLocked()
 		cm.mu.Unlock()
@@ -465,6 +495,149 @@ func (d *DB) enableFileDeletions() {
 
 type fileInfo = base.FileInfo
 
+// ObsoleteFileReason describes why an obsolete file hasn't been deleted yet.
+type ObsoleteFileReason int8
+
+const (
+	// ObsoleteFileReferenced indicates that the sstable is no longer part of the
+	// current version, but is still referenced by an older version, such as one
+	// read by an open iterator or an in-progress compaction.
+	ObsoleteFileReferenced ObsoleteFileReason = iota
+	// ObsoleteFileReferencedBySnapshot indicates that the sstable is part of the
+	// version pinned by one or more file-only snapshots (see
+	// EventuallyFileOnlySnapshot), identified by
+	// ObsoleteFileInfo.SnapshotSeqNums.
+	ObsoleteFileReferencedBySnapshot
+	// ObsoleteFileAwaitingDeletion indicates that the file is no longer
+	// referenced, but hasn't been queued for deletion yet. This is the case while
+	// file deletions are disabled, such as during a checkpoint, and for the
+	// manifests retained by Options.NumPrevManifest.
+	ObsoleteFileAwaitingDeletion
+	// ObsoleteFileQueuedForDeletion indicates that the file is queued for
+	// deletion by the background cleanup goroutine, which may be pacing
+	// deletions (see Options.TargetByteDeletionRate).
+	ObsoleteFileQueuedForDeletion
+)
+
+// String implements fmt.Stringer.
+func (r ObsoleteFileReason) String() string {
+	switch r {
+	case ObsoleteFileReferenced:
+		return "referenced"
+	case ObsoleteFileReferencedBySnapshot:
+		return "referenced-by-snapshot"
+	case ObsoleteFileAwaitingDeletion:
+		return "awaiting-deletion"
+	case ObsoleteFileQueuedForDeletion:
+		return "queued-for-deletion"
+	default:
+		return fmt.Sprintf("unknown(%d)", r)
+	}
+}
+
+// ObsoleteFileInfo describes an obsolete file that hasn't been deleted yet.
+type ObsoleteFileInfo struct {
+	FileType base.FileType
+	FileNum  base.DiskFileNum
+	// Size is the size of the file in bytes. It's approximate for WALs.
+	Size   uint64
+	Reason ObsoleteFileReason
+	// SnapshotSeqNums contains the sequence numbers of the file-only snapshots
+	// referencing the sstable, in increasing order, if Reason is
+	// ObsoleteFileReferencedBySnapshot.
+	SnapshotSeqNums []uint64
+}
+
+// ObsoleteFiles returns the obsolete files that haven't been deleted yet, along
+// with the reason each of them is retained. Obsolete WALs are only included
+// once they're queued for deletion.
+func (d *DB) ObsoleteFiles() []ObsoleteFileInfo {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Find the zombie sstables in the versions pinned by file-only snapshots.
+	snapshotSeqNums := make(map[base.DiskFileNum][]uint64)
+	for es := range d.mu.snapshots.fileOnly {
+		es.mu.Lock()
+		vers, seqNum := es.mu.vers, es.seqNum
+		es.mu.Unlock()
+		if vers == nil {
+			continue
+		}
+		seen := make(map[base.DiskFileNum]struct{})
+		for _, level := range vers.Levels {
+			iter := level.Iter()
+			for f := iter.First(); f != nil; f = iter.Next() {
+				fileNum := f.FileBacking.DiskFileNum
+				if _, ok := d.mu.versions.zombieTables[fileNum]; !ok {
+					continue
+				}
+				if _, ok := seen[fileNum]; ok {
+					continue
+				}
+				seen[fileNum] = struct{}{}
+				snapshotSeqNums[fileNum] = append(snapshotSeqNums[fileNum], seqNum)
+			}
+		}
+	}
+
+	var infos []ObsoleteFileInfo
+	unreferenced := make(map[base.DiskFileNum]struct{}, len(d.mu.versions.obsoleteTables))
+	for _, t := range d.mu.versions.obsoleteTables {
+		unreferenced[t.FileNum] = struct{}{}
+		infos = append(infos, ObsoleteFileInfo{
+			FileType: fileTypeTable,
+			FileNum:  t.FileNum,
+			Size:     t.FileSize,
+			Reason:   ObsoleteFileAwaitingDeletion,
+		})
+	}
+	for fileNum, t := range d.mu.versions.zombieTables {
+		if _, ok := unreferenced[fileNum]; ok {
+			continue
+		}
+		info := ObsoleteFileInfo{
+			FileType: fileTypeTable,
+			FileNum:  fileNum,
+			Size:     t.FileSize,
+			Reason:   ObsoleteFileReferenced,
+		}
+		if seqNums := snapshotSeqNums[fileNum]; len(seqNums) > 0 {
+			slices.Sort(seqNums)
+			info.Reason = ObsoleteFileReferencedBySnapshot
+			info.SnapshotSeqNums = seqNums
+		}
+		infos = append(infos, info)
+	}
+	for _, f := range d.mu.versions.obsoleteManifests {
+		infos = append(infos, ObsoleteFileInfo{
+			FileType: fileTypeManifest,
+			FileNum:  f.FileNum,
+			Size:     f.FileSize,
+			Reason:   ObsoleteFileAwaitingDeletion,
+		})
+	}
+	for _, f := range d.mu.versions.obsoleteOptions {
+		infos = append(infos, ObsoleteFileInfo{
+			FileType: fileTypeOptions,
+			FileNum:  f.FileNum,
+			Size:     f.FileSize,
+			Reason:   ObsoleteFileAwaitingDeletion,
+		})
+	}
+	infos = d.cleanupManager.appendPendingFiles(infos)
+	slices.SortFunc(infos, func(a, b ObsoleteFileInfo) int {
+		if c := cmp.Compare(a.FileType, b.FileType); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.FileNum, b.FileNum)
+	})
+	return infos
+}
+
 // deleteObsoleteFiles enqueues a cleanup job to the cleanup manager, if necessary.
 //
 // d.mu must be held when calling this. The function will release and re-aquire the mutex.
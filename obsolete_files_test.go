@@ -6,6 +6,7 @@ package pebble
 
 import (
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
 	"testing"
@@ -136,3 +137,76 @@ func TestCleaner(t *testing.T) {
 		}
 	})
 }
+
+func TestObsoleteFiles(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem(), DisableAutomaticCompactions: true})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// tables returns the obsolete sstables, once any queued deletions complete.
+	tables := func() []string {
+		d.cleanupManager.Wait()
+		var res []string
+		for _, info := range d.ObsoleteFiles() {
+			if info.FileType != fileTypeTable {
+				continue
+			}
+			s := fmt.Sprintf("%s:%s", info.FileNum, info.Reason)
+			if info.SnapshotSeqNums != nil {
+				s += fmt.Sprint(info.SnapshotSeqNums)
+			}
+			res = append(res, s)
+		}
+		return res
+	}
+	sstables := func() []base.DiskFileNum {
+		infos, err := d.SSTables()
+		require.NoError(t, err)
+		var res []base.DiskFileNum
+		for _, level := range infos {
+			for _, info := range level {
+				res = append(res, base.PhysicalTableDiskFileNum(info.FileNum))
+			}
+		}
+		return res
+	}
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	first := sstables()
+	require.Len(t, first, 1)
+	es := d.NewEventuallyFileOnlySnapshot([]KeyRange{{Start: []byte("a"), End: []byte("z")}})
+	require.True(t, es.hasTransitioned())
+
+	require.NoError(t, d.Set([]byte("b"), []byte("2"), nil))
+	require.NoError(t, d.Flush())
+	second := slices.DeleteFunc(sstables(), func(n base.DiskFileNum) bool { return n == first[0] })
+	require.Len(t, second, 1)
+	iter, err := d.NewIter(nil)
+	require.NoError(t, err)
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+	require.NotContains(t, sstables(), first[0])
+	require.NotContains(t, sstables(), second[0])
+
+	// The first sstable is pinned by the snapshot, and the second by the
+	// iterator.
+	require.Equal(t, []string{
+		fmt.Sprintf("%s:referenced-by-snapshot[%d]", first[0], es.seqNum),
+		fmt.Sprintf("%s:referenced", second[0]),
+	}, tables())
+	require.NoError(t, iter.Close())
+	require.Equal(t, []string{
+		fmt.Sprintf("%s:referenced-by-snapshot[%d]", first[0], es.seqNum),
+	}, tables())
+
+	// Unreferenced sstables are retained while file deletions are disabled.
+	d.mu.Lock()
+	d.disableFileDeletions()
+	d.mu.Unlock()
+	require.NoError(t, es.Close())
+	require.Equal(t, []string{fmt.Sprintf("%s:awaiting-deletion", first[0])}, tables())
+	d.mu.Lock()
+	d.enableFileDeletions()
+	d.mu.Unlock()
+	require.Empty(t, tables())
+}
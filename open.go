@@ -12,7 +12,9 @@ import (
 	"io"
 	"math"
 	"os"
+	"path/filepath"
 	"slices"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -100,6 +102,18 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		}
 	}()
 
+	// Guard against opening the DB twice within the process, where the file
+	// lock may not be enforced.
+	openDirKey, err := registerOpenDir(dirname, opts.FS)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if db == nil {
+			unregisterOpenDir(openDirKey)
+		}
+	}()
+
 	// Lock the database directory.
 	var fileLock *Lock
 	if opts.Lock != nil {
@@ -205,19 +219,22 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 	}
 
 	d := &DB{
-		cacheID:             opts.Cache.NewID(),
-		dirname:             dirname,
-		opts:                opts,
-		cmp:                 opts.Comparer.Compare,
-		equal:               opts.Comparer.Equal,
-		merge:               opts.Merger.Merge,
-		split:               opts.Comparer.Split,
-		abbreviatedKey:      opts.Comparer.AbbreviatedKey,
-		largeBatchThreshold: (opts.MemTableSize - uint64(memTableEmptySize)) / 2,
-		fileLock:            fileLock,
-		dataDir:             dataDir,
-		closed:              new(atomic.Value),
-		closedCh:            make(chan struct{}),
+		cacheID:               opts.Cache.NewID(),
+		dirname:               dirname,
+		opts:                  opts,
+		cmp:                   opts.Comparer.Compare,
+		equal:                 opts.Comparer.Equal,
+		merge:                 opts.Merger.Merge,
+		split:                 opts.Comparer.Split,
+		abbreviatedKey:        opts.Comparer.AbbreviatedKey,
+		largeBatchThreshold:   (opts.MemTableSize - uint64(memTableEmptySize)) / 2,
+		rangeStats:            newRangeStats(opts.Comparer.Compare, opts.RangeStatsBuckets),
+		fileLock:              fileLock,
+		openDirKey:            openDirKey,
+		dataDir:               dataDir,
+		closed:                new(atomic.Value),
+		closedCh:              make(chan struct{}),
+		compactionBreakpoints: make(chan *CompactionBreakpoint),
 	}
 	d.mu.versions = &versionSet{}
 	d.diskAvailBytes.Store(math.MaxUint64)
@@ -258,10 +275,12 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 	}()
 
 	d.commit = newCommitPipeline(commitEnv{
-		logSeqNum:     &d.mu.versions.logSeqNum,
-		visibleSeqNum: &d.mu.versions.visibleSeqNum,
-		apply:         d.commitApply,
-		write:         d.commitWrite,
+		logSeqNum:       &d.mu.versions.logSeqNum,
+		visibleSeqNum:   &d.mu.versions.visibleSeqNum,
+		apply:           d.commitApply,
+		write:           d.commitWrite,
+		observe:         opts.CommitObserver,
+		seqNumAllocator: opts.SeqNumAllocator,
 	})
 	d.mu.nextJobID = 1
 	d.mu.mem.nextSize = opts.MemTableSize
@@ -272,6 +291,7 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 	d.mu.compact.inProgress = make(map[*compaction]struct{})
 	d.mu.compact.noOngoingFlushStartTime = time.Now()
 	d.mu.snapshots.init()
+	d.mu.snapshots.fileOnly = make(map[*EventuallyFileOnlySnapshot]struct{})
 	// logSeqNum is the next sequence number that will be assigned.
 	// Start assigning sequence numbers from base.SeqNumStart to leave
 	// room for reserved sequence numbers (see comments around
@@ -298,15 +318,36 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		BytesPerSync:        opts.BytesPerSync,
 	}
 	providerSettings.Local.ReadaheadConfigFn = opts.Local.ReadaheadConfigFn
+	providerSettings.Local.SSTablePathFunc = sstablePathFunc(opts)
 	providerSettings.Remote.StorageFactory = opts.Experimental.RemoteStorage
 	providerSettings.Remote.CreateOnShared = opts.Experimental.CreateOnShared
 	providerSettings.Remote.CreateOnSharedLocator = opts.Experimental.CreateOnSharedLocator
 	providerSettings.Remote.CacheSizeBytes = opts.Experimental.SecondaryCacheSizeBytes
+	providerSettings.Remote.ReadRetryPolicy = objstorageprovider.RetryPolicy{
+		MaxAttempts:    opts.ObjStoreRetryPolicy.MaxAttempts,
+		InitialBackoff: opts.ObjStoreRetryPolicy.InitialBackoff,
+		MaxBackoff:     opts.ObjStoreRetryPolicy.MaxBackoff,
+		IsRetryable:    opts.ObjStoreRetryPolicy.IsRetryable,
+		OnRetry: func(_ base.DiskFileNum, _ error, willRetry bool) {
+			if willRetry {
+				d.objStoreReadRetries.Add(1)
+			} else {
+				d.objStoreFailedReads.Add(1)
+			}
+		},
+	}
 
 	d.objProvider, err = objstorageprovider.Open(providerSettings)
 	if err != nil {
 		return nil, err
 	}
+	if opts.ReadOnlyStore != nil {
+		d.objProvider = &readOnlyStoreProvider{Provider: d.objProvider, store: opts.ReadOnlyStore}
+	}
+
+	// storeFiles holds the sstables of Options.ReadOnlyStore to add to the LSM
+	// of a newly created DB.
+	var storeFiles []newFileEntry
 
 	if !manifestExists {
 		// DB does not exist.
@@ -319,6 +360,16 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 			jobID, dirname, d.objProvider, opts, manifestMarker, d.FormatMajorVersion, &d.mu.Mutex); err != nil {
 			return nil, err
 		}
+		if opts.ReadOnlyStore != nil {
+			var largestSeqNum uint64
+			storeFiles, largestSeqNum, err = loadReadOnlyStoreTables(opts, opts.ReadOnlyStore, d.cacheID)
+			if err != nil {
+				return nil, err
+			}
+			if d.mu.versions.logSeqNum.Load() <= largestSeqNum {
+				d.mu.versions.logSeqNum.Store(largestSeqNum + 1)
+			}
+		}
 	} else {
 		if opts.ErrorIfExists {
 			return nil, errors.Wrapf(ErrDBAlreadyExists, "dirname=%q", dirname)
@@ -358,6 +409,7 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		BytesPerSync:         opts.WALBytesPerSync,
 		PreallocateSize:      d.walPreallocateSize,
 		MinSyncInterval:      opts.WALMinSyncInterval,
+		SyncCoalesceDuration: opts.WALSyncCoalesceDuration,
 		FsyncLatency:         d.mu.log.metrics.fsyncLatency,
 		QueueSemChan:         d.commit.logSyncQSem,
 		Logger:               opts.Logger,
@@ -445,6 +497,9 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 	// Ratchet d.mu.versions.nextFileNum ahead of all known objects in the
 	// objProvider. This avoids FileNum collisions with obsolete sstables.
 	objects := d.objProvider.List()
+	if opts.ReadOnlyStore != nil {
+		objects = append(objects, opts.ReadOnlyStore.List()...)
+	}
 	for _, obj := range objects {
 		d.mu.versions.markFileNumUsed(obj.DiskFileNum)
 	}
@@ -469,7 +524,7 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 			break
 		}
 	}
-	var ve versionEdit
+	ve := versionEdit{NewFiles: storeFiles}
 	var toFlush flushableList
 	for i, lf := range replayWALs {
 		// WALs other than the last one would have been closed cleanly.
@@ -525,6 +580,10 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 	}
 	d.updateReadStateLocked(d.opts.DebugCheck)
 
+	if err := d.checkOpenIntegrity(); err != nil {
+		return nil, err
+	}
+
 	if !d.opts.ReadOnly {
 		// If the Options specify a format major version higher than the
 		// loaded database's, upgrade it. If this is a new database, this
@@ -594,6 +653,9 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 
 	d.maybeScheduleFlush()
 	d.maybeScheduleCompaction()
+	if !d.opts.ReadOnly && d.opts.ColdDataThreshold > 0 {
+		go d.checkColdDataPeriodically()
+	}
 
 	// Note: this is a no-op if invariants are disabled or race is enabled.
 	//
@@ -925,7 +987,7 @@ func (d *DB) replayWAL(
 							return nil, 0, errors.Wrap(err, "pebble: error when opening flushable ingest files")
 						}
 					} else {
-						path := base.MakeFilepath(d.opts.FS, d.dirname, fileTypeTable, n)
+						path := d.objProvider.Path(objMeta)
 						f, err := d.opts.FS.Open(path)
 						if err != nil {
 							return nil, 0, err
@@ -997,6 +1059,16 @@ func (d *DB) replayWAL(
 			}
 		}
 
+		// The sizes of the batch's keys may not have been persisted in the
+		// MANIFEST before the WAL was closed.
+		for r := b.Reader(); ; {
+			kind, ukey, value, ok, err := r.Next()
+			if !ok || err != nil {
+				break
+			}
+			d.mu.versions.raiseMaxKeySizes(writtenKeySizes(kind, ukey, value))
+		}
+
 		if b.memTableSize >= uint64(d.largeBatchThreshold) {
 			flushMem()
 			// Make a copy of the data slice since it is currently owned by buf and will
@@ -1238,6 +1310,73 @@ func (l *Lock) pathMatches(dirname string) error {
 		err1, err2)
 }
 
+// openDirs is the registry of the data directories of the DBs open in the
+// process, keyed by their absolute, symlink-resolved paths. POSIX file locks
+// are held by processes, so they don't prevent a process from opening a DB
+// that it already has open through a different path to the directory.
+var openDirs struct {
+	sync.Mutex
+	m map[string]struct{}
+}
+
+// registerOpenDir registers the data directory of a DB being opened in
+// openDirs, returning the key to pass to unregisterOpenDir once the DB is
+// closed. It returns ErrDBAlreadyOpen if the directory is already registered.
+// Only directories accessed through vfs.Default (or an FS that unwraps to it,
+// including the disk-health-checking FS of Options.WithFSDefaults) are
+// registered: the key is empty for other filesystems.
+func registerOpenDir(dirname string, fs vfs.FS) (string, error) {
+	for {
+		fs = vfs.Root(fs)
+		unwrapped := vfs.UnwrapDiskHealthChecks(fs)
+		if unwrapped == fs {
+			break
+		}
+		fs = unwrapped
+	}
+	if fs != vfs.Default {
+		return "", nil
+	}
+	key, err := filepath.Abs(dirname)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(key); err == nil {
+		key = resolved
+	}
+	openDirs.Lock()
+	defer openDirs.Unlock()
+	if _, ok := openDirs.m[key]; ok {
+		return "", errors.Wrapf(ErrDBAlreadyOpen, "dirname=%q", dirname)
+	}
+	if openDirs.m == nil {
+		openDirs.m = make(map[string]struct{})
+	}
+	openDirs.m[key] = struct{}{}
+	return key, nil
+}
+
+// unregisterOpenDir removes a data directory registered by registerOpenDir.
+func unregisterOpenDir(key string) {
+	if key == "" {
+		return
+	}
+	openDirs.Lock()
+	defer openDirs.Unlock()
+	delete(openDirs.m, key)
+}
+
+// sstablePathFunc adapts Options.SSTablePathFunc for the objstorage provider.
+func sstablePathFunc(opts *Options) func(fileNum base.DiskFileNum) string {
+	f := opts.SSTablePathFunc
+	if f == nil {
+		return nil
+	}
+	return func(fileNum base.DiskFileNum) string {
+		return f(base.FileNum(fileNum))
+	}
+}
+
 // ErrDBDoesNotExist is generated when ErrorIfNotExists is set and the database
 // does not exist.
 //
@@ -1250,6 +1389,10 @@ var ErrDBDoesNotExist = errors.New("pebble: database does not exist")
 // Note that errors can be wrapped with more details; use errors.Is().
 var ErrDBAlreadyExists = errors.New("pebble: database already exists")
 
+// ErrDBAlreadyOpen is generated when the database is already open within the
+// process, possibly through a different path to its directory.
+var ErrDBAlreadyOpen = errors.New("pebble: database is already open in this process")
+
 // ErrDBNotPristine is generated when ErrorIfNotPristine is set and the database
 // already exists and is not pristine.
 //
@@ -1302,6 +1445,56 @@ func checkConsistency(v *manifest.Version, dirname string, objProvider objstorag
 	return errors.Join(errs...)
 }
 
+// checkOpenIntegrity performs the sstable validation configured by
+// Options.OpenIntegrityChecks.
+func (d *DB) checkOpenIntegrity() error {
+	switch d.opts.OpenIntegrityChecks {
+	case OpenIntegrityChecksNone:
+		return nil
+	case OpenIntegrityChecksHeaders:
+		var errs []error
+		dedup := make(map[base.DiskFileNum]struct{})
+		for level, files := range d.mu.versions.currentVersion().Levels {
+			iter := files.Iter()
+			for f := iter.First(); f != nil; f = iter.Next() {
+				if _, ok := dedup[f.FileBacking.DiskFileNum]; ok {
+					continue
+				}
+				dedup[f.FileBacking.DiskFileNum] = struct{}{}
+				// Opening the sstable through the table cache reads its footer,
+				// metaindex and properties, after which the checksums of all of
+				// its blocks are validated, as for ingested sstables.
+				var err error
+				if f.Virtual {
+					err = d.tableCache.withVirtualReader(
+						f.VirtualMeta(), func(v sstable.VirtualReader) error {
+							return v.ValidateBlockChecksumsOnBacking()
+						})
+				} else {
+					err = d.tableCache.withReader(
+						f.PhysicalMeta(), func(r *sstable.Reader) error {
+							return r.ValidateBlockChecksums()
+						})
+				}
+				if err != nil {
+					errs = append(errs, errors.Wrapf(err, "L%d: %s", errors.Safe(level), f.FileNum))
+				}
+			}
+		}
+		if err := errors.Join(errs...); err != nil {
+			return errors.Wrap(err, "pebble: open integrity check failed")
+		}
+		return nil
+	case OpenIntegrityChecksFull:
+		if err := d.CheckLevels(&CheckLevelsStats{}); err != nil {
+			return errors.Wrap(err, "pebble: open integrity check failed")
+		}
+		return nil
+	default:
+		return errors.AssertionFailedf("pebble: unknown OpenIntegrityCheckLevel %d", d.opts.OpenIntegrityChecks)
+	}
+}
+
 type walEventListenerAdaptor struct {
 	l *EventListener
 }
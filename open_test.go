@@ -318,6 +318,42 @@ func TestOpenAlreadyLocked(t *testing.T) {
 	})
 }
 
+func TestOpenAlreadyOpenInProcess(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db")
+	link := filepath.Join(t.TempDir(), "link")
+	require.NoError(t, os.Mkdir(dir, 0755))
+	require.NoError(t, os.Symlink(dir, link))
+
+	opts := &Options{FS: vfs.Default}
+	d, err := Open(dir, opts)
+	require.NoError(t, err)
+	// Opening the DB again, whether through the same path or a symlink to it,
+	// fails.
+	_, err = Open(dir, opts)
+	require.ErrorIs(t, err, ErrDBAlreadyOpen)
+	_, err = Open(link, opts)
+	require.ErrorIs(t, err, ErrDBAlreadyOpen)
+	_, err = Open(filepath.Join(link, "..", "link", "."), opts)
+	require.ErrorIs(t, err, ErrDBAlreadyOpen)
+	require.NoError(t, d.Close())
+
+	// The DB may be reopened once it's closed.
+	d, err = Open(link, opts)
+	require.NoError(t, err)
+	require.NoError(t, d.Close())
+	d, err = Open(dir, opts)
+	require.NoError(t, err)
+	require.NoError(t, d.Close())
+
+	// The disk-health-checking FS wrapping vfs.Default is guarded too.
+	opts = (&Options{}).WithFSDefaults()
+	d, err = Open(dir, opts)
+	require.NoError(t, err)
+	_, err = Open(link, opts)
+	require.ErrorIs(t, err, ErrDBAlreadyOpen)
+	require.NoError(t, d.Close())
+}
+
 func TestNewDBFilenames(t *testing.T) {
 	versions := map[FormatMajorVersion][]string{
 		internalFormatNewest: {
@@ -325,7 +361,7 @@ func TestNewDBFilenames(t *testing.T) {
 			"LOCK",
 			"MANIFEST-000001",
 			"OPTIONS-000003",
-			"marker.format-version.000004.017",
+			"marker.format-version.000006.019",
 			"marker.manifest.000001.MANIFEST-000001",
 		},
 	}
@@ -1478,3 +1514,130 @@ func TestOpenRatchetsNextFileNum(t *testing.T) {
 	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
 
 }
+
+func TestOpenIntegrityChecks(t *testing.T) {
+	dir := t.TempDir()
+	d, err := Open(dir, &Options{DisableAutomaticCompactions: true})
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("a"), []byte("a"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("b"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Close())
+
+	ls, err := vfs.Default.List(dir)
+	require.NoError(t, err)
+	var sstPath string
+	for _, name := range ls {
+		if filepath.Ext(name) == ".sst" {
+			sstPath = filepath.Join(dir, name)
+		}
+	}
+	require.NotEmpty(t, sstPath)
+
+	open := func(level OpenIntegrityCheckLevel) error {
+		d, err := Open(dir, &Options{OpenIntegrityChecks: level})
+		if err != nil {
+			return err
+		}
+		return d.Close()
+	}
+	corrupt := func(fromEnd bool) {
+		f, err := os.OpenFile(sstPath, os.O_RDWR, os.ModePerm)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, f.Close()) }()
+		off := int64(0)
+		if fromEnd {
+			off, err = f.Seek(-4, 2)
+			require.NoError(t, err)
+		}
+		_, err = f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, off)
+		require.NoError(t, err)
+	}
+
+	for _, level := range []OpenIntegrityCheckLevel{
+		OpenIntegrityChecksNone, OpenIntegrityChecksHeaders, OpenIntegrityChecksFull,
+	} {
+		require.NoError(t, open(level), "%s", level)
+	}
+
+	// Corrupting the first data block is detected by validating its checksum.
+	corrupt(false /* fromEnd */)
+	require.NoError(t, open(OpenIntegrityChecksNone))
+	require.ErrorContains(t, open(OpenIntegrityChecksHeaders), "checksum mismatch")
+	require.Error(t, open(OpenIntegrityChecksFull))
+
+	// Corrupting the footer is detected by the headers check.
+	corrupt(true /* fromEnd */)
+	require.NoError(t, open(OpenIntegrityChecksNone))
+	require.Error(t, open(OpenIntegrityChecksHeaders))
+}
+
+func TestSSTablePathFunc(t *testing.T) {
+	fs := vfs.NewMem()
+	pathFunc := func(fileNum FileNum) string {
+		return fs.PathJoin(fmt.Sprintf("%02d", uint64(fileNum)%4), base.MakeFilename(fileTypeTable, base.DiskFileNum(fileNum)))
+	}
+	opts := &Options{FS: fs, SSTablePathFunc: pathFunc}
+	d, err := Open("db", opts)
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%d", i)), []byte("v"), nil))
+		require.NoError(t, d.Flush())
+	}
+	require.NoError(t, d.Compact([]byte("k"), []byte("l"), false /* parallelize */))
+	require.NoError(t, d.Set([]byte("k4"), []byte("v"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Checkpoint("checkpoint"))
+
+	// tables returns the paths of the sstables in the DB's directory, which are
+	// only those of the live sstables, at the paths returned by pathFunc.
+	var walk func(dirname string, paths []string) []string
+	walk = func(dirname string, paths []string) []string {
+		ls, err := fs.List(dirname)
+		require.NoError(t, err)
+		for _, name := range ls {
+			path := fs.PathJoin(dirname, name)
+			if fileType, _, ok := base.ParseFilename(fs, name); ok && fileType == fileTypeTable {
+				paths = append(paths, path)
+			} else if stat, err := fs.Stat(path); err == nil && stat.IsDir() {
+				paths = walk(path, paths)
+			}
+		}
+		return paths
+	}
+	tables := func(dirname string) []string {
+		paths := walk(dirname, nil)
+		sort.Strings(paths)
+		return paths
+	}
+	var want []string
+	tableInfos, err := d.SSTables()
+	require.NoError(t, err)
+	for _, infos := range tableInfos {
+		for _, info := range infos {
+			want = append(want, fs.PathJoin("db", pathFunc(info.FileNum)))
+		}
+	}
+	sort.Strings(want)
+	require.Len(t, want, 2)
+	require.Equal(t, want, tables("db"))
+	require.NoError(t, d.Close())
+
+	// The DB can only be reopened with the same SSTablePathFunc.
+	_, err = Open("db", &Options{FS: fs})
+	require.Error(t, err)
+	for _, dirname := range []string{"db", "checkpoint"} {
+		d, err := Open(dirname, opts)
+		require.NoError(t, err)
+		iter, err := d.NewIter(nil)
+		require.NoError(t, err)
+		var n int
+		for valid := iter.First(); valid; valid = iter.Next() {
+			n++
+		}
+		require.NoError(t, iter.Close())
+		require.Equal(t, 5, n)
+		require.NoError(t, d.Close())
+	}
+	require.Len(t, tables("checkpoint"), 2)
+}
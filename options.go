@@ -6,6 +6,7 @@ package pebble
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"runtime"
@@ -21,6 +22,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/humanize"
 	"github.com/cockroachdb/pebble/internal/keyspan"
 	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
 	"github.com/cockroachdb/pebble/objstorage/remote"
 	"github.com/cockroachdb/pebble/rangekey"
@@ -187,6 +189,66 @@ type IterOptions struct {
 	// existing is not low or if we just expect a one-time Seek (where loading the
 	// data block directly is better).
 	UseL6Filters bool
+	// PreferredStorageLocality, if set, identifies the object-store locality
+	// that reads of remote (e.g. shared) sstables performed by the iterator
+	// should prefer. It is only honored when the remote.Storage's object
+	// readers implement remote.LocalityAwareObjectReader; reads transparently
+	// fall back to the default replica when the locality is unavailable.
+	PreferredStorageLocality string
+	// SuffixReadAt, if set, configures the iterator to perform a read as of
+	// the version identified by the suffix, using the suffixes delineated by
+	// Comparer.Split. For each prefix, only the newest version whose suffix
+	// sorts at or after SuffixReadAt is surfaced, skipping newer versions and
+	// all older versions. With a comparer that orders newer versions first
+	// (e.g. CockroachDB's MVCC timestamps) this is the newest version with a
+	// timestamp <= the read timestamp. Keys without a suffix sort before every
+	// version and are skipped.
+	//
+	// SuffixReadAt only affects point keys, and is only honored by the
+	// SeekGE, SeekPrefixGE, SeekLT, First, Last, Next, NextPrefix and Prev
+	// methods; the *WithLimit variants ignore it. Next behaves like NextPrefix
+	// and is subject to the same restrictions on the upper bound.
+	SuffixReadAt []byte
+	// MaxMergeOperands, if positive, bounds the number of MERGE records the
+	// iterator merges to compute the value of a single key. Positioning the
+	// iterator at a key whose chain of MERGE records exceeds it makes the
+	// iterator invalid, with Error returning ErrTooManyMergeOperands.
+	MaxMergeOperands int
+	// Deadline, if non-zero, bounds the time for which the iterator may be
+	// used. Once the deadline has passed, positioning the iterator makes it
+	// invalid, with Error returning ErrIteratorDeadlineExceeded, and the
+	// iterator releases its internal iterators and the version it reads: it
+	// stays invalid until it's closed, and SetOptions can't revive it. The
+	// clock is checked once every few hundred internal keys the iterator steps
+	// over, rather than on every call, so the iterator may still be positioned
+	// shortly after the deadline. It's intended to bound how long a runaway
+	// scan can hold onto the version it reads, which prevents the deletion of
+	// the sstables that compactions made obsolete.
+	Deadline time.Time
+	// DistinctValues, if true, causes Iterator.Next to skip point keys whose
+	// values equal the value of the point key at the current position, per
+	// ValueEqual, so that iterating forward with Next visits each run of
+	// consecutive equal values once. Only Next is affected: the other
+	// positioning methods, including seeks, position the iterator as usual,
+	// and are not affected by the values of the surrounding keys. The skipped
+	// keys are still subject to the iterator's bounds and range key masking,
+	// and Next never skips a position without a point key or at which the
+	// range keys change.
+	DistinctValues bool
+	// ValueEqual, if set, is used to compare values for DistinctValues. If not
+	// set, values are compared with bytes.Equal.
+	ValueEqual func(a, b []byte) bool
+	// Tracer, if set, is invoked for every seek and step the Iterator's
+	// internal merging iterator performs on each of its levels (the batch, the
+	// memtables, and each L0 sublevel and lower level), recording the level,
+	// the sstable and the resulting key. It's intended for diagnosing
+	// pathological seek patterns; iterators without a Tracer incur no
+	// overhead. The slices within the event are only valid for the duration
+	// of the call; IterTrace.Record may be used to accumulate a timeline.
+	//
+	// Tracer is not supported by NewExternalIter or ScanInternal. Changing the
+	// Tracer through SetOptions reconstructs the iterator's internal state.
+	Tracer func(IterTraceEvent)
 	// CategoryAndQoS is used for categorized iterator stats. This should not be
 	// changed by calling SetOptions.
 	sstable.CategoryAndQoS
@@ -354,6 +416,11 @@ type BlockPropertyFilterMask interface {
 // Like Options, a nil *WriteOptions is valid and means to use the default
 // values.
 type WriteOptions struct {
+	// Context, if set, bounds the time the write may wait while batch commits
+	// are stalled by Options.L0ResumeWritesThreshold. If it's done before the
+	// stall ends, the write fails with its error.
+	Context context.Context
+
 	// Sync is whether to sync writes through the OS buffer cache and down onto
 	// the actual disk, if applicable. Setting Sync is required for durability of
 	// individual write operations but can result in slower writes.
@@ -381,6 +448,15 @@ func (o *WriteOptions) GetSync() bool {
 	return o == nil || o.Sync
 }
 
+// GetContext returns the Context value, or context.Background if the receiver
+// is nil or the Context is unset.
+func (o *WriteOptions) GetContext() context.Context {
+	if o == nil || o.Context == nil {
+		return context.Background()
+	}
+	return o.Context
+}
+
 // LevelOptions holds the optional per-level parameters.
 type LevelOptions struct {
 	// BlockRestartInterval is the number of keys between restart points
@@ -401,17 +477,46 @@ type LevelOptions struct {
 	// The default value is 90
 	BlockSizeThreshold int
 
+	// BlockSizeAlignment, if positive, aligns every block of the sstables
+	// written to the level to an offset that is a multiple of it, padding the
+	// preceding block with zeros. Setting it to the atomic write size of the
+	// device (typically 4096) avoids read-modify-write cycles on devices that
+	// must rewrite partially written pages, at the cost of the space used by
+	// the padding. The padding isn't part of any block, so checksums and block
+	// properties cover only the blocks' contents.
+	//
+	// The default value of 0 writes blocks contiguously.
+	BlockSizeAlignment int
+
 	// Compression defines the per-block compression to use.
 	//
 	// The default value (DefaultCompression) uses snappy compression.
 	Compression func() Compression
 
+	// CompressionDictionary, if non-empty, is a zstd dictionary used to
+	// compress the data blocks of sstables written to the level when
+	// Compression is ZstdCompression. Each sstable stores the dictionary it was
+	// written with, so the dictionary may be changed or removed at any time.
+	// The dictionary is ignored until the DB's format major version is at least
+	// FormatCompressionDictionaries. See
+	// sstable.WriterOptions.CompressionDictionary.
+	//
+	// The default value means not to use a dictionary.
+	CompressionDictionary []byte
+
 	// FilterPolicy defines a filter algorithm (such as a Bloom filter) that can
 	// reduce disk reads for Get calls.
 	//
 	// One such implementation is bloom.FilterPolicy(10) from the pebble/bloom
 	// package.
 	//
+	// The policy is applied to sstables written by flushes and compactions
+	// whose output level is this level, so different levels may use different
+	// bits-per-key, or no filter at all (e.g. for the bottommost level, where
+	// filters rarely pay for their space). Readers use whichever filter, if any,
+	// was recorded in each sstable's properties, so changing the policy of a
+	// level does not require rewriting existing tables.
+	//
 	// The default value means to use no filter.
 	FilterPolicy FilterPolicy
 
@@ -549,6 +654,50 @@ type Options struct {
 	// flushes, compactions, and table deletion.
 	EventListener *EventListener
 
+	// CompactionOutputValidator, if set, is invoked for every sstable output by
+	// a compaction that rewrites data (i.e. not for flushes, move or copy
+	// compactions), after the sstable has been written and synced but before
+	// the compaction's version edit is applied to the manifest. The level is
+	// the compaction's output level. If the validator returns an error, the
+	// compaction fails, its outputs are deleted and the input sstables remain
+	// in place; the compaction will be retried by a subsequent compaction pick
+	// (a manual compaction returns the error to the caller). The validator is
+	// called concurrently by concurrent compactions.
+	CompactionOutputValidator func(level int, info TableInfo, r *sstable.Reader) error
+
+	// CommitObserver, if set, is invoked for every committed batch with the
+	// first sequence number assigned to the batch. The batch's keys occupy the
+	// sequence numbers [firstSeqNum, firstSeqNum+b.Count()). The observer is
+	// invoked synchronously within the commit pipeline, after the batch has
+	// been assigned its sequence numbers and written to the WAL, but before it
+	// is applied to the memtable and becomes visible to readers. Invocations
+	// are serialized and occur in strictly increasing sequence number order,
+	// even across concurrent committers. CommitObserver is not invoked for
+	// ingested sstables, which also consume sequence numbers.
+	//
+	// The observer runs while holding the commit pipeline's mutex, so any time
+	// spent in it is added to the commit latency of every concurrent writer
+	// and directly reduces write throughput. Implementations should do the
+	// minimum amount of work necessary (e.g. append to an in-memory queue) and
+	// must not call back into the DB. The batch must not be modified or
+	// retained beyond the call.
+	CommitObserver func(b *Batch, firstSeqNum uint64)
+
+	// SeqNumAllocator, if set, is used by the commit pipeline to reserve the
+	// sequence numbers of every committed batch and ingestion, in place of the
+	// DB's internal counter. It allows the sequence numbers of several DBs to
+	// be drawn from a single monotonic space managed externally.
+	//
+	// This is an advanced option that is easy to misuse. See SeqNumAllocator
+	// for the requirements an allocator must satisfy. In particular, a DB's
+	// sequence numbers can't move backwards across restarts, so an allocator
+	// must never hand out a sequence number twice, e.g. by persisting its
+	// counter. Using a different allocator, or none, when reopening a DB is
+	// permitted only if it satisfies the same requirements. Violations are
+	// detected when sequence numbers are reserved, failing the commit or
+	// ingestion with an error.
+	SeqNumAllocator SeqNumAllocator
+
 	// Experimental contains experimental options which are off by default.
 	// These options are temporary and will eventually either be deleted, moved
 	// out of the experimental group, or made the non-adjustable default. These
@@ -832,6 +981,32 @@ type Options struct {
 	// tables are compacted to lower levels.
 	FlushSplitBytes int64
 
+	// FlushSelector, if set, selects the newest memtable to include in a flush
+	// when there are multiple immutable memtables ready to be flushed, such as
+	// to prioritize the memtable whose keys overlap the most L0 sstables. It's
+	// passed the ready memtables, oldest first, and returns the index of the
+	// selected one. Memtables must be flushed oldest first for their WALs to be
+	// reclaimed, so the flush includes the selected memtable and every older
+	// one; the others remain queued for a subsequent flush. A flushable batch is
+	// always flushed along with the memtable whose WAL it shares. Out of range
+	// indexes are rejected, with an error logged, and all the ready memtables
+	// are flushed.
+	//
+	// FlushSelector is invoked with DB.mu held, and computing the L0Overlaps of
+	// the candidates requires seeking within each memtable, so it should only
+	// be set when more than one memtable is expected to be queued. The default
+	// flushes all the ready memtables, oldest first.
+	FlushSelector func(candidates []MemtableInfo) int
+
+	// RecordSeekDistances enables Metrics.SeekDistanceHistogram. The distance
+	// of each monotonic SeekGE is measured by stepping the levels of the
+	// iterator forward to the seek key, up to 16 keys, before the seek is
+	// performed, which adds to the cost of such seeks and may read blocks that
+	// the seek would have skipped. It should only be enabled while analyzing
+	// the locality of a workload's seeks. The default is false, in which case
+	// the histogram is empty.
+	RecordSeekDistances bool
+
 	// FormatMajorVersion sets the format of on-disk files. It is
 	// recommended to set the format major version to an explicit
 	// version, as the default may change over time.
@@ -874,6 +1049,18 @@ type Options struct {
 	// sublevels. Writes are stopped when this threshold is reached.
 	L0StopWritesThreshold int
 
+	// L0ResumeWritesThreshold, if positive, extends the stall of writes at
+	// L0StopWritesThreshold to every batch commit and ingestion, rather than
+	// only to the writes that need a new memtable. Once the number of L0
+	// sublevels reaches L0StopWritesThreshold, new commits and ingestions block
+	// until compactions bring it below L0ResumeWritesThreshold, which must not
+	// exceed L0StopWritesThreshold. This applies backpressure to ingestions,
+	// which otherwise add sublevels to L0 regardless of the stall. Blocked
+	// writes may be canceled through WriteOptions.Context and
+	// DB.IngestWithContext. The time writes spend blocked is reported in
+	// Metrics.L0WriteStall.
+	L0ResumeWritesThreshold int
+
 	// The maximum number of bytes for LBase. The base level is the level which
 	// L0 is compacted into. The base level is determined dynamically based on
 	// the existing data in the LSM. The maximum number of bytes for other levels
@@ -895,6 +1082,15 @@ type Options struct {
 	// LoggerAndTracer is used for writing log messages and traces.
 	LoggerAndTracer LoggerAndTracer
 
+	// MaxBatchSize, if positive, configures DB.Apply to reject batches larger
+	// than this many bytes, as reported by Batch.Len, with
+	// ErrBatchExceedsMaxSize. A batch being committed is held in memory along
+	// with an index of its keys, so an oversized batch may exhaust memory. Large
+	// batches may instead be applied in parts with DB.ApplyChunked.
+	//
+	// The default value is 0, which imposes no limit.
+	MaxBatchSize int
+
 	// MaxManifestFileSize is the maximum size the MANIFEST file is allowed to
 	// become. When the MANIFEST exceeds this size it is rolled over and a new
 	// MANIFEST is created.
@@ -928,12 +1124,48 @@ type Options struct {
 	// The default value is 2.
 	MemTableStopWritesThreshold int
 
+	// MemTableMaxAge, if positive, bounds how long written data may remain in
+	// an unflushed memtable. A flush of a memtable is forced once its oldest
+	// entry is MemTableMaxAge old, regardless of the memtable's size. This
+	// bounds the amount of WAL that must be replayed on recovery for stores with
+	// a low write rate. Memtables that were never written to are not flushed.
+	// The age of the oldest unflushed entry is exposed as
+	// Metrics.MemTable.OldestEntryAge.
+	//
+	// The default value is 0, which disables age-based flushes.
+	MemTableMaxAge time.Duration
+
+	// MinFreeDiskBytes, if positive, configures writes to fail fast with
+	// ErrDiskFull whenever the free space on the disk holding the data
+	// directory, as reported by FS.GetDiskUsage, is below this many bytes. This
+	// avoids wedging the store by filling the disk. Flushes and compactions
+	// continue to run, so compactions that reclaim space can bring the free
+	// space back above the threshold. The free space estimate is refreshed at
+	// least once a second while writes are being attempted, and is exposed as
+	// Metrics.DiskAvailBytes.
+	//
+	// The default value is 0, which disables the check. The check also has no
+	// effect if the FS does not support GetDiskUsage.
+	MinFreeDiskBytes int64
+
 	// Merger defines the associative merge operation to use for merging values
 	// written with {Batch,DB}.Merge.
 	//
 	// The default merger concatenates values.
 	Merger *Merger
 
+	// MergeTableMetadata, if set, computes the table metadata (see
+	// CompactOptions.OutputMetadata) of the sstables output by a compaction
+	// from the metadata of its input sstables, in level order. Inputs without
+	// metadata are passed as nil maps. The function is called without DB.mu
+	// held. If the encoded result exceeds MaxTableMetadataSize, the outputs are
+	// written without metadata and an error is logged.
+	//
+	// If nil, table metadata doesn't survive compactions that rewrite the
+	// tables, other than manual compactions specifying OutputMetadata. Tables
+	// that are moved between levels keep their metadata regardless.
+	MergeTableMetadata func(inputs []map[string]string) map[string]string
+
 	// MaxConcurrentCompactions specifies the maximum number of concurrent
 	// compactions (not including download compactions).
 	//
@@ -947,6 +1179,13 @@ type Options struct {
 	// The default value is 1.
 	MaxConcurrentCompactions func() int
 
+	// CompactionConcurrencyPolicy, if set, determines the maximum number of
+	// concurrent compactions in place of MaxConcurrentCompactions, based on the
+	// current state of L0. See AdaptiveCompactionConcurrency for a built-in
+	// policy that scales with L0 debt. The chosen concurrency is exposed as
+	// Metrics.Compact.Concurrency.
+	CompactionConcurrencyPolicy CompactionConcurrencyPolicy
+
 	// MaxConcurrentDownloads specifies the maximum number of download
 	// compactions. These are compactions that copy an external file to the local
 	// store.
@@ -960,16 +1199,130 @@ type Options struct {
 	// The default value is 1.
 	MaxConcurrentDownloads func() int
 
+	// MaxCompactionInputFiles, if positive, bounds the number of input files of
+	// a compaction, to bound the time a single compaction occupies a compaction
+	// slot. The picker doesn't expand a compaction beyond the inputs it must
+	// include to the point of exceeding it, and manual compactions of key
+	// ranges with more input files are split into multiple compactions of
+	// contiguous key ranges. A compaction's minimal inputs, such as a file
+	// and the files it overlaps in the output level, are never split, so they
+	// may still exceed it. The number of input files of compactions is
+	// reported in Metrics.Compact.
+	MaxCompactionInputFiles int
+
 	// DisableAutomaticCompactions dictates whether automatic compactions are
 	// scheduled or not. The default is false (enabled). This option is only used
 	// externally when running a manual compaction, and internally for tests.
 	DisableAutomaticCompactions bool
 
+	// DeterministicCompaction removes the sources of nondeterminism from flushes
+	// and compactions that are independent of their inputs, so that given the
+	// same sequence of writes, flushes and manual compactions, with the same
+	// sequence numbers, a DB produces byte-identical sstables with the same file
+	// numbers. It's intended for building reproducible test corpora, such as
+	// for fuzzing. When set:
+	//
+	//   - At most one compaction runs at a time, regardless of
+	//     MaxConcurrentCompactions and CompactionConcurrencyPolicy, so the
+	//     compactions of a parallelized manual compaction run one after the
+	//     other and are assigned file numbers in a fixed order.
+	//   - The creation time recorded in the manifest for flush and compaction
+	//     outputs is zero rather than the wall-clock time.
+	//   - Reads are not sampled, so no read-triggered compactions are scheduled.
+	//
+	// The sstables themselves never record the wall-clock time (the
+	// "rocksdb.creation.time" property is always zero), and filters are built
+	// with a fixed hash function, so they need no further changes.
+	//
+	// Automatic compactions are scheduled according to the timing of flushes
+	// and of the asynchronous collection of table statistics, so reproducible
+	// output also requires DisableAutomaticCompactions, with the DB's shape
+	// driven by explicit calls to Flush and Compact. The cost of
+	// DeterministicCompaction is the loss of compaction concurrency.
+	DeterministicCompaction bool
+
+	// DeterministicFlushOutput is a testing option that makes the way a flush
+	// splits its output into sstables depend only on the data being flushed.
+	// Normally, a flush also splits its output at the flush split keys of the
+	// L0 sublevels (see FlushSplitBytes) and to limit the overlap of each
+	// output with the sstables in Lbase, both of which depend on the shape of
+	// the LSM when the flush runs, and so on the timing of prior flushes and
+	// compactions. When set, a flush's output is split only when it reaches
+	// the L0 TargetFileSize, so that the same memtable contents always flush
+	// to the same number and arrangement of sstables, in key order. It's
+	// intended for tests that assert on flush outputs, such as with
+	// CheckLevels, and can lead to more L0 read amplification and larger
+	// compactions out of L0.
+	DeterministicFlushOutput bool
+
+	// QueueManualCompactionsWhilePaused configures the behavior of manual
+	// compactions (DB.Compact, DB.CompactL0) requested while compactions are
+	// paused by DB.PauseCompactions. If false (the default), they fail with
+	// ErrCompactionsPaused. If true, they are queued and block until
+	// compactions are resumed.
+	QueueManualCompactionsWhilePaused bool
+
+	// SnapshotStripeCompactionWeight, if positive, enables compactions that
+	// rewrite sstables whose keys were split into stripes by open snapshots
+	// when they were written, once the snapshots have been released. While a
+	// snapshot is open, a flush or compaction must preserve the newest version
+	// of each key visible to the snapshot in addition to the newest version
+	// overall, so each snapshot whose sequence number falls within an
+	// sstable's sequence number range may leave it with another version of
+	// the keys it overwrites. Rewriting the sstable after the snapshots are
+	// released drops these versions.
+	//
+	// An sstable's score is the number of snapshots that split it and have
+	// since been released, multiplied by SnapshotStripeCompactionWeight, and
+	// sstables with a score of at least 1 are rewritten, highest score first,
+	// when no level needs a score-based compaction. For example, a weight of
+	// 0.5 rewrites sstables once two of their snapshots are released. Only
+	// snapshots open when the sstable was written by this process are
+	// counted. The default is 0 (disabled).
+	SnapshotStripeCompactionWeight float64
+
+	// ColdDataThreshold, if positive, enables cold data compactions, which
+	// demote rarely read sstables to the cheaper storage tier configured by
+	// Experimental.RemoteStorage and Experimental.CreateOnSharedLocator. An
+	// sstable is cold if it has been read fewer than ColdDataThreshold times
+	// per ColdDataPeriod, on average, since it was created or the DB was
+	// opened, whichever is later, and it has existed for at least one period.
+	// A read is counted each time an iterator or Get opens the sstable.
+	//
+	// Cold sstables stored locally are rewritten in place onto shared storage,
+	// one at a time, when no level needs a score-based compaction. Cold data
+	// that becomes hot again returns to local storage once it is compacted
+	// into a level that isn't stored on shared storage. Read counts aren't
+	// persisted, so they start over when the DB is reopened. Requires
+	// Experimental.CreateOnShared to be set. The default is 0 (disabled).
+	ColdDataThreshold float64
+	// ColdDataPeriod is the period over which reads are counted by
+	// ColdDataThreshold. The DB also checks for cold sstables once per period.
+	// The default is one hour.
+	ColdDataPeriod time.Duration
+
+	// ValidateRangeBounds, if true, makes Batch.DeleteRange,
+	// Batch.RangeKeySet, Batch.RangeKeyUnset and Batch.RangeKeyDelete, and the
+	// DB methods of the same names, return an error wrapping ErrInvalidBatch if
+	// the start key isn't less than the end key, instead of writing an empty
+	// or inverted span. Such spans are usually the result of an application
+	// bug, and would otherwise be silently ignored by reads and compactions.
+	// Batches not created by the DB aren't validated. The default is false,
+	// which adds no overhead to writes.
+	ValidateRangeBounds bool
+
 	// DisableConsistencyCheck disables the consistency check that is performed on
 	// open. Should only be used when a database cannot be opened normally (e.g.
 	// some of the tables don't exist / aren't accessible).
 	DisableConsistencyCheck bool
 
+	// OpenIntegrityChecks configures additional validation of the sstables
+	// referenced by the current version that is performed during Open, after
+	// the MANIFEST and WAL have been replayed. See OpenIntegrityCheckLevel. If
+	// any check fails, Open returns an error. The default is
+	// OpenIntegrityChecksNone.
+	OpenIntegrityChecks OpenIntegrityCheckLevel
+
 	// DisableTableStats dictates whether tables should be loaded asynchronously
 	// to compute statistics that inform compaction heuristics. The collection
 	// of table stats improves compaction of tombstones, reclaiming disk space
@@ -990,12 +1343,114 @@ type Options struct {
 	// to keep one older manifest.
 	NumPrevManifest int
 
+	// RangeStatsBuckets, if set, are the boundaries of ranges of keys whose
+	// read and write counts are reported by DB.RangeStats, for detecting hot
+	// spots. The boundaries must be sorted by the Comparer and unique: n
+	// boundaries delimit n+1 ranges, the first and last of which are unbounded.
+	// Counting costs a binary search over the boundaries for every key read or
+	// written, so their number should be modest.
+	//
+	// The default value collects no statistics.
+	RangeStatsBuckets [][]byte
+
 	// ReadOnly indicates that the DB should be opened in read-only mode. Writes
 	// to the DB will return an error, background compactions are disabled, and
 	// the flush that normally occurs after replaying the WAL at startup is
 	// disabled.
 	ReadOnly bool
 
+	// ReadOnlyStore, if set, supplies immutable sstables that are layered
+	// beneath the DB's own. When the DB is created, every sstable in the store
+	// is added to the LSM, with overlapping sstables placed in levels according
+	// to their sequence numbers, which mustn't interleave. The WAL, memtable
+	// flushes and compaction outputs are all written to the local FS, and
+	// reads merge both. The store's objects are never written or removed by
+	// the DB, though a compaction may rewrite their contents into local
+	// sstables. The store must continue to supply the same objects whenever
+	// the DB is reopened, and is not closed by the DB. Checkpoints are not
+	// supported.
+	ReadOnlyStore objstorage.Provider
+
+	// ReadRepairFunc, if set, is consulted when a block read from an sstable
+	// fails checksum verification, to fetch a good copy of the block from a
+	// redundant source such as a replica on shared storage. It's passed the
+	// file number of the physical sstable (the backing sstable of virtual
+	// tables), and the offset and length of the block in that file, including
+	// the block trailer. If it returns the requested number of bytes and they
+	// pass checksum verification, the read proceeds with them; otherwise the
+	// read fails with the original corruption error.
+	//
+	// ReadRepairFunc may be called concurrently, from any goroutine that reads
+	// sstables.
+	ReadRepairFunc func(fileNum FileNum, offset int64, length int) ([]byte, error)
+
+	// FaultInjector, if set, is consulted before each block read from an
+	// sstable that misses the block cache, allowing read errors and slow reads
+	// to be simulated for resilience testing. See FaultInjector.
+	FaultInjector FaultInjector
+
+	// ReadRepairPatchLocalFiles, if true, causes blocks repaired by
+	// ReadRepairFunc to also be written back to the local sstable, so that
+	// subsequent reads of the block don't need to be repaired. Patching is
+	// best-effort: failures are logged and otherwise ignored, and sstables on
+	// shared or external storage are never patched. A patched sstable is
+	// replaced by a patched copy rather than modified in place, so hard links
+	// to it, such as those of checkpoints, are unaffected.
+	ReadRepairPatchLocalFiles bool
+
+	// SSTablePathFunc, if set, maps the file number of a local sstable to its
+	// path relative to the DB's directory, allowing sstables to be sharded
+	// across subdirectories on filesystems that slow down with many files per
+	// directory. For example, it may hash the file number into one of 256
+	// subdirectories. The last element of the path must be the sstable's
+	// standard file name, such as "000123.sst", and subdirectories are created
+	// as needed.
+	//
+	// The MANIFEST only records file numbers, so SSTablePathFunc must return
+	// the same path for a file number across restarts, and must be set
+	// whenever the DB is opened: sstables at other paths are not found.
+	// Checkpoints place sstables at the same paths within the checkpoint
+	// directory, and must be opened with the same SSTablePathFunc. Sstables on
+	// shared or external storage are not affected.
+	SSTablePathFunc func(fileNum FileNum) string
+
+	// CompactionDebugBreakpoint is a testing hook for debugging compactions,
+	// and must not be set in production. If set, it's called with the user key
+	// of each point key written to the output of a compaction, other than a
+	// flush. When it returns true, the compaction pauses before writing any
+	// further keys, and a CompactionBreakpoint is sent on the channel returned
+	// by DB.CompactionBreakpoints, which the compaction waits on until it's
+	// resumed. While paused, the compaction holds on to its inputs and
+	// partially written outputs, and blocks other compactions of the same
+	// files, so every CompactionBreakpoint must be received and resumed.
+	// Closing the DB resumes paused compactions.
+	//
+	// CompactionDebugBreakpoint may be called concurrently by compactions
+	// running in parallel.
+	CompactionDebugBreakpoint func(outputKey []byte) bool
+
+	// CompactionProgressFunc, if set, is called periodically by compactions,
+	// other than flushes, with their progress so far, at most about once per
+	// second per compaction. It's called by the compaction's goroutine without
+	// holding any of the DB's locks, and the compaction doesn't proceed until
+	// it returns, so it should be quick. It may be called concurrently by
+	// compactions running in parallel.
+	CompactionProgressFunc func(CompactionProgress)
+
+	// ObjStoreRetryPolicy configures the retrying of block reads of sstables
+	// on remote storage that fail with transient errors, such as unavailability
+	// of the object store. By default, failed reads are not retried. Retries
+	// are reported in Metrics.ObjStore.
+	ObjStoreRetryPolicy ObjStoreRetryPolicy
+
+	// ComputeTableContentHash, if true, has every sstable written by the DB
+	// record a hash of its keys and values, excluding sequence numbers, in its
+	// properties. Sstables with equal hashes almost certainly hold the same
+	// data, so comparisons of DBs may skip sstables whose hashes match. The
+	// hash is exposed as SSTableInfo.ContentHash. Sstables written before the
+	// option was set, and ingested sstables written without it, have no hash.
+	ComputeTableContentHash bool
+
 	// TableCache is an initialized TableCache which should be set as an
 	// option if the DB needs to be initialized with a pre-existing table cache.
 	// If TableCache is nil, then a table cache which is unique to the DB instance
@@ -1055,6 +1510,18 @@ type Options struct {
 	// changing options dynamically?
 	WALMinSyncInterval func() time.Duration
 
+	// WALSyncCoalesceDuration, if positive, is the duration for which the WAL
+	// waits after a commit requests a sync before syncing, so that the commits
+	// that request a sync in the meantime share the same fsync. This trades
+	// up to WALSyncCoalesceDuration of added commit latency for fewer fsyncs
+	// when many goroutines commit small batches with Sync, complementing the
+	// coalescing of the commit pipeline, which only groups the commits that
+	// queue up while the previous fsync is in progress. Unlike
+	// WALMinSyncInterval, the wait applies even if the last sync was long ago.
+	// The ratio achieved is reported by Metrics.LogWriter.SyncsPerFsync. The
+	// default value of 0 syncs without waiting.
+	WALSyncCoalesceDuration time.Duration
+
 	// TargetByteDeletionRate is the rate (in bytes per second) at which sstable file
 	// deletions are limited to (under normal circumstances).
 	//
@@ -1103,6 +1570,10 @@ type Options struct {
 		// obsolete file deletion (to make events deterministic).
 		testingAlwaysWaitForCleanup bool
 
+		// compactionProgressInterval, if nonzero, overrides the minimum interval
+		// between calls to CompactionProgressFunc by a compaction, for tests.
+		compactionProgressInterval time.Duration
+
 		// fsCloser holds a closer that should be invoked after a DB using these
 		// Options is closed. This is used to automatically stop the
 		// long-running goroutine associated with the disk-health-checking FS.
@@ -1115,6 +1586,58 @@ type Options struct {
 	}
 }
 
+// ObjStoreRetryPolicy configures the retrying of failed reads of sstables on
+// remote storage; see Options.ObjStoreRetryPolicy.
+type ObjStoreRetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts at a read, including the
+	// first. If it is 0 or 1, failed reads are not retried.
+	MaxAttempts int
+	// InitialBackoff is the time to wait before the first retry. The wait
+	// doubles with each subsequent retry, up to MaxBackoff. If it is 0, the
+	// default of 10ms is used.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum time to wait between attempts. If it is 0, the
+	// default of 1s is used.
+	MaxBackoff time.Duration
+	// IsRetryable, if set, returns whether a read that failed with the given
+	// error is transient and should be retried. If not set, all errors are
+	// retried other than those for which the remote.Storage's IsNotExistError
+	// returns true, corruption errors, and errors due to the cancellation of
+	// the read's context.
+	IsRetryable func(err error) bool
+}
+
+// SeqNumAllocator reserves sequence numbers for a DB; see
+// Options.SeqNumAllocator.
+type SeqNumAllocator interface {
+	// Next reserves count consecutive sequence numbers and returns the first
+	// of them. Next is called serially by the commit pipeline, while holding
+	// its mutex, so it should be fast and must not call back into the DB.
+	//
+	// The reserved sequence numbers must be larger than every sequence number
+	// previously reserved for the DB, and than the largest sequence number
+	// recovered when the DB was opened. Gaps between successive reservations,
+	// e.g. due to reservations made for other DBs, are permitted. The
+	// sequence numbers must also be smaller than 1<<55, above which sequence
+	// numbers are reserved for batches.
+	Next(count uint64) uint64
+}
+
+// FaultInjector injects faults into the reads of sstable blocks, for testing
+// that errors and slow reads are handled gracefully; see
+// Options.FaultInjector. Its methods are passed the file number of the
+// physical sstable (the backing sstable of virtual tables), and may be called
+// concurrently, from any goroutine that reads sstables, including those
+// running compactions and CheckLevels.
+type FaultInjector interface {
+	// BeforeRead is called before a block is read from the sstable. If it
+	// returns an error, the read fails with that error.
+	BeforeRead(fileNum FileNum) error
+	// ReadLatency returns the duration by which to delay the read of a block
+	// from the sstable, simulating a slow disk.
+	ReadLatency(fileNum FileNum) time.Duration
+}
+
 // WALFailoverOptions configures the WAL failover mechanics to use during
 // transient write unavailability on the primary WAL volume.
 type WALFailoverOptions struct {
@@ -1130,6 +1653,39 @@ type WALFailoverOptions struct {
 // ReadaheadConfig controls the use of read-ahead.
 type ReadaheadConfig = objstorageprovider.ReadaheadConfig
 
+// OpenIntegrityCheckLevel configures the validation of sstables performed by
+// Open; see Options.OpenIntegrityChecks. The levels trade off the time it takes
+// to open a DB for the strength of the validation.
+type OpenIntegrityCheckLevel int8
+
+const (
+	// OpenIntegrityChecksNone performs no sstable validation beyond the
+	// existence and size check of local sstables (see
+	// Options.DisableConsistencyCheck).
+	OpenIntegrityChecksNone OpenIntegrityCheckLevel = iota
+	// OpenIntegrityChecksHeaders opens every sstable referenced by the current
+	// version, reading its footer, metaindex and properties blocks, and
+	// validates the checksums of all of its blocks without decoding them.
+	OpenIntegrityChecksHeaders
+	// OpenIntegrityChecksFull runs DB.CheckLevels, which reads every key in
+	// the DB and verifies the level invariants.
+	OpenIntegrityChecksFull
+)
+
+// String implements fmt.Stringer.
+func (l OpenIntegrityCheckLevel) String() string {
+	switch l {
+	case OpenIntegrityChecksNone:
+		return "none"
+	case OpenIntegrityChecksHeaders:
+		return "headers"
+	case OpenIntegrityChecksFull:
+		return "full"
+	default:
+		return fmt.Sprintf("OpenIntegrityCheckLevel(%d)", int8(l))
+	}
+}
+
 // DebugCheckLevels calls CheckLevels on the provided database.
 // It may be set in the DebugCheck field of Options to check
 // level invariants whenever a new version is installed.
@@ -1164,6 +1720,9 @@ func (o *Options) EnsureDefaults() *Options {
 	if o.Experimental.KeyValidationFunc == nil {
 		o.Experimental.KeyValidationFunc = func([]byte) error { return nil }
 	}
+	if o.ColdDataPeriod <= 0 {
+		o.ColdDataPeriod = time.Hour
+	}
 	if o.L0CompactionThreshold <= 0 {
 		o.L0CompactionThreshold = 4
 	}
@@ -1447,6 +2006,9 @@ func (o *Options) String() string {
 		fmt.Fprintf(&buf, "  block_restart_interval=%d\n", l.BlockRestartInterval)
 		fmt.Fprintf(&buf, "  block_size=%d\n", l.BlockSize)
 		fmt.Fprintf(&buf, "  block_size_threshold=%d\n", l.BlockSizeThreshold)
+		if l.BlockSizeAlignment != 0 {
+			fmt.Fprintf(&buf, "  block_size_alignment=%d\n", l.BlockSizeAlignment)
+		}
 		fmt.Fprintf(&buf, "  compression=%s\n", resolveDefaultCompression(l.Compression()))
 		fmt.Fprintf(&buf, "  filter_policy=%s\n", filterPolicyName(l.FilterPolicy))
 		fmt.Fprintf(&buf, "  filter_type=%s\n", l.FilterType)
@@ -1810,6 +2372,8 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				l.BlockSize, err = strconv.Atoi(value)
 			case "block_size_threshold":
 				l.BlockSizeThreshold, err = strconv.Atoi(value)
+			case "block_size_alignment":
+				l.BlockSizeAlignment, err = strconv.Atoi(value)
 			case "compression":
 				switch value {
 				case "Default":
@@ -1921,6 +2485,10 @@ func (o *Options) Validate() error {
 		fmt.Fprintf(&buf, "L0StopWritesThreshold (%d) must be >= L0CompactionThreshold (%d)\n",
 			o.L0StopWritesThreshold, o.L0CompactionThreshold)
 	}
+	if o.L0ResumeWritesThreshold > o.L0StopWritesThreshold {
+		fmt.Fprintf(&buf, "L0ResumeWritesThreshold (%d) must be <= L0StopWritesThreshold (%d)\n",
+			o.L0ResumeWritesThreshold, o.L0StopWritesThreshold)
+	}
 	if uint64(o.MemTableSize) >= maxMemTableSize {
 		fmt.Fprintf(&buf, "MemTableSize (%s) must be < %s\n",
 			humanize.Bytes.Uint64(uint64(o.MemTableSize)), humanize.Bytes.Uint64(maxMemTableSize))
@@ -1938,6 +2506,23 @@ func (o *Options) Validate() error {
 			o.FormatMajorVersion, FormatMinForSharedObjects)
 
 	}
+	for i := 1; i < len(o.RangeStatsBuckets); i++ {
+		if o.Comparer.Compare(o.RangeStatsBuckets[i-1], o.RangeStatsBuckets[i]) >= 0 {
+			fmt.Fprintf(&buf, "RangeStatsBuckets must be sorted and unique: %q precedes %q\n",
+				o.RangeStatsBuckets[i-1], o.RangeStatsBuckets[i])
+			break
+		}
+	}
+	if o.SnapshotStripeCompactionWeight < 0 {
+		fmt.Fprintf(&buf, "SnapshotStripeCompactionWeight (%g) must be >= 0\n",
+			o.SnapshotStripeCompactionWeight)
+	}
+	if o.ColdDataThreshold < 0 {
+		fmt.Fprintf(&buf, "ColdDataThreshold (%g) must be >= 0\n", o.ColdDataThreshold)
+	}
+	if o.ColdDataThreshold > 0 && o.Experimental.CreateOnShared == remote.CreateOnSharedNone {
+		fmt.Fprintf(&buf, "ColdDataThreshold requires CreateOnShared to be set\n")
+	}
 	if o.TableCache != nil && o.Cache != o.TableCache.cache {
 		fmt.Fprintf(&buf, "underlying cache in the TableCache and the Cache dont match\n")
 	}
@@ -1961,6 +2546,19 @@ func (o *Options) MakeReaderOptions() sstable.ReaderOptions {
 			readerOpts.MergerName = o.Merger.Name
 		}
 		readerOpts.LoggerAndTracer = o.LoggerAndTracer
+		if repair := o.ReadRepairFunc; repair != nil {
+			readerOpts.ReadRepair = func(fileNum base.DiskFileNum, offset int64, length int) ([]byte, error) {
+				return repair(base.PhysicalTableFileNum(fileNum), offset, length)
+			}
+		}
+		if fi := o.FaultInjector; fi != nil {
+			readerOpts.BeforeRead = func(fileNum base.DiskFileNum) error {
+				return fi.BeforeRead(base.PhysicalTableFileNum(fileNum))
+			}
+			readerOpts.ReadLatency = func(fileNum base.DiskFileNum) time.Duration {
+				return fi.ReadLatency(base.PhysicalTableFileNum(fileNum))
+			}
+		}
 	}
 	return readerOpts
 }
@@ -1989,11 +2587,16 @@ func (o *Options) MakeWriterOptions(level int, format sstable.TableFormat) sstab
 	writerOpts.BlockRestartInterval = levelOpts.BlockRestartInterval
 	writerOpts.BlockSize = levelOpts.BlockSize
 	writerOpts.BlockSizeThreshold = levelOpts.BlockSizeThreshold
+	writerOpts.BlockSizeAlignment = levelOpts.BlockSizeAlignment
 	writerOpts.Compression = resolveDefaultCompression(levelOpts.Compression())
+	if format >= sstable.TableFormatPebblev5 {
+		writerOpts.CompressionDictionary = levelOpts.CompressionDictionary
+	}
 	writerOpts.FilterPolicy = levelOpts.FilterPolicy
 	writerOpts.FilterType = levelOpts.FilterType
 	writerOpts.IndexBlockSize = levelOpts.IndexBlockSize
 	writerOpts.AllocatorSizeClasses = o.AllocatorSizeClasses
+	writerOpts.ComputeContentHash = o.ComputeTableContentHash
 	return writerOpts
 }
 
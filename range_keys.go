@@ -223,9 +223,12 @@ func containsAnyRangeKeys(iter manifest.LevelIterator) bool {
 // result is ignored, and the block is read.
 
 type rangeKeyMasking struct {
-	cmp    base.Compare
-	split  base.Split
-	filter BlockPropertyFilterMask
+	cmp base.Compare
+	// compareSuffixes is Comparer.CompareRangeSuffixes, used for all
+	// comparisons of suffixes.
+	compareSuffixes base.CompareRangeSuffixes
+	split           base.Split
+	filter          BlockPropertyFilterMask
 	// maskActiveSuffix holds the suffix of a range key currently acting as a
 	// mask, hiding point keys with suffixes greater than it. maskActiveSuffix
 	// is only ever non-nil if IterOptions.RangeKeyMasking.Suffix is non-nil.
@@ -238,12 +241,16 @@ type rangeKeyMasking struct {
 	// The span is used for bounds comparisons, to ensure that a range-key mask
 	// is not applied beyond the bounds of the range key.
 	maskSpan *keyspan.Span
-	parent   *Iterator
+	// maskedPoints counts the point keys skipped by SkipPoint since the last
+	// absolute positioning operation. See Iterator.MaskedKeyCount.
+	maskedPoints int
+	parent       *Iterator
 }
 
-func (m *rangeKeyMasking) init(parent *Iterator, cmp base.Compare, split base.Split) {
-	m.cmp = cmp
-	m.split = split
+func (m *rangeKeyMasking) init(parent *Iterator, comparer *base.Comparer) {
+	m.cmp = comparer.Compare
+	m.compareSuffixes = comparer.CompareRangeSuffixes
+	m.split = comparer.Split
 	if parent.opts.RangeKeyMasking.Filter != nil {
 		m.filter = parent.opts.RangeKeyMasking.Filter()
 	}
@@ -268,10 +275,10 @@ func (m *rangeKeyMasking) SpanChanged(s *keyspan.Span) {
 				if s.Keys[j].Suffix == nil {
 					continue
 				}
-				if m.cmp(s.Keys[j].Suffix, m.parent.opts.RangeKeyMasking.Suffix) < 0 {
+				if m.compareSuffixes(s.Keys[j].Suffix, m.parent.opts.RangeKeyMasking.Suffix) < 0 {
 					continue
 				}
-				if len(m.maskActiveSuffix) == 0 || m.cmp(m.maskActiveSuffix, s.Keys[j].Suffix) > 0 {
+				if len(m.maskActiveSuffix) == 0 || m.compareSuffixes(m.maskActiveSuffix, s.Keys[j].Suffix) > 0 {
 					m.maskSpan = s
 					m.maskActiveSuffix = append(m.maskActiveSuffix[:0], s.Keys[j].Suffix...)
 				}
@@ -350,8 +357,9 @@ func (m *rangeKeyMasking) SkipPoint(userKey []byte) bool {
 	// the InterleavingIter). Skip the point key if the range key's suffix is
 	// greater than the point key's suffix.
 	pointSuffix := userKey[m.split(userKey):]
-	if len(pointSuffix) > 0 && m.cmp(m.maskActiveSuffix, pointSuffix) < 0 {
+	if len(pointSuffix) > 0 && m.compareSuffixes(m.maskActiveSuffix, pointSuffix) < 0 {
 		m.parent.stats.RangeKeyStats.SkippedPoints++
+		m.maskedPoints++
 		return true
 	}
 	return false
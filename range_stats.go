@@ -0,0 +1,113 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// RangeStat holds the read and write counts of a range of keys, one of the
+// buckets defined by Options.RangeStatsBuckets.
+type RangeStat struct {
+	// Start is the inclusive start of the range, or nil for the first range.
+	Start []byte
+	// End is the exclusive end of the range, or nil for the last range.
+	End []byte
+	// Reads is the number of point lookups of keys in the range by Get, and of
+	// seeks of iterators to keys in the range.
+	Reads uint64
+	// Writes is the number of keys in the range written by committed batches.
+	// For range deletions and range keys, which cover many keys, only their
+	// start key is counted.
+	Writes uint64
+}
+
+// rangeStats accumulates the read and write counts of the ranges of keys
+// delimited by a sorted list of boundaries. A nil *rangeStats discards all
+// counts, so the hot paths may record counts unconditionally.
+type rangeStats struct {
+	cmp        Compare
+	boundaries [][]byte
+	// counts has the counts of len(boundaries)+1 ranges: the range preceding
+	// boundaries[0], the ranges between consecutive boundaries and the range
+	// from the last boundary on.
+	counts []struct {
+		reads  atomic.Uint64
+		writes atomic.Uint64
+	}
+}
+
+// newRangeStats returns a rangeStats for the given boundaries, or nil if there
+// are none. The boundaries must be sorted and unique, which Options.Validate
+// ensures.
+func newRangeStats(cmp Compare, boundaries [][]byte) *rangeStats {
+	if len(boundaries) == 0 {
+		return nil
+	}
+	s := &rangeStats{cmp: cmp, boundaries: make([][]byte, len(boundaries))}
+	for i, b := range boundaries {
+		s.boundaries[i] = append([]byte(nil), b...)
+	}
+	s.counts = make([]struct {
+		reads  atomic.Uint64
+		writes atomic.Uint64
+	}, len(boundaries)+1)
+	return s
+}
+
+// bucket returns the index of the range containing key.
+func (s *rangeStats) bucket(key []byte) int {
+	return sort.Search(len(s.boundaries), func(i int) bool {
+		return s.cmp(s.boundaries[i], key) > 0
+	})
+}
+
+// recordRead counts a read of key.
+func (s *rangeStats) recordRead(key []byte) {
+	if s != nil {
+		s.counts[s.bucket(key)].reads.Add(1)
+	}
+}
+
+// recordBatch counts the writes of the keys in the batch.
+func (s *rangeStats) recordBatch(b *Batch) {
+	if s == nil {
+		return
+	}
+	for r := b.Reader(); ; {
+		_, key, _, ok, err := r.Next()
+		if !ok || err != nil {
+			return
+		}
+		s.counts[s.bucket(key)].writes.Add(1)
+	}
+}
+
+// RangeStats returns the read and write counts of each of the ranges of keys
+// defined by Options.RangeStatsBuckets since the DB was opened, in key order.
+// It returns nil if Options.RangeStatsBuckets is empty. The bounds of the
+// ranges must not be modified.
+//
+// The counts are incremented independently, so they may not reflect a single
+// point in time if the DB is being read or written concurrently.
+func (d *DB) RangeStats() []RangeStat {
+	s := d.rangeStats
+	if s == nil {
+		return nil
+	}
+	stats := make([]RangeStat, len(s.counts))
+	for i := range stats {
+		if i > 0 {
+			stats[i].Start = s.boundaries[i-1]
+		}
+		if i < len(s.boundaries) {
+			stats[i].End = s.boundaries[i]
+		}
+		stats[i].Reads = s.counts[i].reads.Load()
+		stats[i].Writes = s.counts[i].writes.Load()
+	}
+	return stats
+}
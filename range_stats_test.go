@@ -0,0 +1,68 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRangeStats(t *testing.T) {
+	_, err := Open("", &Options{FS: vfs.NewMem(), RangeStatsBuckets: [][]byte{[]byte("m"), []byte("c")}})
+	require.ErrorContains(t, err, "RangeStatsBuckets must be sorted and unique")
+
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("a"), nil, nil))
+	require.Nil(t, d.RangeStats())
+	require.NoError(t, d.Close())
+
+	d, err = Open("", &Options{FS: vfs.NewMem(), RangeStatsBuckets: [][]byte{[]byte("c"), []byte("m")}})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Writes.
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("c"), []byte("2"), nil))
+	require.NoError(t, b.Merge([]byte("d"), []byte("3"), nil))
+	require.NoError(t, b.DeleteRange([]byte("l"), []byte("z"), nil))
+	require.NoError(t, d.Apply(b, nil))
+	require.NoError(t, d.Set([]byte("x"), []byte("4"), nil))
+
+	// Reads.
+	for _, k := range []string{"a", "b", "m", "z"} {
+		_, closer, err := d.Get([]byte(k))
+		if err == nil {
+			require.NoError(t, closer.Close())
+		}
+	}
+	iter, err := d.NewIter(nil)
+	require.NoError(t, err)
+	iter.SeekGE([]byte("c"))
+	iter.SeekLT([]byte("n"))
+	iter.SeekPrefixGE([]byte("d"))
+	iter.First()
+	iter.Next()
+	clone, err := iter.Clone(CloneOptions{})
+	require.NoError(t, err)
+	clone.SeekGE([]byte("y"))
+	require.NoError(t, clone.Close())
+	require.NoError(t, iter.Close())
+	// Iterators over only a batch don't read the DB.
+	biter, err := d.NewIndexedBatch().NewBatchOnlyIter(context.Background(), nil)
+	require.NoError(t, err)
+	biter.SeekGE([]byte("a"))
+	require.NoError(t, biter.Close())
+
+	require.Equal(t, []RangeStat{
+		{Start: nil, End: []byte("c"), Reads: 2, Writes: 1},
+		{Start: []byte("c"), End: []byte("m"), Reads: 2, Writes: 3},
+		{Start: []byte("m"), End: nil, Reads: 4, Writes: 1},
+	}, d.RangeStats())
+}
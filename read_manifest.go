@@ -0,0 +1,135 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"cmp"
+	"io"
+	"slices"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/record"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// VersionEdit is a decoded record of a MANIFEST, describing one change to the
+// LSM: the sstables it adds and removes, and the DB state recorded alongside
+// them. It's passed to the callback of ReadManifest.
+type VersionEdit struct {
+	// ComparerName is the name of the DB's comparer. It's only set in the
+	// first edit of a MANIFEST.
+	ComparerName string
+	// MinUnflushedLogNum is the smallest WAL file number whose writes have not
+	// been flushed to an sstable, or zero if unchanged by the edit.
+	MinUnflushedLogNum base.DiskFileNum
+	// NextFileNum is the next file number to be assigned, or zero if unchanged
+	// by the edit.
+	NextFileNum uint64
+	// LastSeqNum is an upper bound on the sequence numbers assigned in the
+	// flushed WALs, or zero if unchanged by the edit.
+	LastSeqNum uint64
+	// NewFiles are the sstables added by the edit.
+	NewFiles []VersionEditNewFile
+	// DeletedFiles are the sstables removed by the edit, ordered by level and
+	// file number.
+	DeletedFiles []VersionEditDeletedFile
+	// CreatedBackingTables and RemovedBackingTables are the backing sstables
+	// of virtual sstables that the edit starts and stops tracking.
+	CreatedBackingTables []base.DiskFileNum
+	RemovedBackingTables []base.DiskFileNum
+}
+
+// VersionEditNewFile is an sstable added to a level by a VersionEdit.
+type VersionEditNewFile struct {
+	Level int
+	TableInfo
+	// Virtual is set if the sstable is a virtual sstable, backed by the
+	// physical sstable BackingFileNum.
+	Virtual        bool
+	BackingFileNum base.DiskFileNum
+	// Moved is set if the edit also removes the sstable from another level,
+	// i.e. the edit moves the sstable between levels.
+	Moved bool
+}
+
+// VersionEditDeletedFile is an sstable removed from a level by a VersionEdit.
+type VersionEditDeletedFile struct {
+	Level   int
+	FileNum FileNum
+}
+
+// ReadManifest decodes the version edits of the MANIFEST file at path in fs,
+// invoking fn with each of them in order. The DB doesn't need to be open, and
+// the MANIFEST isn't modified. If fn returns an error, ReadManifest stops and
+// returns it.
+//
+// A MANIFEST created when the DB rotated its previous MANIFEST starts with an
+// edit holding a snapshot of the LSM at the time, which adds every sstable it
+// contained. The checksum of each record is verified, and a corrupt or
+// truncated record stops the read with an error, after fn has been invoked
+// with the edits preceding it. Note that the last record of the MANIFEST of
+// a DB that crashed may have been partially written, which Open tolerates.
+func ReadManifest(path string, fs vfs.FS, fn func(VersionEdit) error) error {
+	f, err := fs.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rr := record.NewReader(f, 0 /* logNum */)
+	for i := 0; ; i++ {
+		r, err := rr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		var ve versionEdit
+		if err == nil {
+			err = ve.Decode(r)
+		}
+		if err != nil {
+			return base.CorruptionErrorf("pebble: reading version edit %d of manifest %q: %v",
+				errors.Safe(i), path, err)
+		}
+		if err := fn(makeVersionEdit(&ve)); err != nil {
+			return err
+		}
+	}
+}
+
+// makeVersionEdit converts a decoded manifest.VersionEdit to a VersionEdit.
+func makeVersionEdit(ve *versionEdit) VersionEdit {
+	e := VersionEdit{
+		ComparerName:         ve.ComparerName,
+		MinUnflushedLogNum:   ve.MinUnflushedLogNum,
+		NextFileNum:          ve.NextFileNum,
+		LastSeqNum:           ve.LastSeqNum,
+		RemovedBackingTables: ve.RemovedBackingTables,
+	}
+	deletedLevels := make(map[FileNum]int, len(ve.DeletedFiles))
+	for df := range ve.DeletedFiles {
+		e.DeletedFiles = append(e.DeletedFiles, VersionEditDeletedFile{Level: df.Level, FileNum: df.FileNum})
+		deletedLevels[df.FileNum] = df.Level
+	}
+	slices.SortFunc(e.DeletedFiles, func(a, b VersionEditDeletedFile) int {
+		if a.Level != b.Level {
+			return cmp.Compare(a.Level, b.Level)
+		}
+		return cmp.Compare(a.FileNum, b.FileNum)
+	})
+	for _, nf := range ve.NewFiles {
+		level, deleted := deletedLevels[nf.Meta.FileNum]
+		e.NewFiles = append(e.NewFiles, VersionEditNewFile{
+			Level:          nf.Level,
+			TableInfo:      nf.Meta.TableInfo(),
+			Virtual:        nf.Meta.Virtual,
+			BackingFileNum: nf.BackingFileNum,
+			Moved:          deleted && level != nf.Level,
+		})
+	}
+	for _, b := range ve.CreatedBackingTables {
+		e.CreatedBackingTables = append(e.CreatedBackingTables, b.DiskFileNum)
+	}
+	return e
+}
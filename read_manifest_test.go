@@ -0,0 +1,92 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"io"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadManifest(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{FS: mem, DisableAutomaticCompactions: true})
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("a"), nil, nil))
+	require.NoError(t, d.Flush())
+	// With nothing below it, the L0 sstable is moved to L6.
+	require.NoError(t, d.Compact([]byte("a"), []byte("b"), false /* parallelize */))
+	require.NoError(t, d.Set([]byte("a"), nil, nil))
+	require.NoError(t, d.Flush())
+	// The two sstables are compacted into one in L6.
+	require.NoError(t, d.Compact([]byte("a"), []byte("b"), false /* parallelize */))
+	manifestNum := d.mu.versions.manifestFileNum
+	require.NoError(t, d.Close())
+	path := base.MakeFilepath(mem, "", fileTypeManifest, manifestNum)
+
+	var edits []VersionEdit
+	require.NoError(t, ReadManifest(path, mem, func(ve VersionEdit) error {
+		edits = append(edits, ve)
+		return nil
+	}))
+	require.Equal(t, DefaultComparer.Name, edits[0].ComparerName)
+	var flushes, moves, compactions int
+	for _, ve := range edits {
+		switch {
+		case len(ve.NewFiles) == 1 && ve.NewFiles[0].Moved:
+			moves++
+			require.Equal(t, 6, ve.NewFiles[0].Level)
+			require.Equal(t, []VersionEditDeletedFile{{Level: 0, FileNum: ve.NewFiles[0].FileNum}}, ve.DeletedFiles)
+		case len(ve.NewFiles) == 1 && len(ve.DeletedFiles) == 0:
+			flushes++
+			require.Equal(t, 0, ve.NewFiles[0].Level)
+			require.NotZero(t, ve.MinUnflushedLogNum)
+		case len(ve.NewFiles) == 1 && len(ve.DeletedFiles) == 2:
+			compactions++
+			require.Equal(t, 6, ve.NewFiles[0].Level)
+			require.False(t, ve.NewFiles[0].Moved)
+			require.Equal(t, 0, ve.DeletedFiles[0].Level)
+			require.Equal(t, 6, ve.DeletedFiles[1].Level)
+		}
+	}
+	require.Equal(t, 2, flushes)
+	require.Equal(t, 1, moves)
+	require.Equal(t, 1, compactions)
+
+	// An error returned by the callback stops the read.
+	n := 0
+	errStop := errors.New("stop")
+	require.ErrorIs(t, ReadManifest(path, mem, func(ve VersionEdit) error {
+		n++
+		return errStop
+	}), errStop)
+	require.Equal(t, 1, n)
+
+	// A record whose checksum doesn't match is reported as corruption, after
+	// the preceding edits are read.
+	f, err := mem.Open(path)
+	require.NoError(t, err)
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	data[len(data)-1] ^= 0xff
+	corruptPath := "MANIFEST-corrupt"
+	f, err = mem.Create(corruptPath, vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	_, err = f.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	n = 0
+	err = ReadManifest(corruptPath, mem, func(ve VersionEdit) error {
+		n++
+		return nil
+	})
+	require.True(t, errors.Is(err, base.ErrCorruption))
+	require.Equal(t, len(edits)-1, n)
+}
@@ -0,0 +1,242 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/keyspan"
+	"github.com/cockroachdb/pebble/internal/private"
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// readOnlyStoreProvider is an objstorage.Provider layering the objects of
+// Options.ReadOnlyStore beneath those of the DB's own provider. Objects are
+// always created in the local provider; the store is only read from. The DB
+// ensures that local objects never reuse the file number of a store object,
+// so every object is in exactly one of the two providers.
+type readOnlyStoreProvider struct {
+	objstorage.Provider
+	store objstorage.Provider
+}
+
+var _ objstorage.Provider = (*readOnlyStoreProvider)(nil)
+
+// inStore returns whether the given object is supplied by the store.
+func (p *readOnlyStoreProvider) inStore(fileType base.FileType, fileNum base.DiskFileNum) bool {
+	_, err := p.store.Lookup(fileType, fileNum)
+	return err == nil
+}
+
+func (p *readOnlyStoreProvider) providerFor(
+	fileType base.FileType, fileNum base.DiskFileNum,
+) objstorage.Provider {
+	if p.inStore(fileType, fileNum) {
+		return p.store
+	}
+	return p.Provider
+}
+
+// OpenForReading is part of the objstorage.Provider interface.
+func (p *readOnlyStoreProvider) OpenForReading(
+	ctx context.Context,
+	fileType base.FileType,
+	fileNum base.DiskFileNum,
+	opts objstorage.OpenOptions,
+) (objstorage.Readable, error) {
+	return p.providerFor(fileType, fileNum).OpenForReading(ctx, fileType, fileNum, opts)
+}
+
+// Remove is part of the objstorage.Provider interface. The store's objects are
+// never removed, even once they're no longer referenced by the LSM.
+func (p *readOnlyStoreProvider) Remove(fileType base.FileType, fileNum base.DiskFileNum) error {
+	if p.inStore(fileType, fileNum) {
+		return nil
+	}
+	return p.Provider.Remove(fileType, fileNum)
+}
+
+// Lookup is part of the objstorage.Provider interface.
+func (p *readOnlyStoreProvider) Lookup(
+	fileType base.FileType, fileNum base.DiskFileNum,
+) (objstorage.ObjectMetadata, error) {
+	return p.providerFor(fileType, fileNum).Lookup(fileType, fileNum)
+}
+
+// Path is part of the objstorage.Provider interface.
+func (p *readOnlyStoreProvider) Path(meta objstorage.ObjectMetadata) string {
+	return p.providerFor(meta.FileType, meta.DiskFileNum).Path(meta)
+}
+
+// Size is part of the objstorage.Provider interface.
+func (p *readOnlyStoreProvider) Size(meta objstorage.ObjectMetadata) (int64, error) {
+	return p.providerFor(meta.FileType, meta.DiskFileNum).Size(meta)
+}
+
+// IsSharedForeign is part of the objstorage.Provider interface.
+func (p *readOnlyStoreProvider) IsSharedForeign(meta objstorage.ObjectMetadata) bool {
+	return p.providerFor(meta.FileType, meta.DiskFileNum).IsSharedForeign(meta)
+}
+
+// RemoteObjectBacking is part of the objstorage.Provider interface.
+func (p *readOnlyStoreProvider) RemoteObjectBacking(
+	meta *objstorage.ObjectMetadata,
+) (objstorage.RemoteObjectBackingHandle, error) {
+	return p.providerFor(meta.FileType, meta.DiskFileNum).RemoteObjectBacking(meta)
+}
+
+// IsNotExistError is part of the objstorage.Provider interface.
+func (p *readOnlyStoreProvider) IsNotExistError(err error) bool {
+	return p.Provider.IsNotExistError(err) || p.store.IsNotExistError(err)
+}
+
+// loadReadOnlyStoreTables returns the new file entries adding every sstable in
+// the store to the LSM of a newly created DB, along with the largest sequence
+// number of any key within them.
+//
+// The sstables are placed from oldest to newest (by largest sequence number),
+// each in the level immediately above the shallowest level of any placed
+// sstable it overlaps, or in L6 if it overlaps none, and within L0 ordered by
+// sequence number. Newer keys only shadow older ones if the sequence numbers
+// of each sstable are all greater than those of the sstables it's placed
+// above, so an error is returned if the ranges of sequence numbers of
+// overlapping sstables interleave, as they may in an LSM whose compactions
+// moved newer keys below older ones.
+func loadReadOnlyStoreTables(
+	opts *Options, store objstorage.Provider, cacheID uint64,
+) (_ []newFileEntry, largestSeqNum uint64, _ error) {
+	var metas []*fileMetadata
+	for _, obj := range store.List() {
+		if obj.FileType != fileTypeTable {
+			continue
+		}
+		m, err := loadReadOnlyStoreTable(opts, store, cacheID, obj.DiskFileNum)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "pebble: loading read-only store table %s", obj.DiskFileNum)
+		}
+		if m != nil {
+			metas = append(metas, m)
+			largestSeqNum = max(largestSeqNum, m.LargestSeqNum)
+		}
+	}
+	slices.SortFunc(metas, func(a, b *fileMetadata) int {
+		if c := cmp.Compare(a.LargestSeqNum, b.LargestSeqNum); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.FileNum, b.FileNum)
+	})
+
+	entries := make([]newFileEntry, 0, len(metas))
+	for _, m := range metas {
+		level := numLevels - 1
+		bounds := m.UserKeyBounds()
+		for _, e := range entries {
+			if !e.Meta.Overlaps(opts.Comparer.Compare, &bounds) {
+				continue
+			}
+			if e.Meta.LargestSeqNum >= m.SmallestSeqNum {
+				return nil, 0, errors.Errorf(
+					"pebble: read-only store sstables %s and %s overlap in both keys and sequence numbers",
+					e.Meta.FileNum, m.FileNum)
+			}
+			if e.Level <= level {
+				level = max(e.Level-1, 0)
+			}
+		}
+		entries = append(entries, newFileEntry{Level: level, Meta: m})
+	}
+	return entries, largestSeqNum, nil
+}
+
+// loadReadOnlyStoreTable creates the FileMetadata for one sstable in the store,
+// returning nil if the sstable is empty. Unlike ingested sstables, the keys of
+// store sstables retain the sequence numbers they were written with.
+func loadReadOnlyStoreTable(
+	opts *Options, store objstorage.Provider, cacheID uint64, fileNum base.DiskFileNum,
+) (*fileMetadata, error) {
+	open := func() (objstorage.Readable, error) {
+		return store.OpenForReading(context.TODO(), fileTypeTable, fileNum, objstorage.OpenOptions{MustExist: true})
+	}
+	readable, err := open()
+	if err != nil {
+		return nil, err
+	}
+	m, err := loadTableMeta(opts, opts.FormatMajorVersion, readable, cacheID,
+		base.PhysicalTableFileNum(fileNum), func(opts *Options, key *InternalKey) error {
+			if key.Kind() == InternalKeyKindInvalid {
+				return base.CorruptionErrorf("pebble: read-only store sstable has corrupted key: %s",
+					key.Pretty(opts.Comparer.FormatKey))
+			}
+			return nil
+		})
+	if err != nil || m == nil {
+		return nil, err
+	}
+
+	// The sequence number bounds of the sstable are only known by scanning all
+	// of its keys.
+	readable, err = open()
+	if err != nil {
+		return nil, err
+	}
+	cacheOpts := private.SSTableCacheOpts(cacheID, fileNum).(sstable.ReaderOption)
+	r, err := sstable.NewReader(readable, opts.MakeReaderOptions(), cacheOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if err := loadTableSeqNums(m, r); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// loadTableSeqNums sets the sequence number bounds of m, the FileMetadata of
+// the sstable read by r, from the sequence numbers of its keys.
+func loadTableSeqNums(m *fileMetadata, r *sstable.Reader) error {
+	m.SmallestSeqNum = base.InternalKeySeqNumMax
+	extend := func(seqNum uint64) {
+		m.SmallestSeqNum = min(m.SmallestSeqNum, seqNum)
+		m.LargestSeqNum = max(m.LargestSeqNum, seqNum)
+	}
+	iter, err := r.NewIter(sstable.NoTransforms, nil /* lower */, nil /* upper */)
+	if err != nil {
+		return err
+	}
+	for kv := iter.First(); kv != nil; kv = iter.Next() {
+		extend(kv.SeqNum())
+	}
+	if err := firstError(iter.Error(), iter.Close()); err != nil {
+		return err
+	}
+	for _, newIter := range []func(sstable.IterTransforms) (keyspan.FragmentIterator, error){
+		r.NewRawRangeDelIter, r.NewRawRangeKeyIter,
+	} {
+		spanIter, err := newIter(sstable.NoTransforms)
+		if err != nil {
+			return err
+		}
+		if spanIter == nil {
+			continue
+		}
+		s, err := spanIter.First()
+		for ; s != nil; s, err = spanIter.Next() {
+			for _, k := range s.Keys {
+				extend(k.SeqNum())
+			}
+		}
+		spanIter.Close()
+		if err != nil {
+			return err
+		}
+	}
+	m.LargestSeqNumAbsolute = m.LargestSeqNum
+	return nil
+}
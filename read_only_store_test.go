@@ -0,0 +1,139 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnlyStore(t *testing.T) {
+	// Write the store's sstables with another DB: an L6 table and a newer,
+	// overlapping table that shadows some of its keys.
+	storeFS := vfs.NewMem()
+	{
+		d, err := Open("store", &Options{FS: storeFS, DisableAutomaticCompactions: true})
+		require.NoError(t, err)
+		for _, k := range []string{"a", "b", "c", "d", "e"} {
+			require.NoError(t, d.Set([]byte(k), []byte(k+"1"), nil))
+		}
+		require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+		require.NoError(t, d.Set([]byte("b"), []byte("b2"), nil))
+		require.NoError(t, d.Delete([]byte("c"), nil))
+		require.NoError(t, d.Flush())
+		require.NoError(t, d.Close())
+	}
+	storeFiles, err := storeFS.List("store")
+	require.NoError(t, err)
+
+	store, err := objstorageprovider.Open(objstorageprovider.DefaultSettings(storeFS, "store"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, store.Close()) }()
+
+	fs := vfs.NewMem()
+	opts := &Options{FS: fs, DisableAutomaticCompactions: true, ReadOnlyStore: store}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+
+	expect := func(want map[string]string) {
+		t.Helper()
+		for _, k := range []string{"a", "b", "c", "d", "e", "f"} {
+			v, closer, err := d.Get([]byte(k))
+			if want[k] == "" {
+				require.True(t, errors.Is(err, ErrNotFound), "key %s", k)
+				continue
+			}
+			require.NoError(t, err)
+			require.Equal(t, want[k], string(v), "key %s", k)
+			require.NoError(t, closer.Close())
+		}
+		var stats CheckLevelsStats
+		require.NoError(t, d.CheckLevels(&stats))
+	}
+	expect(map[string]string{"a": "a1", "b": "b2", "d": "d1", "e": "e1"})
+
+	// The newer store table is placed above the one it overlaps.
+	var levels []int
+	tables, err := d.SSTables()
+	require.NoError(t, err)
+	for level, infos := range tables {
+		for range infos {
+			levels = append(levels, level)
+		}
+	}
+	require.Equal(t, []int{5, 6}, levels)
+
+	// Writes are layered above the store's tables, and flushes and compactions
+	// write to the local FS without modifying the store.
+	require.NoError(t, d.Set([]byte("a"), []byte("a3"), nil))
+	require.NoError(t, d.Delete([]byte("d"), nil))
+	require.NoError(t, d.Set([]byte("f"), []byte("f3"), nil))
+	want := map[string]string{"a": "a3", "b": "b2", "e": "e1", "f": "f3"}
+	expect(want)
+	require.NoError(t, d.Flush())
+	expect(want)
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+	expect(want)
+	files, err := storeFS.List("store")
+	require.NoError(t, err)
+	require.ElementsMatch(t, storeFiles, files)
+
+	require.Error(t, d.Checkpoint("checkpoint"))
+
+	// The DB may be reopened over the same store.
+	require.NoError(t, d.Close())
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	expect(want)
+	require.NoError(t, d.Set([]byte("e"), []byte("e4"), nil))
+	want["e"] = "e4"
+	expect(want)
+	require.NoError(t, d.Close())
+}
+
+func TestReadOnlyStoreSeqNums(t *testing.T) {
+	// Writes to the DB must not be shadowed by the store's keys, regardless of
+	// the sequence numbers the store was written with.
+	storeFS := vfs.NewMem()
+	{
+		d, err := Open("store", &Options{FS: storeFS})
+		require.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			require.NoError(t, d.Set([]byte("k"), []byte(fmt.Sprint(i)), nil))
+		}
+		require.NoError(t, d.Flush())
+		require.NoError(t, d.Close())
+	}
+	store, err := objstorageprovider.Open(objstorageprovider.DefaultSettings(storeFS, "store"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, store.Close()) }()
+
+	d, err := Open("", &Options{FS: vfs.NewMem(), ReadOnlyStore: store})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	require.NoError(t, d.Set([]byte("k"), []byte("local"), nil))
+	v, closer, err := d.Get([]byte("k"))
+	require.NoError(t, err)
+	require.Equal(t, "local", string(v))
+	require.NoError(t, closer.Close())
+}
+
+func TestReadOnlyStoreInterleavedSeqNums(t *testing.T) {
+	// The store's sstables can't be placed in an order in which newer keys
+	// shadow older ones, so the DB isn't created.
+	storeFS := vfs.NewMem()
+	writeInterleavedSeqNumsDB(t, storeFS, "store")
+	store, err := objstorageprovider.Open(objstorageprovider.DefaultSettings(storeFS, "store"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, store.Close()) }()
+
+	_, err = Open("", &Options{FS: vfs.NewMem(), ReadOnlyStore: store})
+	require.ErrorContains(t, err, "overlap in both keys and sequence numbers")
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSession(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("1"), nil))
+
+	s := d.NewReadSession()
+
+	// Writes, flushes and compactions after the session was created are
+	// invisible to it.
+	require.NoError(t, d.Set([]byte("a"), []byte("2"), nil))
+	require.NoError(t, d.Delete([]byte("b"), nil))
+	require.NoError(t, d.Set([]byte("c"), []byte("2"), nil))
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+
+	// Reads don't reference the session's state.
+	refs := s.readState.refcnt.Load()
+
+	v, closer, err := s.Get([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, "1", string(v))
+	require.Equal(t, refs, s.readState.refcnt.Load())
+	require.NoError(t, closer.Close())
+	_, _, err = s.Get([]byte("c"))
+	require.ErrorIs(t, err, ErrNotFound)
+
+	iter, err := s.NewIter(nil)
+	require.NoError(t, err)
+	require.Equal(t, refs, s.readState.refcnt.Load())
+	var keys []string
+	for valid := iter.First(); valid; valid = iter.Next() {
+		keys = append(keys, string(iter.Key())+"="+string(iter.Value()))
+	}
+	require.Equal(t, []string{"a=1", "b=1"}, keys)
+	// A clone references the session's state, and may outlive the session.
+	clone, err := iter.Clone(CloneOptions{})
+	require.NoError(t, err)
+	require.Error(t, iter.Refresh())
+	require.NoError(t, iter.Close())
+	require.Equal(t, refs+1, s.readState.refcnt.Load())
+	require.NoError(t, s.Close())
+
+	require.True(t, clone.Last())
+	require.Equal(t, "b", string(clone.Key()))
+	require.NoError(t, clone.Close())
+
+	// The DB's current state is unaffected.
+	v, closer, err = d.Get([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, "2", string(v))
+	require.NoError(t, closer.Close())
+}
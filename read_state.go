@@ -78,7 +78,8 @@ func (d *DB) loadReadState() *readState {
 
 // updateReadStateLocked creates a new readState from the current version and
 // list of memtables. Requires DB.mu is held. If checker is not nil, it is
-// called after installing the new readState.
+// called after installing the new readState. It also updates the stall of
+// writes imposed by Options.L0ResumeWritesThreshold.
 func (d *DB) updateReadStateLocked(checker func(*DB) error) {
 	s := &readState{
 		db:        d,
@@ -95,6 +96,7 @@ func (d *DB) updateReadStateLocked(checker func(*DB) error) {
 	old := d.readState.val
 	d.readState.val = s
 	d.readState.Unlock()
+	d.updateL0WriteStallLocked()
 	if checker != nil {
 		if err := checker(d); err != nil {
 			d.opts.Logger.Fatalf("checker failed with error: %s", err)
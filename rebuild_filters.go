@@ -0,0 +1,153 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/manifest"
+)
+
+// RebuildFilters rewrites the sstables in the given levels whose filters don't
+// match the filter policy configured for their level by
+// LevelOptions.FilterPolicy, such as sstables written before a filter policy
+// was configured or with a weaker one.
+//
+// Each such sstable is replaced by a copy with a new file number that has a
+// rebuilt filter block, but whose data blocks are copied unchanged, which is
+// considerably cheaper than compacting it. The exception is sstables with value
+// blocks: these are rewritten from scratch by a rewrite compaction. Virtual
+// sstables are not rewritten, since their backing sstables may be shared.
+//
+// RebuildFilters blocks until every matching sstable has been rewritten, or an
+// error occurs.
+func (d *DB) RebuildFilters(levels []int) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	for _, level := range levels {
+		if level < 0 || level >= numLevels {
+			return errors.Errorf("pebble: invalid level %d", level)
+		}
+	}
+	// Sstables may be moved between levels by concurrent compactions, so keep
+	// looking for sstables to rewrite until there are none.
+	for {
+		candidates, err := d.filterRebuildCandidates(levels)
+		if err != nil {
+			return err
+		}
+		if len(candidates) == 0 {
+			return nil
+		}
+		for _, c := range candidates {
+			_, err := d.rewriteTable(c.level, c.meta, c.kind, DefaultCompression)
+			if err != nil && !errors.Is(err, ErrCancelledCompaction) {
+				return err
+			}
+		}
+	}
+}
+
+// filterRebuildCandidate is an sstable found by filterRebuildCandidates.
+type filterRebuildCandidate struct {
+	level int
+	meta  *fileMetadata
+	kind  compactionKind
+}
+
+// filterRebuildCandidates returns the physical sstables in the given levels of
+// the current version whose filters don't match the filter policy of their
+// level, and the kind of compaction that rewrites each of them.
+func (d *DB) filterRebuildCandidates(levels []int) ([]filterRebuildCandidate, error) {
+	rs := d.loadReadState()
+	defer rs.unref()
+	var candidates []filterRebuildCandidate
+	for _, level := range levels {
+		var policyName string
+		if p := d.opts.Level(level).FilterPolicy; p != nil {
+			policyName = p.Name()
+		}
+		iter := rs.current.Levels[level].Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			if f.Virtual {
+				continue
+			}
+			props, err := d.tableCache.getTableProperties(f)
+			if err != nil {
+				return nil, err
+			}
+			if props.FilterPolicyName == policyName {
+				continue
+			}
+			kind := compactionKindRebuildFilter
+			if props.NumValueBlocks > 0 {
+				kind = compactionKindRewrite
+			}
+			candidates = append(candidates, filterRebuildCandidate{level: level, meta: f, kind: kind})
+		}
+	}
+	return candidates, nil
+}
+
+// rewriteTable runs a compaction of the given kind rewriting an sstable in
+// the given level, waiting for any compaction that it's already part of to
+// complete first. If compression isn't DefaultCompression, the output uses it
+// in place of the level's compression. rewriteTable returns the compaction
+// once it has completed, or nil if the sstable is no longer in the level. Like
+// a manual compaction, it waits while the DB is quiesced or compactions are
+// paused, or returns ErrCompactionsPaused; see waitForCompactionsAllowedLocked.
+func (d *DB) rewriteTable(
+	level int, meta *fileMetadata, kind compactionKind, compression Compression,
+) (*compaction, error) {
+	d.mu.Lock()
+	var comp *compaction
+	var doneCh chan error
+	for doneCh == nil {
+		if err := d.waitForCompactionsAllowedLocked(); err != nil {
+			d.mu.Unlock()
+			return nil, err
+		}
+		vers := d.mu.versions.currentVersion()
+		if !levelContainsFile(vers.Levels[level], meta) {
+			d.mu.Unlock()
+			return nil, nil
+		}
+		env := compactionEnv{
+			diskAvailBytes:          d.diskAvailBytes.Load(),
+			earliestSnapshotSeqNum:  d.mu.snapshots.earliest(),
+			earliestUnflushedSeqNum: d.getEarliestUnflushedSeqNumLocked(),
+			inProgressCompactions:   d.getInProgressCompactionInfoLocked(nil),
+		}
+		pc := pickDownloadCompaction(vers, d.opts, env, d.mu.versions.picker.getBaseLevel(), kind, level, meta)
+		if pc == nil {
+			// The sstable is part of a conflicting compaction. Wait for a
+			// compaction to complete and try again.
+			d.mu.compact.cond.Wait()
+			continue
+		}
+		doneCh = make(chan error, 1)
+		comp = newCompaction(pc, d.opts, d.timeNow(), d.objProvider)
+		comp.compression = compression
+		d.mu.compact.compactingCount++
+		d.addInProgressCompaction(comp)
+		go d.compact(comp, doneCh)
+	}
+	d.mu.Unlock()
+	return comp, <-doneCh
+}
+
+// levelContainsFile returns whether the level contains the given file.
+func levelContainsFile(level manifest.LevelMetadata, f *fileMetadata) bool {
+	iter := level.Iter()
+	for m := iter.First(); m != nil; m = iter.Next() {
+		if m == f {
+			return true
+		}
+	}
+	return false
+}
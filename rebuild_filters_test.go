@@ -0,0 +1,95 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble/bloom"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRebuildFilters(t *testing.T) {
+	fs := vfs.NewMem()
+	opts := &Options{FS: fs, DisableAutomaticCompactions: true}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%03d", i)), []byte(fmt.Sprint(i)), nil))
+	}
+	require.NoError(t, d.DeleteRange([]byte("k010"), []byte("k020"), nil))
+	require.NoError(t, d.RangeKeySet([]byte("k030"), []byte("k040"), nil, []byte("v"), nil))
+	require.NoError(t, d.Compact([]byte("k"), []byte("l"), false))
+	require.NoError(t, d.Set([]byte("k050"), []byte("new"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Close())
+
+	// Reopen the DB with a filter policy.
+	opts.EnsureDefaults()
+	for i := range opts.Levels {
+		opts.Levels[i].FilterPolicy = bloom.FilterPolicy(10)
+	}
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// filters returns the file number and filter policy of each sstable, by
+	// level.
+	filters := func() [numLevels][]string {
+		tables, err := d.SSTables(WithProperties())
+		require.NoError(t, err)
+		var res [numLevels][]string
+		for level, infos := range tables {
+			for _, info := range infos {
+				res[level] = append(res[level], fmt.Sprintf("%s:%q", info.FileNum, info.Properties.FilterPolicyName))
+			}
+		}
+		return res
+	}
+	contents := func() []string {
+		iter, err := d.NewIter(&IterOptions{KeyTypes: IterKeyTypePointsAndRanges})
+		require.NoError(t, err)
+		var res []string
+		for valid := iter.First(); valid; valid = iter.Next() {
+			s := string(iter.Key())
+			if hasPoint, _ := iter.HasPointAndRange(); hasPoint {
+				s += ":" + string(iter.Value())
+			}
+			res = append(res, s)
+		}
+		require.NoError(t, iter.Close())
+		return res
+	}
+	before := filters()
+	require.Len(t, before[0], 1)
+	require.Len(t, before[6], 1)
+	wantContents := contents()
+
+	require.Error(t, d.RebuildFilters([]int{numLevels}))
+
+	// Only the sstables in the requested levels are rewritten.
+	require.NoError(t, d.RebuildFilters([]int{6}))
+	after := filters()
+	require.Equal(t, before[0], after[0])
+	require.Len(t, after[6], 1)
+	require.NotEqual(t, before[6], after[6])
+	require.Contains(t, after[6][0], fmt.Sprintf("%q", bloom.FilterPolicy(10).Name()))
+	require.Equal(t, wantContents, contents())
+	var stats CheckLevelsStats
+	require.NoError(t, d.CheckLevels(&stats))
+	require.Equal(t, int64(1), d.Metrics().Compact.RewriteCount)
+
+	// Rebuilding is a no-op once the filters match.
+	require.NoError(t, d.RebuildFilters([]int{0, 6}))
+	final := filters()
+	require.Equal(t, after[6], final[6])
+	require.NotEqual(t, before[0], final[0])
+	require.NoError(t, d.RebuildFilters([]int{0, 6}))
+	require.Equal(t, final, filters())
+	require.Equal(t, wantContents, contents())
+	require.NoError(t, d.CheckLevels(&stats))
+}
@@ -0,0 +1,423 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"sort"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/batchrepr"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/record"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs/atomicfs"
+	"github.com/cockroachdb/pebble/wal"
+)
+
+// RebuildManifest replaces the MANIFEST of the DB in dirname with one built
+// from the local sstables in the directory, for recovering a DB whose MANIFEST
+// is corrupt or missing while its sstables are intact. The DB must not be
+// open. The LSM built from the sstables is checked as by CheckLevels before
+// the new MANIFEST is installed, and once it is, the DB is opened read-only
+// and validated with CheckLevels.
+//
+// RebuildManifest is a disaster-recovery tool. The bounds and sequence
+// numbers of each sstable are recomputed from its contents, and the sstables
+// are placed in order of increasing sequence numbers: each sstable is placed
+// in L6 if it overlaps neither the sstables already in L6 nor those already
+// in L0, and in L0 otherwise. The sstables in L0 are ordered by sequence
+// number, so that newer keys shadow older ones, which requires that the
+// sequence numbers of each sstable placed in L0 be greater than those of all
+// the sstables it overlaps; RebuildManifest fails without installing the new
+// MANIFEST if they aren't, since the order of the keys of such sstables can't
+// be recovered from their bounds. The resulting LSM may be far from the one
+// that was lost, and may take a lot of compaction to reshape, but it holds the
+// data of all the sstables.
+//
+// Sstables whose keys all have a zero sequence number are placed as the
+// oldest, as is right for those compacted into L6. Ingested sstables that
+// haven't been compacted since keep the zero sequence numbers they were built
+// with, so they may end up shadowed by older keys.
+//
+// The writes in the WALs that are newer than every key in the sstables, which
+// can't have been flushed, are copied to a new WAL that is replayed when the
+// DB is opened. Older writes are presumed to have been flushed, since
+// replaying WALs that were already flushed could resurrect deleted keys, and
+// the WALs holding them are deleted when the DB is opened. The following are
+// not recovered:
+//
+//   - Writes only in the WAL that are older than a key in the sstables.
+//   - Sstables on shared or external storage.
+//   - Virtual sstables: their backing sstables are recovered whole, which may
+//     resurrect keys that were excised from them.
+//
+// Similarly, the MANIFEST does not record which sstables were obsolete, so
+// sstables that were obsolete but not yet deleted are recovered, and may
+// resurrect keys that were since deleted.
+func RebuildManifest(dirname string, opts *Options) (err error) {
+	opts = opts.Clone().EnsureDefaults()
+	opts.ReadOnly = false
+	fs := opts.FS
+
+	if err := func() error {
+		fileLock, err := fs.Lock(base.MakeFilepath(fs, dirname, fileTypeLock, base.DiskFileNum(0)))
+		if err != nil {
+			return err
+		}
+		defer fileLock.Close()
+		return rebuildManifest(dirname, opts)
+	}(); err != nil {
+		return err
+	}
+
+	opts.ReadOnly = true
+	d, err := Open(dirname, opts)
+	if err != nil {
+		return errors.Wrap(err, "pebble: opening the DB with the rebuilt MANIFEST")
+	}
+	defer func() { err = firstError(err, d.Close()) }()
+	return d.CheckLevels(nil /* stats */)
+}
+
+// rebuildManifest writes the MANIFEST for RebuildManifest and makes it the
+// current one.
+func rebuildManifest(dirname string, opts *Options) (err error) {
+	fs := opts.FS
+	providerSettings := objstorageprovider.Settings{
+		Logger:    opts.Logger,
+		FS:        fs,
+		FSDirName: dirname,
+		FSCleaner: opts.Cleaner,
+	}
+	providerSettings.Local.SSTablePathFunc = sstablePathFunc(opts)
+	provider, err := objstorageprovider.Open(providerSettings)
+	if err != nil {
+		return err
+	}
+	defer provider.Close()
+
+	// The new MANIFEST, and the next file number it records, must follow every
+	// file number in use, including those of the WALs.
+	var maxFileNum base.DiskFileNum
+	for _, dir := range []string{dirname, opts.WALDir} {
+		if dir == "" {
+			continue
+		}
+		ls, err := fs.List(dir)
+		if err != nil {
+			return err
+		}
+		for _, filename := range ls {
+			if _, fileNum, ok := base.ParseFilename(fs, filename); ok {
+				maxFileNum = max(maxFileNum, fileNum)
+			}
+		}
+	}
+
+	var files []*fileMetadata
+	for _, obj := range provider.List() {
+		if obj.FileType != fileTypeTable || obj.IsRemote() {
+			continue
+		}
+		maxFileNum = max(maxFileNum, obj.DiskFileNum)
+		meta, err := rebuildTableMeta(opts, provider, obj.DiskFileNum)
+		if err != nil {
+			return errors.Wrapf(err, "pebble: loading %s", provider.Path(obj))
+		}
+		if meta != nil {
+			files = append(files, meta)
+		}
+	}
+
+	entries, err := placeRebuiltTables(opts.Comparer, files)
+	if err != nil {
+		return err
+	}
+	ve := &versionEdit{ComparerName: opts.Comparer.Name}
+	for _, nf := range entries {
+		ve.NewFiles = append(ve.NewFiles, nf)
+		ve.LastSeqNum = max(ve.LastSeqNum, nf.Meta.LargestSeqNum)
+	}
+	if err := checkRebuiltTables(opts, provider, entries, ve.LastSeqNum); err != nil {
+		return errors.Wrap(err, "pebble: checking the rebuilt LSM")
+	}
+
+	walNum := maxFileNum + 1
+	manifestFileNum := walNum + 1
+	ve.NextFileNum = uint64(manifestFileNum) + 1
+	ve.MinUnflushedLogNum = walNum
+	walPath, err := rebuildWAL(opts, dirname, walNum, ve.LastSeqNum)
+	if err != nil {
+		return err
+	}
+	installed := false
+	defer func() {
+		if err != nil && !installed {
+			_ = fs.Remove(walPath)
+		}
+	}()
+
+	manifestPath := base.MakeFilepath(fs, dirname, fileTypeManifest, manifestFileNum)
+	f, err := fs.Create(manifestPath, "pebble-manifest")
+	if err != nil {
+		return err
+	}
+	rw := record.NewWriter(f)
+	w, err := rw.Next()
+	if err == nil {
+		err = ve.Encode(w)
+	}
+	err = firstError(err, rw.Close())
+	if err == nil {
+		err = f.Sync()
+	}
+	if err = firstError(err, f.Close()); err != nil {
+		_ = fs.Remove(manifestPath)
+		return err
+	}
+
+	// NB: Move is responsible for syncing the directory.
+	marker, _, err := atomicfs.LocateMarker(fs, dirname, manifestMarkerName)
+	if err != nil {
+		_ = fs.Remove(manifestPath)
+		return err
+	}
+	if err = marker.Move(base.MakeFilename(fileTypeManifest, manifestFileNum)); err != nil {
+		_ = marker.Close()
+		_ = fs.Remove(manifestPath)
+		return err
+	}
+	installed = true
+	return marker.Close()
+}
+
+// checkRebuiltTables checks that newer keys shadow older ones in the LSM formed
+// by the sstables placed by placeRebuiltTables, whose largest sequence number
+// is seqNum, before it's installed.
+func checkRebuiltTables(
+	opts *Options, provider objstorage.Provider, entries []newFileEntry, seqNum uint64,
+) (err error) {
+	var levels [numLevels][]*fileMetadata
+	readers := make(map[base.FileNum]*sstable.Reader, len(entries))
+	defer func() {
+		for _, r := range readers {
+			err = firstError(err, r.Close())
+		}
+	}()
+	for _, nf := range entries {
+		readable, err := provider.OpenForReading(context.Background(), fileTypeTable,
+			nf.Meta.FileBacking.DiskFileNum, objstorage.OpenOptions{MustExist: true})
+		if err != nil {
+			return err
+		}
+		r, err := sstable.NewReader(readable, opts.MakeReaderOptions())
+		if err != nil {
+			return err
+		}
+		readers[nf.Meta.FileNum] = r
+		levels[nf.Level] = append(levels[nf.Level], nf.Meta)
+	}
+	return checkTableLevels(opts, levels, func(m *fileMetadata) *sstable.Reader {
+		return readers[m.FileNum]
+	}, seqNum+1)
+}
+
+// rebuildWAL writes the batches in the WALs of the DB in dirname with sequence
+// numbers greater than seqNum, the largest one in the recovered sstables, to a
+// new WAL numbered walNum, and returns its path. Batches recording ingestions
+// are skipped, since the ingested sstables are recovered with the others.
+func rebuildWAL(
+	opts *Options, dirname string, walNum base.DiskFileNum, seqNum uint64,
+) (path string, err error) {
+	fs := opts.FS
+	walDirs := []wal.Dir{{FS: fs, Dirname: dirname}}
+	if opts.WALDir != "" && opts.WALDir != dirname {
+		walDirs = append(walDirs, wal.Dir{FS: fs, Dirname: opts.WALDir})
+	}
+	logs, err := wal.Scan(walDirs...)
+	if err != nil {
+		return "", err
+	}
+
+	path = wal.MakeLogFilepath(walDirs[len(walDirs)-1], wal.NumWAL(walNum))
+	f, err := fs.Create(path, "pebble-wal")
+	if err != nil {
+		return "", err
+	}
+	rw := record.NewWriter(f)
+	defer func() {
+		err = firstError(err, rw.Close())
+		if err == nil {
+			err = f.Sync()
+		}
+		if err = firstError(err, f.Close()); err != nil {
+			_ = fs.Remove(path)
+			path = ""
+		}
+	}()
+
+	var buf bytes.Buffer
+	for _, ll := range logs {
+		if err := func() error {
+			rr := ll.OpenForRead()
+			defer rr.Close()
+			for {
+				r, _, err := rr.NextRecord()
+				if err == nil {
+					buf.Reset()
+					_, err = io.Copy(&buf, r)
+				}
+				if err == io.EOF || record.IsInvalidRecord(err) {
+					// As when replaying the WAL, a WAL's tail may be invalid
+					// because of preallocation or recycling.
+					return nil
+				} else if err != nil {
+					return err
+				}
+				if buf.Len() < batchrepr.HeaderLen {
+					return base.CorruptionErrorf("pebble: corrupt wal %s", errors.Safe(ll.Num))
+				}
+				var b Batch
+				b.SetRepr(buf.Bytes())
+				if b.SeqNum() <= seqNum {
+					continue
+				}
+				br := b.Reader()
+				if kind, _, _, ok, err := br.Next(); err != nil {
+					return err
+				} else if ok && kind == InternalKeyKindIngestSST {
+					continue
+				}
+				if _, err := rw.WriteRecord(buf.Bytes()); err != nil {
+					return err
+				}
+			}
+		}(); err != nil {
+			return path, errors.Wrapf(err, "pebble: copying wal %s", ll.Num)
+		}
+	}
+	return path, nil
+}
+
+// rebuildTableMeta returns the FileMetadata of a local sstable for
+// RebuildManifest, or nil if the sstable is empty.
+func rebuildTableMeta(
+	opts *Options, provider objstorage.Provider, fileNum base.DiskFileNum,
+) (*fileMetadata, error) {
+	openReadable := func() (objstorage.Readable, error) {
+		return provider.OpenForReading(context.Background(), fileTypeTable, fileNum,
+			objstorage.OpenOptions{MustExist: true})
+	}
+	readable, err := openReadable()
+	if err != nil {
+		return nil, err
+	}
+	// loadTableMeta closes the readable along with its reader.
+	meta, err := loadTableMeta(opts, FormatNewest, readable, 0 /* cacheID */, base.FileNum(fileNum),
+		func(opts *Options, key *InternalKey) error {
+			if key.Kind() == InternalKeyKindInvalid {
+				return base.CorruptionErrorf("pebble: sstable has corrupted key: %s",
+					key.Pretty(opts.Comparer.FormatKey))
+			}
+			return nil
+		})
+	if err != nil || meta == nil {
+		return nil, err
+	}
+	if readable, err = openReadable(); err != nil {
+		return nil, err
+	}
+	r, err := sstable.NewReader(readable, opts.MakeReaderOptions())
+	if err != nil {
+		return nil, err
+	}
+	err = loadTableSeqNums(meta, r)
+	return meta, firstError(err, r.Close())
+}
+
+// placeRebuiltTables assigns the sstables recovered by RebuildManifest to
+// levels, in order of increasing sequence numbers. An sstable is placed in L6
+// if it overlaps neither the sstables in L6 nor those in L0, and in L0
+// otherwise. Since an sstable in L0 blocks the placement in L6 of any newer
+// sstable it overlaps, the sstables in L6 are older than those they overlap in
+// L0. Within L0, sstables are ordered by their largest sequence numbers, so
+// the keys of overlapping sstables are only ordered correctly if their ranges
+// of sequence numbers don't interleave. placeRebuiltTables returns an error if
+// they do, since the correct order can't be determined from the sstables'
+// bounds.
+func placeRebuiltTables(comparer *Comparer, files []*fileMetadata) ([]newFileEntry, error) {
+	cmp := comparer.Compare
+	manifest.SortBySeqNum(files)
+	// The key ranges of the sstables in L6 and L0, as sorted, disjoint
+	// intervals. The file bounds are treated as inclusive, which is
+	// conservative for exclusive sentinel largest keys.
+	var l6, l0 keyIntervals
+	entries := make([]newFileEntry, len(files))
+	for i, f := range files {
+		start, end := f.Smallest.UserKey, f.Largest.UserKey
+		level := numLevels - 1
+		if l6.overlaps(cmp, start, end) || l0.overlaps(cmp, start, end) {
+			level = 0
+			l0.add(cmp, start, end)
+			// Every sstable placed so far has a largest sequence number no
+			// greater than f's, so it's older than f in the LSM.
+			for _, e := range entries[:i] {
+				p := e.Meta
+				if p.LargestSeqNum < f.SmallestSeqNum ||
+					cmp(p.Smallest.UserKey, end) > 0 || cmp(p.Largest.UserKey, start) < 0 {
+					continue
+				}
+				return nil, errors.Errorf(
+					"pebble: cannot order overlapping sstables %s [%s-%s] #%d-%d and %s [%s-%s] #%d-%d",
+					p.FileNum, p.Smallest.Pretty(comparer.FormatKey), p.Largest.Pretty(comparer.FormatKey),
+					p.SmallestSeqNum, p.LargestSeqNum,
+					f.FileNum, f.Smallest.Pretty(comparer.FormatKey), f.Largest.Pretty(comparer.FormatKey),
+					f.SmallestSeqNum, f.LargestSeqNum)
+			}
+		} else {
+			l6.add(cmp, start, end)
+		}
+		entries[i] = newFileEntry{Level: level, Meta: f}
+	}
+	return entries, nil
+}
+
+// keyIntervals is a set of inclusive user key intervals, kept as sorted,
+// disjoint intervals.
+type keyIntervals [][2][]byte
+
+// search returns the index of the first interval that ends at or after key.
+func (s keyIntervals) search(cmp Compare, key []byte) int {
+	return sort.Search(len(s), func(i int) bool { return cmp(s[i][1], key) >= 0 })
+}
+
+// overlaps returns whether any interval overlaps [start, end].
+func (s keyIntervals) overlaps(cmp Compare, start, end []byte) bool {
+	i := s.search(cmp, start)
+	return i < len(s) && cmp(s[i][0], end) <= 0
+}
+
+// add adds [start, end] to the set, merging it with the intervals it
+// overlaps.
+func (s *keyIntervals) add(cmp Compare, start, end []byte) {
+	i := s.search(cmp, start)
+	j := i
+	for ; j < len(*s) && cmp((*s)[j][0], end) <= 0; j++ {
+		if cmp((*s)[j][0], start) < 0 {
+			start = (*s)[j][0]
+		}
+		if cmp((*s)[j][1], end) > 0 {
+			end = (*s)[j][1]
+		}
+	}
+	*s = slices.Replace(*s, i, j, [2][]byte{start, end})
+}
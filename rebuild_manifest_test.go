@@ -0,0 +1,140 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRebuildManifest(t *testing.T) {
+	fs := vfs.NewMem()
+	opts := &Options{FS: fs, DisableAutomaticCompactions: true}
+	d, err := Open("db", opts)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("a%d", i)), []byte("old"), nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("b"), false /* parallelize */))
+	// Newer versions of some of the keys overlap the compacted sstable, along
+	// with a range deletion.
+	require.NoError(t, d.Set([]byte("a3"), []byte("new"), nil))
+	require.NoError(t, d.DeleteRange([]byte("a5"), []byte("a7"), nil))
+	require.NoError(t, d.Flush())
+	// A newer sstable that overlaps neither belongs in L6.
+	require.NoError(t, d.Set([]byte("c"), []byte("new"), nil))
+	require.NoError(t, d.Flush())
+	// Writes only in the WAL are replayed.
+	require.NoError(t, d.Set([]byte("e"), []byte("new"), nil))
+
+	contents := func(d *DB) string {
+		iter, err := d.NewIter(nil)
+		require.NoError(t, err)
+		var b strings.Builder
+		for valid := iter.First(); valid; valid = iter.Next() {
+			fmt.Fprintf(&b, "%s=%s ", iter.Key(), iter.Value())
+		}
+		require.NoError(t, iter.Close())
+		return b.String()
+	}
+	want := contents(d)
+	require.NoError(t, d.Close())
+
+	// Remove the MANIFESTs.
+	ls, err := fs.List("db")
+	require.NoError(t, err)
+	for _, filename := range ls {
+		if fileType, _, ok := base.ParseFilename(fs, filename); ok && fileType == fileTypeManifest {
+			require.NoError(t, fs.Remove(fs.PathJoin("db", filename)))
+		}
+	}
+	_, err = Open("db", opts)
+	require.Error(t, err)
+
+	require.NoError(t, RebuildManifest("db", opts))
+	d, err = Open("db", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	require.Equal(t, want, contents(d))
+	tables, err := d.SSTables()
+	require.NoError(t, err)
+	// L0 also holds the sstable flushed from the replayed WAL.
+	require.Len(t, tables[0], 2)
+	require.Len(t, tables[6], 2)
+	require.NoError(t, d.CheckLevels(nil /* stats */))
+
+	// New writes don't reuse the file numbers of the recovered sstables.
+	require.NoError(t, d.Set([]byte("f"), []byte("new"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false /* parallelize */))
+	require.Equal(t, want+"f=new ", contents(d))
+}
+
+// writeInterleavedSeqNumsDB writes a DB in dirname whose sstables overlap in
+// both keys and sequence numbers: a key in the sstable in L6 is newer than the
+// keys of the sstables above it. It returns the options of the DB.
+func writeInterleavedSeqNumsDB(t *testing.T, fs vfs.FS, dirname string) *Options {
+	opts := &Options{FS: fs, DisableAutomaticCompactions: true}
+	// Prevent the compaction of an sstable from L0 into L6 from being expanded
+	// to the large sstables in L0 that it doesn't overlap.
+	opts.Levels = make([]LevelOptions, numLevels)
+	for i := range opts.Levels {
+		opts.Levels[i].Compression = func() Compression { return NoCompression }
+		opts.Levels[i].TargetFileSize = 1 << 10
+	}
+	d, err := Open(dirname, opts)
+	require.NoError(t, err)
+	// Prevent the sequence numbers from being zeroed in L6.
+	snap := d.NewSnapshot()
+	for _, k := range []string{"a", "m", "z"} {
+		require.NoError(t, d.Set([]byte(k), []byte("old"), nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("zz"), false /* parallelize */))
+	// Both flushes land in L0, above the sstable in L6. Compacting the second
+	// one into L6 leaves the sstable in L6 with a key newer than those of the
+	// first one.
+	for _, k := range []string{"a", "m"} {
+		require.NoError(t, d.Set([]byte(k), bytes.Repeat([]byte("x"), 64<<10), nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("q"), []byte("new"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("q"), []byte("r"), false /* parallelize */))
+	tables, err := d.SSTables()
+	require.NoError(t, err)
+	require.NotEmpty(t, tables[0])
+	require.Len(t, tables[6], 1)
+	for _, table := range tables[0] {
+		require.Less(t, table.LargestSeqNum, tables[6][0].LargestSeqNum)
+	}
+	require.NoError(t, snap.Close())
+	require.NoError(t, d.Close())
+	return opts
+}
+
+func TestRebuildManifestInterleavedSeqNums(t *testing.T) {
+	fs := vfs.NewMem()
+	opts := writeInterleavedSeqNumsDB(t, fs, "db")
+
+	// The sstables can't be placed in an order in which newer keys shadow older
+	// ones, so the rebuild fails and the DB is untouched.
+	require.ErrorContains(t, RebuildManifest("db", opts), "cannot order overlapping sstables")
+	d, err := Open("db", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	v, closer, err := d.Get([]byte("m"))
+	require.NoError(t, err)
+	require.Len(t, v, 64<<10)
+	require.NoError(t, closer.Close())
+	require.NoError(t, d.CheckLevels(nil /* stats */))
+}
@@ -76,10 +76,8 @@ type syncQueue struct {
 	// power of 2. A slot is in use until the tail index has moved beyond it.
 	slots [SyncConcurrency]syncSlot
 
-	// blocked is an atomic boolean which indicates whether syncing is currently
-	// blocked or can proceed. It is used by the implementation of
-	// min-sync-interval to block syncing until the min interval has passed.
-	blocked atomic.Bool
+	// blocked indicates whether syncing is currently blocked or can proceed.
+	blocked syncBlockers
 }
 
 const dequeueBits = 32
@@ -107,12 +105,12 @@ func (q *syncQueue) push(wg *sync.WaitGroup, err *error) {
 	q.headTail.Add(1 << dequeueBits)
 }
 
-func (q *syncQueue) setBlocked() {
-	q.blocked.Store(true)
+func (q *syncQueue) setBlocked(b syncBlocker) {
+	q.blocked.set(b)
 }
 
-func (q *syncQueue) clearBlocked() {
-	q.blocked.Store(false)
+func (q *syncQueue) clearBlocked(b syncBlocker) {
+	q.blocked.clear(b)
 }
 
 func (q *syncQueue) empty() bool {
@@ -122,13 +120,13 @@ func (q *syncQueue) empty() bool {
 
 // load returns the head, tail of the queue for what should be synced to the
 // caller. It can return a head, tail of zero if syncing is blocked due to
-// min-sync-interval. It additionally returns the real length of this queue,
+// min-sync-interval or sync coalescing. It additionally returns the real length of this queue,
 // regardless of whether syncing is blocked.
 func (q *syncQueue) load() (head, tail, realLength uint32) {
 	ptrs := q.headTail.Load()
 	head, tail = q.unpack(ptrs)
 	realLength = head - tail
-	if q.blocked.Load() {
+	if q.blocked.any() {
 		return 0, 0, realLength
 	}
 	return head, tail, realLength
@@ -166,6 +164,41 @@ func (q *syncQueue) pop(head, tail uint32, err error, queueSemChan chan struct{}
 	return nil
 }
 
+// syncBlocker is a reason for which syncing may be blocked. Each reason is set
+// and cleared independently, and syncing proceeds once none is set.
+type syncBlocker uint8
+
+const (
+	// minSyncIntervalBlocker blocks syncing until min-sync-interval has passed
+	// since the previous sync.
+	minSyncIntervalBlocker syncBlocker = iota
+	// coalesceBlocker blocks syncing for the sync coalesce duration after the
+	// first sync request following a sync.
+	coalesceBlocker
+	numSyncBlockers
+)
+
+// syncBlockers holds the syncBlockers that are currently set.
+type syncBlockers [numSyncBlockers]atomic.Bool
+
+func (b *syncBlockers) set(r syncBlocker) {
+	b[r].Store(true)
+}
+
+func (b *syncBlockers) clear(r syncBlocker) {
+	b[r].Store(false)
+}
+
+// any returns true if syncing is blocked for any reason.
+func (b *syncBlockers) any() bool {
+	for i := range b {
+		if b[i].Load() {
+			return true
+		}
+	}
+	return false
+}
+
 // pendingSyncs abstracts out the handling of pending sync requests. In
 // standalone mode the implementation is a thin wrapper around syncQueue. In
 // the mode where the LogWriter can be subject to failover, there is no queue
@@ -182,8 +215,8 @@ func (q *syncQueue) pop(head, tail uint32, err error, queueSemChan chan struct{}
 //     snapshot to be overwritten.
 type pendingSyncs interface {
 	push(PendingSync)
-	setBlocked()
-	clearBlocked()
+	setBlocked(syncBlocker)
+	clearBlocked(syncBlocker)
 	empty() bool
 	snapshotForPop() pendingSyncsSnapshot
 	pop(snap pendingSyncsSnapshot, err error) error
@@ -256,10 +289,8 @@ type pendingSyncsWithHighestSyncIndex struct {
 	// to NoSyncIndex, and reset to NoSyncIndex after the sync.
 	index           atomic.Int64
 	snapshotBacking PendingSyncIndex
-	// blocked is an atomic boolean which indicates whether syncing is currently
-	// blocked or can proceed. It is used by the implementation of
-	// min-sync-interval to block syncing until the min interval has passed.
-	blocked                   atomic.Bool
+	// blocked indicates whether syncing is currently blocked or can proceed.
+	blocked                   syncBlockers
 	externalSyncQueueCallback ExternalSyncQueueCallback
 }
 
@@ -278,12 +309,12 @@ func (si *pendingSyncsWithHighestSyncIndex) push(ps PendingSync) {
 	si.index.Store(ps2.Index)
 }
 
-func (si *pendingSyncsWithHighestSyncIndex) setBlocked() {
-	si.blocked.Store(true)
+func (si *pendingSyncsWithHighestSyncIndex) setBlocked(b syncBlocker) {
+	si.blocked.set(b)
 }
 
-func (si *pendingSyncsWithHighestSyncIndex) clearBlocked() {
-	si.blocked.Store(false)
+func (si *pendingSyncsWithHighestSyncIndex) clearBlocked(b syncBlocker) {
+	si.blocked.clear(b)
 }
 
 func (si *pendingSyncsWithHighestSyncIndex) empty() bool {
@@ -297,7 +328,7 @@ func (si *pendingSyncsWithHighestSyncIndex) snapshotForPop() pendingSyncsSnapsho
 
 func (si *pendingSyncsWithHighestSyncIndex) load() int64 {
 	index := si.index.Load()
-	if index != NoSyncIndex && si.blocked.Load() {
+	if index != NoSyncIndex && si.blocked.any() {
 		index = NoSyncIndex
 	}
 	return index
@@ -451,6 +482,10 @@ type LogWriter struct {
 		closed chan struct{}
 		// Accumulated flush error.
 		err error
+		// syncCoalesceDuration is the duration for which syncing is delayed
+		// after a sync is requested, to coalesce more sync requests into the
+		// same fsync.
+		syncCoalesceDuration time.Duration
 		// minSyncInterval is the minimum duration between syncs.
 		minSyncInterval durationFunc
 		fsyncLatency    prometheus.Histogram
@@ -471,12 +506,20 @@ type LogWriter struct {
 	pendingSyncsBackingIndex pendingSyncsWithHighestSyncIndex
 
 	pendingSyncForSyncQueueBacking pendingSyncForSyncQueue
+
+	// syncRequests is the number of records written with a sync requested.
+	// It's added to LogWriterMetrics.SyncRequests by Metrics.
+	syncRequests atomic.Int64
 }
 
 // LogWriterConfig is a struct used for configuring new LogWriters
 type LogWriterConfig struct {
 	WALMinSyncInterval durationFunc
 	WALFsyncLatency    prometheus.Histogram
+	// WALSyncCoalesceDuration, if positive, is the duration for which the
+	// LogWriter waits after a sync is requested before syncing, so that the
+	// sync requests that arrive in the meantime share the fsync.
+	WALSyncCoalesceDuration time.Duration
 	// QueueSemChan is an optional channel to pop from when popping from
 	// LogWriter.flusher.syncQueue. It functions as a semaphore that prevents
 	// the syncQueue from overflowing (which will cause a panic). All production
@@ -556,6 +599,7 @@ func NewLogWriter(
 
 	f := &r.flusher
 	f.minSyncInterval = logWriterConfig.WALMinSyncInterval
+	f.syncCoalesceDuration = logWriterConfig.WALSyncCoalesceDuration
 	f.fsyncLatency = logWriterConfig.WALFsyncLatency
 
 	go func() {
@@ -570,6 +614,10 @@ func (w *LogWriter) flushLoop(context.Context) {
 
 	// Initialize idleStartTime to when the loop starts.
 	idleStartTime := time.Now()
+	// coalesceTimer ends the delay of syncing for f.syncCoalesceDuration, and
+	// coalesced is set once the pending sync requests have been delayed.
+	var coalesceTimer syncTimer
+	var coalesced bool
 	var syncTimer syncTimer
 	defer func() {
 		// Capture the idle duration between the last piece of work and when the
@@ -578,6 +626,9 @@ func (w *LogWriter) flushLoop(context.Context) {
 		if syncTimer != nil {
 			syncTimer.Stop()
 		}
+		if coalesceTimer != nil {
+			coalesceTimer.Stop()
+		}
 		close(f.closed)
 		f.Unlock()
 	}()
@@ -613,6 +664,12 @@ func (w *LogWriter) flushLoop(context.Context) {
 	//   requested, any previously queued flush work will be synced. This
 	//   motivates reading the syncing work (f.syncQ.load()) before picking up
 	//   the flush work (w.block.written.Load()).
+	//
+	// - If f.syncCoalesceDuration is positive, syncing is also blocked, by a
+	//   separate syncBlocker cleared by coalesceTimer, for that duration after
+	//   the first sync request following a sync is seen, so that the requests
+	//   that arrive in the meantime are synced by the same fsync. Syncing
+	//   proceeds once neither blocker is set.
 
 	// The list of full blocks that need to be written. This is copied from
 	// f.pending on every loop iteration, though the number of elements is
@@ -632,9 +689,10 @@ func (w *LogWriter) flushLoop(context.Context) {
 				break
 			}
 			if f.close {
-				// If the writer is closed, pretend the sync timer fired immediately so
-				// that we can process any queued sync requests.
-				f.pendingSyncs.clearBlocked()
+				// If the writer is closed, pretend the sync timers fired immediately
+				// so that we can process any queued sync requests.
+				f.pendingSyncs.clearBlocked(minSyncIntervalBlocker)
+				f.pendingSyncs.clearBlocked(coalesceBlocker)
 				if !f.pendingSyncs.empty() {
 					break
 				}
@@ -662,6 +720,21 @@ func (w *LogWriter) flushLoop(context.Context) {
 		f.pending = f.pending[:0]
 		f.metrics.PendingBufferLen.AddSample(int64(len(pending)))
 
+		if d := f.syncCoalesceDuration; d > 0 && !coalesced && !f.close && !f.pendingSyncs.empty() {
+			// Delay syncing to wait for more sync requests. Flushing proceeds in
+			// the meantime.
+			coalesced = true
+			f.pendingSyncs.setBlocked(coalesceBlocker)
+			if coalesceTimer == nil {
+				coalesceTimer = w.afterFunc(d, func() {
+					f.pendingSyncs.clearBlocked(coalesceBlocker)
+					f.ready.Signal()
+				})
+			} else {
+				coalesceTimer.Reset(d)
+			}
+		}
+
 		// Grab the list of sync waiters. Note that syncQueue.load() will return
 		// 0,0 while we're waiting for the min-sync-interval to expire. This
 		// allows flushing to proceed even if we're not ready to sync.
@@ -697,9 +770,15 @@ func (w *LogWriter) flushLoop(context.Context) {
 		if synced && f.fsyncLatency != nil {
 			f.fsyncLatency.Observe(float64(syncLatency))
 		}
+		if synced {
+			f.metrics.Fsyncs++
+			coalesced = false
+		}
 		f.err = err
 		if f.err != nil {
-			f.pendingSyncs.clearBlocked()
+			f.pendingSyncs.clearBlocked(minSyncIntervalBlocker)
+			f.pendingSyncs.clearBlocked(coalesceBlocker)
+			coalesced = false
 			// Update the idleStartTime if work could not be done, so that we don't
 			// include the duration we tried to do work as idle. We don't bother
 			// with the rest of the accounting, which means we will undercount.
@@ -711,10 +790,10 @@ func (w *LogWriter) flushLoop(context.Context) {
 			// A sync was performed. Make sure we've waited for the min sync
 			// interval before syncing again.
 			if min := f.minSyncInterval(); min > 0 {
-				f.pendingSyncs.setBlocked()
+				f.pendingSyncs.setBlocked(minSyncIntervalBlocker)
 				if syncTimer == nil {
 					syncTimer = w.afterFunc(min, func() {
-						f.pendingSyncs.clearBlocked()
+						f.pendingSyncs.clearBlocked(minSyncIntervalBlocker)
 						f.ready.Signal()
 					})
 				} else {
@@ -933,6 +1012,7 @@ func (w *LogWriter) SyncRecordGeneralized(p []byte, ps PendingSync) (logSize int
 		// blocks to the file if syncing has been requested. The contract is that
 		// any record written to the LogWriter to this point will be flushed to the
 		// OS and synced to disk.
+		w.syncRequests.Add(1)
 		f := &w.flusher
 		f.pendingSyncs.push(ps)
 		f.ready.Signal()
@@ -1009,6 +1089,7 @@ func (w *LogWriter) Metrics() LogWriterMetrics {
 	w.flusher.Lock()
 	defer w.flusher.Unlock()
 	m := *w.flusher.metrics
+	m.SyncRequests = w.syncRequests.Load()
 	return m
 }
 
@@ -1017,6 +1098,19 @@ type LogWriterMetrics struct {
 	WriteThroughput  base.ThroughputMetric
 	PendingBufferLen base.GaugeSampleMetric
 	SyncQueueLen     base.GaugeSampleMetric
+	// SyncRequests is the number of records whose writer requested a sync, and
+	// Fsyncs the number of fsyncs performed to satisfy them.
+	SyncRequests int64
+	Fsyncs       int64
+}
+
+// SyncsPerFsync returns the average number of sync requests satisfied by each
+// fsync, or zero if there were none.
+func (m *LogWriterMetrics) SyncsPerFsync() float64 {
+	if m.Fsyncs == 0 {
+		return 0
+	}
+	return float64(m.SyncRequests) / float64(m.Fsyncs)
 }
 
 // Merge merges metrics from x. Requires that x is non-nil.
@@ -1024,5 +1118,7 @@ func (m *LogWriterMetrics) Merge(x *LogWriterMetrics) error {
 	m.WriteThroughput.Merge(x.WriteThroughput)
 	m.PendingBufferLen.Merge(x.PendingBufferLen)
 	m.SyncQueueLen.Merge(x.SyncQueueLen)
+	m.SyncRequests += x.SyncRequests
+	m.Fsyncs += x.Fsyncs
 	return nil
 }
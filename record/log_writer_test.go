@@ -366,6 +366,63 @@ func TestMinSyncIntervalClose(t *testing.T) {
 	wg.Wait()
 }
 
+func TestSyncCoalesceDuration(t *testing.T) {
+	const coalesceDuration = 100 * time.Millisecond
+
+	f := &syncFile{}
+	w := NewLogWriter(f, 0, LogWriterConfig{
+		WALSyncCoalesceDuration: coalesceDuration,
+		WALFsyncLatency:         prometheus.NewHistogram(prometheus.HistogramOpts{}),
+	})
+
+	var timer fakeTimer
+	w.afterFunc = func(d time.Duration, f func()) syncTimer {
+		if d != coalesceDuration {
+			t.Fatalf("expected coalesceDuration %s, but found %s", coalesceDuration, d)
+		}
+		timer.f = f
+		timer.Reset(d)
+		return &timer
+	}
+
+	syncRecord := func() *sync.WaitGroup {
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		_, err := w.SyncRecord([]byte("a"), wg, new(error))
+		require.NoError(t, err)
+		return wg
+	}
+
+	for round := 0; round < 2; round++ {
+		// The sync requests are not synced until the timer fires, although the
+		// records are written.
+		startSyncPos := f.syncPos.Load()
+		var wgs []*sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wgs = append(wgs, syncRecord())
+		}
+		require.NoError(t, try(time.Millisecond, 5*time.Second, func() error {
+			if v := f.writePos.Load(); v <= startSyncPos {
+				return errors.Errorf("expected writePos > %d, but found %d", startSyncPos, v)
+			}
+			return nil
+		}))
+		require.Equal(t, startSyncPos, f.syncPos.Load())
+
+		// Fire the timer. All the requests are satisfied by one fsync.
+		timer.f()
+		for _, wg := range wgs {
+			wg.Wait()
+		}
+		require.Equal(t, f.writePos.Load(), f.syncPos.Load())
+	}
+	require.NoError(t, w.Close())
+	m := w.Metrics()
+	require.Equal(t, int64(20), m.SyncRequests)
+	require.Equal(t, int64(2), m.Fsyncs)
+	require.Equal(t, 10.0, m.SyncsPerFsync())
+}
+
 type syncFileWithWait struct {
 	f       syncFile
 	writeWG sync.WaitGroup
@@ -579,13 +636,21 @@ func TestPendingSyncsWithHighestSyncIndex(t *testing.T) {
 	require.False(t, q.empty())
 	require.Equal(t, int64(0), q.load())
 	require.Equal(t, int64(0), q.snapshotForPop().(*PendingSyncIndex).Index)
-	q.setBlocked()
+	q.setBlocked(minSyncIntervalBlocker)
 	require.True(t, q.empty())
 	require.Equal(t, int64(NoSyncIndex), q.load())
 	require.Equal(t, int64(NoSyncIndex), q.snapshotForPop().(*PendingSyncIndex).Index)
-	q.clearBlocked()
+	q.clearBlocked(minSyncIntervalBlocker)
 	require.False(t, q.empty())
 	require.Equal(t, int64(0), q.load())
+	// Syncing stays blocked until every blocker is cleared: the coalesce
+	// timer firing doesn't end the min-sync-interval.
+	q.setBlocked(minSyncIntervalBlocker)
+	q.setBlocked(coalesceBlocker)
+	q.clearBlocked(coalesceBlocker)
+	require.True(t, q.empty())
+	q.clearBlocked(minSyncIntervalBlocker)
+	require.False(t, q.empty())
 
 	const highestIndex = 100
 	testErr := errors.New("test error")
@@ -0,0 +1,96 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// RewriteLevelStats describes the work done by DB.RewriteLevel.
+type RewriteLevelStats struct {
+	// TablesRewritten is the number of sstables rewritten.
+	TablesRewritten int
+	// BytesRead is the total size of the sstables that were rewritten, and
+	// BytesWritten that of the sstables that replaced them.
+	BytesRead    uint64
+	BytesWritten uint64
+}
+
+// RewriteLevel rewrites the sstables in the given level that don't use the
+// given compression with it, for migrating existing data to a new compression
+// algorithm. Each sstable is rewritten by a rewrite compaction whose output
+// stays in the same level, which doesn't change the DB's contents. Virtual
+// sstables are not rewritten, since their backing sstables may be shared.
+//
+// RewriteLevel blocks until every such sstable present in the level when it
+// was called has been rewritten, or an error occurs, logging its progress as
+// it goes. It's resumable: since sstables that already use the compression
+// are skipped, calling it again after an error or a restart picks up where it
+// left off. Sstables that are compacted into another level before they're
+// rewritten are skipped, and compactions, including those of the rewritten
+// sstables, continue to use the compression configured for their output level
+// by LevelOptions.Compression, which should be updated to match.
+func (d *DB) RewriteLevel(level int, newCompression Compression) (RewriteLevelStats, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return RewriteLevelStats{}, ErrReadOnly
+	}
+	if level < 0 || level >= numLevels {
+		return RewriteLevelStats{}, errors.Errorf("pebble: invalid level %d", level)
+	}
+	if newCompression < DefaultCompression || newCompression >= sstable.NCompression {
+		return RewriteLevelStats{}, errors.Errorf("pebble: invalid compression %d", newCompression)
+	}
+	newCompression = resolveDefaultCompression(newCompression)
+
+	candidates, err := d.compressionRewriteCandidates(level, newCompression)
+	if err != nil {
+		return RewriteLevelStats{}, err
+	}
+	var stats RewriteLevelStats
+	for i, f := range candidates {
+		c, err := d.rewriteTable(level, f, compactionKindRewrite, newCompression)
+		if err != nil && !errors.Is(err, ErrCancelledCompaction) {
+			return stats, err
+		}
+		if err == nil && c != nil {
+			stats.TablesRewritten++
+			stats.BytesRead += f.Size
+			if m := c.metrics[level]; m != nil {
+				stats.BytesWritten += m.BytesCompacted
+			}
+		}
+		d.opts.Logger.Infof("rewriting L%d with %s compression: %d of %d sstables done",
+			level, newCompression, i+1, len(candidates))
+	}
+	return stats, nil
+}
+
+// compressionRewriteCandidates returns the physical sstables in the given
+// level of the current version that don't use the given compression.
+func (d *DB) compressionRewriteCandidates(
+	level int, compression Compression,
+) ([]*fileMetadata, error) {
+	rs := d.loadReadState()
+	defer rs.unref()
+	var candidates []*fileMetadata
+	iter := rs.current.Levels[level].Iter()
+	for f := iter.First(); f != nil; f = iter.Next() {
+		if f.Virtual {
+			continue
+		}
+		props, err := d.tableCache.getTableProperties(f)
+		if err != nil {
+			return nil, err
+		}
+		if props.CompressionName != compression.String() {
+			candidates = append(candidates, f)
+		}
+	}
+	return candidates, nil
+}
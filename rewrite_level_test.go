@@ -0,0 +1,90 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteLevel(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem(), DisableAutomaticCompactions: true})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	// Compact two halves of the keys into separate sstables in L6.
+	for _, start := range []int{0, 500} {
+		for i := start; i < start+500; i++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("k%04d", i)), []byte(fmt.Sprint(i)), nil))
+		}
+		require.NoError(t, d.Compact([]byte("k"), []byte("l"), false /* parallelize */))
+	}
+	require.NoError(t, d.DeleteRange([]byte("k0100"), []byte("k0200"), nil))
+	require.NoError(t, d.Set([]byte("k0500"), []byte("new"), nil))
+	require.NoError(t, d.Flush())
+
+	// compressions returns the compression of each sstable, by level.
+	compressions := func() [numLevels][]string {
+		tables, err := d.SSTables(WithProperties())
+		require.NoError(t, err)
+		var res [numLevels][]string
+		for level, infos := range tables {
+			for _, info := range infos {
+				res[level] = append(res[level], info.Properties.CompressionName)
+			}
+		}
+		return res
+	}
+	contents := func() string {
+		iter, err := d.NewIter(nil)
+		require.NoError(t, err)
+		var b strings.Builder
+		for valid := iter.First(); valid; valid = iter.Next() {
+			fmt.Fprintf(&b, "%s=%s ", iter.Key(), iter.Value())
+		}
+		require.NoError(t, iter.Close())
+		return b.String()
+	}
+	before := compressions()
+	require.Len(t, before[0], 1)
+	require.Len(t, before[6], 2)
+	wantContents := contents()
+
+	_, err = d.RewriteLevel(numLevels, ZstdCompression)
+	require.Error(t, err)
+
+	stats, err := d.RewriteLevel(6, ZstdCompression)
+	require.NoError(t, err)
+	after := compressions()
+	require.Equal(t, before[0], after[0])
+	require.Len(t, after[6], len(before[6]))
+	for _, c := range after[6] {
+		require.Equal(t, "ZSTD", c)
+	}
+	require.Equal(t, len(before[6]), stats.TablesRewritten)
+	require.Greater(t, stats.BytesRead, uint64(0))
+	require.Greater(t, stats.BytesWritten, uint64(0))
+	require.Equal(t, uint64(d.Metrics().Levels[6].Size), stats.BytesWritten)
+	require.Equal(t, wantContents, contents())
+	require.NoError(t, d.CheckLevels(nil /* stats */))
+
+	// The sstables that already use the compression aren't rewritten again.
+	stats, err = d.RewriteLevel(6, ZstdCompression)
+	require.NoError(t, err)
+	require.Equal(t, RewriteLevelStats{}, stats)
+
+	// DefaultCompression is snappy.
+	stats, err = d.RewriteLevel(0, DefaultCompression)
+	require.NoError(t, err)
+	require.Zero(t, stats.TablesRewritten)
+	stats, err = d.RewriteLevel(0, NoCompression)
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.TablesRewritten)
+	require.Equal(t, []string{"NoCompression"}, compressions()[0])
+	require.Equal(t, wantContents, contents())
+}
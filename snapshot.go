@@ -45,7 +45,7 @@ func (s *Snapshot) Get(key []byte) ([]byte, io.Closer, error) {
 	if s.db == nil {
 		panic(ErrClosed)
 	}
-	return s.db.getInternal(key, nil /* batch */, s)
+	return s.db.getInternal(key, nil /* batch */, s, 0 /* maxMergeOperands */)
 }
 
 // NewIter returns an iterator that is unpositioned (Iterator.Valid() will
@@ -118,6 +118,10 @@ func (s *Snapshot) closeLocked() error {
 	if e := s.db.mu.snapshots.earliest(); e > s.seqNum {
 		s.db.maybeScheduleCompactionPicker(pickElisionOnly)
 	}
+	// Files that s split into stripes may now be rewritten without them.
+	if s.db.opts.SnapshotStripeCompactionWeight > 0 {
+		s.db.maybeScheduleCompactionPicker(pickSnapshotStripe)
+	}
 	s.db = nil
 	return nil
 }
@@ -138,6 +142,12 @@ func (s *Snapshot) Close() error {
 	return s.closeLocked()
 }
 
+// SeqNum returns the sequence number the snapshot reads at: it observes the
+// writes with smaller sequence numbers.
+func (s *Snapshot) SeqNum() uint64 {
+	return s.seqNum
+}
+
 type snapshotList struct {
 	root Snapshot
 }
@@ -206,6 +216,55 @@ func (l *snapshotList) remove(s *Snapshot) {
 	s.list = nil // avoid memory leaks
 }
 
+// SnapshotInfo describes an open snapshot.
+type SnapshotInfo struct {
+	// SeqNum is the sequence number the snapshot reads at, as returned by
+	// Snapshot.SeqNum or EventuallyFileOnlySnapshot.SeqNum.
+	SeqNum uint64
+	// EventuallyFileOnly is true if the snapshot is an
+	// EventuallyFileOnlySnapshot.
+	EventuallyFileOnly bool
+}
+
+// FilePinnedBy returns the open snapshots, in increasing sequence number
+// order, whose sequence numbers fall within the sequence number range of the
+// sstable with the given file number in the current version. Such a snapshot
+// observes some of the sstable's keys but not others, so the older versions of
+// keys and the deleted keys the sstable retains for the snapshot can't be
+// dropped by compactions until it's released. FilePinnedBy returns nil if no
+// snapshots pin the sstable or if it's not in the current version.
+//
+// Snapshots with sequence numbers above the sstable's range may also prevent
+// the sstable's tombstones from dropping the data they delete in lower
+// levels; they aren't reported.
+func (d *DB) FilePinnedBy(fileNum FileNum) []SnapshotInfo {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var file *fileMetadata
+	for _, level := range d.mu.versions.currentVersion().Levels {
+		iter := level.Iter()
+		for f := iter.First(); f != nil && file == nil; f = iter.Next() {
+			if f.FileNum == fileNum {
+				file = f
+			}
+		}
+	}
+	if file == nil {
+		return nil
+	}
+	var infos []SnapshotInfo
+	l := &d.mu.snapshots.snapshotList
+	for s := l.root.next; s != &l.root; s = s.next {
+		if file.SmallestSeqNum < s.seqNum && s.seqNum <= file.LargestSeqNum {
+			infos = append(infos, SnapshotInfo{SeqNum: s.seqNum, EventuallyFileOnly: s.efos != nil})
+		}
+	}
+	return infos
+}
+
 // EventuallyFileOnlySnapshot (aka EFOS) provides a read-only point-in-time view
 // of the database state, similar to Snapshot. An EventuallyFileOnlySnapshot
 // induces less write amplification than Snapshot, at the cost of increased space
@@ -276,6 +335,7 @@ func (d *DB) makeEventuallyFileOnlySnapshot(keyRanges []KeyRange) *EventuallyFil
 	if isFileOnly {
 		es.mu.vers = d.mu.versions.currentVersion()
 		es.mu.vers.Ref()
+		d.mu.snapshots.fileOnly[es] = struct{}{}
 	} else {
 		s := &Snapshot{
 			db:     d,
@@ -312,6 +372,7 @@ func (es *EventuallyFileOnlySnapshot) transitionToFileOnlySnapshot(vers *version
 	}
 	// The caller has already called Ref() on vers.
 	es.mu.vers = vers
+	es.db.mu.snapshots.fileOnly[es] = struct{}{}
 	// NB: The callers should have already done a check of es.excised.
 	oldSnap := es.mu.snap
 	es.mu.snap = nil
@@ -395,6 +456,12 @@ func (es *EventuallyFileOnlySnapshot) WaitForFileOnlySnapshot(
 	return nil
 }
 
+// SeqNum returns the sequence number the snapshot reads at: it observes the
+// writes with smaller sequence numbers.
+func (es *EventuallyFileOnlySnapshot) SeqNum() uint64 {
+	return es.seqNum
+}
+
 // Close closes the file-only snapshot and releases all referenced resources.
 // Not idempotent.
 func (es *EventuallyFileOnlySnapshot) Close() error {
@@ -411,6 +478,7 @@ func (es *EventuallyFileOnlySnapshot) Close() error {
 	}
 	if es.mu.vers != nil {
 		es.mu.vers.UnrefLocked()
+		delete(es.db.mu.snapshots.fileOnly, es)
 	}
 	return nil
 }
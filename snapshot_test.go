@@ -380,3 +380,32 @@ func TestNewSnapshotRace(t *testing.T) {
 	wg.Wait()
 	require.NoError(t, d.Close())
 }
+
+func TestFilePinnedBy(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), nil, nil))
+	s1 := d.NewSnapshot()
+	defer func() { require.NoError(t, s1.Close()) }()
+	require.NoError(t, d.Set([]byte("b"), nil, nil))
+	es := d.NewEventuallyFileOnlySnapshot([]KeyRange{{Start: []byte("a"), End: []byte("z")}})
+	defer func() { require.NoError(t, es.Close()) }()
+	require.NoError(t, d.Set([]byte("c"), nil, nil))
+	require.NoError(t, d.Flush())
+	s2 := d.NewSnapshot()
+	defer func() { require.NoError(t, s2.Close()) }()
+
+	tables, err := d.SSTables()
+	require.NoError(t, err)
+	require.Len(t, tables[0], 1)
+	fileNum := tables[0][0].FileNum
+
+	// The snapshot taken after the flush doesn't split the sstable, and the
+	// eventually file-only snapshot became file-only when its memtable was
+	// flushed, so it retains the whole sstable rather than its keys.
+	require.Less(t, es.SeqNum(), s2.SeqNum())
+	require.Equal(t, []SnapshotInfo{{SeqNum: s1.SeqNum()}}, d.FilePinnedBy(fileNum))
+	require.Nil(t, d.FilePinnedBy(fileNum+100))
+}
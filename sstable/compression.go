@@ -20,7 +20,7 @@ func decompressedLen(blockType blockType, b []byte) (int, int, error) {
 	case snappyCompressionBlockType:
 		l, err := snappy.DecodedLen(b)
 		return l, 0, err
-	case zstdCompressionBlockType:
+	case zstdCompressionBlockType, zstdDictCompressionBlockType:
 		// This will also be used by zlib, bzip2 and lz4 to retrieve the decodedLen
 		// if we implement these algorithms in the future.
 		decodedLenU64, varIntLen := binary.Uvarint(b)
@@ -34,8 +34,9 @@ func decompressedLen(blockType blockType, b []byte) (int, int, error) {
 }
 
 // decompressInto decompresses compressed into buf. The buf slice must have the
-// exact size as the decompressed value.
-func decompressInto(blockType blockType, compressed []byte, buf []byte) error {
+// exact size as the decompressed value. The dict is the table's compression
+// dictionary, required to decompress zstdDictCompressionBlockType blocks.
+func decompressInto(blockType blockType, compressed []byte, buf []byte, dict []byte) error {
 	var result []byte
 	var err error
 	switch blockType {
@@ -43,6 +44,11 @@ func decompressInto(blockType blockType, compressed []byte, buf []byte) error {
 		result, err = snappy.Decode(buf, compressed)
 	case zstdCompressionBlockType:
 		result, err = decodeZstd(buf, compressed)
+	case zstdDictCompressionBlockType:
+		if len(dict) == 0 {
+			return base.CorruptionErrorf("pebble/table: missing compression dictionary")
+		}
+		result, err = decodeZstdDict(buf, compressed, dict)
 	default:
 		return base.CorruptionErrorf("pebble/table: unknown block compression: %d", errors.Safe(blockType))
 	}
@@ -59,7 +65,7 @@ func decompressInto(blockType blockType, compressed []byte, buf []byte) error {
 // decompressBlock decompresses an SST block, with manually-allocated space.
 // NB: If decompressBlock returns (nil, nil), no decompression was necessary and
 // the caller may use `b` directly.
-func decompressBlock(blockType blockType, b []byte) (*cache.Value, error) {
+func decompressBlock(blockType blockType, b []byte, dict []byte) (*cache.Value, error) {
 	if blockType == noCompressionBlockType {
 		return nil, nil
 	}
@@ -72,7 +78,7 @@ func decompressBlock(blockType blockType, b []byte) (*cache.Value, error) {
 	// Allocate sufficient space from the cache.
 	decoded := cache.Alloc(decodedLen)
 	decodedBuf := decoded.Buf()
-	if err := decompressInto(blockType, b, decodedBuf); err != nil {
+	if err := decompressInto(blockType, b, decodedBuf, dict); err != nil {
 		cache.Free(decoded)
 		return nil, err
 	}
@@ -80,8 +86,9 @@ func decompressBlock(blockType blockType, b []byte) (*cache.Value, error) {
 }
 
 // compressBlock compresses an SST block, using compressBuf as the desired destination.
+// If dict is non-empty, zstd compression uses it as a dictionary.
 func compressBlock(
-	compression Compression, b []byte, compressedBuf []byte,
+	compression Compression, b []byte, compressedBuf []byte, dict []byte,
 ) (blockType blockType, compressed []byte) {
 	switch compression {
 	case SnappyCompression:
@@ -96,6 +103,9 @@ func compressBlock(
 	varIntLen := binary.PutUvarint(compressedBuf, uint64(len(b)))
 	switch compression {
 	case ZstdCompression:
+		if len(dict) > 0 {
+			return zstdDictCompressionBlockType, encodeZstdDict(compressedBuf, varIntLen, b, dict)
+		}
 		return zstdCompressionBlockType, encodeZstd(compressedBuf, varIntLen, b)
 	default:
 		return noCompressionBlockType, b
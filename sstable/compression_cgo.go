@@ -9,6 +9,7 @@ package sstable
 
 import (
 	"bytes"
+	"io"
 
 	"github.com/DataDog/zstd"
 )
@@ -36,3 +37,25 @@ func encodeZstd(compressedBuf []byte, varIntLen int, b []byte) []byte {
 	writer.Close()
 	return buf.Bytes()
 }
+
+// decodeZstdDict decompresses src, compressed using the zstd dictionary dict,
+// into dst.
+func decodeZstdDict(dst, src, dict []byte) ([]byte, error) {
+	reader := zstd.NewReaderDict(bytes.NewReader(src), dict)
+	defer reader.Close()
+	n, err := io.ReadFull(reader, dst)
+	if err != nil {
+		return nil, err
+	}
+	return dst[:n], nil
+}
+
+// encodeZstdDict compresses b using the zstd dictionary dict, appending the
+// result to compressedBuf[:varIntLen].
+func encodeZstdDict(compressedBuf []byte, varIntLen int, b []byte, dict []byte) []byte {
+	buf := bytes.NewBuffer(compressedBuf[:varIntLen])
+	writer := zstd.NewWriterLevelDict(buf, 3, dict)
+	writer.Write(b)
+	writer.Close()
+	return buf.Bytes()
+}
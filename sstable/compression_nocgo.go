@@ -7,7 +7,11 @@
 
 package sstable
 
-import "github.com/klauspost/compress/zstd"
+import (
+	"bytes"
+
+	"github.com/klauspost/compress/zstd"
+)
 
 // decodeZstd decompresses src with the Zstandard algorithm. The destination
 // buffer must already be sufficiently sized, otherwise decodeZstd may error.
@@ -27,3 +31,37 @@ func encodeZstd(compressedBuf []byte, varIntLen int, b []byte) []byte {
 	defer encoder.Close()
 	return encoder.EncodeAll(b, compressedBuf[:varIntLen])
 }
+
+// zstdDictMagic begins the dictionaries trained with the zstd dictionary
+// builder. Like the cgo implementation, which leaves the choice to libzstd, a
+// dictionary is loaded as a trained dictionary if it begins with zstdDictMagic
+// and as raw content otherwise, so that both implementations produce and accept
+// the same frames for the same dictionary.
+var zstdDictMagic = []byte{0x37, 0xa4, 0x30, 0xec}
+
+// decodeZstdDict decompresses src, compressed using the zstd dictionary dict,
+// into dst.
+func decodeZstdDict(dst, src, dict []byte) ([]byte, error) {
+	opt := zstd.WithDecoderDictRaw(0, dict)
+	if bytes.HasPrefix(dict, zstdDictMagic) {
+		opt = zstd.WithDecoderDicts(dict)
+	}
+	decoder, err := zstd.NewReader(nil, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+	return decoder.DecodeAll(src, dst[:0])
+}
+
+// encodeZstdDict compresses b using the zstd dictionary dict, appending the
+// result to compressedBuf[:varIntLen].
+func encodeZstdDict(compressedBuf []byte, varIntLen int, b []byte, dict []byte) []byte {
+	opt := zstd.WithEncoderDictRaw(0, dict)
+	if bytes.HasPrefix(dict, zstdDictMagic) {
+		opt = zstd.WithEncoderDict(dict)
+	}
+	encoder, _ := zstd.NewWriter(nil, opt)
+	defer encoder.Close()
+	return encoder.EncodeAll(b, compressedBuf[:varIntLen])
+}
@@ -5,11 +5,14 @@
 package sstable
 
 import (
+	"bytes"
 	"encoding/binary"
 	"math/rand"
 	"testing"
 	"time"
 
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/cache"
 	"github.com/stretchr/testify/require"
 )
@@ -27,8 +30,8 @@ func TestCompressionRoundtrip(t *testing.T) {
 			// not sufficient, compressBlock should allocate one that is.
 			compressedBuf := make([]byte, rng.Intn(1<<10 /* 1 KiB */))
 
-			btyp, compressed := compressBlock(compression, payload, compressedBuf)
-			v, err := decompressBlock(btyp, compressed)
+			btyp, compressed := compressBlock(compression, payload, compressedBuf, nil /* dict */)
+			v, err := decompressBlock(btyp, compressed, nil /* dict */)
 			require.NoError(t, err)
 			got := payload
 			if v != nil {
@@ -53,8 +56,28 @@ func TestDecompressionError(t *testing.T) {
 	fauxCompressed = fauxCompressed[:n+compressedPayloadLen]
 	rng.Read(fauxCompressed[n:])
 
-	v, err := decompressBlock(zstdCompressionBlockType, fauxCompressed)
+	v, err := decompressBlock(zstdCompressionBlockType, fauxCompressed, nil /* dict */)
 	t.Log(err)
 	require.Error(t, err)
 	require.Nil(t, v)
 }
+
+func TestCompressionDictRoundtrip(t *testing.T) {
+	dict := bytes.Repeat([]byte("pebble-compression-dictionary-"), 64)
+	payload := bytes.Repeat([]byte("pebble-compression-"), 16)
+
+	btyp, compressed := compressBlock(ZstdCompression, payload, nil /* compressedBuf */, dict)
+	require.Equal(t, zstdDictCompressionBlockType, btyp)
+	v, err := decompressBlock(btyp, compressed, dict)
+	require.NoError(t, err)
+	require.Equal(t, payload, v.Buf())
+	cache.Free(v)
+
+	// Decompressing without the dictionary is a corruption error.
+	_, err = decompressBlock(btyp, compressed, nil /* dict */)
+	require.True(t, errors.Is(err, base.ErrCorruption))
+
+	// Other compression algorithms ignore the dictionary.
+	btyp, _ = compressBlock(SnappyCompression, payload, nil /* compressedBuf */, dict)
+	require.Equal(t, snappyCompressionBlockType, btyp)
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// contentHasher computes the Properties.ContentHash of an sstable, a hash of
+// its keys and values in the order they're added. Sequence numbers are
+// excluded, so that sstables holding the same keys and values hash the same
+// regardless of when the keys were written. Point keys, range deletions and
+// range keys are hashed separately, since the Writer may receive them in any
+// relative order.
+type contentHasher struct {
+	points    *xxhash.Digest
+	rangeDels *xxhash.Digest
+	rangeKeys *xxhash.Digest
+	buf       []byte
+}
+
+func newContentHasher() *contentHasher {
+	return &contentHasher{
+		points:    xxhash.New(),
+		rangeDels: xxhash.New(),
+		rangeKeys: xxhash.New(),
+	}
+}
+
+// add hashes a key and its value into d. Each is length-prefixed so that the
+// boundaries between keys and values are unambiguous.
+func (h *contentHasher) add(d *xxhash.Digest, key base.InternalKey, value []byte) {
+	h.buf = binary.AppendUvarint(h.buf[:0], uint64(len(key.UserKey)))
+	h.buf = append(h.buf, key.UserKey...)
+	h.buf = append(h.buf, byte(key.Kind()))
+	h.buf = binary.AppendUvarint(h.buf, uint64(len(value)))
+	_, _ = d.Write(h.buf)
+	_, _ = d.Write(value)
+}
+
+// sum returns the hash of everything added, formatted as hex.
+func (h *contentHasher) sum() string {
+	var b [24]byte
+	binary.LittleEndian.PutUint64(b[0:], h.points.Sum64())
+	binary.LittleEndian.PutUint64(b[8:], h.rangeDels.Sum64())
+	binary.LittleEndian.PutUint64(b[16:], h.rangeKeys.Sum64())
+	return fmt.Sprintf("%016x", xxhash.Sum64(b[:]))
+}
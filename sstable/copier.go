@@ -64,6 +64,12 @@ func CopySpan(
 		o.FilterPolicy = nil
 	}
 	o.TableFormat = r.tableFormat
+	// The copied data blocks must remain decompressible, so the output carries
+	// the input's compression dictionary, if any.
+	if r.compressionDict != nil {
+		o.Compression = ZstdCompression
+		o.CompressionDictionary = r.compressionDict
+	}
 	w := NewWriter(output, o)
 
 	// We don't want the writer to attempt to write out block property data in
@@ -124,6 +130,10 @@ func CopySpan(
 	// Remove all user properties to disable block properties, which we do not
 	// calculate.
 	w.props.UserProperties = nil
+	// The content hash covers keys outside the span too, and the Writer doesn't
+	// see the copied keys to compute its own.
+	w.props.ContentHash = ""
+	w.contentHash = nil
 	// Reset props that we'll re-derive as we build our own index.
 	w.props.IndexPartitions = 0
 	w.props.TopLevelIndexSize = 0
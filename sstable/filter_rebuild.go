@@ -0,0 +1,194 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"context"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/rangedel"
+	"github.com/cockroachdb/pebble/internal/rangekey"
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+)
+
+// ErrFilterRebuildUnsupported is returned by RebuildFilter for sstables whose
+// layout doesn't permit copying their data blocks unchanged.
+var ErrFilterRebuildUnsupported = errors.New("pebble: cannot rebuild the filter of an sstable with value blocks")
+
+// RebuildFilter produces a copy of an input sstable with a filter built by
+// o.FilterPolicy, or no filter if o.FilterPolicy is nil.
+//
+// Like CopySpan, RebuildFilter copies the data blocks of the input byte-for-byte
+// and builds a new index pointing into them, avoiding all decompression and
+// recompression of the data. The keys are read only to add their prefixes to
+// the new filter. The range deletions and range keys of the input are carried
+// over, as are its properties, including its user properties and the block
+// properties within its index. The table format of the input is preserved.
+//
+// RebuildFilter returns ErrFilterRebuildUnsupported if the input has value
+// blocks, since these are referenced by the data blocks. Such sstables must be
+// rewritten from scratch.
+//
+// Closes input and finishes or aborts output in all cases, including on errors.
+func RebuildFilter(
+	ctx context.Context,
+	input objstorage.Readable,
+	rOpts ReaderOptions,
+	output objstorage.Writable,
+	o WriterOptions,
+) (size uint64, _ error) {
+	r, err := NewReader(input, rOpts)
+	if err != nil {
+		input.Close()
+		output.Abort()
+		return 0, err
+	}
+	defer r.Close() // r.Close now owns calling input.Close().
+
+	o.TableFormat = r.tableFormat
+	// The copied data blocks must remain decompressible, so the output carries
+	// the input's compression dictionary, if any, and no other.
+	if r.compressionDict != nil {
+		o.Compression = ZstdCompression
+		o.CompressionDictionary = r.compressionDict
+	} else {
+		o.CompressionDictionary = nil
+	}
+	w := NewWriter(output, o)
+	// The block properties within the copied index entries are carried over, so
+	// the writer mustn't compute its own.
+	w.blockPropCollectors = nil
+	defer func() {
+		if w != nil {
+			// set w.err to any non-nil error just so it aborts instead of finishing.
+			w.err = base.ErrNotFound
+			// w.Close now owns calling output.Abort().
+			w.Close()
+		}
+	}()
+
+	if r.Properties.NumValueBlocks > 0 {
+		return 0, ErrFilterRebuildUnsupported
+	}
+
+	// Add the prefix of every point key to the new filter.
+	iter, err := r.NewIter(NoTransforms, nil /* lower */, nil /* upper */)
+	if err != nil {
+		return 0, err
+	}
+	for kv := iter.First(); kv != nil; kv = iter.Next() {
+		w.maybeAddToFilter(kv.K.UserKey)
+	}
+	if err := firstError(iter.Error(), iter.Close()); err != nil {
+		return 0, err
+	}
+
+	var preallocRH objstorageprovider.PreallocatedReadHandle
+	rh := objstorageprovider.UsePreallocatedReadHandle(
+		ctx, r.readable, objstorage.ReadBeforeForIndexAndFilter, &preallocRH)
+	defer rh.Close()
+	indexH, err := r.readIndex(ctx, rh, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer indexH.Release()
+
+	// Find all the data blocks: those intersecting the span from the smallest
+	// possible key through the last separator in the top-level index.
+	top, err := newBlockIter(r.Compare, r.Split, indexH.Get(), NoTransforms)
+	if err != nil {
+		return 0, err
+	}
+	var end InternalKey
+	kv := top.Last()
+	hasBlocks := kv != nil
+	if hasBlocks {
+		end = kv.K.Clone()
+	}
+	if err := firstError(top.Error(), top.Close()); err != nil {
+		return 0, err
+	}
+	var blocks []indexEntry
+	if hasBlocks {
+		blocks, err = intersectingIndexEntries(ctx, r, rh, indexH, InternalKey{}, end)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Copy the data blocks and add index entries pointing to them.
+	if len(blocks) > 0 {
+		offset := blocks[0].bh.Offset
+		length := blocks[len(blocks)-1].bh.Offset + blocks[len(blocks)-1].bh.Length + blockTrailerLen - offset
+		if err := objstorage.Copy(ctx, r.readable, w.writable, offset, length); err != nil {
+			return 0, err
+		}
+		w.meta.Size += length
+		for i := range blocks {
+			blocks[i].bh.Offset -= offset
+			if err := w.addIndexEntrySep(blocks[i].sep, blocks[i].bh, w.dataBlockBuf.tmp[:]); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Carry over the range deletions and range keys, which are already
+	// fragmented.
+	rangeDelIter, err := r.NewRawRangeDelIter(NoTransforms)
+	if err != nil {
+		return 0, err
+	}
+	if rangeDelIter != nil {
+		defer rangeDelIter.Close()
+		s, err := rangeDelIter.First()
+		for ; s != nil; s, err = rangeDelIter.Next() {
+			if err := rangedel.Encode(s, w.addTombstone); err != nil {
+				return 0, err
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	rangeKeyIter, err := r.NewRawRangeKeyIter(NoTransforms)
+	if err != nil {
+		return 0, err
+	}
+	if rangeKeyIter != nil {
+		defer rangeKeyIter.Close()
+		s, err := rangeKeyIter.First()
+		for ; s != nil; s, err = rangeKeyIter.Next() {
+			if err := rangekey.Encode(s, w.AddRangeKey); err != nil {
+				return 0, err
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Copy all the props from the source file, resetting those that are
+	// re-derived as the new index and filter are written.
+	w.props = r.Properties
+	w.props.IndexPartitions = 0
+	w.props.TopLevelIndexSize = 0
+	w.props.IndexSize = 0
+	w.props.IndexType = 0
+	w.props.FilterPolicyName = ""
+	w.props.FilterSize = 0
+	// The Writer doesn't see the copied keys to compute a content hash, so the
+	// input's is kept.
+	w.contentHash = nil
+
+	if err := w.Close(); err != nil {
+		w = nil
+		return 0, err
+	}
+	wrote := w.meta.Size
+	w = nil
+	return wrote, nil
+}
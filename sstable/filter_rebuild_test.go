@@ -0,0 +1,157 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/bloom"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/keyspan"
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRebuildFilter(t *testing.T) {
+	filterPolicy := bloom.FilterPolicy(10)
+	readerOpts := ReaderOptions{
+		Filters: map[string]base.FilterPolicy{filterPolicy.Name(): filterPolicy},
+	}
+	// dump returns the point keys and values, range deletions and range keys of
+	// the sstable.
+	dump := func(r *Reader) (points, spans []string) {
+		iter, err := r.NewIter(NoTransforms, nil /* lower */, nil /* upper */)
+		require.NoError(t, err)
+		for kv := iter.First(); kv != nil; kv = iter.Next() {
+			v, _, err := kv.Value(nil)
+			require.NoError(t, err)
+			points = append(points, fmt.Sprintf("%s:%s", kv.K, v))
+		}
+		require.NoError(t, iter.Close())
+		for _, newIter := range []func(IterTransforms) (keyspan.FragmentIterator, error){
+			r.NewRawRangeDelIter, r.NewRawRangeKeyIter,
+		} {
+			spanIter, err := newIter(NoTransforms)
+			require.NoError(t, err)
+			if spanIter == nil {
+				continue
+			}
+			s, err := spanIter.First()
+			for ; s != nil; s, err = spanIter.Next() {
+				spans = append(spans, s.String())
+			}
+			require.NoError(t, err)
+			spanIter.Close()
+		}
+		return points, spans
+	}
+
+	for format := TableFormatPebblev2; format <= TableFormatMax; format++ {
+		for _, indexBlockSize := range []int{1 << 10, 128} {
+			t.Run(fmt.Sprintf("%s/index-block-size=%d", format, indexBlockSize), func(t *testing.T) {
+				// Write an sstable without a filter.
+				obj := &objstorage.MemObj{}
+				w := NewWriter(obj, WriterOptions{
+					TableFormat:        format,
+					BlockSize:          256,
+					IndexBlockSize:     indexBlockSize,
+					ComputeContentHash: true,
+				})
+				for i := 0; i < 1000; i++ {
+					key := base.MakeInternalKey([]byte(fmt.Sprintf("key%04d", i)), uint64(i+1), base.InternalKeyKindSet)
+					require.NoError(t, w.AddWithForceObsolete(key, []byte(fmt.Sprint(i)), false))
+				}
+				require.NoError(t, w.DeleteRange([]byte("key0100"), []byte("key0200")))
+				require.NoError(t, w.RangeKeySet([]byte("key0300"), []byte("key0400"), []byte("@5"), []byte("v")))
+				require.NoError(t, w.Close())
+
+				r, err := NewMemReader(obj.Data(), readerOpts)
+				require.NoError(t, err)
+				defer r.Close()
+				require.Nil(t, r.tableFilter)
+				wantPoints, wantSpans := dump(r)
+
+				rebuilt := &objstorage.MemObj{}
+				size, err := RebuildFilter(context.Background(), newMemReader(obj.Data()), readerOpts, rebuilt,
+					WriterOptions{FilterPolicy: filterPolicy, TableFormat: TableFormatPebblev2, ComputeContentHash: true})
+				require.NoError(t, err)
+				require.Equal(t, uint64(len(rebuilt.Data())), size)
+
+				// The rebuilt sstable has the same contents, format and properties,
+				// along with the new filter.
+				r2, err := NewMemReader(rebuilt.Data(), readerOpts)
+				require.NoError(t, err)
+				defer r2.Close()
+				require.NotNil(t, r2.tableFilter)
+				require.Equal(t, filterPolicy.Name(), r2.Properties.FilterPolicyName)
+				tf, err := r2.TableFormat()
+				require.NoError(t, err)
+				require.Equal(t, format, tf)
+				require.Equal(t, r.Properties.NumEntries, r2.Properties.NumEntries)
+				require.Equal(t, r.Properties.NumRangeDeletions, r2.Properties.NumRangeDeletions)
+				require.Equal(t, r.Properties.NumRangeKeySets, r2.Properties.NumRangeKeySets)
+				require.NotEmpty(t, r.Properties.ContentHash)
+				require.Equal(t, r.Properties.ContentHash, r2.Properties.ContentHash)
+				points, spans := dump(r2)
+				require.Equal(t, wantPoints, points)
+				require.Equal(t, wantSpans, spans)
+				require.Greater(t, r2.Properties.FilterSize, uint64(0))
+			})
+		}
+	}
+
+	t.Run("compression-dictionary", func(t *testing.T) {
+		// The output carries the compression dictionary of the input, if any,
+		// rather than the one in the writer options.
+		for _, dict := range [][]byte{nil, []byte("key00 key01 key02")} {
+			obj := &objstorage.MemObj{}
+			w := NewWriter(obj, WriterOptions{
+				TableFormat:           TableFormatPebblev5,
+				BlockSize:             256,
+				Compression:           ZstdCompression,
+				CompressionDictionary: dict,
+			})
+			for i := 0; i < 100; i++ {
+				require.NoError(t, w.Set([]byte(fmt.Sprintf("key%04d", i)), []byte(fmt.Sprint(i))))
+			}
+			require.NoError(t, w.Close())
+			r, err := NewMemReader(obj.Data(), readerOpts)
+			require.NoError(t, err)
+			defer r.Close()
+			wantPoints, _ := dump(r)
+
+			rebuilt := &objstorage.MemObj{}
+			_, err = RebuildFilter(context.Background(), newMemReader(obj.Data()), readerOpts, rebuilt,
+				WriterOptions{
+					FilterPolicy:          filterPolicy,
+					Compression:           SnappyCompression,
+					CompressionDictionary: []byte("other"),
+				})
+			require.NoError(t, err)
+			r2, err := NewMemReader(rebuilt.Data(), readerOpts)
+			require.NoError(t, err)
+			defer r2.Close()
+			require.Equal(t, dict, r2.compressionDict)
+			points, _ := dump(r2)
+			require.Equal(t, wantPoints, points)
+		}
+	})
+
+	t.Run("value-blocks", func(t *testing.T) {
+		obj := &objstorage.MemObj{}
+		w := NewWriter(obj, WriterOptions{TableFormat: TableFormatPebblev3})
+		require.NoError(t, w.AddWithForceObsolete(
+			base.MakeInternalKey([]byte("a"), 2, base.InternalKeyKindSet), []byte("new"), false))
+		require.NoError(t, w.AddWithForceObsolete(
+			base.MakeInternalKey([]byte("a"), 1, base.InternalKeyKindSet), []byte("old"), false))
+		require.NoError(t, w.Close())
+		_, err := RebuildFilter(context.Background(), newMemReader(obj.Data()), readerOpts, &objstorage.MemObj{},
+			WriterOptions{FilterPolicy: filterPolicy})
+		require.True(t, errors.Is(err, ErrFilterRebuildUnsupported))
+	})
+}
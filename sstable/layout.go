@@ -32,10 +32,13 @@ type Layout struct {
 	RangeKey   BlockHandle
 	ValueBlock []BlockHandle
 	ValueIndex BlockHandle
-	Properties BlockHandle
-	MetaIndex  BlockHandle
-	Footer     BlockHandle
-	Format     TableFormat
+	// CompressionDict is the block holding the zstd dictionary data blocks
+	// were compressed with, if any.
+	CompressionDict BlockHandle
+	Properties      BlockHandle
+	MetaIndex       BlockHandle
+	Footer          BlockHandle
+	Format          TableFormat
 }
 
 // Describe returns a description of the layout. If the verbose parameter is
@@ -74,6 +77,9 @@ func (l *Layout) Describe(
 	if l.ValueIndex.Length != 0 {
 		blocks = append(blocks, block{l.ValueIndex, "value-index"})
 	}
+	if l.CompressionDict.Length != 0 {
+		blocks = append(blocks, block{l.CompressionDict, "compression-dict"})
+	}
 	if l.Properties.Length != 0 {
 		blocks = append(blocks, block{l.Properties, "properties"})
 	}
@@ -5,6 +5,8 @@
 package sstable
 
 import (
+	"time"
+
 	"github.com/cockroachdb/fifo"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/cache"
@@ -115,6 +117,25 @@ type ReaderOptions struct {
 
 	// Logger is an optional logger and tracer.
 	LoggerAndTracer base.LoggerAndTracer
+
+	// ReadRepair, if set, is consulted when a block read from the sstable fails
+	// checksum verification. It's passed the offset and length of the block,
+	// including the block trailer, and should return a good copy of those
+	// bytes. If it returns an error, or bytes that also fail checksum
+	// verification, the read fails with the original corruption error.
+	ReadRepair func(fileNum base.DiskFileNum, offset int64, length int) ([]byte, error)
+
+	// OnReadRepaired, if set, is called with the good copy of a block after the
+	// block has been repaired by ReadRepair.
+	OnReadRepaired func(fileNum base.DiskFileNum, offset int64, data []byte)
+
+	// BeforeRead, if set, is called before a block that misses the cache is
+	// read from the sstable. If it returns an error, the read fails with it.
+	BeforeRead func(fileNum base.DiskFileNum) error
+
+	// ReadLatency, if set, is called before a block that misses the cache is
+	// read from the sstable, and the read is delayed by the returned duration.
+	ReadLatency func(fileNum base.DiskFileNum) time.Duration
 }
 
 func (o ReaderOptions) ensureDefaults() ReaderOptions {
@@ -164,6 +185,15 @@ type WriterOptions struct {
 	// The default value is 60.
 	SizeClassAwareThreshold int
 
+	// BlockSizeAlignment, if positive, aligns the offset of every block of the
+	// sstable to a multiple of it, padding the preceding block with zeros, so
+	// that no block shares a device page with another when the alignment is the
+	// page size of the device (typically 4096). The padding lies outside of the
+	// blocks, so it's neither covered by their checksums nor visible to readers.
+	//
+	// The default value of 0 writes blocks contiguously.
+	BlockSizeAlignment int
+
 	// Cache is used to cache uncompressed blocks from sstables.
 	//
 	// The default is a nil cache.
@@ -181,6 +211,16 @@ type WriterOptions struct {
 	// The default value (DefaultCompression) uses snappy compression.
 	Compression Compression
 
+	// CompressionDictionary, if non-empty and Compression is ZstdCompression,
+	// is a zstd dictionary used to compress data blocks. Dictionaries help
+	// compress small blocks whose contents share common substrings with each
+	// other but not within a block. The dictionary may be either raw content
+	// or a dictionary trained with the zstd dictionary builder, which is
+	// recognized by the zstd dictionary magic number it begins with. It is
+	// stored in the table, so readers need no configuration to decompress the
+	// blocks. Must be empty if TableFormat < TableFormatPebblev5.
+	CompressionDictionary []byte
+
 	// FilterPolicy defines a filter algorithm (such as a Bloom filter) that can
 	// reduce disk reads for Get calls.
 	//
@@ -233,6 +273,11 @@ type WriterOptions struct {
 	// built and lives for the lifetime of writing that table.
 	BlockPropertyCollectors []func() BlockPropertyCollector
 
+	// UserProperties are additional user properties written to the properties
+	// block of the table. They may not share a name with a block property
+	// collector.
+	UserProperties map[string]string
+
 	// Checksum specifies which checksum to use.
 	Checksum ChecksumType
 
@@ -260,6 +305,10 @@ type WriterOptions struct {
 	// https://github.com/cockroachdb/cockroach/issues/117113).
 	DisableValueBlocks bool
 
+	// ComputeContentHash, if true, stores a hash of the sstable's keys and
+	// values in Properties.ContentHash. See Options.ComputeTableContentHash.
+	ComputeContentHash bool
+
 	// AllocatorSizeClasses provides a sorted list containing the supported size
 	// classes of the underlying memory allocator. This provides hints to the
 	// writer's flushing policy to select block sizes that preemptively reduce
@@ -131,6 +131,10 @@ type Properties struct {
 
 	// The name of the comparer used in this table.
 	ComparerName string `prop:"rocksdb.comparator"`
+	// A hash of the keys, excluding sequence numbers, and values of the table,
+	// in order. Empty unless WriterOptions.ComputeContentHash was set. Tables
+	// with the same hash almost certainly hold the same keys and values.
+	ContentHash string `prop:"pebble.content-hash"`
 	// The total size of all data blocks.
 	DataSize uint64 `prop:"rocksdb.data.size"`
 	// The name of the filter policy used in this table. Empty if no filter
@@ -335,6 +339,9 @@ func (p *Properties) save(tblFormat TableFormat, w *rawBlockWriter) {
 	if p.ComparerName != "" {
 		p.saveString(m, unsafe.Offsetof(p.ComparerName), p.ComparerName)
 	}
+	if p.ContentHash != "" {
+		p.saveString(m, unsafe.Offsetof(p.ContentHash), p.ContentHash)
+	}
 	if p.CompressionName != "" {
 		p.saveString(m, unsafe.Offsetof(p.CompressionName), p.CompressionName)
 	}
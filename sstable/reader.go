@@ -236,6 +236,7 @@ type Reader struct {
 	filterBH          BlockHandle
 	rangeDelBH        BlockHandle
 	rangeKeyBH        BlockHandle
+	compressionDictBH BlockHandle
 	rangeDelTransform blockTransform
 	valueBIH          valueBlocksIndexHandle
 	propertiesBH      BlockHandle
@@ -247,6 +248,9 @@ type Reader struct {
 	FormatKey         base.FormatKey
 	Split             Split
 	tableFilter       *tableFilterReader
+	// compressionDict is the zstd dictionary that data blocks were compressed
+	// with, if any. See WriterOptions.CompressionDictionary.
+	compressionDict []byte
 	// Keep types that are not multiples of 8 bytes at the end and with
 	// decreasing size.
 	Properties    Properties
@@ -559,6 +563,25 @@ func checkChecksum(
 	return nil
 }
 
+// readRepair attempts to replace the contents of b, the block bh that failed
+// checksum verification, with a good copy obtained from ReaderOptions.ReadRepair.
+// It returns true if b was repaired.
+func (r *Reader) readRepair(b []byte, bh BlockHandle) bool {
+	if r.opts.ReadRepair == nil {
+		return false
+	}
+	n := int(bh.Length + blockTrailerLen)
+	repaired, err := r.opts.ReadRepair(r.fileNum, int64(bh.Offset), n)
+	if err != nil || len(repaired) != n || checkChecksum(r.checksumType, repaired, bh, r.fileNum) != nil {
+		return false
+	}
+	copy(b, repaired)
+	if r.opts.OnReadRepaired != nil {
+		r.opts.OnReadRepaired(r.fileNum, int64(bh.Offset), repaired)
+	}
+	return true
+}
+
 type cacheValueOrBuf struct {
 	// buf.Valid() returns true if backed by a BufferPool.
 	buf Buf
@@ -630,6 +653,11 @@ func (r *Reader) readBlock(
 
 	// Cache miss.
 
+	if r.opts.BeforeRead != nil {
+		if err := r.opts.BeforeRead(r.fileNum); err != nil {
+			return bufferHandle{}, err
+		}
+	}
 	if sema := r.opts.LoadBlockSema; sema != nil {
 		if err := sema.Acquire(ctx, 1); err != nil {
 			// An error here can only come from the context.
@@ -650,6 +678,9 @@ func (r *Reader) readBlock(
 	}
 
 	readStartTime := time.Now()
+	if r.opts.ReadLatency != nil {
+		time.Sleep(r.opts.ReadLatency(r.fileNum))
+	}
 	var err error
 	if readHandle != nil {
 		err = readHandle.ReadAt(ctx, compressed.get(), int64(bh.Offset))
@@ -678,8 +709,10 @@ func (r *Reader) readBlock(
 		return bufferHandle{}, err
 	}
 	if err := checkChecksum(r.checksumType, compressed.get(), bh, r.fileNum); err != nil {
-		compressed.release()
-		return bufferHandle{}, err
+		if !r.readRepair(compressed.get(), bh) {
+			compressed.release()
+			return bufferHandle{}, err
+		}
 	}
 
 	typ := blockType(compressed.get()[bh.Length])
@@ -701,7 +734,7 @@ func (r *Reader) readBlock(
 		} else {
 			decompressed = cacheValueOrBuf{v: cache.Alloc(decodedLen)}
 		}
-		if err := decompressInto(typ, compressed.get()[prefixLen:], decompressed.get()); err != nil {
+		if err := decompressInto(typ, compressed.get()[prefixLen:], decompressed.get(), r.compressionDict); err != nil {
 			compressed.release()
 			return bufferHandle{}, err
 		}
@@ -866,6 +899,19 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle, readHandle objstorage.Re
 		r.rangeKeyBH = bh
 	}
 
+	if bh, ok := meta[metaCompressionDictName]; ok {
+		r.compressionDictBH = bh
+		b, err = r.readBlock(
+			context.Background(), bh, nil /* transform */, readHandle, nil, /* stats */
+			nil /* iterStats */, nil /* buffer pool */)
+		if err != nil {
+			return err
+		}
+		// The dictionary outlives the block, which is released to the cache.
+		r.compressionDict = append([]byte(nil), b.Get()...)
+		b.Release()
+	}
+
 	for name, fp := range r.opts.Filters {
 		types := []struct {
 			ftype  FilterType
@@ -903,15 +949,16 @@ func (r *Reader) Layout() (*Layout, error) {
 	}
 
 	l := &Layout{
-		Data:       make([]BlockHandleWithProperties, 0, r.Properties.NumDataBlocks),
-		Filter:     r.filterBH,
-		RangeDel:   r.rangeDelBH,
-		RangeKey:   r.rangeKeyBH,
-		ValueIndex: r.valueBIH.h,
-		Properties: r.propertiesBH,
-		MetaIndex:  r.metaIndexBH,
-		Footer:     r.footerBH,
-		Format:     r.tableFormat,
+		Data:            make([]BlockHandleWithProperties, 0, r.Properties.NumDataBlocks),
+		Filter:          r.filterBH,
+		RangeDel:        r.rangeDelBH,
+		RangeKey:        r.rangeKeyBH,
+		ValueIndex:      r.valueBIH.h,
+		Properties:      r.propertiesBH,
+		MetaIndex:       r.metaIndexBH,
+		Footer:          r.footerBH,
+		Format:          r.tableFormat,
+		CompressionDict: r.compressionDictBH,
 	}
 
 	indexH, err := r.readIndex(context.Background(), nil, nil, nil)
@@ -1021,7 +1068,7 @@ func (r *Reader) ValidateBlockChecksums() error {
 		blocks[i] = l.Data[i].BlockHandle
 	}
 	blocks = append(blocks, l.Index...)
-	blocks = append(blocks, l.TopIndex, l.Filter, l.RangeDel, l.RangeKey, l.Properties, l.MetaIndex)
+	blocks = append(blocks, l.TopIndex, l.Filter, l.RangeDel, l.RangeKey, l.CompressionDict, l.Properties, l.MetaIndex)
 
 	// Sorting by offset ensures we are performing a sequential scan of the
 	// file.
@@ -1056,6 +1103,25 @@ func (r *Reader) CommonProperties() *CommonProperties {
 	return &r.Properties.CommonProperties
 }
 
+// MayContainPrefix returns false if the table definitely contains no point
+// keys with the given prefix, as determined by the table's filter. It reads
+// the filter block, but no data blocks. It returns true if the table has no
+// filter.
+func (r *Reader) MayContainPrefix(ctx context.Context, prefix []byte) (bool, error) {
+	if r.err != nil {
+		return false, r.err
+	}
+	if r.tableFilter == nil {
+		return true, nil
+	}
+	h, err := r.readFilter(ctx, nil /* readHandle */, nil /* stats */, nil /* iterStats */)
+	if err != nil {
+		return false, err
+	}
+	defer h.Release()
+	return r.tableFilter.mayContain(h.Get(), prefix), nil
+}
+
 // EstimateDiskUsage returns the total size of data blocks overlapping the range
 // `[start, end]`. Even if a data block partially overlaps, or we cannot
 // determine overlap due to abbreviated index keys, the full data block size is
@@ -154,6 +154,7 @@ func rewriteBlocks(
 	restartInterval int,
 	checksumType ChecksumType,
 	compression Compression,
+	compressionDict []byte,
 	input []BlockHandleWithProperties,
 	output []blockWithSpan,
 	totalWorkers, worker int,
@@ -163,7 +164,10 @@ func rewriteBlocks(
 	bw := blockWriter{
 		restartInterval: restartInterval,
 	}
-	buf := blockBuf{checksummer: checksummer{checksumType: checksumType}}
+	buf := blockBuf{
+		checksummer:     checksummer{checksumType: checksumType},
+		compressionDict: compressionDict,
+	}
 	if checksumType == ChecksumTypeXXHash {
 		buf.checksummer.xxHasher = xxhash.New()
 	}
@@ -299,6 +303,7 @@ func rewriteDataBlocksToWriter(
 				w.dataBlockBuf.dataBlock.restartInterval,
 				w.blockBuf.checksummer.checksumType,
 				w.compression,
+				w.compressionDict,
 				data,
 				blocks,
 				concurrency,
@@ -388,6 +393,8 @@ func rewriteDataBlocksToWriter(
 	w.props.NumEntries = r.Properties.NumEntries
 	w.props.RawKeySize = r.Properties.RawKeySize
 	w.props.RawValueSize = r.Properties.RawValueSize
+	// The Writer doesn't see the rewritten keys to compute a content hash.
+	w.contentHash = nil
 	w.meta.SetSmallestPointKey(blocks[0].start)
 	w.meta.SetLargestPointKey(blocks[len(blocks)-1].end)
 	return nil
@@ -531,7 +538,7 @@ func readBlockBuf(r *Reader, bh BlockHandle, buf []byte) ([]byte, []byte, error)
 		buf = make([]byte, decompressedLen)
 	}
 	dst := buf[:decompressedLen]
-	err = decompressInto(typ, raw[prefix:], dst)
+	err = decompressInto(typ, raw[prefix:], dst, r.compressionDict)
 	return dst, buf, err
 }
 
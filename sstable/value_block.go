@@ -555,7 +555,7 @@ func (w *valueBlockWriter) compressAndFlush() {
 	b := w.buf
 	if w.compression != NoCompression {
 		blockType, w.compressedBuf.b =
-			compressBlock(w.compression, w.buf.b, w.compressedBuf.b[:cap(w.compressedBuf.b)])
+			compressBlock(w.compression, w.buf.b, w.compressedBuf.b[:cap(w.compressedBuf.b)], nil /* dict */)
 		if len(w.compressedBuf.b) < len(w.buf.b)-len(w.buf.b)/8 {
 			b = w.compressedBuf
 		} else {
@@ -597,8 +597,11 @@ func (w *valueBlockWriter) computeChecksum(block []byte) {
 	binary.LittleEndian.PutUint32(block[n+1:], checksum)
 }
 
+// finish writes the value blocks and their index to writer, starting at
+// fileOffset. If padding is non-empty, each block is aligned to a multiple of
+// its length by writing a prefix of it before the block.
 func (w *valueBlockWriter) finish(
-	writer io.Writer, fileOffset uint64,
+	writer io.Writer, fileOffset uint64, padding []byte,
 ) (valueBlocksIndexHandle, valueBlocksAndIndexStats, error) {
 	if len(w.buf.b) > 0 {
 		w.compressAndFlush()
@@ -607,20 +610,37 @@ func (w *valueBlockWriter) finish(
 	if n == 0 {
 		return valueBlocksIndexHandle{}, valueBlocksAndIndexStats{}, nil
 	}
+	// align writes the padding that aligns fileOffset, if any.
+	align := func() error {
+		if p := alignmentPadding(fileOffset, len(padding)); p > 0 {
+			if _, err := writer.Write(padding[:p]); err != nil {
+				return err
+			}
+			fileOffset += uint64(p)
+		}
+		return nil
+	}
 	largestOffset := uint64(0)
 	largestLength := uint64(0)
 	for i := range w.blocks {
+		if err := align(); err != nil {
+			return valueBlocksIndexHandle{}, valueBlocksAndIndexStats{}, err
+		}
 		_, err := writer.Write(w.blocks[i].block.b)
 		if err != nil {
 			return valueBlocksIndexHandle{}, valueBlocksAndIndexStats{}, err
 		}
-		w.blocks[i].handle.Offset += fileOffset
+		w.blocks[i].handle.Offset = fileOffset
+		fileOffset += uint64(len(w.blocks[i].block.b))
 		largestOffset = w.blocks[i].handle.Offset
 		if largestLength < w.blocks[i].handle.Length {
 			largestLength = w.blocks[i].handle.Length
 		}
 	}
-	vbihOffset := fileOffset + w.totalBlockBytes
+	if err := align(); err != nil {
+		return valueBlocksIndexHandle{}, valueBlocksAndIndexStats{}, err
+	}
+	vbihOffset := fileOffset
 
 	vbih := valueBlocksIndexHandle{
 		h: BlockHandle{
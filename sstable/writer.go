@@ -148,7 +148,14 @@ type Writer struct {
 	writingToLowestLevel bool
 	cache                *cache.Cache
 	restartInterval      int
-	checksumType         ChecksumType
+	// blockPadding is a zeroed buffer whose length is the alignment of blocks,
+	// or nil if blocks aren't aligned. See WriterOptions.BlockSizeAlignment.
+	blockPadding   []byte
+	checksumType   ChecksumType
+	userProperties map[string]string
+	// compressionDict is the zstd dictionary used to compress data blocks, if
+	// any. See WriterOptions.CompressionDictionary.
+	compressionDict []byte
 	// disableKeyOrderChecks disables the checks that keys are added to an
 	// sstable in order. It is intended for internal use only in the construction
 	// of invalid sstables for testing. See tool/make_test_sstables.go.
@@ -181,6 +188,9 @@ type Writer struct {
 	blockPropCollectors []BlockPropertyCollector
 	obsoleteCollector   obsoleteKeyBlockPropertyCollector
 	blockPropsEncoder   blockPropertiesEncoder
+	// contentHash accumulates Properties.ContentHash, if
+	// WriterOptions.ComputeContentHash is set.
+	contentHash *contentHasher
 	// filter accumulates the filter block. If populated, the filter ingests
 	// either the output of w.split (i.e. a prefix extractor) if w.split is not
 	// nil, or the full keys otherwise.
@@ -593,6 +603,9 @@ type blockBuf struct {
 	// lifetime of the blockBuf, avoiding the allocation of a temporary buffer for each block.
 	compressedBuf []byte
 	checksummer   checksummer
+	// compressionDict is the zstd dictionary used to compress blocks written
+	// through the blockBuf, if any. It's only set for data blocks.
+	compressionDict []byte
 }
 
 func (b *blockBuf) clear() {
@@ -601,6 +614,7 @@ func (b *blockBuf) clear() {
 	// to make an allocation.
 	*b = blockBuf{
 		compressedBuf: b.compressedBuf, checksummer: b.checksummer,
+		compressionDict: b.compressionDict,
 	}
 }
 
@@ -651,10 +665,13 @@ var dataBlockBufPool = sync.Pool{
 	},
 }
 
-func newDataBlockBuf(restartInterval int, checksumType ChecksumType) *dataBlockBuf {
+func newDataBlockBuf(
+	restartInterval int, checksumType ChecksumType, compressionDict []byte,
+) *dataBlockBuf {
 	d := dataBlockBufPool.Get().(*dataBlockBuf)
 	d.dataBlock.restartInterval = restartInterval
 	d.checksummer.checksumType = checksumType
+	d.compressionDict = compressionDict
 	return d
 }
 
@@ -1014,6 +1031,9 @@ func (w *Writer) addPoint(key InternalKey, value []byte, forceObsolete bool) err
 	}
 
 	w.maybeAddToFilter(key.UserKey)
+	if w.contentHash != nil {
+		w.contentHash.add(w.contentHash.points, key, value)
+	}
 	w.dataBlockBuf.dataBlock.addWithOptionalValuePrefix(
 		key, isObsolete, valueStoredWithKey, maxSharedKeyLen, addPrefixToValueStoredWithKey, prefix,
 		setHasSameKeyPrefix)
@@ -1145,6 +1165,9 @@ func (w *Writer) addTombstone(key InternalKey, value []byte) error {
 	w.props.NumRangeDeletions++
 	w.props.RawKeySize += uint64(key.Size())
 	w.props.RawValueSize += uint64(len(value))
+	if w.contentHash != nil {
+		w.contentHash.add(w.contentHash.rangeDels, key, value)
+	}
 	w.rangeDelBlock.add(key, value)
 	return nil
 }
@@ -1343,6 +1366,10 @@ func (w *Writer) addRangeKey(key InternalKey, value []byte) error {
 		}
 	}
 
+	if w.contentHash != nil {
+		w.contentHash.add(w.contentHash.rangeKeys, key, value)
+	}
+
 	// Add the key to the block.
 	w.rangeKeyBlock.add(key, value)
 	return nil
@@ -1455,7 +1482,7 @@ func (w *Writer) flush(key InternalKey) error {
 	} else {
 		err = w.coordination.writeQueue.addSync(writeTask)
 	}
-	w.dataBlockBuf = newDataBlockBuf(w.restartInterval, w.checksumType)
+	w.dataBlockBuf = newDataBlockBuf(w.restartInterval, w.checksumType, w.compressionDict)
 
 	return err
 }
@@ -1830,7 +1857,7 @@ func (w *Writer) writeTwoLevelIndex() (BlockHandle, error) {
 func compressAndChecksum(b []byte, compression Compression, blockBuf *blockBuf) []byte {
 	// Compress the buffer, discarding the result if the improvement isn't at
 	// least 12.5%.
-	blockType, compressed := compressBlock(compression, b, blockBuf.compressedBuf)
+	blockType, compressed := compressBlock(compression, b, blockBuf.compressedBuf, blockBuf.compressionDict)
 	if blockType != noCompressionBlockType && cap(compressed) > cap(blockBuf.compressedBuf) {
 		blockBuf.compressedBuf = compressed[:cap(compressed)]
 	}
@@ -1849,6 +1876,9 @@ func compressAndChecksum(b []byte, compression Compression, blockBuf *blockBuf)
 }
 
 func (w *Writer) writeCompressedBlock(block []byte, blockTrailerBuf []byte) (BlockHandle, error) {
+	if err := w.alignBlock(); err != nil {
+		return BlockHandle{}, err
+	}
 	bh := BlockHandle{Offset: w.meta.Size, Length: uint64(len(block))}
 
 	if w.cacheID != 0 && w.fileNum != 0 {
@@ -1873,6 +1903,32 @@ func (w *Writer) writeCompressedBlock(block []byte, blockTrailerBuf []byte) (Blo
 	return bh, nil
 }
 
+// alignBlock pads the sstable with zeros up to the next multiple of the block
+// alignment, if any.
+func (w *Writer) alignBlock() error {
+	n := alignmentPadding(w.meta.Size, len(w.blockPadding))
+	if n == 0 {
+		return nil
+	}
+	if err := w.writable.Write(w.blockPadding[:n]); err != nil {
+		return err
+	}
+	w.meta.Size += uint64(n)
+	return nil
+}
+
+// alignmentPadding returns the number of bytes of padding that align offset to
+// a multiple of alignment. An alignment of zero requires no padding.
+func alignmentPadding(offset uint64, alignment int) int {
+	if alignment <= 0 {
+		return 0
+	}
+	if r := offset % uint64(alignment); r != 0 {
+		return alignment - int(r)
+	}
+	return 0
+}
+
 // Write implements io.Writer. This is analogous to writeCompressedBlock for
 // blocks that already incorporate the trailer, and don't need the callee to
 // return a BlockHandle.
@@ -1933,6 +1989,13 @@ func (w *Writer) assertFormatCompatibility() error {
 			"table format version %s is less than the minimum required version %s for sized deletion tombstones",
 			w.tableFormat, TableFormatPebblev4)
 	}
+
+	// PebbleDBv5: compression dictionaries.
+	if w.compressionDict != nil && w.tableFormat < TableFormatPebblev5 {
+		return errors.Newf(
+			"table format version %s is less than the minimum required version %s for compression dictionaries",
+			w.tableFormat, TableFormatPebblev5)
+	}
 	return nil
 }
 
@@ -2026,6 +2089,9 @@ func (w *Writer) Close() (err error) {
 		}
 	}
 	w.props.DataSize = w.meta.Size
+	if w.contentHash != nil {
+		w.props.ContentHash = w.contentHash.sum()
+	}
 
 	// Write the filter block.
 	var metaindex rawBlockWriter
@@ -2116,8 +2182,20 @@ func (w *Writer) Close() (err error) {
 		}
 	}
 
+	// Write the compression dictionary, which readers need to decompress data
+	// blocks. Like the other meta blocks, it is never compressed itself. The
+	// compression dictionary name sorts before the other block names.
+	if w.compressionDict != nil {
+		bh, err := w.writeBlock(w.compressionDict, NoCompression, &w.blockBuf)
+		if err != nil {
+			return err
+		}
+		n := encodeBlockHandle(w.blockBuf.tmp[:], bh)
+		metaindex.add(InternalKey{UserKey: []byte(metaCompressionDictName)}, w.blockBuf.tmp[:n])
+	}
+
 	if w.valueBlockWriter != nil {
-		vbiHandle, vbStats, err := w.valueBlockWriter.finish(w, w.meta.Size)
+		vbiHandle, vbStats, err := w.valueBlockWriter.finish(w, w.meta.Size, w.blockPadding)
 		if err != nil {
 			return err
 		}
@@ -2162,6 +2240,9 @@ func (w *Writer) Close() (err error) {
 				// that the block property collector was used when writing.
 				userProps[w.blockPropCollectors[i].Name()] = prop
 			}
+			for name, prop := range w.userProperties {
+				userProps[name] = prop
+			}
 			if len(userProps) > 0 {
 				w.props.UserProperties = userProps
 			}
@@ -2303,6 +2384,7 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 		cache:                o.Cache,
 		restartInterval:      o.BlockRestartInterval,
 		checksumType:         o.Checksum,
+		userProperties:       o.UserProperties,
 		indexBlock:           newIndexBlockBuf(o.Parallelism),
 		rangeDelBlock: blockWriter{
 			restartInterval: 1,
@@ -2319,6 +2401,12 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 		},
 		allocatorSizeClasses: o.AllocatorSizeClasses,
 	}
+	if o.BlockSizeAlignment > 0 {
+		w.blockPadding = make([]byte, o.BlockSizeAlignment)
+	}
+	if w.compression == ZstdCompression && len(o.CompressionDictionary) > 0 {
+		w.compressionDict = o.CompressionDictionary
+	}
 	if w.tableFormat >= TableFormatPebblev3 {
 		w.shortAttributeExtractor = o.ShortAttributeExtractor
 		w.requiredInPlaceValueBound = o.RequiredInPlaceValueBound
@@ -2330,7 +2418,7 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 		}
 	}
 
-	w.dataBlockBuf = newDataBlockBuf(w.restartInterval, w.checksumType)
+	w.dataBlockBuf = newDataBlockBuf(w.restartInterval, w.checksumType, w.compressionDict)
 
 	w.blockBuf = blockBuf{
 		checksummer: checksummer{checksumType: o.Checksum},
@@ -2361,6 +2449,9 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 			panic(fmt.Sprintf("unknown filter type: %v", o.FilterType))
 		}
 	}
+	if o.ComputeContentHash {
+		w.contentHash = newContentHasher()
+	}
 
 	w.props.ComparerName = o.Comparer.Name
 	w.props.CompressionName = o.Compression.String()
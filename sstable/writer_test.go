@@ -21,6 +21,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/cache"
 	"github.com/cockroachdb/pebble/internal/humanize"
+	"github.com/cockroachdb/pebble/internal/keyspan"
 	"github.com/cockroachdb/pebble/internal/testkeys"
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
@@ -434,7 +435,7 @@ func TestBlockBufClear(t *testing.T) {
 }
 
 func TestClearDataBlockBuf(t *testing.T) {
-	d := newDataBlockBuf(1, ChecksumTypeCRC32c)
+	d := newDataBlockBuf(1, ChecksumTypeCRC32c, nil /* compressionDict */)
 	d.blockBuf.compressedBuf = make([]byte, 1)
 	d.dataBlock.add(ikey("apple"), nil)
 	d.dataBlock.add(ikey("banana"), nil)
@@ -888,6 +889,14 @@ func TestWriter_TableFormatCompatibility(t *testing.T) {
 				return w.RangeKeyDelete([]byte("a"), []byte("b"))
 			},
 		},
+		{
+			name:      "compression dictionary",
+			minFormat: TableFormatPebblev5,
+			configureFn: func(opts *WriterOptions) {
+				opts.Compression = ZstdCompression
+				opts.CompressionDictionary = []byte("dictionary")
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -1143,3 +1152,198 @@ var test4bSuffixComparer = &base.Comparer{
 	},
 	Name: "comparer-split-4b-suffix",
 }
+
+func TestWriterBlockSizeAlignment(t *testing.T) {
+	const alignment = 4096
+	readerOpts := ReaderOptions{
+		Comparer: testkeys.Comparer,
+		Filters:  map[string]base.FilterPolicy{bloom.FilterPolicy(10).Name(): bloom.FilterPolicy(10)},
+	}
+	// write returns an sstable with point keys, some of whose values are stored
+	// in value blocks, range deletions and range keys.
+	write := func(alignment int, parallelism bool) []byte {
+		obj := &objstorage.MemObj{}
+		w := NewWriter(obj, WriterOptions{
+			BlockSize:          1000,
+			BlockSizeAlignment: alignment,
+			IndexBlockSize:     200,
+			Comparer:           testkeys.Comparer,
+			Compression:        NoCompression,
+			FilterPolicy:       bloom.FilterPolicy(10),
+			Parallelism:        parallelism,
+			TableFormat:        TableFormatPebblev4,
+		})
+		for i := 0; i < 2000; i++ {
+			for ts := 2; ts >= 1; ts-- {
+				key := base.MakeInternalKey(testkeys.KeyAt(testkeys.Alpha(4), int64(i), int64(ts)), 0, InternalKeyKindSet)
+				require.NoError(t, w.Add(key, bytes.Repeat([]byte{byte(i)}, 50)))
+			}
+		}
+		require.NoError(t, w.DeleteRange([]byte("b"), []byte("c")))
+		require.NoError(t, w.RangeKeySet([]byte("d"), []byte("e"), []byte("@1"), []byte("v")))
+		require.NoError(t, w.Close())
+		return obj.Data()
+	}
+	// dump returns the contents of the sstable.
+	dump := func(r *Reader) []string {
+		var res []string
+		iter, err := r.NewIter(NoTransforms, nil /* lower */, nil /* upper */)
+		require.NoError(t, err)
+		for kv := iter.First(); kv != nil; kv = iter.Next() {
+			v, _, err := kv.Value(nil)
+			require.NoError(t, err)
+			res = append(res, fmt.Sprintf("%s:%x", kv.K, v))
+		}
+		require.NoError(t, iter.Close())
+		for _, newIter := range []func(IterTransforms) (keyspan.FragmentIterator, error){
+			r.NewRawRangeDelIter, r.NewRawRangeKeyIter,
+		} {
+			spanIter, err := newIter(NoTransforms)
+			require.NoError(t, err)
+			s, err := spanIter.First()
+			for ; s != nil; s, err = spanIter.Next() {
+				res = append(res, s.String())
+			}
+			require.NoError(t, err)
+			spanIter.Close()
+		}
+		return res
+	}
+
+	r, err := NewMemReader(write(0, false), readerOpts)
+	require.NoError(t, err)
+	defer r.Close()
+	want := dump(r)
+
+	for _, parallelism := range []bool{false, true} {
+		t.Run(fmt.Sprintf("parallelism=%t", parallelism), func(t *testing.T) {
+			r, err := NewMemReader(write(alignment, parallelism), readerOpts)
+			require.NoError(t, err)
+			defer r.Close()
+			require.NoError(t, r.ValidateBlockChecksums())
+			require.Equal(t, want, dump(r))
+
+			l, err := r.Layout()
+			require.NoError(t, err)
+			require.Greater(t, len(l.Data), 1)
+			require.Greater(t, len(l.Index), 1)
+			require.Greater(t, len(l.ValueBlock), 1)
+			handles := []BlockHandle{
+				l.TopIndex, l.Filter, l.RangeDel, l.RangeKey, l.ValueIndex, l.Properties, l.MetaIndex,
+			}
+			for _, bh := range l.Data {
+				handles = append(handles, bh.BlockHandle)
+			}
+			handles = append(handles, l.Index...)
+			handles = append(handles, l.ValueBlock...)
+			for _, bh := range handles {
+				require.Zero(t, bh.Offset%alignment, "block %+v is unaligned", bh)
+			}
+		})
+	}
+}
+
+// BenchmarkWriterBlockSizeAlignment measures the number of device pages shared
+// by consecutive data blocks, each of which is written twice by a device that
+// must read-modify-write partially written pages, with and without aligning
+// blocks to the page size.
+func BenchmarkWriterBlockSizeAlignment(b *testing.B) {
+	const pageSize = 4096
+	keys := make([][]byte, 1e5)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%08d", i))
+	}
+	for _, alignment := range []int{0, pageSize} {
+		b.Run(fmt.Sprintf("alignment=%d", alignment), func(b *testing.B) {
+			opts := WriterOptions{
+				BlockSize:          pageSize,
+				BlockSizeAlignment: alignment,
+				Compression:        SnappyCompression,
+				TableFormat:        TableFormatPebblev2,
+			}
+			var sharedPages, blocks int
+			for i := 0; i < b.N; i++ {
+				obj := &objstorage.MemObj{}
+				w := NewWriter(obj, opts)
+				for j := range keys {
+					if err := w.Set(keys[j], keys[j]); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := w.Close(); err != nil {
+					b.Fatal(err)
+				}
+				b.SetBytes(int64(len(obj.Data())))
+
+				b.StopTimer()
+				r, err := NewMemReader(obj.Data(), ReaderOptions{})
+				if err != nil {
+					b.Fatal(err)
+				}
+				l, err := r.Layout()
+				if err != nil {
+					b.Fatal(err)
+				}
+				for j := 1; j < len(l.Data); j++ {
+					prev := l.Data[j-1].BlockHandle
+					if (prev.Offset+prev.Length+blockTrailerLen-1)/pageSize == l.Data[j].Offset/pageSize {
+						sharedPages++
+					}
+				}
+				blocks += len(l.Data)
+				require.NoError(b, r.Close())
+				b.StartTimer()
+			}
+			b.ReportMetric(float64(sharedPages)/float64(blocks), "shared-pages/block")
+		})
+	}
+}
+
+func TestWriterContentHash(t *testing.T) {
+	// write returns the content hash of an sstable holding the given key=value
+	// pairs, written with the given sequence number, along with a range
+	// deletion and a range key.
+	write := func(pairs string, seqNum uint64, parallelism bool) string {
+		obj := &objstorage.MemObj{}
+		w := NewWriter(obj, WriterOptions{
+			BlockSize:          1,
+			ComputeContentHash: true,
+			Parallelism:        parallelism,
+			TableFormat:        TableFormatPebblev4,
+		})
+		for _, pair := range strings.Fields(pairs) {
+			k, v, _ := strings.Cut(pair, "=")
+			require.NoError(t, w.Add(base.MakeInternalKey([]byte(k), seqNum, InternalKeyKindSet), []byte(v)))
+		}
+		require.NoError(t, w.DeleteRange([]byte("x"), []byte("y")))
+		require.NoError(t, w.RangeKeySet([]byte("y"), []byte("z"), nil, []byte("v")))
+		require.NoError(t, w.Close())
+		r, err := NewMemReader(obj.Data(), ReaderOptions{})
+		require.NoError(t, err)
+		defer r.Close()
+		return r.Properties.ContentHash
+	}
+
+	h := write("a=1 b=2 c=3", 1, false)
+	require.NotEmpty(t, h)
+	// The hash is deterministic, and independent of sequence numbers and of
+	// how the sstable was written.
+	require.Equal(t, h, write("a=1 b=2 c=3", 1, false))
+	require.Equal(t, h, write("a=1 b=2 c=3", 2, false))
+	require.Equal(t, h, write("a=1 b=2 c=3", 1, true))
+	// It depends on every key and value.
+	require.NotEqual(t, h, write("a=1 b=2 d=3", 1, false))
+	require.NotEqual(t, h, write("a=1 b=2 c=4", 1, false))
+	require.NotEqual(t, h, write("a=1 b=2", 1, false))
+	require.NotEqual(t, write("a=12", 1, false), write("a1=2", 1, false))
+
+	// Without ComputeContentHash, no hash is recorded.
+	obj := &objstorage.MemObj{}
+	w := NewWriter(obj, WriterOptions{})
+	require.NoError(t, w.Set([]byte("a"), []byte("1")))
+	require.NoError(t, w.Close())
+	r, err := NewMemReader(obj.Data(), ReaderOptions{})
+	require.NoError(t, err)
+	defer r.Close()
+	require.Empty(t, r.Properties.ContentHash)
+}
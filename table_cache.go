@@ -25,6 +25,7 @@ import (
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider/objiotracing"
 	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
 )
 
 var emptyIter = &errorIter{err: nil}
@@ -148,12 +149,76 @@ func newTableCacheContainer(
 	t.dbOpts.cacheID = cacheID
 	t.dbOpts.objProvider = objProvider
 	t.dbOpts.opts = opts.MakeReaderOptions()
+	if opts.ReadRepairFunc != nil && opts.ReadRepairPatchLocalFiles {
+		// Patches are serialized so that concurrent patches of the same sstable
+		// don't swap in copies missing each other's blocks.
+		var patchMu sync.Mutex
+		t.dbOpts.opts.OnReadRepaired = func(fileNum base.DiskFileNum, offset int64, data []byte) {
+			patchMu.Lock()
+			defer patchMu.Unlock()
+			patchLocalTable(opts, objProvider, fileNum, offset, data)
+		}
+	}
 	t.dbOpts.filterMetrics = &sstable.FilterMetricsTracker{}
 	t.dbOpts.iterCount = new(atomic.Int32)
 	t.dbOpts.sstStatsCollector = sstStatsCollector
 	return t
 }
 
+// patchLocalTable replaces a local sstable with a copy whose bytes at the
+// given offset are overwritten with data, a block repaired by
+// Options.ReadRepairFunc. The sstable is never modified in place, since its
+// inode may be shared through hard links by checkpoints and other DBs, which
+// must not observe the patch. Patching is best-effort; the outcome is logged.
+func patchLocalTable(
+	opts *Options,
+	objProvider objstorage.Provider,
+	fileNum base.DiskFileNum,
+	offset int64,
+	data []byte,
+) {
+	meta, err := objProvider.Lookup(fileTypeTable, fileNum)
+	if err != nil || meta.IsRemote() {
+		return
+	}
+	path := objProvider.Path(meta)
+	fs := opts.FS
+	// The copy is written alongside the sstable so that renaming it over the
+	// sstable is atomic. Temporary files left behind by a crash in the DB's
+	// directory are removed on Open.
+	tmpPath := fs.PathJoin(fs.PathDir(path), base.MakeFilename(fileTypeTemp, fileNum))
+	err = func() error {
+		if err := vfs.Copy(fs, path, tmpPath); err != nil {
+			return err
+		}
+		f, err := fs.OpenReadWrite(tmpPath, vfs.WriteCategoryUnspecified)
+		if err != nil {
+			return err
+		}
+		_, err = f.WriteAt(data, offset)
+		if err == nil {
+			err = f.Sync()
+		}
+		if err = firstError(err, f.Close()); err != nil {
+			return err
+		}
+		if err := fs.Rename(tmpPath, path); err != nil {
+			return err
+		}
+		dir, err := fs.OpenDir(fs.PathDir(path))
+		if err != nil {
+			return err
+		}
+		return firstError(dir.Sync(), dir.Close())
+	}()
+	if err != nil {
+		_ = fs.Remove(tmpPath)
+		opts.Logger.Errorf("failed to patch repaired block at %d/%d in %s: %v", errors.Safe(offset), errors.Safe(len(data)), path, err)
+		return
+	}
+	opts.Logger.Infof("patched repaired block at %d/%d in %s", errors.Safe(offset), errors.Safe(len(data)), path)
+}
+
 // Before calling close, make sure that there will be no further need
 // to access any of the files associated with the store.
 func (c *tableCacheContainer) close() error {
@@ -235,6 +300,28 @@ func (c *tableCacheContainer) estimateSize(
 	return size, nil
 }
 
+// mayContainPrefix returns false if the sstable definitely contains no point
+// keys with the given prefix, consulting only the sstable's filter.
+func (c *tableCacheContainer) mayContainPrefix(
+	meta *fileMetadata, prefix []byte,
+) (bool, error) {
+	if meta.SyntheticPrefix.IsSet() {
+		var ok bool
+		if prefix, ok = bytes.CutPrefix(prefix, meta.SyntheticPrefix); !ok {
+			return false, nil
+		}
+	}
+	s := c.tableCache.getShard(meta.FileBacking.DiskFileNum)
+	v := s.findNode(meta.FileBacking, &c.dbOpts)
+	defer s.unrefValue(v)
+	if v.err != nil {
+		return false, v.err
+	}
+	// The filter of a virtual sstable's backing sstable covers all of the
+	// virtual sstable's keys.
+	return v.reader.MayContainPrefix(context.TODO(), prefix)
+}
+
 // createCommonReader creates a Reader for this file.
 func createCommonReader(v *tableCacheValue, file *fileMetadata) sstable.CommonReader {
 	// TODO(bananabrick): We suffer an allocation if file is a virtual sstable.
@@ -562,6 +649,7 @@ func (c *tableCacheShard) newPointIter(
 	if opts != nil {
 		useFilter = manifest.LevelToInt(opts.level) != 6 || opts.UseL6Filters
 		ctx = objiotracing.WithLevel(ctx, manifest.LevelToInt(opts.level))
+		ctx = objstorage.WithPreferredLocality(ctx, opts.PreferredStorageLocality)
 	}
 	tableFormat, err := v.reader.TableFormat()
 	if err != nil {
@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"strconv"
@@ -1253,3 +1254,143 @@ func (tl *catchFatalLogger) Errorf(format string, args ...interface{}) {}
 func (tl *catchFatalLogger) Fatalf(format string, args ...interface{}) {
 	tl.fatalMsgs = append(tl.fatalMsgs, fmt.Sprintf(format, args...))
 }
+
+func TestTableCacheReadRepair(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	tables, err := d.SSTables()
+	require.NoError(t, err)
+	fileNum := tables[0][0].FileNum
+	require.NoError(t, d.Close())
+
+	// Corrupt the first data block, saving a clean copy of the sstable.
+	path := base.MakeFilepath(mem, "", fileTypeTable, base.PhysicalTableDiskFileNum(fileNum))
+	readFile := func() []byte {
+		f, err := mem.Open(path)
+		require.NoError(t, err)
+		defer f.Close()
+		b, err := io.ReadAll(f)
+		require.NoError(t, err)
+		return b
+	}
+	clean := readFile()
+	f, err := mem.OpenReadWrite(path, vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{clean[0] ^ 0xff}, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	get := func(opts *Options) error {
+		opts.FS = mem
+		d, err := Open("", opts)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, d.Close()) }()
+		v, closer, err := d.Get([]byte("a"))
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+		require.Equal(t, "1", string(v))
+		return nil
+	}
+
+	// Without repair, the read fails.
+	err = get(&Options{})
+	require.True(t, errors.Is(err, base.ErrCorruption), "%v", err)
+
+	// A repair that returns bad data doesn't help.
+	err = get(&Options{
+		ReadRepairFunc: func(FileNum, int64, int) ([]byte, error) {
+			return readFile(), nil
+		},
+	})
+	require.True(t, errors.Is(err, base.ErrCorruption), "%v", err)
+
+	// A repair returning the clean block allows the read to proceed; the local
+	// file is only patched if requested.
+	var repairs int
+	repair := func(n FileNum, offset int64, length int) ([]byte, error) {
+		require.Equal(t, fileNum, n)
+		repairs++
+		return clean[offset : offset+int64(length)], nil
+	}
+	require.NoError(t, get(&Options{ReadRepairFunc: repair}))
+	require.Equal(t, 1, repairs)
+	require.NotEqual(t, clean, readFile())
+
+	// The patch doesn't modify the sstable in place, which would also modify
+	// its hard links.
+	require.NoError(t, mem.Link(path, "link"))
+	require.NoError(t, get(&Options{ReadRepairFunc: repair, ReadRepairPatchLocalFiles: true}))
+	require.Equal(t, 2, repairs)
+	require.Equal(t, clean, readFile())
+	require.NoError(t, get(&Options{}))
+	link, err := mem.Open("link")
+	require.NoError(t, err)
+	defer link.Close()
+	b, err := io.ReadAll(link)
+	require.NoError(t, err)
+	require.NotEqual(t, clean, b)
+}
+
+type testFaultInjector struct {
+	mu      sync.Mutex
+	err     error
+	latency time.Duration
+	reads   map[FileNum]int
+}
+
+func (fi *testFaultInjector) BeforeRead(fileNum FileNum) error {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.reads[fileNum]++
+	return fi.err
+}
+
+func (fi *testFaultInjector) ReadLatency(FileNum) time.Duration {
+	return fi.latency
+}
+
+func TestTableCacheFaultInjector(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	tables, err := d.SSTables()
+	require.NoError(t, err)
+	fileNum := tables[0][0].FileNum
+	require.NoError(t, d.Close())
+
+	open := func(fi *testFaultInjector) *DB {
+		fi.reads = map[FileNum]int{}
+		d, err := Open("", &Options{FS: mem, FaultInjector: fi})
+		require.NoError(t, err)
+		return d
+	}
+
+	// Injected errors fail reads, including those of CheckLevels.
+	injectedErr := errors.New("injected")
+	fi := &testFaultInjector{err: injectedErr}
+	d = open(fi)
+	_, _, err = d.Get([]byte("a"))
+	require.ErrorIs(t, err, injectedErr)
+	require.ErrorIs(t, d.CheckLevels(nil), injectedErr)
+	require.Len(t, fi.reads, 1)
+	require.NotZero(t, fi.reads[fileNum])
+	require.NoError(t, d.Close())
+
+	// Injected latency delays reads, which otherwise succeed.
+	fi = &testFaultInjector{latency: 10 * time.Millisecond}
+	d = open(fi)
+	start := time.Now()
+	v, closer, err := d.Get([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, "1", string(v))
+	require.NoError(t, closer.Close())
+	require.GreaterOrEqual(t, time.Since(start), fi.latency*time.Duration(fi.reads[fileNum]))
+	require.NoError(t, d.Close())
+}
@@ -0,0 +1,112 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"encoding/binary"
+	"slices"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// MaxTableMetadataSize is the maximum size of the encoded table metadata of an
+// sstable. The metadata is encoded as the length-prefixed keys and values of
+// the map, in key order.
+const MaxTableMetadataSize = 1 << 10
+
+// tableMetadataPropertyName is the name of the sstable user property holding
+// the encoded table metadata.
+const tableMetadataPropertyName = "pebble.table-metadata"
+
+// encodeTableMetadata encodes m, returning nil if m is empty.
+func encodeTableMetadata(m map[string]string) []byte {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var buf []byte
+	for _, k := range keys {
+		buf = binary.AppendUvarint(buf, uint64(len(k)))
+		buf = append(buf, k...)
+		buf = binary.AppendUvarint(buf, uint64(len(m[k])))
+		buf = append(buf, m[k]...)
+	}
+	return buf
+}
+
+// decodeTableMetadata decodes the table metadata in the given user properties
+// of an sstable, returning nil if the sstable has none.
+func decodeTableMetadata(userProps map[string]string) (map[string]string, error) {
+	data, ok := userProps[tableMetadataPropertyName]
+	if !ok {
+		return nil, nil
+	}
+	m := make(map[string]string)
+	for len(data) > 0 {
+		var kv [2]string
+		for i := range kv {
+			n, w := binary.Uvarint([]byte(data))
+			if w <= 0 || uint64(len(data)-w) < n {
+				return nil, base.CorruptionErrorf("pebble: invalid table metadata")
+			}
+			kv[i] = data[w : w+int(n)]
+			data = data[w+int(n):]
+		}
+		m[kv[0]] = kv[1]
+	}
+	return m, nil
+}
+
+// compactionOutputMetadata returns the encoded table metadata to write to the
+// sstables output by c: the metadata requested by the manual compaction, a
+// copied table's own metadata, or the result of Options.MergeTableMetadata.
+func (d *DB) compactionOutputMetadata(c *compaction) ([]byte, error) {
+	if c.outputMetadata != nil {
+		return encodeTableMetadata(c.outputMetadata), nil
+	}
+	if c.kind != compactionKindCopy && d.opts.MergeTableMetadata == nil {
+		return nil, nil
+	}
+	var inputs []map[string]string
+	for _, cl := range c.inputs {
+		iter := cl.files.Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			props, err := d.tableCache.getTableProperties(f)
+			if err != nil {
+				return nil, err
+			}
+			m, err := decodeTableMetadata(props.UserProperties)
+			if err != nil {
+				return nil, errors.Wrapf(err, "table %s", f.FileNum)
+			}
+			inputs = append(inputs, m)
+		}
+	}
+	if c.kind == compactionKindCopy {
+		return encodeTableMetadata(inputs[0]), nil
+	}
+	encoded := encodeTableMetadata(d.opts.MergeTableMetadata(inputs))
+	if len(encoded) > MaxTableMetadataSize {
+		d.opts.Logger.Errorf("merged table metadata is %d bytes, exceeding the maximum of %d; omitting it",
+			len(encoded), MaxTableMetadataSize)
+		return nil, nil
+	}
+	return encoded, nil
+}
+
+// withTableMetadata returns the writer options with the given encoded table
+// metadata added to the user properties.
+func withTableMetadata(o sstable.WriterOptions, metadata []byte) sstable.WriterOptions {
+	if metadata != nil {
+		o.UserProperties = map[string]string{tableMetadataPropertyName: string(metadata)}
+	}
+	return o
+}
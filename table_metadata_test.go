@@ -0,0 +1,99 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableMetadataEncoding(t *testing.T) {
+	for _, m := range []map[string]string{
+		{"tenant": "foo"},
+		{"tenant": "foo", "cold": "", "": "empty-key"},
+	} {
+		encoded := encodeTableMetadata(m)
+		decoded, err := decodeTableMetadata(map[string]string{tableMetadataPropertyName: string(encoded)})
+		require.NoError(t, err)
+		require.Equal(t, m, decoded)
+	}
+	require.Nil(t, encodeTableMetadata(nil))
+
+	m, err := decodeTableMetadata(map[string]string{"other": "prop"})
+	require.NoError(t, err)
+	require.Nil(t, m)
+
+	encoded := encodeTableMetadata(map[string]string{"tenant": "foo"})
+	_, err = decodeTableMetadata(map[string]string{tableMetadataPropertyName: string(encoded[:len(encoded)-1])})
+	require.Error(t, err)
+}
+
+func TestCompactWithOutputMetadata(t *testing.T) {
+	var merged [][]map[string]string
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		MergeTableMetadata: func(inputs []map[string]string) map[string]string {
+			merged = append(merged, inputs)
+			// Keep the union of the inputs' metadata.
+			out := make(map[string]string)
+			for _, m := range inputs {
+				for k, v := range m {
+					out[k] = v
+				}
+			}
+			return out
+		},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	metadata := func() []map[string]string {
+		tables, err := d.SSTables(WithProperties())
+		require.NoError(t, err)
+		var res []map[string]string
+		for _, level := range tables {
+			for _, info := range level {
+				res = append(res, info.Metadata)
+			}
+		}
+		return res
+	}
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%d", i)), []byte("v"), nil))
+	}
+	require.NoError(t, d.Flush())
+	require.Equal(t, []map[string]string{nil}, metadata())
+
+	// The tables are rewritten with the requested metadata, even once they're
+	// in the bottommost level.
+	tags := map[string]string{"tenant": "foo", "cold": ""}
+	require.NoError(t, d.CompactWithOptions([]byte("a"), []byte("z"), CompactOptions{OutputMetadata: tags}))
+	require.Equal(t, []map[string]string{tags}, metadata())
+	require.Empty(t, merged)
+	tags2 := map[string]string{"tenant": "bar"}
+	require.NoError(t, d.CompactWithOptions([]byte("a"), []byte("z"), CompactOptions{OutputMetadata: tags2}))
+	require.Equal(t, []map[string]string{tags2}, metadata())
+
+	// Other compactions derive the metadata of their outputs from their inputs.
+	require.NoError(t, d.Set([]byte("k5"), []byte("v2"), nil))
+	require.NoError(t, d.Flush())
+	require.Equal(t, []map[string]string{nil, tags2}, metadata())
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+	require.Equal(t, []map[string]string{tags2}, metadata())
+	require.Equal(t, [][]map[string]string{{nil, tags2}}, merged)
+
+	// The metadata is size-bounded.
+	err = d.CompactWithOptions([]byte("a"), []byte("z"), CompactOptions{
+		OutputMetadata: map[string]string{"big": strings.Repeat("x", MaxTableMetadataSize)},
+	})
+	require.Error(t, err)
+	require.Equal(t, []map[string]string{tags2}, metadata())
+}
@@ -1083,6 +1083,37 @@ func countTombstones(v *version) (count uint64) {
 	return count
 }
 
+// snapshotPinnedBytes returns an estimate of the bytes of data in the version
+// that are kept only because they're visible to the snapshot at seqNum. See
+// Metrics.SnapshotPinnedBytes.
+//
+// The deletion estimates of a table are attributed to its tombstones
+// uniformly over its seqnum range, and only the portion attributed to seqnums
+// at or above seqNum is counted. The estimate depends on seqNum, so unlike
+// the other per-version metrics it can't be cached as a B-Tree annotation and
+// requires iterating over all the tables.
+func snapshotPinnedBytes(v *version, seqNum uint64) (size uint64) {
+	for l := 0; l < numLevels; l++ {
+		iter := v.Levels[l].Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			if !f.StatsValid() || f.LargestSeqNum < seqNum {
+				continue
+			}
+			deleted := f.Stats.PointDeletionsBytesEstimate + f.Stats.RangeDeletionsBytesEstimate
+			if deleted == 0 {
+				continue
+			}
+			if f.SmallestSeqNum >= seqNum {
+				size += deleted
+				continue
+			}
+			span := f.LargestSeqNum - f.SmallestSeqNum + 1
+			size += uint64(float64(deleted) * float64(f.LargestSeqNum-seqNum+1) / float64(span))
+		}
+	}
+	return size
+}
+
 // valueBlocksSizeAnnotator implements manifest.Annotator, annotating B-Tree
 // nodes with the sum of the files' Properties.ValueBlocksSize. Its annotation
 // type is a *uint64. The value block size may change once a table's stats are
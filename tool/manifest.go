@@ -206,6 +206,11 @@ func (m *manifestT) runDump(cmd *cobra.Command, args []string) {
 					empty = false
 					fmt.Fprintf(stdout, "  last-seq-num:  %d\n", ve.LastSeqNum)
 				}
+				if ve.MaxKeySize != 0 || ve.MaxValueSize != 0 {
+					empty = false
+					fmt.Fprintf(stdout, "  max-key-size:  %d\n", ve.MaxKeySize)
+					fmt.Fprintf(stdout, "  max-val-size:  %d\n", ve.MaxValueSize)
+				}
 				entries := make([]manifest.DeletedFileEntry, 0, len(ve.DeletedFiles))
 				for df := range ve.DeletedFiles {
 					empty = false
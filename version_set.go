@@ -51,6 +51,13 @@ type versionSet struct {
 	// visibleSeqNum is <= logSeqNum.
 	visibleSeqNum atomic.Uint64
 
+	// The high-water marks of the sizes of the keys and values committed to the
+	// DB, which are updated by the commit path and, at FormatMaxKeyValueSizes
+	// and above, persisted in every version edit logged by logAndApply. See
+	// Metrics.Keys.MaxKeySize.
+	maxKeySize   atomic.Uint64
+	maxValueSize atomic.Uint64
+
 	// Number of bytes present in sstables being written by in-progress
 	// compactions. This value will be zero if there are no in-progress
 	// compactions. Updated and read atomically.
@@ -269,6 +276,7 @@ func (vs *versionSet) load(
 		if ve.NextFileNum != 0 {
 			vs.nextFileNum = ve.NextFileNum
 		}
+		vs.raiseMaxKeySizes(ve.MaxKeySize, ve.MaxValueSize)
 		if ve.LastSeqNum != 0 {
 			// logSeqNum is the _next_ sequence number that will be assigned,
 			// while LastSeqNum is the last assigned sequence number. Note that
@@ -406,7 +414,8 @@ func (vs *versionSet) logUnlock() {
 // to the current version, and installs the new version.
 //
 // logAndApply fills in the following fields of the VersionEdit: NextFileNum,
-// LastSeqNum, RemovedBackingTables. The removed backing tables are those
+// LastSeqNum, MaxKeySize and MaxValueSize (at FormatMaxKeyValueSizes and
+// above), RemovedBackingTables. The removed backing tables are those
 // backings that are no longer used (in the new version) after applying the edit
 // (as per vs.virtualBackings). Other than these fields, the VersionEdit must be
 // complete.
@@ -469,6 +478,10 @@ func (vs *versionSet) logAndApply(
 		// or manifest records, so this case should never happen.
 		vs.opts.Logger.Fatalf("logSeqNum must be a positive integer: %d", logSeqNum)
 	}
+	if vs.getFormatMajorVersion() >= FormatMaxKeyValueSizes {
+		ve.MaxKeySize = vs.maxKeySize.Load()
+		ve.MaxValueSize = vs.maxValueSize.Load()
+	}
 
 	currentVersion := vs.currentVersion()
 	var newVersion *version
@@ -815,6 +828,17 @@ func sizeIfLocal(
 	return false, 0
 }
 
+// incrementCompactionInputFiles counts the input files of a compaction, other
+// than a flush, in the metrics.
+func (vs *versionSet) incrementCompactionInputFiles(inputs []compactionLevel) {
+	var n int
+	for i := range inputs {
+		n += inputs[i].files.Len()
+	}
+	vs.metrics.Compact.InputFiles += uint64(n)
+	vs.metrics.Compact.MaxInputFiles = max(vs.metrics.Compact.MaxInputFiles, n)
+}
+
 func (vs *versionSet) incrementCompactions(
 	kind compactionKind, extraLevels []*compactionLevel, pickerMetrics compactionPickerMetrics,
 ) {
@@ -842,7 +866,7 @@ func (vs *versionSet) incrementCompactions(
 		vs.metrics.Compact.Count++
 		vs.metrics.Compact.ReadCount++
 
-	case compactionKindRewrite:
+	case compactionKindRewrite, compactionKindRebuildFilter, compactionKindColdData:
 		vs.metrics.Compact.Count++
 		vs.metrics.Compact.RewriteCount++
 
@@ -942,6 +966,22 @@ func (vs *versionSet) createManifest(
 	return nil
 }
 
+// raiseMaxKeySizes raises the high-water marks of the sizes of the keys and
+// values committed to the DB to at least the given sizes.
+func (vs *versionSet) raiseMaxKeySizes(keySize, valueSize uint64) {
+	raiseAtomicMax(&vs.maxKeySize, keySize)
+	raiseAtomicMax(&vs.maxValueSize, valueSize)
+}
+
+// raiseAtomicMax sets x to v if v is greater.
+func raiseAtomicMax(x *atomic.Uint64, v uint64) {
+	for cur := x.Load(); v > cur; cur = x.Load() {
+		if x.CompareAndSwap(cur, v) {
+			return
+		}
+	}
+}
+
 func (vs *versionSet) markFileNumUsed(fileNum base.DiskFileNum) {
 	if vs.nextFileNum <= uint64(fileNum) {
 		vs.nextFileNum = uint64(fileNum + 1)
@@ -547,6 +547,16 @@ type slot struct {
 // diskHealthCheckingFS implements FS.
 var _ FS = (*diskHealthCheckingFS)(nil)
 
+// UnwrapDiskHealthChecks returns the FS wrapped by fs if fs was returned by
+// WithDiskHealthChecks, and fs itself otherwise. Root doesn't unwrap the
+// disk-health-checking FS, since tests rely on it being opaque.
+func UnwrapDiskHealthChecks(fs FS) FS {
+	if d, ok := fs.(*diskHealthCheckingFS); ok {
+		return d.fs
+	}
+	return fs
+}
+
 // WithDiskHealthChecks wraps an FS and ensures that all write-oriented
 // operations on the FS are wrapped with disk health detection checks and
 // aggregated. Disk operations that are observed to take longer than
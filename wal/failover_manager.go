@@ -623,6 +623,7 @@ func (wm *failoverManager) Create(wn NumWAL, jobID int) (Writer, error) {
 		bytesPerSync:                wm.opts.BytesPerSync,
 		preallocateSize:             wm.opts.PreallocateSize,
 		minSyncInterval:             wm.opts.MinSyncInterval,
+		syncCoalesceDuration:        wm.opts.SyncCoalesceDuration,
 		fsyncLatency:                wm.opts.FsyncLatency,
 		queueSemChan:                wm.opts.QueueSemChan,
 		stopper:                     wm.stopper,
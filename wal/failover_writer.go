@@ -457,6 +457,8 @@ type failoverWriterOpts struct {
 	fsyncLatency    prometheus.Histogram
 	queueSemChan    chan struct{}
 	stopper         *stopper
+	// syncCoalesceDuration is documented in Options.SyncCoalesceDuration.
+	syncCoalesceDuration time.Duration
 
 	failoverWriteAndSyncLatency prometheus.Histogram
 	writerClosed                func(logicalLogWithSizesEtc)
@@ -629,6 +631,7 @@ func (ww *failoverWriter) switchToNewDir(dir dirAndFileHandle) error {
 		w := record.NewLogWriter(recorderAndWriter, base.DiskFileNum(ww.opts.wn),
 			record.LogWriterConfig{
 				WALMinSyncInterval:        ww.opts.minSyncInterval,
+				WALSyncCoalesceDuration:   ww.opts.syncCoalesceDuration,
 				WALFsyncLatency:           ww.opts.fsyncLatency,
 				QueueSemChan:              ww.opts.queueSemChan,
 				ExternalSyncQueueCallback: ww.doneSyncCallback,
@@ -49,6 +49,12 @@ func (li LogNameIndex) String() string {
 	return fmt.Sprintf("%03d", li)
 }
 
+// MakeLogFilepath returns the path of the log file that a standalone WAL
+// numbered wn has in dir, for writing a WAL outside of a Manager.
+func MakeLogFilepath(dir Dir, wn NumWAL) string {
+	return dir.FS.PathJoin(dir.Dirname, makeLogFilename(wn, 0))
+}
+
 // makeLogFilename makes a log filename.
 func makeLogFilename(wn NumWAL, index LogNameIndex) string {
 	if index == 0 {
@@ -121,6 +127,8 @@ type Options struct {
 
 	// MinSyncInterval is documented in Options.WALMinSyncInterval.
 	MinSyncInterval func() time.Duration
+	// SyncCoalesceDuration is documented in Options.WALSyncCoalesceDuration.
+	SyncCoalesceDuration time.Duration
 	// FsyncLatency records fsync latency. This doesn't differentiate between
 	// fsyncs on the primary and secondary dir.
 	//